@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/pdf"
+)
+
+func main() {
+	f, err := os.Create("out.pdf")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	p := pdf.New(f, 120, 60)
+	draw(p)
+	if err := p.Close(); err != nil {
+		panic(err)
+	}
+}
+
+func draw(p *pdf.PDF) {
+	curve, err := canvas.ParseSVG("M0 0C30 60 70 -20 100 40")
+	if err != nil {
+		panic(err)
+	}
+
+	style := canvas.DefaultStyle
+	style.FillColor = canvas.Transparent
+	style.StrokeWidth = 6.0
+	style.StrokeCapper = canvas.RoundCap
+	style.StrokeJoiner = canvas.RoundJoin
+
+	gradient := pdf.LinearGradient{
+		Start: canvas.Point{X: 0.0, Y: 0.0},
+		End:   canvas.Point{X: 100.0, Y: 0.0},
+		Stops: []pdf.GradientStop{
+			{Offset: 0.0, Color: canvas.Orangered},
+			{Offset: 0.5, Color: canvas.Gold},
+			{Offset: 1.0, Color: canvas.Steelblue},
+		},
+	}
+	p.RenderPathGradientStroke(curve, style, gradient, canvas.Identity.Translate(10.0, 10.0))
+}
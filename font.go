@@ -25,12 +25,14 @@ func StringPath(sfnt *canvasFont.SFNT, text string, size float64) (*Path, error)
 	var x, y int32
 	glyphs := fontShaping.Shape(text, size, shaping.LeftToRight, shaping.Latin)
 	for _, glyph := range glyphs {
-		path, err := GlyphPath(sfnt, glyph.ID, size, float64(x+glyph.XOffset)*f, float64(y+glyph.YOffset)*f)
-		if err != nil {
-			return p, err
-		}
-		if path != nil {
-			p = p.Append(path)
+		if !sfnt.IsEmptyGlyph(glyph.ID) {
+			path, err := GlyphPath(sfnt, glyph.ID, size, float64(x+glyph.XOffset)*f, float64(y+glyph.YOffset)*f)
+			if err != nil {
+				return p, err
+			}
+			if path != nil {
+				p = p.Append(path)
+			}
 		}
 		x += glyph.XAdvance
 		y += glyph.YAdvance
@@ -38,71 +40,83 @@ func StringPath(sfnt *canvasFont.SFNT, text string, size float64) (*Path, error)
 	return p, nil
 }
 
+// GlyphPath returns the outline of the glyph as a path for the given font size, with its origin at (x,y).
 func GlyphPath(sfnt *canvasFont.SFNT, glyphID uint16, size, x, y float64) (*Path, error) {
-	if sfnt.IsTrueType {
-		contour, err := sfnt.GlyphContour(glyphID)
-		if err != nil || contour == nil {
-			return nil, err
+	p, err := GlyphOutline(sfnt, glyphID)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	f := size / float64(sfnt.Head.UnitsPerEm)
+	return p.Transform(Identity.Translate(x, y).Scale(f, f)), nil
+}
+
+// GlyphOutline returns the outline of the glyph as a path in font units, where the quadratic Béziers of TrueType contours are reconstructed from their on-curve and off-curve points including the implied on-curve points between consecutive off-curve points. It returns nil for empty glyphs.
+func GlyphOutline(sfnt *canvasFont.SFNT, glyphID uint16) (*Path, error) {
+	if !sfnt.IsTrueType {
+		return nil, fmt.Errorf("CFF not supported")
+	}
+	contour, err := sfnt.GlyphContour(glyphID)
+	if err != nil || contour == nil {
+		return nil, err
+	}
+
+	p := &Path{}
+	start := 0
+	for _, endPoint := range contour.EndPoints {
+		end := int(endPoint) + 1
+		if end <= start || len(contour.OnCurve) < end {
+			break
+		}
+		n := end - start
+		point := func(i int) Point {
+			i = start + i%n
+			return Point{float64(contour.XCoordinates[i]), float64(contour.YCoordinates[i])}
 		}
 
-		f := size / float64(sfnt.Head.UnitsPerEm)
-		p := &Path{}
-		var i uint16
-		for _, endPoint := range contour.EndPoints {
-			j := i
-			first := true
-			firstOff := false
-			prevOff := false
-			for ; i <= endPoint; i++ {
-				if first {
-					if contour.OnCurve[i] {
-						p.MoveTo(x+float64(contour.XCoordinates[i])*f, y+float64(contour.YCoordinates[i])*f)
-						first = false
-					} else if !prevOff {
-						// first point is off
-						firstOff = true
-						prevOff = true
-					} else {
-						// first and second point are off
-						xMid := float64(contour.XCoordinates[i-1]+contour.XCoordinates[i]) / 2.0
-						yMid := float64(contour.YCoordinates[i-1]+contour.YCoordinates[i]) / 2.0
-						p.MoveTo(x+xMid*f, y+yMid*f)
-					}
-				} else if !prevOff {
-					if contour.OnCurve[i] {
-						p.LineTo(x+float64(contour.XCoordinates[i])*f, y+float64(contour.YCoordinates[i])*f)
-					} else {
-						prevOff = true
-					}
-				} else {
-					if contour.OnCurve[i] {
-						p.QuadTo(x+float64(contour.XCoordinates[i-1])*f, y+float64(contour.YCoordinates[i-1])*f, x+float64(contour.XCoordinates[i])*f, y+float64(contour.YCoordinates[i])*f)
-						prevOff = false
-					} else {
-						xMid := float64(contour.XCoordinates[i-1]+contour.XCoordinates[i]) / 2.0
-						yMid := float64(contour.YCoordinates[i-1]+contour.YCoordinates[i]) / 2.0
-						p.QuadTo(x+float64(contour.XCoordinates[i-1])*f, y+float64(contour.YCoordinates[i-1])*f, x+xMid*f, y+yMid*f)
-					}
-				}
+		// start at the first on-curve point, or between the last and first point if all are off-curve
+		first := -1
+		for i := 0; i < n; i++ {
+			if contour.OnCurve[start+i] {
+				first = i
+				break
 			}
-			start := p.StartPos()
-			if firstOff {
-				if prevOff {
-					xMid := float64(contour.XCoordinates[i-1]+contour.XCoordinates[j]) / 2.0
-					yMid := float64(contour.YCoordinates[i-1]+contour.YCoordinates[j]) / 2.0
-					p.QuadTo(x+xMid*f, y+yMid*f, start.X, start.Y)
+		}
+		var startPos Point
+		count := n - 1 // number of points after the start
+		if first == -1 {
+			startPos = point(n-1).Interpolate(point(0), 0.5)
+			count = n
+		} else {
+			startPos = point(first)
+		}
+		p.MoveTo(startPos.X, startPos.Y)
+
+		var control *Point
+		for k := 1; k <= count; k++ {
+			i := first + k
+			pos := point(i)
+			if contour.OnCurve[start+i%n] {
+				if control != nil {
+					p.QuadTo(control.X, control.Y, pos.X, pos.Y)
 				} else {
-					p.QuadTo(x+float64(contour.XCoordinates[i-1])*f, y+float64(contour.YCoordinates[i-1])*f, start.X, start.Y)
+					p.LineTo(pos.X, pos.Y)
 				}
-			} else if prevOff {
-				p.QuadTo(x+float64(contour.XCoordinates[i-1])*f, y+float64(contour.YCoordinates[i-1])*f, start.X, start.Y)
+				control = nil
+			} else {
+				if control != nil {
+					mid := control.Interpolate(pos, 0.5)
+					p.QuadTo(control.X, control.Y, mid.X, mid.Y)
+				}
+				control = &pos
 			}
-			p.Close()
 		}
-		return p, nil
-	} else {
-		return nil, fmt.Errorf("CFF not supported")
+		if control != nil {
+			p.QuadTo(control.X, control.Y, startPos.X, startPos.Y)
+		}
+		p.Close()
+		start = end
 	}
+	return p, nil
 }
 
 // TypographicOptions are the options that can be enabled to make typographic or ligature substitutions automatically.
@@ -125,6 +139,11 @@ type Font struct {
 	raw       []byte
 	sfnt      *sfnt.Font
 
+	// decoration metrics in font units, zero if the font tables could not be parsed
+	unitsPerEm                            uint16
+	underlinePosition, underlineThickness int16
+	strikeoutPosition, strikeoutThickness int16
+
 	// TODO: use sub/superscript Unicode transformations in ToPath etc. if they exist
 	typography  bool
 	ligatures   []textSubstitution
@@ -149,6 +168,13 @@ func parseFont(name string, b []byte) (*Font, error) {
 		raw:       b,
 		sfnt:      (*sfnt.Font)(sfntFont),
 	}
+	if b, err := canvasFont.ToSFNT(b); err == nil {
+		if metrics, err := canvasFont.ParseSFNTMetrics(b); err == nil {
+			f.unitsPerEm = metrics.Head.UnitsPerEm
+			f.underlinePosition, f.underlineThickness = metrics.UnderlineMetrics()
+			f.strikeoutPosition, f.strikeoutThickness = metrics.StrikeoutMetrics()
+		}
+	}
 	f.superscript = f.supportedSubstitutions(superscriptSubstitutes)
 	f.subscript = f.supportedSubstitutions(subscriptSubstitutes)
 	f.Use(0)
@@ -170,6 +196,24 @@ func (f *Font) UnitsPerEm() float64 {
 	return float64(f.sfnt.UnitsPerEm())
 }
 
+// UnderlineMetrics returns the position and thickness of the underline for the given font size, where the position is the distance from the baseline to the top of the underline and is negative below the baseline. It returns false if the font does not define decoration metrics.
+func (f *Font) UnderlineMetrics(ppem float64) (float64, float64, bool) {
+	if f.unitsPerEm == 0 {
+		return 0.0, 0.0, false
+	}
+	scale := ppem / float64(f.unitsPerEm)
+	return float64(f.underlinePosition) * scale, float64(f.underlineThickness) * scale, true
+}
+
+// StrikeoutMetrics returns the position and thickness of the strikeout for the given font size, where the position is the distance from the baseline to the top of the strikeout. It returns false if the font does not define decoration metrics.
+func (f *Font) StrikeoutMetrics(ppem float64) (float64, float64, bool) {
+	if f.unitsPerEm == 0 {
+		return 0.0, 0.0, false
+	}
+	scale := ppem / float64(f.unitsPerEm)
+	return float64(f.strikeoutPosition) * scale, float64(f.strikeoutThickness) * scale, true
+}
+
 // Kerning returns the horizontal adjustment for the rune pair. A positive kern means to move the glyphs further apart.
 // Returns 0 if there is an error.
 func (f *Font) Kerning(left, right rune, ppem float64) (float64, error) {
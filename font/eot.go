@@ -61,8 +61,8 @@ func ParseEOT(b []byte) ([]byte, error) {
 	}
 
 	fontData := r.ReadBytes(fontDataSize)
-	if r.EOF() {
-		return nil, ErrInvalidFontData
+	if err := r.Err(); err != nil {
+		return nil, err
 	}
 
 	isCompressed := (flags & 0x00000004) != 0
@@ -82,7 +82,7 @@ func ParseEOT(b []byte) ([]byte, error) {
 	_ = checkSumAdjustment
 	// TODO: (EOT) verify or recalculate master checksum
 	//fmt.Println(binary.BigEndian.Uint32(w.Bytes()[iCheckSumAdjustment:]))
-	//checksum := 0xB1B0AFBA - calcChecksum(w.Bytes())
+	//checksum := 0xB1B0AFBA - CalcChecksum(w.Bytes())
 	//if checkSumAdjustment != checksum {
 	//return nil, 0, fmt.Errorf("bad checksum")
 	//}
@@ -3,10 +3,17 @@ package font
 import (
 	"encoding/binary"
 	"fmt"
+	"image/color"
+	"io"
+	"io/ioutil"
 	"math"
+	"math/bits"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf16"
 )
 
 const MaxCmapSegments = 20000
@@ -15,6 +22,9 @@ type SFNT struct {
 	Data              []byte
 	IsCFF, IsTrueType bool // only one can be true
 	Tables            map[string][]byte
+	Repaired          bool // malformed tables were repaired when parsing leniently
+
+	options ParseOptions
 
 	// required
 	Cmap *cmapTable
@@ -35,19 +45,73 @@ type SFNT struct {
 
 	// optional
 	Kern *kernTable
-	//Gpos *gposTable
+	Colr *colrTable
+	Cpal *cpalTable
+	Sbix *sbixTable
+	Cblc *cblcTable
+	Gdef *gdefTable
+	Gpos *gposTable
+	Morx *morxTable
+	Feat *featTable
+	Stat *statTable
+	Mvar *mvarTable
 	//Gasp *gaspTable
 
 }
 
+// Table returns a copy of the raw bytes of the table with the given tag.
+func (sfnt *SFNT) Table(tag string) ([]byte, bool) {
+	b, ok := sfnt.Tables[tag]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, b...), true
+}
+
+// TableChecksum calculates the checksum of the table with the given tag. For the head table the checksumAdjustment field is regarded as zero.
+func (sfnt *SFNT) TableChecksum(tag string) (uint32, bool) {
+	b, ok := sfnt.Tables[tag]
+	if !ok {
+		return 0, false
+	}
+	padding := (4 - len(b)&3) & 3
+	b = append(append([]byte{}, b...), make([]byte, padding)...)
+	if tag == "head" && 12 <= len(b) {
+		binary.BigEndian.PutUint32(b[8:], 0x00000000)
+	}
+	return CalcChecksum(b), true
+}
+
 func (sfnt *SFNT) GlyphIndex(r rune) uint16 {
+	if sfnt.Cmap == nil {
+		return 0 // not loaded
+	}
 	return sfnt.Cmap.Get(r)
 }
 
+// HasGlyph returns true if the rune is mapped to a glyph other than .notdef, so that callers can fall back to another font otherwise.
+func (sfnt *SFNT) HasGlyph(r rune) bool {
+	return sfnt.GlyphIndex(r) != 0
+}
+
+// GlyphIndices returns the glyph IDs for the runes, and the positions in rs of the runes that are not in the font and map to .notdef.
+func (sfnt *SFNT) GlyphIndices(rs []rune) ([]uint16, []int) {
+	var missing []int
+	glyphIDs := make([]uint16, len(rs))
+	for i, r := range rs {
+		glyphIDs[i] = sfnt.GlyphIndex(r)
+		if glyphIDs[i] == 0 {
+			missing = append(missing, i)
+		}
+	}
+	return glyphIDs, missing
+}
+
 func (sfnt *SFNT) GlyphName(glyphID uint16) string {
 	return sfnt.Post.Get(glyphID)
 }
 
+// GlyphContour returns the contour of a TrueType glyph in font units, assembling composite glyphs from their components. Empty glyphs such as the space have no outline and return a nil contour without an error, callers must draw nothing for them and only advance the pen. Use IsEmptyGlyph to check for empty glyphs without decoding the contour.
 func (sfnt *SFNT) GlyphContour(glyphID uint16) (*glyfContour, error) {
 	if !sfnt.IsTrueType {
 		return nil, fmt.Errorf("CFF not supported")
@@ -55,15 +119,685 @@ func (sfnt *SFNT) GlyphContour(glyphID uint16) (*glyfContour, error) {
 	return sfnt.Glyf.Contour(glyphID, 0)
 }
 
+// IsEmptyGlyph returns true if the TrueType glyph has no outline, such as the space glyph, either because it has no data or no contours. Invalid glyph IDs are empty as well. It returns false for CFF fonts.
+func (sfnt *SFNT) IsEmptyGlyph(glyphID uint16) bool {
+	if !sfnt.IsTrueType {
+		return false
+	}
+	b, err := sfnt.Glyf.Get(glyphID)
+	return err != nil || len(b) < 2 || binary.BigEndian.Uint16(b) == 0
+}
+
+// GlyphSVGPath returns the outline of a glyph as the data of an SVG path element, using M, L, Q, and Z commands in font units with the y-axis flipped to point down. Composite glyphs are assembled from their components. To scale the glyph by the units per em, use a viewBox such as "0 -ascender unitsPerEm unitsPerEm" on the SVG element.
+func (sfnt *SFNT) GlyphSVGPath(glyphID uint16) (string, error) {
+	contour, err := sfnt.GlyphContour(glyphID)
+	if err != nil || contour == nil {
+		return "", err
+	}
+
+	sb := strings.Builder{}
+	writePoint := func(x, y float64) {
+		sb.WriteString(strconv.FormatFloat(x, 'f', -1, 64))
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.FormatFloat(-y, 'f', -1, 64))
+	}
+	start := 0
+	for _, endPoint := range contour.EndPoints {
+		end := int(endPoint) + 1
+		if end <= start || len(contour.OnCurve) < end {
+			break
+		}
+		n := end - start
+		point := func(i int) (float64, float64) {
+			i = start + i%n
+			return float64(contour.XCoordinates[i]), float64(contour.YCoordinates[i])
+		}
+
+		// start at the first on-curve point, or between the last and first point if all are off-curve
+		first := -1
+		for i := 0; i < n; i++ {
+			if contour.OnCurve[start+i] {
+				first = i
+				break
+			}
+		}
+		var x0, y0 float64
+		count := n - 1 // number of points after the start
+		if first == -1 {
+			xa, ya := point(n - 1)
+			xb, yb := point(0)
+			x0, y0 = (xa+xb)/2.0, (ya+yb)/2.0
+			count = n
+		} else {
+			x0, y0 = point(first)
+		}
+		if 0 < sb.Len() {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString("M")
+		writePoint(x0, y0)
+
+		hasControl := false
+		var cx, cy float64
+		for k := 1; k <= count; k++ {
+			i := first + k
+			x, y := point(i)
+			if contour.OnCurve[start+i%n] {
+				if hasControl {
+					sb.WriteString("Q")
+					writePoint(cx, cy)
+					sb.WriteByte(' ')
+				} else {
+					sb.WriteString("L")
+				}
+				writePoint(x, y)
+				hasControl = false
+			} else {
+				if hasControl {
+					sb.WriteString("Q")
+					writePoint(cx, cy)
+					sb.WriteByte(' ')
+					writePoint((cx+x)/2.0, (cy+y)/2.0)
+				}
+				cx, cy = x, y
+				hasControl = true
+			}
+		}
+		if hasControl {
+			sb.WriteString("Q")
+			writePoint(cx, cy)
+			sb.WriteByte(' ')
+			writePoint(x0, y0)
+		}
+		sb.WriteString("Z")
+		start = end
+	}
+	return sb.String(), nil
+}
+
+// GlyphsBounds returns the union of the bounding boxes in font units of the glyphs, each placed at the origin. Glyphs are assembled from their contours, so that the bounds of composite glyphs are correct even when their header is not. Empty glyphs are skipped, and if all are empty it returns zeros. See GlyphsBoundsFast for a faster version using only the glyph headers.
+func (sfnt *SFNT) GlyphsBounds(glyphIDs []uint16) (int16, int16, int16, int16) {
+	bounds := glyphsBounds{}
+	for _, glyphID := range glyphIDs {
+		contour, err := sfnt.GlyphContour(glyphID)
+		if err != nil || contour == nil {
+			continue
+		}
+		for i := range contour.XCoordinates {
+			bounds.add(contour.XCoordinates[i], contour.YCoordinates[i], contour.XCoordinates[i], contour.YCoordinates[i])
+		}
+	}
+	return bounds.xmin, bounds.ymin, bounds.xmax, bounds.ymax
+}
+
+// GlyphsBoundsFast returns the union of the bounding boxes in font units of the glyphs, each placed at the origin, as stored in the glyph headers without decoding the contours. Empty glyphs are skipped, and if all are empty it returns zeros.
+func (sfnt *SFNT) GlyphsBoundsFast(glyphIDs []uint16) (int16, int16, int16, int16) {
+	bounds := glyphsBounds{}
+	if !sfnt.IsTrueType {
+		return 0, 0, 0, 0
+	}
+	for _, glyphID := range glyphIDs {
+		if xmin, ymin, xmax, ymax, ok := sfnt.Glyf.Bounds(glyphID); ok {
+			bounds.add(xmin, ymin, xmax, ymax)
+		}
+	}
+	return bounds.xmin, bounds.ymin, bounds.xmax, bounds.ymax
+}
+
+type glyphsBounds struct {
+	xmin, ymin, xmax, ymax int16
+	set                    bool
+}
+
+func (bounds *glyphsBounds) add(xmin, ymin, xmax, ymax int16) {
+	if !bounds.set {
+		bounds.xmin, bounds.ymin, bounds.xmax, bounds.ymax = xmin, ymin, xmax, ymax
+		bounds.set = true
+		return
+	}
+	if xmin < bounds.xmin {
+		bounds.xmin = xmin
+	}
+	if ymin < bounds.ymin {
+		bounds.ymin = ymin
+	}
+	if bounds.xmax < xmax {
+		bounds.xmax = xmax
+	}
+	if bounds.ymax < ymax {
+		bounds.ymax = ymax
+	}
+}
+
+// GlyphComponents returns the glyph IDs directly referenced by a composite glyph, without recursively assembling them. It returns false for simple or empty glyphs and for CFF fonts.
+func (sfnt *SFNT) GlyphComponents(glyphID uint16) ([]uint16, bool) {
+	if !sfnt.IsTrueType {
+		return nil, false
+	}
+	return sfnt.Glyf.Components(glyphID)
+}
+
+// EachGlyph calls fn for the contour of every glyph in the font, skipping empty glyphs such as the space. It stops at and returns the first error, either from parsing a glyph or from fn.
+func (sfnt *SFNT) EachGlyph(fn func(glyphID uint16, contour *glyfContour) error) error {
+	if !sfnt.IsTrueType {
+		return fmt.Errorf("CFF not supported")
+	}
+	for i := 0; i < int(sfnt.Maxp.NumGlyphs); i++ {
+		glyphID := uint16(i)
+		if b, err := sfnt.Glyf.Get(glyphID); err != nil {
+			return err
+		} else if len(b) == 0 {
+			continue
+		}
+
+		contour, err := sfnt.Glyf.Contour(glyphID, 0)
+		if err != nil {
+			return err
+		} else if err := fn(glyphID, contour); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (sfnt *SFNT) GlyphAdvance(glyphID uint16) uint16 {
 	return sfnt.Hmtx.Advance(glyphID)
 }
 
+// AdvanceForRune returns the advance width of the glyph for the given rune. Runes not in the font return the advance of .notdef.
+func (sfnt *SFNT) AdvanceForRune(r rune) uint16 {
+	return sfnt.GlyphAdvance(sfnt.GlyphIndex(r))
+}
+
+// AdvancesForRunes returns the advance widths of the glyphs for the given runes.
+func (sfnt *SFNT) AdvancesForRunes(rs []rune) []uint16 {
+	advances := make([]uint16, len(rs))
+	for i, r := range rs {
+		advances[i] = sfnt.AdvanceForRune(r)
+	}
+	return advances
+}
+
+// Info is a summary of a font, see SFNT.Info.
+type Info struct {
+	Family, Subfamily string
+	NumGlyphs         uint16
+	UnitsPerEm        uint16
+	Weight            uint16 // weight class between 1 and 1000, such as 400 for regular and 700 for bold
+	IsCFF, IsTrueType bool   // only one can be true
+	IsVariable        bool   // has an fvar table
+	HasColor          bool   // has COLR, sbix, CBDT, or SVG color glyphs
+}
+
+// Info returns a summary of the font from the head, maxp, name, and OS/2 tables, and the presence of the fvar and color tables. The family and subfamily are the typographic names if present.
+func (sfnt *SFNT) Info() Info {
+	info := Info{
+		NumGlyphs:  sfnt.Maxp.NumGlyphs,
+		UnitsPerEm: sfnt.Head.UnitsPerEm,
+		Weight:     sfnt.OS2.UsWeightClass,
+		IsCFF:      sfnt.IsCFF,
+		IsTrueType: sfnt.IsTrueType,
+	}
+	var ok bool
+	if info.Family, ok = sfnt.Name.Get(16); !ok {
+		info.Family, _ = sfnt.Name.Get(1)
+	}
+	if info.Subfamily, ok = sfnt.Name.Get(17); !ok {
+		info.Subfamily, _ = sfnt.Name.Get(2)
+	}
+	_, info.IsVariable = sfnt.Tables["fvar"]
+	for _, tag := range []string{"COLR", "sbix", "CBDT", "SVG "} {
+		if _, ok := sfnt.Tables[tag]; ok {
+			info.HasColor = true
+		}
+	}
+	return info
+}
+
+// IsMonospaced returns true if the font is monospaced, either when the post table says so or when all glyph advances of the digits and ASCII letters are equal. It also returns the common advance width.
+func (sfnt *SFNT) IsMonospaced() (bool, uint16) {
+	var advance uint16
+	for _, r := range "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ" {
+		glyphID := sfnt.GlyphIndex(r)
+		if glyphID == 0 {
+			continue
+		} else if advance == 0 {
+			advance = sfnt.GlyphAdvance(glyphID)
+		} else if advance != sfnt.GlyphAdvance(glyphID) {
+			if sfnt.Post.IsFixedPitch != 0 {
+				return true, sfnt.Hhea.AdvanceWidthMax
+			}
+			return false, 0
+		}
+	}
+	if advance == 0 {
+		if sfnt.Post.IsFixedPitch != 0 {
+			return true, sfnt.Hhea.AdvanceWidthMax
+		}
+		return false, 0
+	}
+	return true, advance
+}
+
+// UnicodeRanges returns the names of the Unicode ranges that the font claims to support according to the OS/2 table.
+func (sfnt *SFNT) UnicodeRanges() []string {
+	ranges := []string{}
+	bits := [4]uint32{sfnt.OS2.UlUnicodeRange1, sfnt.OS2.UlUnicodeRange2, sfnt.OS2.UlUnicodeRange3, sfnt.OS2.UlUnicodeRange4}
+	for i, name := range os2UnicodeRanges {
+		if bits[i/32]&(1<<(i%32)) != 0 {
+			ranges = append(ranges, name)
+		}
+	}
+	return ranges
+}
+
+// CodePages returns the names of the code pages that the font claims to support according to the OS/2 table.
+func (sfnt *SFNT) CodePages() []string {
+	codePages := []string{}
+	bits := [2]uint32{sfnt.OS2.UlCodePageRange1, sfnt.OS2.UlCodePageRange2}
+	for i, name := range os2CodePageRanges {
+		if name != "" && bits[i/32]&(1<<(i%32)) != 0 {
+			codePages = append(codePages, name)
+		}
+	}
+	return codePages
+}
+
+// VendorID returns the font vendor identifier from the OS/2 table, trimmed of trailing spaces and NULs.
+func (sfnt *SFNT) VendorID() string {
+	return strings.TrimRight(string(sfnt.OS2.AchVendID[:]), " \x00")
+}
+
+// VendorName returns the name of the font vendor, or an empty string if unknown.
+func (sfnt *SFNT) VendorName() string {
+	return vendorNames[sfnt.VendorID()]
+}
+
 func (sfnt *SFNT) Kerning(left, right uint16) int16 {
 	return sfnt.Kern.Get(left, right)
 }
 
+// ColorLayers returns the color layers of a glyph from the COLR table with colors from the given CPAL palette, drawn in order from bottom to top. It returns false if the glyph has no color layers.
+func (sfnt *SFNT) ColorLayers(glyphID uint16, palette int) ([]ColorLayer, bool) {
+	if sfnt.Colr == nil {
+		return nil, false
+	}
+	layers, ok := sfnt.Colr.Get(glyphID)
+	if !ok {
+		return nil, false
+	}
+
+	colorLayers := make([]ColorLayer, len(layers))
+	for i, layer := range layers {
+		colorLayers[i].GlyphID = layer.GlyphID
+		if layer.PaletteIndex == 0xFFFF || sfnt.Cpal == nil {
+			colorLayers[i].Foreground = true
+		} else if col, ok := sfnt.Cpal.Get(palette, layer.PaletteIndex); ok {
+			colorLayers[i].Color = col
+		} else {
+			colorLayers[i].Foreground = true
+		}
+	}
+	return colorLayers, true
+}
+
+// GlyphBitmap returns the embedded color bitmap of a glyph from the sbix or CBDT tables, using the strike with a pixels-per-em closest to the given size. It returns false if the glyph has no bitmap.
+func (sfnt *SFNT) GlyphBitmap(glyphID uint16, ppem uint16) (*GlyphBitmap, bool) {
+	if sfnt.Sbix != nil {
+		if bitmap, ok := sfnt.Sbix.Get(glyphID, ppem); ok {
+			return bitmap, true
+		}
+	}
+	if sfnt.Cblc != nil {
+		if cbdt, ok := sfnt.Tables["CBDT"]; ok {
+			return sfnt.Cblc.Get(cbdt, glyphID, ppem)
+		}
+	}
+	return nil, false
+}
+
+// BestStrike returns the pixels-per-em of the bitmap strike closest to the given size from the sbix or CBLC tables, preferring bigger strikes, which is the strike that GlyphBitmap uses. Bitmaps must be scaled by ppem/strikePPEM to render them at the given size. It returns false for fonts without color bitmaps.
+func (sfnt *SFNT) BestStrike(ppem uint16) (uint16, bool) {
+	if sfnt.Sbix != nil {
+		if ppems := sfnt.Sbix.ppems(); 0 < len(ppems) {
+			return ppems[nearestStrike(ppems, ppem)], true
+		}
+	}
+	if sfnt.Cblc != nil {
+		if _, ok := sfnt.Tables["CBDT"]; ok {
+			if ppems := sfnt.Cblc.ppems(); 0 < len(ppems) {
+				return ppems[nearestStrike(ppems, ppem)], true
+			}
+		}
+	}
+	return 0, false
+}
+
+// GlyphClass returns the class of the glyph from the GDEF table, or UnclassifiedGlyph if the font does not classify its glyphs.
+func (sfnt *SFNT) GlyphClass(glyphID uint16) GlyphClass {
+	if sfnt.Gdef == nil {
+		return UnclassifiedGlyph
+	}
+	return sfnt.Gdef.GlyphClass(glyphID)
+}
+
+// MarkAttachClass returns the mark attachment class of the glyph from the GDEF table, or zero if it has none.
+func (sfnt *SFNT) MarkAttachClass(glyphID uint16) uint16 {
+	if sfnt.Gdef == nil {
+		return 0
+	}
+	return sfnt.Gdef.MarkAttachClass(glyphID)
+}
+
+// LigatureCarets returns the caret positions in font units between the components of a ligature glyph from the GDEF table, or false if the font defines none. Caret positions defined by a contour point are omitted.
+func (sfnt *SFNT) LigatureCarets(glyphID uint16) ([]int16, bool) {
+	if sfnt.Gdef == nil {
+		return nil, false
+	}
+	return sfnt.Gdef.LigatureCarets(glyphID)
+}
+
+// ApplyMorx applies the default substitutions and ligatures of the Apple Advanced Typography morx table to the glyphs in logical order and returns the resulting glyphs, which may be fewer than the input. It returns the glyphs unchanged if the font has no morx table.
+func (sfnt *SFNT) ApplyMorx(glyphIDs []uint16) []uint16 {
+	if sfnt.Morx == nil {
+		return glyphIDs
+	}
+	return sfnt.Morx.Apply(glyphIDs)
+}
+
+// AATFeatures returns the feature types and selectors of the AAT feat table with their names from the name table, or nil if the font has no feat table.
+func (sfnt *SFNT) AATFeatures() []AATFeature {
+	if sfnt.Feat == nil {
+		return nil
+	}
+
+	features := make([]AATFeature, len(sfnt.Feat.Features))
+	for i, feature := range sfnt.Feat.Features {
+		features[i].Type = feature.Feature
+		features[i].Name, _ = sfnt.Name.Get(feature.NameIndex)
+		features[i].Exclusive = feature.Flags&0x8000 != 0
+		if feature.Flags&0x4000 != 0 {
+			features[i].Default = int(feature.Flags & 0x00FF)
+		}
+		features[i].Selectors = make([]AATFeatureSelector, len(feature.Settings))
+		for j, setting := range feature.Settings {
+			features[i].Selectors[j].Setting = setting.Setting
+			features[i].Selectors[j].Name, _ = sfnt.Name.Get(setting.NameIndex)
+		}
+	}
+	return features
+}
+
+// StyleAttributes returns the design axes of the STAT table with their named axis values, and the named combinations of values on several axes, with their names from the name table. It returns nil if the font has no STAT table.
+func (sfnt *SFNT) StyleAttributes() ([]StyleAxis, []StyleCombination) {
+	if sfnt.Stat == nil {
+		return nil, nil
+	}
+
+	axes := make([]StyleAxis, len(sfnt.Stat.DesignAxes))
+	for i, axis := range sfnt.Stat.DesignAxes {
+		axes[i].Tag = axis.Tag
+		axes[i].Name, _ = sfnt.Name.Get(axis.NameID)
+		axes[i].Ordering = axis.Ordering
+	}
+
+	var combinations []StyleCombination
+	for _, value := range sfnt.Stat.AxisValues {
+		name, _ := sfnt.Name.Get(value.NameID)
+		if value.Format == 4 {
+			combination := StyleCombination{
+				Name:   name,
+				Flags:  value.Flags,
+				Values: make(map[string]float64, len(value.AxisIndices)),
+			}
+			for j, axisIndex := range value.AxisIndices {
+				combination.Values[axes[axisIndex].Tag] = value.Values[j]
+			}
+			combinations = append(combinations, combination)
+			continue
+		}
+		axes[value.AxisIndex].Values = append(axes[value.AxisIndex].Values, StyleValue{
+			Name:        name,
+			Flags:       value.Flags,
+			Value:       value.Value,
+			Min:         value.Min,
+			Max:         value.Max,
+			LinkedValue: value.LinkedValue,
+		})
+	}
+	return axes, combinations
+}
+
+// MarkToMark returns the offset in font units of the origin of mark relative to the origin of prevMark, when mark is stacked on prevMark using the mark-to-mark attachment of the GPOS table. It returns false if the font does not position the pair.
+func (sfnt *SFNT) MarkToMark(prevMark, mark uint16) (int16, int16, bool) {
+	if sfnt.Gpos == nil {
+		return 0, 0, false
+	}
+	return sfnt.Gpos.MarkToMark(prevMark, mark)
+}
+
+// KerningMerged returns the kerning in font units between two glyphs from either the GPOS or the kern table. Pair adjustments of the kern feature of the default script in the GPOS table take precedence, so that for fonts with both tables the kern table is only used for pairs that the GPOS table does not cover, even when their values differ.
+func (sfnt *SFNT) KerningMerged(left, right uint16) int16 {
+	if sfnt.Gpos != nil {
+		if kern, ok := sfnt.Gpos.Kerning(left, right); ok {
+			return kern
+		}
+	}
+	if sfnt.Kern == nil {
+		return 0
+	}
+	return sfnt.Kerning(left, right)
+}
+
+// SubscriptSize returns the horizontal and vertical font size for subscripts in font units. It falls back to 0.7 times the em size if not set.
+func (sfnt *SFNT) SubscriptSize() (int16, int16) {
+	x, y := sfnt.OS2.YSubscriptXSize, sfnt.OS2.YSubscriptYSize
+	if x == 0 || y == 0 {
+		size := int16(0.7*float64(sfnt.Head.UnitsPerEm) + 0.5)
+		x, y = size, size
+	}
+	return x, y
+}
+
+// SubscriptOffset returns the horizontal and vertical offset for subscripts in font units, where a positive vertical offset is downwards from the baseline. It falls back to half the descent if not set.
+func (sfnt *SFNT) SubscriptOffset() (int16, int16) {
+	x, y := sfnt.OS2.YSubscriptXOffset, sfnt.OS2.YSubscriptYOffset
+	if y == 0 {
+		y = -sfnt.Hhea.Descender / 2
+	}
+	return x, y
+}
+
+// SuperscriptSize returns the horizontal and vertical font size for superscripts in font units. It falls back to 0.7 times the em size if not set.
+func (sfnt *SFNT) SuperscriptSize() (int16, int16) {
+	x, y := sfnt.OS2.YSuperscriptXSize, sfnt.OS2.YSuperscriptYSize
+	if x == 0 || y == 0 {
+		size := int16(0.7*float64(sfnt.Head.UnitsPerEm) + 0.5)
+		x, y = size, size
+	}
+	return x, y
+}
+
+// SuperscriptOffset returns the horizontal and vertical offset for superscripts in font units, where a positive vertical offset is upwards from the baseline. It falls back to half the ascent if not set.
+func (sfnt *SFNT) SuperscriptOffset() (int16, int16) {
+	x, y := sfnt.OS2.YSuperscriptXOffset, sfnt.OS2.YSuperscriptYOffset
+	if y == 0 {
+		y = sfnt.Hhea.Ascender / 2
+	}
+	return x, y
+}
+
+// UnderlineMetrics returns the position and thickness of the underline in font units, where the position is the distance from the baseline to the top of the underline and is negative below the baseline. It falls back to 0.15 and 0.075 times the em size below the baseline if not set.
+func (sfnt *SFNT) UnderlineMetrics() (int16, int16) {
+	position, thickness := sfnt.Post.UnderlinePosition, sfnt.Post.UnderlineThickness
+	if position == 0 {
+		position = -int16(0.15*float64(sfnt.Head.UnitsPerEm) + 0.5)
+	}
+	if thickness <= 0 {
+		thickness = int16(0.075*float64(sfnt.Head.UnitsPerEm) + 0.5)
+	}
+	return position, thickness
+}
+
+// StrikeoutMetrics returns the position and thickness of the strikeout in font units, where the position is the distance from the baseline to the top of the strikeout as for the underline. It falls back to the underline thickness and a stroke centered at half the x-height if not set.
+func (sfnt *SFNT) StrikeoutMetrics() (int16, int16) {
+	position, thickness := sfnt.OS2.YStrikeoutPosition, sfnt.OS2.YStrikeoutSize
+	if thickness <= 0 {
+		_, thickness = sfnt.UnderlineMetrics()
+	}
+	if position == 0 {
+		position = sfnt.xHeight()/2 + thickness/2
+	}
+	return position, thickness
+}
+
+// xHeight returns the x-height in font units from the OS/2 table, or the height of the x glyph if not set. It falls back to half the ascender.
+func (sfnt *SFNT) xHeight() int16 {
+	if 0 < sfnt.OS2.SxHeight {
+		return sfnt.OS2.SxHeight
+	} else if sfnt.IsTrueType && sfnt.Glyf != nil {
+		if _, _, _, ymax, ok := sfnt.Glyf.Bounds(sfnt.GlyphIndex('x')); ok && 0 < ymax {
+			return ymax
+		}
+	}
+	return sfnt.Hhea.Ascender / 2
+}
+
+// LineMetrics returns the ascender, descender, and line gap in font units, where the descender is negative below the baseline. It uses the typographic metrics of the OS/2 table if the font sets USE_TYPO_METRICS, and the hhea metrics otherwise.
+func (sfnt *SFNT) LineMetrics() (int16, int16, int16) {
+	if sfnt.OS2.HasTypoMetrics && sfnt.OS2.FsSelection&0x0080 != 0 {
+		return sfnt.OS2.STypoAscender, sfnt.OS2.STypoDescender, sfnt.OS2.STypoLineGap
+	}
+	return sfnt.Hhea.Ascender, sfnt.Hhea.Descender, sfnt.Hhea.LineGap
+}
+
+// LineMetricsAt returns the ascender, descender, and line gap in font units like LineMetrics, for the instance of a variable font at the given normalized coordinates in [-1,1] per axis. The metrics are adjusted by the deltas of the MVAR table, if present.
+func (sfnt *SFNT) LineMetricsAt(coords []float64) (int16, int16, int16) {
+	ascender, descender, lineGap := sfnt.LineMetrics()
+	tags := [3]string{"hasc", "hdsc", "hlgp"}
+	if sfnt.OS2.HasTypoMetrics && sfnt.OS2.FsSelection&0x0080 != 0 {
+		tags = [3]string{"tasc", "tdsc", "tlgp"}
+	}
+	return sfnt.variedMetric(tags[0], ascender, coords), sfnt.variedMetric(tags[1], descender, coords), sfnt.variedMetric(tags[2], lineGap, coords)
+}
+
+// UnderlineMetricsAt returns the position and thickness of the underline in font units like UnderlineMetrics, for the instance of a variable font at the given normalized coordinates in [-1,1] per axis. The metrics are adjusted by the deltas of the MVAR table, if present.
+func (sfnt *SFNT) UnderlineMetricsAt(coords []float64) (int16, int16) {
+	position, thickness := sfnt.UnderlineMetrics()
+	return sfnt.variedMetric("undo", position, coords), sfnt.variedMetric("unds", thickness, coords)
+}
+
+// StrikeoutMetricsAt returns the position and thickness of the strikeout in font units like StrikeoutMetrics, for the instance of a variable font at the given normalized coordinates in [-1,1] per axis. The metrics are adjusted by the deltas of the MVAR table, if present.
+func (sfnt *SFNT) StrikeoutMetricsAt(coords []float64) (int16, int16) {
+	position, thickness := sfnt.StrikeoutMetrics()
+	return sfnt.variedMetric("stro", position, coords), sfnt.variedMetric("strs", thickness, coords)
+}
+
+// SubscriptSizeAt returns the horizontal and vertical font size for subscripts in font units like SubscriptSize, for the instance of a variable font at the given normalized coordinates in [-1,1] per axis. The sizes are adjusted by the deltas of the MVAR table, if present.
+func (sfnt *SFNT) SubscriptSizeAt(coords []float64) (int16, int16) {
+	x, y := sfnt.SubscriptSize()
+	return sfnt.variedMetric("sbxs", x, coords), sfnt.variedMetric("sbys", y, coords)
+}
+
+// SubscriptOffsetAt returns the horizontal and vertical offset for subscripts in font units like SubscriptOffset, for the instance of a variable font at the given normalized coordinates in [-1,1] per axis. The offsets are adjusted by the deltas of the MVAR table, if present.
+func (sfnt *SFNT) SubscriptOffsetAt(coords []float64) (int16, int16) {
+	x, y := sfnt.SubscriptOffset()
+	return sfnt.variedMetric("sbxo", x, coords), sfnt.variedMetric("sbyo", y, coords)
+}
+
+// SuperscriptSizeAt returns the horizontal and vertical font size for superscripts in font units like SuperscriptSize, for the instance of a variable font at the given normalized coordinates in [-1,1] per axis. The sizes are adjusted by the deltas of the MVAR table, if present.
+func (sfnt *SFNT) SuperscriptSizeAt(coords []float64) (int16, int16) {
+	x, y := sfnt.SuperscriptSize()
+	return sfnt.variedMetric("spxs", x, coords), sfnt.variedMetric("spys", y, coords)
+}
+
+// SuperscriptOffsetAt returns the horizontal and vertical offset for superscripts in font units like SuperscriptOffset, for the instance of a variable font at the given normalized coordinates in [-1,1] per axis. The offsets are adjusted by the deltas of the MVAR table, if present.
+func (sfnt *SFNT) SuperscriptOffsetAt(coords []float64) (int16, int16) {
+	x, y := sfnt.SuperscriptOffset()
+	return sfnt.variedMetric("spxo", x, coords), sfnt.variedMetric("spyo", y, coords)
+}
+
+// MetricVariation returns the delta in font units of the metric with the given MVAR value tag, such as "undo" for the underline offset or "tasc" for the typographic ascender, for the instance of a variable font at the given normalized coordinates in [-1,1] per axis. It returns false if the font has no MVAR table or does not vary the metric.
+func (sfnt *SFNT) MetricVariation(tag string, coords []float64) (float64, bool) {
+	if sfnt.Mvar == nil {
+		return 0.0, false
+	}
+	return sfnt.Mvar.Delta(tag, coords)
+}
+
+func (sfnt *SFNT) variedMetric(tag string, value int16, coords []float64) int16 {
+	if delta, ok := sfnt.MetricVariation(tag, coords); ok {
+		return int16(math.Round(float64(value) + delta))
+	}
+	return value
+}
+
+// TypoMetrics returns the typographic ascender, descender, and line gap of the OS/2 table in font units, where the descender is negative below the baseline. It falls back to the hhea metrics for the short version 0 OS/2 table that lacks them.
+func (sfnt *SFNT) TypoMetrics() (int16, int16, int16) {
+	if !sfnt.OS2.HasTypoMetrics {
+		return sfnt.Hhea.Ascender, sfnt.Hhea.Descender, sfnt.Hhea.LineGap
+	}
+	return sfnt.OS2.STypoAscender, sfnt.OS2.STypoDescender, sfnt.OS2.STypoLineGap
+}
+
+// WinMetrics returns the Windows ascent and descent of the OS/2 table in font units, where both are positive. It falls back to the hhea metrics for the short version 0 OS/2 table that lacks them.
+func (sfnt *SFNT) WinMetrics() (uint16, uint16) {
+	if !sfnt.OS2.HasTypoMetrics {
+		ascent, descent := sfnt.Hhea.Ascender, -sfnt.Hhea.Descender
+		if ascent < 0 {
+			ascent = 0
+		}
+		if descent < 0 {
+			descent = 0
+		}
+		return uint16(ascent), uint16(descent)
+	}
+	return sfnt.OS2.UsWinAscent, sfnt.OS2.UsWinDescent
+}
+
+// ParseOptions are options for parsing SFNT fonts.
+type ParseOptions struct {
+	// StripHinting discards the TrueType hinting instructions of all glyphs and removes the cvt, fpgm, and prep tables, which is useful for renderers that do not grid-fit or do not want to run font bytecode. The stripped tables are reflected in the Tables field and in any font written from it, such as subsets.
+	StripHinting bool
+
+	// MetricsOnly parses only the tables needed for text measurement and font matching, which are head, maxp, hhea, hmtx, OS/2, name, and post. The outlines and the cmap table are not loaded, so that GlyphIndex always returns zero and outline accessors such as GlyphContour return an error.
+	MetricsOnly bool
+
+	// Lenient accepts malformed glyf tables that are salvageable. Up to three trailing padding bytes after the last glyph are ignored, and loca offsets that exceed the glyf table are clamped to its length, which marks the font as repaired.
+	Lenient bool
+
+	// MaxGlyphs, MaxPostStringBytes, and MaxComponents limit the resources spent on untrusted fonts, where ErrLimitExceeded is returned when a limit is exceeded and zero means no limit. MaxGlyphs limits the number of glyphs of the maxp table, which determines the size of the loca, hmtx, and post tables. MaxPostStringBytes limits the size of the glyph name strings of a version 2 post table. MaxComponents limits the number of components that are assembled for a single TrueType composite glyph, including those of nested composite glyphs.
+	MaxGlyphs          int
+	MaxPostStringBytes int
+	MaxComponents      int
+}
+
+// ParseSFNT parses an SFNT font file (TrueType or OpenType) with the default options, see ParseSFNTOptions.
 func ParseSFNT(b []byte) (*SFNT, error) {
+	return ParseSFNTOptions(b, ParseOptions{})
+}
+
+// ParseSFNTReader reads an SFNT font file (TrueType or OpenType) of at most maxSize bytes from r and parses it with the default options. It returns ErrExceedsMemory if the font is larger, without reading more than maxSize+1 bytes. A maxSize of zero or larger than math.MaxInt32 uses the largest size supported by the parser.
+func ParseSFNTReader(r io.Reader, maxSize int) (*SFNT, error) {
+	if maxSize <= 0 || math.MaxInt32 < maxSize {
+		maxSize = math.MaxInt32
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	} else if maxSize < len(b) {
+		return nil, ErrExceedsMemory
+	}
+	return ParseSFNT(b)
+}
+
+// ParseSFNTMetrics parses an SFNT font file (TrueType or OpenType) for text measurement and font matching only, see ParseOptions.MetricsOnly.
+func ParseSFNTMetrics(b []byte) (*SFNT, error) {
+	return ParseSFNTOptions(b, ParseOptions{MetricsOnly: true})
+}
+
+// ParseSFNTOptions parses an SFNT font file (TrueType or OpenType) with the given options. The byte slice is not modified.
+func ParseSFNTOptions(b []byte, options ParseOptions) (*SFNT, error) {
 	if len(b) < 12 || math.MaxInt32 < len(b) {
 		return nil, ErrInvalidFontData
 	}
@@ -105,7 +839,7 @@ func ParseSFNT(b []byte) (*SFNT, error) {
 			checksumAdjustment = binary.BigEndian.Uint32(b[offset+8:])
 			binary.BigEndian.PutUint32(b[offset+8:], 0x00000000)
 		}
-		if calcChecksum(b[offset:offset+length+padding]) != checksum {
+		if CalcChecksum(b[offset:offset+length+padding]) != checksum {
 			return nil, fmt.Errorf("%s: bad checksum", tag)
 		}
 		if tag == "head" {
@@ -116,6 +850,7 @@ func ParseSFNT(b []byte) (*SFNT, error) {
 	// TODO: check file checksum
 
 	sfnt := &SFNT{}
+	sfnt.options = options
 	sfnt.Data = b
 	sfnt.IsCFF = sfntVersion == "OTTO"
 	sfnt.IsTrueType = binary.BigEndian.Uint32([]byte(sfntVersion)) == 0x00010000
@@ -148,7 +883,7 @@ func ParseSFNT(b []byte) (*SFNT, error) {
 	} else if err := sfnt.parseHhea(); err != nil {
 		return nil, err
 	}
-	if sfnt.IsTrueType {
+	if sfnt.IsTrueType && !options.MetricsOnly {
 		if err := sfnt.parseLoca(); err != nil {
 			return nil, err
 		}
@@ -160,6 +895,10 @@ func ParseSFNT(b []byte) (*SFNT, error) {
 	}
 	sort.Strings(tableNames)
 	for _, tableName := range tableNames {
+		if options.MetricsOnly && tableName != "hmtx" && tableName != "name" && tableName != "OS/2" && tableName != "post" {
+			continue
+		}
+
 		var err error
 		switch tableName {
 		//case "CFF ":
@@ -168,24 +907,103 @@ func ParseSFNT(b []byte) (*SFNT, error) {
 		//	err = sfnt.parseCFF2()
 		case "cmap":
 			err = sfnt.parseCmap()
+		case "CBLC":
+			err = sfnt.parseCblc()
+		case "COLR":
+			err = sfnt.parseColr()
+		case "CPAL":
+			err = sfnt.parseCpal()
 		case "glyf":
 			err = sfnt.parseGlyf()
+		case "feat":
+			err = sfnt.parseFeat()
+		case "GDEF":
+			if sfnt.parseGDEF() != nil {
+				// glyph definitions are optional, ignore malformed tables
+				sfnt.Gdef = nil
+			}
+		case "GPOS":
+			if sfnt.parseGPOS() != nil {
+				// positioning is optional, ignore malformed tables
+				sfnt.Gpos = nil
+			}
 		case "hmtx":
 			err = sfnt.parseHmtx()
 		case "kern":
 			err = sfnt.parseKern()
+		case "morx":
+			err = sfnt.parseMorx()
+		case "MVAR":
+			err = sfnt.parseMVAR()
 		case "name":
 			err = sfnt.parseName()
 		case "OS/2":
 			err = sfnt.parseOS2()
 		case "post":
 			err = sfnt.parsePost()
+		case "sbix":
+			err = sfnt.parseSbix()
+		case "STAT":
+			err = sfnt.parseSTAT()
 		}
 		if err != nil {
 			return nil, err
 		}
 	}
-	return sfnt, nil
+
+	if options.StripHinting {
+		if err := sfnt.stripHinting(); err != nil {
+			return nil, err
+		}
+	}
+	return sfnt, nil
+}
+
+// stripHinting removes the hinting tables and the instructions of all glyphs. The glyf, loca, head, and maxp tables are replaced by copies so that the font data is not modified.
+func (sfnt *SFNT) stripHinting() error {
+	delete(sfnt.Tables, "cvt ")
+	delete(sfnt.Tables, "fpgm")
+	delete(sfnt.Tables, "prep")
+	if !sfnt.IsTrueType || sfnt.Glyf == nil {
+		return nil
+	}
+
+	// rewrite glyphs without instructions using long loca offsets
+	glyf := newBinaryWriter([]byte{})
+	offsets := make([]uint32, len(sfnt.Loca.Offsets))
+	for glyphID := 0; glyphID+1 < len(sfnt.Loca.Offsets); glyphID++ {
+		b, err := sfnt.Glyf.Get(uint16(glyphID))
+		if err != nil {
+			return err
+		} else if b, err = stripGlyphInstructions(b); err != nil {
+			return fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+		}
+		offsets[glyphID] = glyf.Len()
+		glyf.WriteBytes(b)
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+	}
+	offsets[len(offsets)-1] = glyf.Len()
+
+	loca := newBinaryWriter([]byte{})
+	for _, offset := range offsets {
+		loca.WriteUint32(offset)
+	}
+	sfnt.Loca.Offsets = offsets
+	sfnt.Glyf.data = glyf.Bytes()
+	sfnt.Head.IndexToLocFormat = 1
+	sfnt.Maxp.MaxSizeOfInstructions = 0
+
+	head := append([]byte{}, sfnt.Tables["head"]...)
+	binary.BigEndian.PutUint16(head[50:], 1) // indexToLocFormat
+	maxp := append([]byte{}, sfnt.Tables["maxp"]...)
+	binary.BigEndian.PutUint16(maxp[26:], 0) // maxSizeOfInstructions
+	sfnt.Tables["glyf"] = sfnt.Glyf.data
+	sfnt.Tables["loca"] = loca.Bytes()
+	sfnt.Tables["head"] = head
+	sfnt.Tables["maxp"] = maxp
+	return nil
 }
 
 ////////////////////////////////////////////////////////////////
@@ -201,6 +1019,14 @@ func (subtable *cmapFormat0) Get(r rune) (uint16, bool) {
 	return uint16(subtable.GlyphIdArray[r]), true
 }
 
+func (subtable *cmapFormat0) ForEach(fn func(rune, uint16)) {
+	for r, glyphID := range subtable.GlyphIdArray {
+		if glyphID != 0 {
+			fn(rune(r), uint16(glyphID))
+		}
+	}
+}
+
 type cmapFormat4 struct {
 	StartCode     []uint16
 	EndCode       []uint16
@@ -224,12 +1050,34 @@ func (subtable *cmapFormat4) Get(r rune) (uint16, bool) {
 			// r-startCode  ->  difference of rune with startCode
 			// -(n-1)  ->  subtract offset from the current idRangeOffset item
 			index := int(subtable.IdRangeOffset[i]/2) + int(uint16(r)-subtable.StartCode[i]) - (n - i)
-			return subtable.GlyphIdArray[index], true // index is always valid
+			if index < 0 || len(subtable.GlyphIdArray) <= index {
+				return 0, false // validated when parsing, but subtables may be constructed otherwise
+			}
+			return subtable.GlyphIdArray[index], true
 		}
 	}
 	return 0, false
 }
 
+func (subtable *cmapFormat4) ForEach(fn func(rune, uint16)) {
+	n := len(subtable.StartCode)
+	for i := 0; i < n; i++ {
+		for r := int(subtable.StartCode[i]); r <= int(subtable.EndCode[i]); r++ {
+			glyphID := uint16(subtable.IdDelta[i]) + uint16(r)
+			if subtable.IdRangeOffset[i] != 0 {
+				index := int(subtable.IdRangeOffset[i]/2) + (r - int(subtable.StartCode[i])) - (n - i)
+				if index < 0 || len(subtable.GlyphIdArray) <= index {
+					break
+				}
+				glyphID = subtable.GlyphIdArray[index]
+			}
+			if glyphID != 0 {
+				fn(rune(r), glyphID)
+			}
+		}
+	}
+}
+
 type cmapFormat6 struct {
 	FirstCode    uint16
 	GlyphIdArray []uint16
@@ -242,6 +1090,14 @@ func (subtable *cmapFormat6) Get(r rune) (uint16, bool) {
 	return subtable.GlyphIdArray[uint32(r)-uint32(subtable.FirstCode)], true
 }
 
+func (subtable *cmapFormat6) ForEach(fn func(rune, uint16)) {
+	for i, glyphID := range subtable.GlyphIdArray {
+		if glyphID != 0 {
+			fn(rune(subtable.FirstCode)+rune(i), glyphID)
+		}
+	}
+}
+
 type cmapFormat12 struct {
 	StartCharCode []uint32
 	EndCharCode   []uint32
@@ -260,31 +1116,98 @@ func (subtable *cmapFormat12) Get(r rune) (uint16, bool) {
 	return 0, false
 }
 
+func (subtable *cmapFormat12) ForEach(fn func(rune, uint16)) {
+	for i := 0; i < len(subtable.StartCharCode); i++ {
+		for r := subtable.StartCharCode[i]; r <= subtable.EndCharCode[i] && r <= unicode.MaxRune; r++ {
+			glyphID := (r - subtable.StartCharCode[i]) + subtable.StartGlyphID[i]
+			if math.MaxUint16 < glyphID {
+				break
+			} else if glyphID != 0 {
+				fn(rune(r), uint16(glyphID))
+			}
+		}
+	}
+}
+
 type cmapEncodingRecord struct {
 	PlatformID uint16
 	EncodingID uint16
 	Format     uint16
 	Subtable   uint16
+	Language   uint32 // for the Macintosh platform this is the QuickDraw language ID plus one, or zero if language-independent
 }
 
 type cmapSubtable interface {
 	Get(rune) (uint16, bool)
+	ForEach(func(rune, uint16)) // calls the function for every rune that maps to a glyph other than .notdef
 }
 
 type cmapTable struct {
 	EncodingRecords []cmapEncodingRecord
 	Subtables       []cmapSubtable
+
+	order []int // subtable indices in order of preference
 }
 
+// Get returns the glyph ID for the rune from the first subtable that maps it, preferring Unicode subtables over language-specific Macintosh subtables.
 func (t *cmapTable) Get(r rune) uint16 {
-	for _, subtable := range t.Subtables {
-		if glyphID, ok := subtable.Get(r); ok {
+	if t.order == nil {
+		for _, subtable := range t.Subtables {
+			if glyphID, ok := subtable.Get(r); ok {
+				return glyphID
+			}
+		}
+		return 0
+	}
+	for _, i := range t.order {
+		if glyphID, ok := t.Subtables[i].Get(r); ok {
 			return glyphID
 		}
 	}
 	return 0
 }
 
+// Language returns the language ID of the i-th encoding record. For the Macintosh platform it is the QuickDraw language ID plus one, and zero for language-independent subtables and other platforms.
+func (t *cmapTable) Language(i int) uint32 {
+	return t.EncodingRecords[i].Language
+}
+
+// rank returns the preference of an encoding record when selecting a subtable, lower is better.
+func (record cmapEncodingRecord) rank() int {
+	switch record.PlatformID {
+	case 0: // Unicode
+		return 0
+	case 3: // Windows
+		if record.EncodingID == 1 || record.EncodingID == 10 {
+			return 0
+		}
+		return 1
+	case 1: // Macintosh
+		if record.Language == 0 {
+			return 2
+		}
+		return 3
+	}
+	return 4
+}
+
+// sortSubtables sets the order in which subtables are searched from the preference of their encoding records.
+func (t *cmapTable) sortSubtables() {
+	records := append([]cmapEncodingRecord{}, t.EncodingRecords...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].rank() < records[j].rank()
+	})
+
+	t.order = make([]int, 0, len(t.Subtables))
+	seen := make([]bool, len(t.Subtables))
+	for _, record := range records {
+		if !seen[record.Subtable] {
+			seen[record.Subtable] = true
+			t.order = append(t.order, int(record.Subtable))
+		}
+	}
+}
+
 func (sfnt *SFNT) parseCmap() error {
 	// requires data from maxp
 	b, ok := sfnt.Tables["cmap"]
@@ -306,10 +1229,13 @@ func (sfnt *SFNT) parseCmap() error {
 
 	// find and extract subtables and make sure they don't overlap each other
 	offsets, lengths := []uint32{0}, []uint32{4 + 8*uint32(numTables)}
+	subtableIDs, languages := []int{-1}, []uint32{0} // for each offset
 	for j := 0; j < int(numTables); j++ {
 		platformID := r.ReadUint16()
 		encodingID := r.ReadUint16()
-		subtableID := -1
+		subtableID := -1 // remains -1 for unsupported formats
+		var language uint32
+		shared := false
 
 		offset := r.ReadUint32()
 		if uint32(len(b))-8 < offset { // subtable must be at least 8 bytes long to extract length
@@ -335,12 +1261,14 @@ func (sfnt *SFNT) parseCmap() error {
 		} else {
 			return fmt.Errorf("cmap: bad format %d for subtable %d", format, j)
 		}
-		if length < 8 || math.MaxUint32-offset < length {
+		if length < 8 || uint32(len(b))-offset < length {
 			return fmt.Errorf("cmap: bad subtable %d", j)
 		}
 		for i := 0; i < len(offsets); i++ {
 			if offset == offsets[i] && length == lengths[i] {
-				subtableID = int(i)
+				shared = true
+				subtableID = subtableIDs[i]
+				language = languages[i]
 				break
 			} else if offset <= offsets[i] && offsets[i] < offset+length {
 				return fmt.Errorf("cmap: bad subtable %d", j)
@@ -348,17 +1276,13 @@ func (sfnt *SFNT) parseCmap() error {
 		}
 		rs.buf = rs.buf[:length:length]
 
-		if subtableID == -1 {
-			subtableID = len(sfnt.Cmap.Subtables)
-			offsets = append(offsets, offset)
-			lengths = append(lengths, length)
-
+		if !shared {
 			switch format {
 			case 0:
 				if rs.Len() != 258 {
 					return fmt.Errorf("cmap: bad subtable %d", j)
 				}
-				_ = rs.ReadUint16() // languageID
+				language = uint32(rs.ReadUint16())
 
 				subtable := &cmapFormat0{}
 				copy(subtable.GlyphIdArray[:], rs.ReadBytes(256))
@@ -372,7 +1296,7 @@ func (sfnt *SFNT) parseCmap() error {
 				if rs.Len() < 10 {
 					return fmt.Errorf("cmap: bad subtable %d", j)
 				}
-				_ = rs.ReadUint16() // languageID
+				language = uint32(rs.ReadUint16())
 
 				segCount := rs.ReadUint16()
 				if segCount%2 != 0 {
@@ -424,8 +1348,10 @@ func (sfnt *SFNT) parseCmap() error {
 					if idRangeOffset%2 != 0 {
 						return fmt.Errorf("cmap: bad idRangeOffset in subtable %d", j)
 					} else if idRangeOffset != 0 {
-						index := int(idRangeOffset/2) + int(subtable.EndCode[i]-subtable.StartCode[i]) - (int(segCount) - i)
-						if index < 0 || glyphIdArrayLength <= uint32(index) {
+						// the index increases with the rune, so the first and last rune of the segment bound all indices
+						first := int(idRangeOffset/2) - (int(segCount) - i)
+						last := first + int(subtable.EndCode[i]-subtable.StartCode[i])
+						if first < 0 || glyphIdArrayLength <= uint32(last) {
 							return fmt.Errorf("cmap: bad idRangeOffset in subtable %d", j)
 						}
 					}
@@ -444,7 +1370,7 @@ func (sfnt *SFNT) parseCmap() error {
 				if rs.Len() < 6 {
 					return fmt.Errorf("cmap: bad subtable %d", j)
 				}
-				_ = rs.ReadUint16() // language
+				language = uint32(rs.ReadUint16())
 
 				subtable := &cmapFormat6{}
 				subtable.FirstCode = rs.ReadUint16()
@@ -461,7 +1387,7 @@ func (sfnt *SFNT) parseCmap() error {
 				if rs.Len() < 8 {
 					return fmt.Errorf("cmap: bad subtable %d", j)
 				}
-				_ = rs.ReadUint32() // language
+				language = rs.ReadUint32()
 				numGroups := rs.ReadUint32()
 				if MaxCmapSegments < numGroups {
 					return fmt.Errorf("cmap: too many segments in subtable %d", j)
@@ -488,642 +1414,2791 @@ func (sfnt *SFNT) parseCmap() error {
 				}
 				sfnt.Cmap.Subtables = append(sfnt.Cmap.Subtables, subtable)
 			}
+			if format == 0 || format == 4 || format == 6 || format == 12 {
+				subtableID = len(sfnt.Cmap.Subtables) - 1
+			}
+			offsets = append(offsets, offset)
+			lengths = append(lengths, length)
+			subtableIDs = append(subtableIDs, subtableID)
+			languages = append(languages, language)
+		}
+		if subtableID == -1 {
+			continue // unsupported format
 		}
 		sfnt.Cmap.EncodingRecords = append(sfnt.Cmap.EncodingRecords, cmapEncodingRecord{
 			PlatformID: platformID,
 			EncodingID: encodingID,
 			Format:     format,
 			Subtable:   uint16(subtableID),
+			Language:   language,
 		})
 	}
+	sfnt.Cmap.sortSubtables()
 	return nil
 }
 
+// BuildCmap builds a cmap table with a single subtable for the Windows platform that maps the runes to glyph IDs. It uses format 4 when all runes are in the Basic Multilingual Plane and format 12 otherwise, or when the segments do not fit in the 16-bit length of a format 4 subtable.
+func BuildCmap(m map[rune]uint16) ([]byte, error) {
+	runes := make([]rune, 0, len(m))
+	for r := range m {
+		if r < 0 || unicode.MaxRune < r {
+			return nil, fmt.Errorf("cmap: bad rune %v", r)
+		}
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	// group consecutive runes that map to consecutive glyph IDs
+	type cmapGroup struct {
+		start, end rune
+		glyphID    uint16
+	}
+	groups := []cmapGroup{}
+	for _, r := range runes {
+		if 0 < len(groups) {
+			group := &groups[len(groups)-1]
+			if group.end+1 == r && uint32(group.glyphID)+uint32(r-group.start) == uint32(m[r]) {
+				group.end = r
+				continue
+			}
+		}
+		groups = append(groups, cmapGroup{r, r, m[r]})
+	}
+
+	// format 4 requires a last segment that maps 0xFFFF to .notdef
+	numSegments := len(groups)
+	if len(groups) == 0 || groups[len(groups)-1].end != 0xFFFF {
+		numSegments++
+	}
+	format4 := (len(runes) == 0 || runes[len(runes)-1] <= 0xFFFF) && 16+8*numSegments <= math.MaxUint16
+
+	w := newBinaryWriter([]byte{})
+	w.WriteUint16(0) // version
+	w.WriteUint16(1) // numTables
+	w.WriteUint16(3) // platformID
+	if format4 {
+		w.WriteUint16(1)  // encodingID
+		w.WriteUint32(12) // offset
+
+		if numSegments != len(groups) {
+			groups = append(groups, cmapGroup{0xFFFF, 0xFFFF, 0})
+		}
+		segCount := uint16(len(groups))
+		entrySelector := uint16(math.Floor(math.Log2(float64(segCount))))
+		searchRange := 2 * uint16(1<<entrySelector)
+
+		w.WriteUint16(4)                        // format
+		w.WriteUint16(16 + 8*segCount)          // length
+		w.WriteUint16(0)                        // language
+		w.WriteUint16(2 * segCount)             // segCountX2
+		w.WriteUint16(searchRange)              // searchRange
+		w.WriteUint16(entrySelector)            // entrySelector
+		w.WriteUint16(2*segCount - searchRange) // rangeShift
+		for _, group := range groups {
+			w.WriteUint16(uint16(group.end)) // endCode
+		}
+		w.WriteUint16(0) // reservedPad
+		for _, group := range groups {
+			w.WriteUint16(uint16(group.start)) // startCode
+		}
+		for _, group := range groups {
+			w.WriteUint16(group.glyphID - uint16(group.start)) // idDelta, is modulo 65536
+		}
+		for range groups {
+			w.WriteUint16(0) // idRangeOffset
+		}
+	} else {
+		w.WriteUint16(10) // encodingID
+		w.WriteUint32(12) // offset
+
+		if MaxCmapSegments < len(groups) {
+			return nil, fmt.Errorf("cmap: too many segments")
+		}
+		numGroups := uint32(len(groups))
+		w.WriteUint16(12)                // format
+		w.WriteUint16(0)                 // reserved
+		w.WriteUint32(16 + 12*numGroups) // length
+		w.WriteUint32(0)                 // language
+		w.WriteUint32(numGroups)         // numGroups
+		for _, group := range groups {
+			w.WriteUint32(uint32(group.start))   // startCharCode
+			w.WriteUint32(uint32(group.end))     // endCharCode
+			w.WriteUint32(uint32(group.glyphID)) // startGlyphID
+		}
+	}
+	return w.Bytes(), nil
+}
+
 ////////////////////////////////////////////////////////////////
 
-type glyfContour struct {
-	GlyphID                uint16
-	XMin, YMin, XMax, YMax int16
-	EndPoints              []uint16
-	Instructions           []byte
-	OnCurve                []bool
-	XCoordinates           []int16
-	YCoordinates           []int16
+// ColorLayer is a layer of a color glyph, which is the outline of another glyph filled with a premultiplied color. If Foreground is set, the layer must be filled with the text color instead.
+type ColorLayer struct {
+	GlyphID    uint16
+	Color      color.RGBA
+	Foreground bool
 }
 
-func (contour *glyfContour) String() string {
-	var b strings.Builder
-	fmt.Fprintf(&b, "Glyph %v:\n", contour.GlyphID)
-	fmt.Fprintf(&b, "  Contours: %v\n", len(contour.EndPoints))
-	fmt.Fprintf(&b, "  XMin: %v\n", contour.XMin)
-	fmt.Fprintf(&b, "  YMin: %v\n", contour.YMin)
-	fmt.Fprintf(&b, "  XMax: %v\n", contour.XMax)
-	fmt.Fprintf(&b, "  YMax: %v\n", contour.YMax)
-	fmt.Fprintf(&b, "  EndPoints: %v\n", contour.EndPoints)
-	fmt.Fprintf(&b, "  Instruction length: %v\n", len(contour.Instructions))
-	fmt.Fprintf(&b, "  Coordinates:\n")
-	for i := 0; i <= int(contour.EndPoints[len(contour.EndPoints)-1]); i++ {
-		fmt.Fprintf(&b, "    ")
-		if i < len(contour.XCoordinates) {
-			fmt.Fprintf(&b, "%8v", contour.XCoordinates[i])
-		} else {
-			fmt.Fprintf(&b, "  ----  ")
+type colrBaseGlyph struct {
+	GlyphID         uint16
+	FirstLayerIndex uint16
+	NumLayers       uint16
+}
+
+type colrLayer struct {
+	GlyphID      uint16
+	PaletteIndex uint16
+}
+
+type colrTable struct {
+	BaseGlyphs []colrBaseGlyph
+	Layers     []colrLayer
+}
+
+func (colr *colrTable) Get(glyphID uint16) ([]colrLayer, bool) {
+	// binary search
+	i := sort.Search(len(colr.BaseGlyphs), func(i int) bool {
+		return glyphID <= colr.BaseGlyphs[i].GlyphID
+	})
+	if i == len(colr.BaseGlyphs) || colr.BaseGlyphs[i].GlyphID != glyphID {
+		return nil, false
+	}
+	first := int(colr.BaseGlyphs[i].FirstLayerIndex)
+	return colr.Layers[first : first+int(colr.BaseGlyphs[i].NumLayers)], true
+}
+
+func (sfnt *SFNT) parseColr() error {
+	b, ok := sfnt.Tables["COLR"]
+	if !ok {
+		return fmt.Errorf("COLR: missing table")
+	} else if len(b) < 14 {
+		return fmt.Errorf("COLR: bad table")
+	}
+
+	r := newBinaryReader(b)
+	_ = r.ReadUint16() // version, only version 0 records are supported and version 1 is backwards compatible
+	numBaseGlyphRecords := r.ReadUint16()
+	baseGlyphRecordsOffset := r.ReadUint32()
+	layerRecordsOffset := r.ReadUint32()
+	numLayerRecords := r.ReadUint16()
+	if uint32(len(b)) < baseGlyphRecordsOffset+6*uint32(numBaseGlyphRecords) || uint32(len(b)) < layerRecordsOffset+4*uint32(numLayerRecords) {
+		return fmt.Errorf("COLR: bad offsets")
+	}
+
+	sfnt.Colr = &colrTable{
+		BaseGlyphs: make([]colrBaseGlyph, numBaseGlyphRecords),
+		Layers:     make([]colrLayer, numLayerRecords),
+	}
+	r.Seek(baseGlyphRecordsOffset)
+	for i := 0; i < int(numBaseGlyphRecords); i++ {
+		sfnt.Colr.BaseGlyphs[i].GlyphID = r.ReadUint16()
+		sfnt.Colr.BaseGlyphs[i].FirstLayerIndex = r.ReadUint16()
+		sfnt.Colr.BaseGlyphs[i].NumLayers = r.ReadUint16()
+		if 0 < i && sfnt.Colr.BaseGlyphs[i].GlyphID <= sfnt.Colr.BaseGlyphs[i-1].GlyphID {
+			return fmt.Errorf("COLR: bad base glyph order")
+		} else if numLayerRecords < sfnt.Colr.BaseGlyphs[i].FirstLayerIndex || numLayerRecords-sfnt.Colr.BaseGlyphs[i].FirstLayerIndex < sfnt.Colr.BaseGlyphs[i].NumLayers {
+			return fmt.Errorf("COLR: bad layers for base glyph %d", sfnt.Colr.BaseGlyphs[i].GlyphID)
 		}
-		if i < len(contour.YCoordinates) {
-			fmt.Fprintf(&b, " %8v", contour.YCoordinates[i])
-		} else {
-			fmt.Fprintf(&b, "   ----  ")
+	}
+	r.Seek(layerRecordsOffset)
+	for i := 0; i < int(numLayerRecords); i++ {
+		sfnt.Colr.Layers[i].GlyphID = r.ReadUint16()
+		sfnt.Colr.Layers[i].PaletteIndex = r.ReadUint16()
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// GlyphBitmap is an embedded bitmap of a glyph. The origin is the offset in pixels of the lower-left corner of the image relative to the glyph origin, with Y upwards.
+type GlyphBitmap struct {
+	Format           string // such as "png"
+	Data             []byte
+	PPEM             uint16
+	OriginX, OriginY int16
+}
+
+// nearestStrike returns the index of the strike with the pixels-per-em closest to ppem, preferring bigger strikes.
+func nearestStrike(ppems []uint16, ppem uint16) int {
+	best := -1
+	for i, strikePPEM := range ppems {
+		if best == -1 {
+			best = i
+			continue
 		}
-		if i < len(contour.OnCurve) {
-			onCurve := "Off"
-			if contour.OnCurve[i] {
-				onCurve = "On"
-			}
-			fmt.Fprintf(&b, " %3v\n", onCurve)
-		} else {
-			fmt.Fprintf(&b, " ---\n")
+		d := int(strikePPEM) - int(ppem)
+		dBest := int(ppems[best]) - int(ppem)
+		if d < 0 && dBest < 0 && dBest < d || 0 <= d && (dBest < 0 || d < dBest) {
+			best = i
 		}
 	}
-	return b.String()
+	return best
 }
 
-type glyfTable struct {
+type sbixStrike struct {
+	PPEM uint16
+	PPI  uint16
 	data []byte
-	loca *locaTable
 }
 
-func (glyf *glyfTable) Get(glyphID uint16) []byte {
-	if len(glyf.loca.Offsets) <= int(glyphID)+1 {
-		return nil
+type sbixTable struct {
+	numGlyphs uint16
+	Strikes   []sbixStrike
+}
+
+func (sbix *sbixTable) ppems() []uint16 {
+	ppems := make([]uint16, len(sbix.Strikes))
+	for i, strike := range sbix.Strikes {
+		ppems[i] = strike.PPEM
 	}
-	start := glyf.loca.Offsets[glyphID]
-	end := glyf.loca.Offsets[glyphID+1]
-	return glyf.data[start:end]
+	return ppems
 }
 
-func (glyf *glyfTable) Contour(glyphID uint16, level int) (*glyfContour, error) {
-	b := glyf.Get(glyphID)
-	if b == nil {
-		return nil, fmt.Errorf("glyf: bad glyphID %v", glyphID)
-	} else if len(b) == 0 {
-		return nil, nil
+func (sbix *sbixTable) Get(glyphID uint16, ppem uint16) (*GlyphBitmap, bool) {
+	i := nearestStrike(sbix.ppems(), ppem)
+	if i == -1 {
+		return nil, false
 	}
-	r := newBinaryReader(b)
-	if r.Len() < 10 {
-		return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+	return sbix.get(sbix.Strikes[i], glyphID, 0)
+}
+
+func (sbix *sbixTable) get(strike sbixStrike, glyphID uint16, level int) (*GlyphBitmap, bool) {
+	if sbix.numGlyphs <= glyphID || 1 < level {
+		return nil, false
+	}
+	r := newBinaryReader(strike.data)
+	r.Seek(4 + 4*uint32(glyphID))
+	start := r.ReadUint32()
+	end := r.ReadUint32()
+	if r.EOF() || end < start+8 || uint32(len(strike.data)) < end {
+		return nil, false // no glyph data
 	}
 
-	contour := &glyfContour{}
-	contour.GlyphID = glyphID
-	numberOfContours := r.ReadInt16()
-	contour.XMin = r.ReadInt16()
-	contour.YMin = r.ReadInt16()
-	contour.XMax = r.ReadInt16()
-	contour.YMax = r.ReadInt16()
-	if 0 <= numberOfContours {
-		// simple glyph
-		if r.Len() < 2*uint32(numberOfContours)+2 {
-			return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+	r.Seek(start)
+	originX := r.ReadInt16()
+	originY := r.ReadInt16()
+	graphicType := r.ReadString(4)
+	data := r.ReadBytes(end - start - 8)
+	if graphicType == "dupe" {
+		if len(data) < 2 {
+			return nil, false
 		}
-		contour.EndPoints = make([]uint16, numberOfContours)
-		for i := 0; i < int(numberOfContours); i++ {
-			contour.EndPoints[i] = r.ReadUint16()
+		return sbix.get(strike, binary.BigEndian.Uint16(data), level+1)
+	}
+	return &GlyphBitmap{
+		Format:  strings.TrimRight(graphicType, " "),
+		Data:    data,
+		PPEM:    strike.PPEM,
+		OriginX: originX,
+		OriginY: originY,
+	}, true
+}
+
+func (sfnt *SFNT) parseSbix() error {
+	b, ok := sfnt.Tables["sbix"]
+	if !ok {
+		return fmt.Errorf("sbix: missing table")
+	} else if len(b) < 8 {
+		return fmt.Errorf("sbix: bad table")
+	}
+
+	r := newBinaryReader(b)
+	_ = r.ReadUint16() // version
+	_ = r.ReadUint16() // flags
+	numStrikes := r.ReadUint32()
+	if r.Len() < 4*numStrikes {
+		return fmt.Errorf("sbix: bad table")
+	}
+
+	// each strike has a header and numGlyphs+1 offsets
+	strikeHeaderLength := 4 + 4*(uint32(sfnt.Maxp.NumGlyphs)+1)
+	sfnt.Sbix = &sbixTable{
+		numGlyphs: sfnt.Maxp.NumGlyphs,
+		Strikes:   make([]sbixStrike, numStrikes),
+	}
+	for i := 0; i < int(numStrikes); i++ {
+		offset := r.ReadUint32()
+		if uint32(len(b)) < offset || uint32(len(b))-offset < strikeHeaderLength {
+			return fmt.Errorf("sbix: bad offset for strike %d", i)
 		}
+		sfnt.Sbix.Strikes[i].PPEM = binary.BigEndian.Uint16(b[offset:])
+		sfnt.Sbix.Strikes[i].PPI = binary.BigEndian.Uint16(b[offset+2:])
+		sfnt.Sbix.Strikes[i].data = b[offset:]
+	}
+	return nil
+}
 
-		instructionLength := r.ReadUint16()
-		if r.Len() < uint32(instructionLength) {
-			return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+////////////////////////////////////////////////////////////////
+
+type cblcIndexSubTable struct {
+	FirstGlyphIndex, LastGlyphIndex uint16
+	data                            []byte // index subtable starting at its header
+}
+
+type cblcBitmapSize struct {
+	PPEMX, PPEMY uint8
+	SubTables    []cblcIndexSubTable
+}
+
+type cblcTable struct {
+	BitmapSizes []cblcBitmapSize
+}
+
+func (cblc *cblcTable) ppems() []uint16 {
+	ppems := make([]uint16, len(cblc.BitmapSizes))
+	for i, bitmapSize := range cblc.BitmapSizes {
+		ppems[i] = uint16(bitmapSize.PPEMY)
+	}
+	return ppems
+}
+
+func (cblc *cblcTable) Get(cbdt []byte, glyphID uint16, ppem uint16) (*GlyphBitmap, bool) {
+	ppems := cblc.ppems()
+	i := nearestStrike(ppems, ppem)
+	if i == -1 {
+		return nil, false
+	}
+
+	for _, subtable := range cblc.BitmapSizes[i].SubTables {
+		if glyphID < subtable.FirstGlyphIndex || subtable.LastGlyphIndex < glyphID {
+			continue
 		}
-		contour.Instructions = r.ReadBytes(uint32(instructionLength))
+		bitmap, ok := subtable.get(cbdt, glyphID)
+		if ok {
+			bitmap.PPEM = ppems[i]
+		}
+		return bitmap, ok
+	}
+	return nil, false
+}
 
-		numPoints := int(contour.EndPoints[numberOfContours-1]) + 1
-		flags := make([]byte, numPoints)
-		contour.OnCurve = make([]bool, numPoints)
-		for i := 0; i < numPoints; i++ {
-			if r.Len() < 1 {
-				return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
-			}
+func (subtable *cblcIndexSubTable) get(cbdt []byte, glyphID uint16) (*GlyphBitmap, bool) {
+	r := newBinaryReader(subtable.data)
+	indexFormat := r.ReadUint16()
+	imageFormat := r.ReadUint16()
+	imageDataOffset := r.ReadUint32()
 
-			flags[i] = r.ReadByte()
-			contour.OnCurve[i] = flags[i]&0x01 != 0
-			if flags[i]&0x08 != 0 { // REPEAT_FLAG
-				repeat := r.ReadByte()
-				for j := 1; j <= int(repeat); j++ {
-					flags[i+j] = flags[i]
-					contour.OnCurve[i+j] = contour.OnCurve[i]
+	// find the offset and length of the glyph data in CBDT
+	var start, end uint32
+	var metrics []byte // big glyph metrics for all glyphs
+	i := uint32(glyphID - subtable.FirstGlyphIndex)
+	switch indexFormat {
+	case 1:
+		r.Seek(8 + 4*i)
+		start, end = r.ReadUint32(), r.ReadUint32()
+	case 2:
+		imageSize := r.ReadUint32()
+		metrics = r.ReadBytes(8)
+		start, end = i*imageSize, (i+1)*imageSize
+	case 3:
+		r.Seek(8 + 2*i)
+		start, end = uint32(r.ReadUint16()), uint32(r.ReadUint16())
+	case 4, 5:
+		var imageSize, numGlyphs uint32
+		if indexFormat == 5 {
+			imageSize = r.ReadUint32()
+			metrics = r.ReadBytes(8)
+		}
+		numGlyphs = r.ReadUint32()
+		if r.Len() < 4*numGlyphs {
+			return nil, false
+		}
+		found := false
+		for j := uint32(0); j < numGlyphs; j++ {
+			if indexFormat == 4 {
+				id := r.ReadUint16()
+				offset := uint32(r.ReadUint16())
+				if id == glyphID {
+					_ = r.ReadUint16() // next glyphID
+					start, end = offset, uint32(r.ReadUint16())
+					found = true
+					break
 				}
-				i += int(repeat)
+			} else if r.ReadUint16() == glyphID {
+				start, end = j*imageSize, (j+1)*imageSize
+				found = true
+				break
 			}
 		}
+		if !found {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	if r.EOF() || end <= start || uint32(len(cbdt)) < imageDataOffset || uint32(len(cbdt))-imageDataOffset < end {
+		return nil, false
+	}
 
-		var x int16
-		contour.XCoordinates = make([]int16, numPoints)
-		for i := 0; i < numPoints; i++ {
-			xShortVector := flags[i]&0x02 != 0
-			xIsSameOrPositiveXShortVector := flags[i]&0x10 != 0
-			if xShortVector {
-				if r.Len() < 1 {
-					return nil, fmt.Errorf("glyf: bad table or flags for glyphID %v", glyphID)
-				}
-				if xIsSameOrPositiveXShortVector {
-					x += int16(r.ReadUint8())
-				} else {
-					x -= int16(r.ReadUint8())
-				}
-			} else if !xIsSameOrPositiveXShortVector {
-				if r.Len() < 2 {
-					return nil, fmt.Errorf("glyf: bad table or flags for glyphID %v", glyphID)
-				}
-				x += r.ReadInt16()
+	r = newBinaryReader(cbdt[imageDataOffset+start : imageDataOffset+end])
+	switch imageFormat {
+	case 17:
+		metrics = r.ReadBytes(5) // small glyph metrics
+	case 18:
+		metrics = r.ReadBytes(8) // big glyph metrics
+	case 19:
+	default:
+		return nil, false
+	}
+	length := r.ReadUint32()
+	data := r.ReadBytes(length)
+	if r.EOF() || len(metrics) < 5 {
+		return nil, false
+	}
+
+	// glyph metrics start with height, width, bearingX, bearingY where bearingY is the distance from the baseline to the top
+	height := int16(metrics[0])
+	bearingX := int16(int8(metrics[2]))
+	bearingY := int16(int8(metrics[3]))
+	return &GlyphBitmap{
+		Format:  "png",
+		Data:    data,
+		OriginX: bearingX,
+		OriginY: bearingY - height,
+	}, true
+}
+
+func (sfnt *SFNT) parseCblc() error {
+	b, ok := sfnt.Tables["CBLC"]
+	if !ok {
+		return fmt.Errorf("CBLC: missing table")
+	} else if len(b) < 8 {
+		return fmt.Errorf("CBLC: bad table")
+	}
+
+	r := newBinaryReader(b)
+	_ = r.ReadUint16() // majorVersion
+	_ = r.ReadUint16() // minorVersion
+	numSizes := r.ReadUint32()
+	if r.Len() < 48*numSizes {
+		return fmt.Errorf("CBLC: bad table")
+	}
+
+	sfnt.Cblc = &cblcTable{
+		BitmapSizes: make([]cblcBitmapSize, numSizes),
+	}
+	for i := 0; i < int(numSizes); i++ {
+		indexSubTableArrayOffset := r.ReadUint32()
+		_ = r.ReadUint32() // indexTablesSize
+		numberOfIndexSubTables := r.ReadUint32()
+		_ = r.ReadUint32()  // colorRef
+		_ = r.ReadBytes(24) // hori and vert line metrics
+		_ = r.ReadUint16()  // startGlyphIndex
+		_ = r.ReadUint16()  // endGlyphIndex
+		sfnt.Cblc.BitmapSizes[i].PPEMX = r.ReadUint8()
+		sfnt.Cblc.BitmapSizes[i].PPEMY = r.ReadUint8()
+		_ = r.ReadUint8() // bitDepth
+		_ = r.ReadUint8() // flags
+
+		if uint32(len(b)) < indexSubTableArrayOffset || (uint32(len(b))-indexSubTableArrayOffset)/8 < numberOfIndexSubTables {
+			return fmt.Errorf("CBLC: bad index subtables for bitmap size %d", i)
+		}
+		sfnt.Cblc.BitmapSizes[i].SubTables = make([]cblcIndexSubTable, numberOfIndexSubTables)
+		for j := uint32(0); j < numberOfIndexSubTables; j++ {
+			rec := b[indexSubTableArrayOffset+8*j:]
+			subtable := &sfnt.Cblc.BitmapSizes[i].SubTables[j]
+			subtable.FirstGlyphIndex = binary.BigEndian.Uint16(rec)
+			subtable.LastGlyphIndex = binary.BigEndian.Uint16(rec[2:])
+			offset := indexSubTableArrayOffset + binary.BigEndian.Uint32(rec[4:])
+			if subtable.LastGlyphIndex < subtable.FirstGlyphIndex || offset < indexSubTableArrayOffset || uint32(len(b)) < offset || uint32(len(b))-offset < 8 {
+				return fmt.Errorf("CBLC: bad index subtable %d for bitmap size %d", j, i)
 			}
-			contour.XCoordinates[i] = x
+			subtable.data = b[offset:]
 		}
+	}
+	return nil
+}
 
-		var y int16
-		contour.YCoordinates = make([]int16, numPoints)
-		for i := 0; i < numPoints; i++ {
-			yShortVector := flags[i]&0x04 != 0
-			yIsSameOrPositiveYShortVector := flags[i]&0x20 != 0
-			if yShortVector {
-				if r.Len() < 1 {
-					return nil, fmt.Errorf("glyf: bad table or flags for glyphID %v", glyphID)
-				}
-				if yIsSameOrPositiveYShortVector {
-					y += int16(r.ReadUint8())
-				} else {
-					y -= int16(r.ReadUint8())
-				}
-			} else if !yIsSameOrPositiveYShortVector {
-				if r.Len() < 2 {
-					return nil, fmt.Errorf("glyf: bad table or flags for glyphID %v", glyphID)
-				}
-				y += r.ReadInt16()
+////////////////////////////////////////////////////////////////
+
+type cpalTable struct {
+	NumPaletteEntries  uint16
+	ColorRecordIndices []uint16
+	ColorRecords       []color.RGBA
+}
+
+// Get returns the premultiplied color of the entry in the palette.
+func (cpal *cpalTable) Get(palette int, entry uint16) (color.RGBA, bool) {
+	if palette < 0 || len(cpal.ColorRecordIndices) <= palette || cpal.NumPaletteEntries <= entry {
+		return color.RGBA{}, false
+	}
+	i := int(cpal.ColorRecordIndices[palette]) + int(entry)
+	if len(cpal.ColorRecords) <= i {
+		return color.RGBA{}, false
+	}
+	return cpal.ColorRecords[i], true
+}
+
+func (sfnt *SFNT) parseCpal() error {
+	b, ok := sfnt.Tables["CPAL"]
+	if !ok {
+		return fmt.Errorf("CPAL: missing table")
+	} else if len(b) < 12 {
+		return fmt.Errorf("CPAL: bad table")
+	}
+
+	r := newBinaryReader(b)
+	_ = r.ReadUint16() // version, version 1 only adds optional arrays
+	numPaletteEntries := r.ReadUint16()
+	numPalettes := r.ReadUint16()
+	numColorRecords := r.ReadUint16()
+	colorRecordsArrayOffset := r.ReadUint32()
+	if r.Len() < 2*uint32(numPalettes) || uint32(len(b)) < colorRecordsArrayOffset+4*uint32(numColorRecords) {
+		return fmt.Errorf("CPAL: bad table")
+	}
+
+	sfnt.Cpal = &cpalTable{
+		NumPaletteEntries:  numPaletteEntries,
+		ColorRecordIndices: make([]uint16, numPalettes),
+		ColorRecords:       make([]color.RGBA, numColorRecords),
+	}
+	for i := 0; i < int(numPalettes); i++ {
+		sfnt.Cpal.ColorRecordIndices[i] = r.ReadUint16()
+	}
+	r.Seek(colorRecordsArrayOffset)
+	for i := 0; i < int(numColorRecords); i++ {
+		blue := uint32(r.ReadUint8())
+		green := uint32(r.ReadUint8())
+		red := uint32(r.ReadUint8())
+		alpha := uint32(r.ReadUint8())
+		sfnt.Cpal.ColorRecords[i] = color.RGBA{uint8(red * alpha / 255), uint8(green * alpha / 255), uint8(blue * alpha / 255), uint8(alpha)}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+// GlyphClass is the class of a glyph as defined in the GDEF table.
+type GlyphClass uint16
+
+// see GlyphClass
+const (
+	UnclassifiedGlyph GlyphClass = iota
+	BaseGlyph
+	LigatureGlyph
+	MarkGlyph
+	ComponentGlyph
+)
+
+// otClassDef is an OpenType class definition table that maps glyph IDs to classes, glyphs not in the table are of class zero.
+type otClassDef struct {
+	StartGlyphID uint16         // format 1
+	Classes      []uint16       // format 1
+	Ranges       []otClassRange // format 2
+}
+
+type otClassRange struct {
+	Start, End, Class uint16
+}
+
+// Get returns the class of the glyph.
+func (classDef *otClassDef) Get(glyphID uint16) uint16 {
+	if classDef.Ranges == nil {
+		if classDef.StartGlyphID <= glyphID && int(glyphID-classDef.StartGlyphID) < len(classDef.Classes) {
+			return classDef.Classes[glyphID-classDef.StartGlyphID]
+		}
+		return 0
+	}
+	i := sort.Search(len(classDef.Ranges), func(i int) bool { return glyphID <= classDef.Ranges[i].End })
+	if i < len(classDef.Ranges) && classDef.Ranges[i].Start <= glyphID {
+		return classDef.Ranges[i].Class
+	}
+	return 0
+}
+
+func parseOTClassDef(b []byte, offset uint32) (*otClassDef, error) {
+	if uint32(len(b)) < offset {
+		return nil, fmt.Errorf("bad class definition offset")
+	}
+	r := newBinaryReader(b[offset:])
+	format := r.ReadUint16()
+	classDef := &otClassDef{}
+	if format == 1 {
+		classDef.StartGlyphID = r.ReadUint16()
+		glyphCount := r.ReadUint16()
+		if r.Len() < 2*uint32(glyphCount) {
+			return nil, fmt.Errorf("bad class definition")
+		}
+		classDef.Classes = make([]uint16, glyphCount)
+		for i := 0; i < int(glyphCount); i++ {
+			classDef.Classes[i] = r.ReadUint16()
+		}
+	} else if format == 2 {
+		classRangeCount := r.ReadUint16()
+		if r.Len() < 6*uint32(classRangeCount) {
+			return nil, fmt.Errorf("bad class definition")
+		}
+		classDef.Ranges = make([]otClassRange, classRangeCount)
+		for i := 0; i < int(classRangeCount); i++ {
+			classDef.Ranges[i].Start = r.ReadUint16()
+			classDef.Ranges[i].End = r.ReadUint16()
+			classDef.Ranges[i].Class = r.ReadUint16()
+			if classDef.Ranges[i].End < classDef.Ranges[i].Start || 0 < i && classDef.Ranges[i].Start <= classDef.Ranges[i-1].End {
+				return nil, fmt.Errorf("bad class definition")
 			}
-			contour.YCoordinates[i] = y
 		}
 	} else {
-		if 7 < level {
-			return nil, fmt.Errorf("glyf: compound glyphs too deeply nested")
-		}
+		return nil, fmt.Errorf("bad class definition format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad class definition")
+	}
+	return classDef, nil
+}
 
-		// composite glyph
-		for {
-			if r.Len() < 4 {
-				return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
-			}
+type gdefTable struct {
+	GlyphClassDef      *otClassDef
+	MarkAttachClassDef *otClassDef
+	LigCaretCoverage   *otCoverage
+	LigCarets          [][]int16 // per ligature glyph in coverage order, in font units
+}
 
-			flags := r.ReadUint16()
-			subGlyphID := r.ReadUint16()
-			if flags&0x0002 == 0 { // ARGS_ARE_XY_VALUES
-				return nil, fmt.Errorf("glyf: composite glyph not supported")
-			}
-			var dx, dy int16
-			if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
-				if r.Len() < 4 {
-					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
-				}
-				dx = r.ReadInt16()
-				dy = r.ReadInt16()
-			} else {
-				if r.Len() < 2 {
-					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
-				}
-				dx = int16(r.ReadInt8())
-				dy = int16(r.ReadInt8())
+// GlyphClass returns the glyph class, or UnclassifiedGlyph if the font has no glyph class definition.
+func (gdef *gdefTable) GlyphClass(glyphID uint16) GlyphClass {
+	if gdef.GlyphClassDef == nil {
+		return UnclassifiedGlyph
+	}
+	return GlyphClass(gdef.GlyphClassDef.Get(glyphID))
+}
+
+// MarkAttachClass returns the mark attachment class of a mark glyph, which lookups use to filter marks, or zero if it has none.
+func (gdef *gdefTable) MarkAttachClass(glyphID uint16) uint16 {
+	if gdef.MarkAttachClassDef == nil {
+		return 0
+	}
+	return gdef.MarkAttachClassDef.Get(glyphID)
+}
+
+// LigatureCarets returns the caret positions in font units between the components of a ligature glyph, or false if the font defines none.
+func (gdef *gdefTable) LigatureCarets(glyphID uint16) ([]int16, bool) {
+	if gdef.LigCaretCoverage == nil {
+		return nil, false
+	}
+	i, ok := gdef.LigCaretCoverage.Index(glyphID)
+	if !ok || len(gdef.LigCarets) <= i {
+		return nil, false
+	}
+	return gdef.LigCarets[i], true
+}
+
+func (sfnt *SFNT) parseGDEF() error {
+	b, ok := sfnt.Tables["GDEF"]
+	if !ok {
+		return fmt.Errorf("GDEF: missing table")
+	} else if len(b) < 12 {
+		return fmt.Errorf("GDEF: bad table")
+	}
+
+	r := newBinaryReader(b)
+	if majorVersion := r.ReadUint16(); majorVersion != 1 {
+		return fmt.Errorf("GDEF: bad version")
+	}
+	_ = r.ReadUint16() // minorVersion
+	glyphClassDefOffset := uint32(r.ReadUint16())
+	_ = r.ReadUint16() // attachListOffset
+	ligCaretListOffset := uint32(r.ReadUint16())
+	markAttachClassDefOffset := uint32(r.ReadUint16())
+
+	var err error
+	sfnt.Gdef = &gdefTable{}
+	if glyphClassDefOffset != 0 {
+		if sfnt.Gdef.GlyphClassDef, err = parseOTClassDef(b, glyphClassDefOffset); err != nil {
+			return fmt.Errorf("GDEF: %v", err)
+		}
+	}
+	if markAttachClassDefOffset != 0 {
+		if sfnt.Gdef.MarkAttachClassDef, err = parseOTClassDef(b, markAttachClassDefOffset); err != nil {
+			return fmt.Errorf("GDEF: %v", err)
+		}
+	}
+	if ligCaretListOffset != 0 {
+		if uint32(len(b)) < ligCaretListOffset+4 {
+			return fmt.Errorf("GDEF: bad ligature caret list")
+		}
+		bl := b[ligCaretListOffset:]
+		r = newBinaryReader(bl)
+		coverageOffset := uint32(r.ReadUint16())
+		if sfnt.Gdef.LigCaretCoverage, err = parseOTCoverage(bl, coverageOffset); err != nil {
+			return fmt.Errorf("GDEF: %v", err)
+		}
+
+		ligGlyphCount := r.ReadUint16()
+		if r.Len() < 2*uint32(ligGlyphCount) {
+			return fmt.Errorf("GDEF: bad ligature caret list")
+		}
+		sfnt.Gdef.LigCarets = make([][]int16, ligGlyphCount)
+		for j := 0; j < int(ligGlyphCount); j++ {
+			ligGlyphOffset := uint32(r.ReadUint16())
+			if uint32(len(bl)) < ligGlyphOffset {
+				return fmt.Errorf("GDEF: bad ligature glyph %d", j)
 			}
-			var txx, txy, tyx, tyy int16
-			if flags&0x0008 != 0 { // WE_HAVE_A_SCALE
-				if r.Len() < 2 {
-					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
-				}
-				txx = r.ReadInt16()
-				tyy = txx
-			} else if flags&0x0040 != 0 { // WE_HAVE_AN_X_AND_Y_SCALE
-				if r.Len() < 4 {
-					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+			rg := newBinaryReader(bl[ligGlyphOffset:])
+			caretCount := rg.ReadUint16()
+			carets := make([]int16, 0, caretCount)
+			for i := 0; i < int(caretCount); i++ {
+				caretValueOffset := ligGlyphOffset + uint32(rg.ReadUint16())
+				if rg.EOF() || uint32(len(bl)) < caretValueOffset {
+					return fmt.Errorf("GDEF: bad ligature glyph %d", j)
 				}
-				txx = r.ReadInt16()
-				tyy = r.ReadInt16()
-			} else if flags&0x0080 != 0 { // WE_HAVE_A_TWO_BY_TWO
-				if r.Len() < 8 {
-					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+				rc := newBinaryReader(bl[caretValueOffset:])
+				format := rc.ReadUint16()
+				coordinate := rc.ReadInt16()
+				if rc.EOF() || format < 1 || 3 < format {
+					return fmt.Errorf("GDEF: bad caret value for ligature glyph %d", j)
+				} else if format == 2 {
+					// TODO: support caret values by contour point
+					continue
 				}
-				txx = r.ReadInt16()
-				txy = r.ReadInt16()
-				tyx = r.ReadInt16()
-				tyy = r.ReadInt16()
+				carets = append(carets, coordinate)
 			}
+			sfnt.Gdef.LigCarets[j] = carets
+		}
+	}
+	return nil
+}
 
-			subContour, err := glyf.Contour(subGlyphID, level+1)
-			if err != nil {
-				return nil, err
-			}
+////////////////////////////////////////////////////////////////
 
-			var numPoints uint16
-			if 0 < len(contour.EndPoints) {
-				numPoints = contour.EndPoints[len(contour.EndPoints)-1] + 1
+// otCoverage is an OpenType coverage table that maps glyph IDs to coverage indices.
+type otCoverage struct {
+	GlyphIDs []uint16          // format 1
+	Ranges   []otCoverageRange // format 2
+}
+
+type otCoverageRange struct {
+	Start, End, StartIndex uint16
+}
+
+// Index returns the coverage index of the glyph, or false if the glyph is not covered.
+func (coverage *otCoverage) Index(glyphID uint16) (int, bool) {
+	if coverage.Ranges == nil {
+		i := sort.Search(len(coverage.GlyphIDs), func(i int) bool { return glyphID <= coverage.GlyphIDs[i] })
+		if i < len(coverage.GlyphIDs) && coverage.GlyphIDs[i] == glyphID {
+			return i, true
+		}
+		return 0, false
+	}
+	i := sort.Search(len(coverage.Ranges), func(i int) bool { return glyphID <= coverage.Ranges[i].End })
+	if i < len(coverage.Ranges) && coverage.Ranges[i].Start <= glyphID {
+		return int(coverage.Ranges[i].StartIndex) + int(glyphID-coverage.Ranges[i].Start), true
+	}
+	return 0, false
+}
+
+func parseOTCoverage(b []byte, offset uint32) (*otCoverage, error) {
+	if uint32(len(b)) < offset {
+		return nil, fmt.Errorf("bad coverage offset")
+	}
+	r := newBinaryReader(b[offset:])
+	format := r.ReadUint16()
+	count := r.ReadUint16()
+	coverage := &otCoverage{}
+	if format == 1 {
+		coverage.GlyphIDs = make([]uint16, count)
+		for i := 0; i < int(count); i++ {
+			coverage.GlyphIDs[i] = r.ReadUint16()
+			if 0 < i && coverage.GlyphIDs[i] <= coverage.GlyphIDs[i-1] {
+				return nil, fmt.Errorf("bad coverage")
 			}
-			for i := 0; i < len(subContour.EndPoints); i++ {
-				contour.EndPoints = append(contour.EndPoints, numPoints+subContour.EndPoints[i])
+		}
+	} else if format == 2 {
+		coverage.Ranges = make([]otCoverageRange, count)
+		for i := 0; i < int(count); i++ {
+			coverage.Ranges[i].Start = r.ReadUint16()
+			coverage.Ranges[i].End = r.ReadUint16()
+			coverage.Ranges[i].StartIndex = r.ReadUint16()
+			if coverage.Ranges[i].End < coverage.Ranges[i].Start || 0 < i && coverage.Ranges[i].Start <= coverage.Ranges[i-1].End {
+				return nil, fmt.Errorf("bad coverage")
 			}
-			contour.OnCurve = append(contour.OnCurve, subContour.OnCurve...)
-			for i := 0; i < len(subContour.XCoordinates); i++ {
-				x := subContour.XCoordinates[i]
-				y := subContour.YCoordinates[i]
-				if flags&0x00C8 != 0 { // has transformation
-					const half = 1 << 13
-					xt := int16((int64(x)*int64(txx)+half)>>14) + int16((int64(y)*int64(tyx)+half)>>14)
-					yt := int16((int64(x)*int64(txy)+half)>>14) + int16((int64(y)*int64(tyy)+half)>>14)
-					x, y = xt, yt
-				}
-				contour.XCoordinates = append(contour.XCoordinates, dx+x)
-				contour.YCoordinates = append(contour.YCoordinates, dy+y)
+		}
+	} else {
+		return nil, fmt.Errorf("bad coverage format")
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad coverage")
+	}
+	return coverage, nil
+}
+
+// otAnchor is an OpenType anchor point in font units, the contour point and device adjustments of formats 2 and 3 are ignored.
+type otAnchor struct {
+	X, Y int16
+}
+
+func parseOTAnchor(b []byte, offset uint32) (otAnchor, error) {
+	if uint32(len(b)) < offset {
+		return otAnchor{}, fmt.Errorf("bad anchor offset")
+	}
+	r := newBinaryReader(b[offset:])
+	if format := r.ReadUint16(); format < 1 || 3 < format {
+		return otAnchor{}, fmt.Errorf("bad anchor format")
+	}
+	anchor := otAnchor{r.ReadInt16(), r.ReadInt16()}
+	if r.EOF() {
+		return otAnchor{}, fmt.Errorf("bad anchor")
+	}
+	return anchor, nil
+}
+
+type gposMarkRecord struct {
+	Class  uint16
+	Anchor otAnchor
+}
+
+// gposMarkMarkPos is a mark-to-mark attachment subtable (LookupType 6), where Mark1 is the attaching mark and Mark2 the preceding mark it attaches to.
+type gposMarkMarkPos struct {
+	Mark1Coverage *otCoverage
+	Mark2Coverage *otCoverage
+	Mark1Records  []gposMarkRecord
+	Mark2Anchors  [][]*otAnchor // per mark class, nil if the mark has no anchor for the class
+}
+
+type gposTable struct {
+	PairPos     [][]gposPairPos // per lookup of the kern feature
+	MarkMarkPos []gposMarkMarkPos
+}
+
+// Kerning returns the horizontal advance adjustment in font units of the left glyph when followed by the right glyph, summed over the lookups of the kern feature of the default script, where in each lookup the first subtable that covers the pair applies. It returns false if no lookup covers the pair.
+func (gpos *gposTable) Kerning(left, right uint16) (int16, bool) {
+	var kern int16
+	found := false
+	for _, lookup := range gpos.PairPos {
+		for _, subtable := range lookup {
+			if k, ok := subtable.Get(left, right); ok {
+				kern += k
+				found = true
+				break
 			}
-			if flags&0x0020 == 0 { // MORE_COMPONENTS
+		}
+	}
+	return kern, found
+}
+
+// MarkToMark returns the offset in font units of the origin of mark relative to the origin of prevMark when mark is attached on top of prevMark, or false if the font has no mark-to-mark attachment for the pair.
+func (gpos *gposTable) MarkToMark(prevMark, mark uint16) (int16, int16, bool) {
+	for _, subtable := range gpos.MarkMarkPos {
+		i, ok := subtable.Mark1Coverage.Index(mark)
+		if !ok || len(subtable.Mark1Records) <= i {
+			continue
+		}
+		j, ok := subtable.Mark2Coverage.Index(prevMark)
+		if !ok || len(subtable.Mark2Anchors) <= j {
+			continue
+		}
+		record := subtable.Mark1Records[i]
+		if int(record.Class) < len(subtable.Mark2Anchors[j]) && subtable.Mark2Anchors[j][record.Class] != nil {
+			anchor := subtable.Mark2Anchors[j][record.Class]
+			return anchor.X - record.Anchor.X, anchor.Y - record.Anchor.Y, true
+		}
+	}
+	return 0, 0, false
+}
+
+// parseOTDefaultFeatures returns the feature indices of the default language system of the DFLT script, or else the latn script, or else the first script. It returns nil if there is no script list.
+func parseOTDefaultFeatures(b []byte, scriptListOffset uint32) (map[uint16]bool, error) {
+	if scriptListOffset == 0 {
+		return nil, nil
+	} else if uint32(len(b)) < scriptListOffset+2 {
+		return nil, fmt.Errorf("bad script list")
+	}
+
+	r := newBinaryReader(b[scriptListOffset:])
+	scriptCount := r.ReadUint16()
+	scriptOffset := uint32(0)
+	for j := 0; j < int(scriptCount); j++ {
+		tag := r.ReadString(4)
+		offset := scriptListOffset + uint32(r.ReadUint16())
+		if r.EOF() {
+			return nil, fmt.Errorf("bad script list")
+		} else if j == 0 || tag == "DFLT" || tag == "latn" {
+			scriptOffset = offset
+			if tag == "DFLT" {
 				break
 			}
 		}
 	}
-	return contour, nil
+
+	features := map[uint16]bool{}
+	if scriptOffset == 0 {
+		return features, nil
+	} else if uint32(len(b)) < scriptOffset+2 {
+		return nil, fmt.Errorf("bad script")
+	}
+	defaultLangSysOffset := uint32(newBinaryReader(b[scriptOffset:]).ReadUint16())
+	if defaultLangSysOffset == 0 {
+		return features, nil
+	} else if uint32(len(b)) < scriptOffset+defaultLangSysOffset+6 {
+		return nil, fmt.Errorf("bad language system")
+	}
+	r = newBinaryReader(b[scriptOffset+defaultLangSysOffset:])
+	_ = r.ReadUint16() // lookupOrderOffset
+	if requiredFeatureIndex := r.ReadUint16(); requiredFeatureIndex != 0xFFFF {
+		features[requiredFeatureIndex] = true
+	}
+	featureIndexCount := r.ReadUint16()
+	for i := 0; i < int(featureIndexCount); i++ {
+		features[r.ReadUint16()] = true
+	}
+	if r.EOF() {
+		return nil, fmt.Errorf("bad language system")
+	}
+	return features, nil
+}
+
+func (sfnt *SFNT) parseGPOS() error {
+	b, ok := sfnt.Tables["GPOS"]
+	if !ok {
+		return fmt.Errorf("GPOS: missing table")
+	} else if len(b) < 10 {
+		return fmt.Errorf("GPOS: bad table")
+	}
+
+	r := newBinaryReader(b)
+	if majorVersion := r.ReadUint16(); majorVersion != 1 {
+		return fmt.Errorf("GPOS: bad version")
+	}
+	_ = r.ReadUint16() // minorVersion
+	scriptListOffset := uint32(r.ReadUint16())
+	featureListOffset := uint32(r.ReadUint16())
+	lookupListOffset := uint32(r.ReadUint16())
+	if uint32(len(b)) < featureListOffset+2 {
+		return fmt.Errorf("GPOS: bad feature list")
+	} else if uint32(len(b)) < lookupListOffset+2 {
+		return fmt.Errorf("GPOS: bad lookup list")
+	}
+
+	// find the lookups of the kern feature of the default script, so that pairs are not kerned once per script
+	features, err := parseOTDefaultFeatures(b, scriptListOffset)
+	if err != nil {
+		return fmt.Errorf("GPOS: %v", err)
+	}
+	kernLookups := map[uint16]bool{}
+	r = newBinaryReader(b[featureListOffset:])
+	featureCount := r.ReadUint16()
+	for j := 0; j < int(featureCount); j++ {
+		tag := r.ReadString(4)
+		featureOffset := featureListOffset + uint32(r.ReadUint16())
+		if r.EOF() || uint32(len(b)) < featureOffset+4 {
+			return fmt.Errorf("GPOS: bad feature %d", j)
+		} else if tag != "kern" || features != nil && !features[uint16(j)] {
+			continue
+		}
+		rf := newBinaryReader(b[featureOffset:])
+		_ = rf.ReadUint16() // featureParamsOffset
+		lookupIndexCount := rf.ReadUint16()
+		for i := 0; i < int(lookupIndexCount); i++ {
+			kernLookups[rf.ReadUint16()] = true
+		}
+		if rf.EOF() {
+			return fmt.Errorf("GPOS: bad feature %d", j)
+		}
+	}
+
+	sfnt.Gpos = &gposTable{}
+	r = newBinaryReader(b[lookupListOffset:])
+	lookupCount := r.ReadUint16()
+	for j := 0; j < int(lookupCount); j++ {
+		lookupOffset := lookupListOffset + uint32(r.ReadUint16())
+		if r.EOF() {
+			return fmt.Errorf("GPOS: bad lookup list")
+		} else if uint32(len(b)) < lookupOffset {
+			continue // skip bad lookups
+		}
+
+		rl := newBinaryReader(b[lookupOffset:])
+		lookupType := rl.ReadUint16()
+		_ = rl.ReadUint16() // lookupFlag
+		subtableCount := rl.ReadUint16()
+		var pairPos []gposPairPos
+		for i := 0; i < int(subtableCount); i++ {
+			subtableOffset := lookupOffset + uint32(rl.ReadUint16())
+			if rl.EOF() {
+				break
+			} else if uint32(len(b)) < subtableOffset {
+				continue // skip bad subtables
+			}
+
+			subtableType := lookupType
+			if lookupType == 9 {
+				// extension positioning
+				rs := newBinaryReader(b[subtableOffset:])
+				_ = rs.ReadUint16() // posFormat
+				subtableType = rs.ReadUint16()
+				extensionOffset := rs.ReadUint32()
+				if rs.EOF() || uint32(len(b))-subtableOffset < extensionOffset {
+					continue
+				}
+				subtableOffset += extensionOffset
+			}
+			if subtableType == 2 && kernLookups[uint16(j)] {
+				if subtable, err := parseGPOSPairPos(b[subtableOffset:]); err == nil {
+					pairPos = append(pairPos, subtable)
+				}
+			} else if subtableType == 6 {
+				if subtable, err := parseGPOSMarkMarkPos(b[subtableOffset:]); err == nil {
+					sfnt.Gpos.MarkMarkPos = append(sfnt.Gpos.MarkMarkPos, subtable)
+				}
+			}
+			// TODO: support other GPOS lookup types
+		}
+		if pairPos != nil {
+			sfnt.Gpos.PairPos = append(sfnt.Gpos.PairPos, pairPos)
+		}
+	}
+	return nil
+}
+
+// gposPairPos is a pair adjustment subtable (LookupType 2), of which only the horizontal advance adjustment of the first glyph is kept.
+type gposPairPos struct {
+	Coverage *otCoverage
+
+	// format 1, sorted second glyphs and their advance adjustments per covered first glyph
+	SecondGlyphs [][]uint16
+	XAdvances    [][]int16
+
+	// format 2, advance adjustments per first and second class
+	ClassDef1, ClassDef2 *otClassDef
+	Class2Count          uint16
+	ClassXAdvances       []int16
+}
+
+// Get returns the horizontal advance adjustment of the left glyph, or false if the subtable does not cover the pair.
+func (subtable *gposPairPos) Get(left, right uint16) (int16, bool) {
+	i, ok := subtable.Coverage.Index(left)
+	if !ok {
+		return 0, false
+	}
+	if subtable.ClassDef1 == nil {
+		if len(subtable.SecondGlyphs) <= i {
+			return 0, false
+		}
+		secondGlyphs := subtable.SecondGlyphs[i]
+		j := sort.Search(len(secondGlyphs), func(j int) bool { return right <= secondGlyphs[j] })
+		if j < len(secondGlyphs) && secondGlyphs[j] == right {
+			return subtable.XAdvances[i][j], true
+		}
+		return 0, false
+	}
+	class1 := uint32(subtable.ClassDef1.Get(left))
+	class2 := uint32(subtable.ClassDef2.Get(right))
+	if class2 < uint32(subtable.Class2Count) {
+		if k := class1*uint32(subtable.Class2Count) + class2; k < uint32(len(subtable.ClassXAdvances)) {
+			return subtable.ClassXAdvances[k], true
+		}
+	}
+	return 0, false
+}
+
+// gposValueRecordSize returns the size in bytes of a value record with the given value format.
+func gposValueRecordSize(valueFormat uint16) uint32 {
+	return 2 * uint32(bits.OnesCount16(valueFormat&0x00FF))
+}
+
+// readGPOSValueRecordXAdvance reads a value record and returns its horizontal advance adjustment.
+func readGPOSValueRecordXAdvance(r *binaryReader, valueFormat uint16) int16 {
+	var xAdvance int16
+	for bit := uint16(0x0001); bit <= 0x0080; bit <<= 1 {
+		if valueFormat&bit != 0 {
+			v := r.ReadInt16()
+			if bit == 0x0004 { // X_ADVANCE
+				xAdvance = v
+			}
+		}
+	}
+	return xAdvance
+}
+
+func parseGPOSPairPos(b []byte) (gposPairPos, error) {
+	subtable := gposPairPos{}
+	r := newBinaryReader(b)
+	posFormat := r.ReadUint16()
+	coverageOffset := uint32(r.ReadUint16())
+	valueFormat1 := r.ReadUint16()
+	valueFormat2 := r.ReadUint16()
+	if r.EOF() {
+		return subtable, fmt.Errorf("bad pair adjustment subtable")
+	}
+
+	var err error
+	if subtable.Coverage, err = parseOTCoverage(b, coverageOffset); err != nil {
+		return subtable, err
+	}
+	recordSize := gposValueRecordSize(valueFormat1) + gposValueRecordSize(valueFormat2)
+	if posFormat == 1 {
+		pairSetCount := r.ReadUint16()
+		if r.Len() < 2*uint32(pairSetCount) {
+			return subtable, fmt.Errorf("bad pair adjustment subtable")
+		}
+		subtable.SecondGlyphs = make([][]uint16, pairSetCount)
+		subtable.XAdvances = make([][]int16, pairSetCount)
+		for i := 0; i < int(pairSetCount); i++ {
+			pairSetOffset := uint32(r.ReadUint16())
+			if uint32(len(b)) < pairSetOffset+2 {
+				return subtable, fmt.Errorf("bad pair set")
+			}
+			rp := newBinaryReader(b[pairSetOffset:])
+			pairValueCount := rp.ReadUint16()
+			if rp.Len() < uint32(pairValueCount)*(2+recordSize) {
+				return subtable, fmt.Errorf("bad pair set")
+			}
+			subtable.SecondGlyphs[i] = make([]uint16, pairValueCount)
+			subtable.XAdvances[i] = make([]int16, pairValueCount)
+			for j := 0; j < int(pairValueCount); j++ {
+				subtable.SecondGlyphs[i][j] = rp.ReadUint16()
+				if 0 < j && subtable.SecondGlyphs[i][j] <= subtable.SecondGlyphs[i][j-1] {
+					return subtable, fmt.Errorf("bad pair set")
+				}
+				subtable.XAdvances[i][j] = readGPOSValueRecordXAdvance(rp, valueFormat1)
+				_ = rp.ReadBytes(gposValueRecordSize(valueFormat2))
+			}
+		}
+	} else if posFormat == 2 {
+		classDef1Offset := uint32(r.ReadUint16())
+		classDef2Offset := uint32(r.ReadUint16())
+		class1Count := r.ReadUint16()
+		subtable.Class2Count = r.ReadUint16()
+		if r.EOF() || r.Len() < uint32(class1Count)*uint32(subtable.Class2Count)*recordSize {
+			return subtable, fmt.Errorf("bad pair adjustment subtable")
+		}
+		if subtable.ClassDef1, err = parseOTClassDef(b, classDef1Offset); err != nil {
+			return subtable, err
+		} else if subtable.ClassDef2, err = parseOTClassDef(b, classDef2Offset); err != nil {
+			return subtable, err
+		}
+		subtable.ClassXAdvances = make([]int16, uint32(class1Count)*uint32(subtable.Class2Count))
+		for k := range subtable.ClassXAdvances {
+			subtable.ClassXAdvances[k] = readGPOSValueRecordXAdvance(r, valueFormat1)
+			_ = r.ReadBytes(gposValueRecordSize(valueFormat2))
+		}
+	} else {
+		return subtable, fmt.Errorf("bad pair adjustment format")
+	}
+	return subtable, nil
+}
+
+func parseGPOSMarkMarkPos(b []byte) (gposMarkMarkPos, error) {
+	subtable := gposMarkMarkPos{}
+	r := newBinaryReader(b)
+	if posFormat := r.ReadUint16(); posFormat != 1 {
+		return subtable, fmt.Errorf("bad mark-to-mark format")
+	}
+	mark1CoverageOffset := uint32(r.ReadUint16())
+	mark2CoverageOffset := uint32(r.ReadUint16())
+	markClassCount := r.ReadUint16()
+	mark1ArrayOffset := uint32(r.ReadUint16())
+	mark2ArrayOffset := uint32(r.ReadUint16())
+	if r.EOF() || uint32(len(b)) < mark1ArrayOffset || uint32(len(b)) < mark2ArrayOffset {
+		return subtable, fmt.Errorf("bad mark-to-mark subtable")
+	}
+
+	var err error
+	if subtable.Mark1Coverage, err = parseOTCoverage(b, mark1CoverageOffset); err != nil {
+		return subtable, err
+	} else if subtable.Mark2Coverage, err = parseOTCoverage(b, mark2CoverageOffset); err != nil {
+		return subtable, err
+	}
+
+	// mark1 array
+	b1 := b[mark1ArrayOffset:]
+	r = newBinaryReader(b1)
+	markCount := r.ReadUint16()
+	subtable.Mark1Records = make([]gposMarkRecord, markCount)
+	for i := 0; i < int(markCount); i++ {
+		subtable.Mark1Records[i].Class = r.ReadUint16()
+		anchorOffset := uint32(r.ReadUint16())
+		if r.EOF() || markClassCount <= subtable.Mark1Records[i].Class {
+			return subtable, fmt.Errorf("bad mark record")
+		} else if subtable.Mark1Records[i].Anchor, err = parseOTAnchor(b1, anchorOffset); err != nil {
+			return subtable, err
+		}
+	}
+
+	// mark2 array
+	b2 := b[mark2ArrayOffset:]
+	r = newBinaryReader(b2)
+	mark2Count := r.ReadUint16()
+	if uint32(len(b2)) < 2+2*uint32(mark2Count)*uint32(markClassCount) {
+		return subtable, fmt.Errorf("bad mark2 array")
+	}
+	subtable.Mark2Anchors = make([][]*otAnchor, mark2Count)
+	for i := 0; i < int(mark2Count); i++ {
+		subtable.Mark2Anchors[i] = make([]*otAnchor, markClassCount)
+		for k := 0; k < int(markClassCount); k++ {
+			if anchorOffset := uint32(r.ReadUint16()); anchorOffset != 0 {
+				anchor, err := parseOTAnchor(b2, anchorOffset)
+				if err != nil {
+					return subtable, err
+				}
+				subtable.Mark2Anchors[i][k] = &anchor
+			}
+		}
+	}
+	return subtable, nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type glyfContour struct {
+	GlyphID                uint16
+	XMin, YMin, XMax, YMax int16
+	EndPoints              []uint16
+	Instructions           []byte
+	OnCurve                []bool
+	XCoordinates           []int16
+	YCoordinates           []int16
+}
+
+func (contour *glyfContour) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Glyph %v:\n", contour.GlyphID)
+	fmt.Fprintf(&b, "  Contours: %v\n", len(contour.EndPoints))
+	fmt.Fprintf(&b, "  XMin: %v\n", contour.XMin)
+	fmt.Fprintf(&b, "  YMin: %v\n", contour.YMin)
+	fmt.Fprintf(&b, "  XMax: %v\n", contour.XMax)
+	fmt.Fprintf(&b, "  YMax: %v\n", contour.YMax)
+	fmt.Fprintf(&b, "  EndPoints: %v\n", contour.EndPoints)
+	fmt.Fprintf(&b, "  Instruction length: %v\n", len(contour.Instructions))
+	fmt.Fprintf(&b, "  Coordinates:\n")
+	if len(contour.EndPoints) == 0 {
+		return b.String()
+	}
+	for i := 0; i <= int(contour.EndPoints[len(contour.EndPoints)-1]); i++ {
+		fmt.Fprintf(&b, "    ")
+		if i < len(contour.XCoordinates) {
+			fmt.Fprintf(&b, "%8v", contour.XCoordinates[i])
+		} else {
+			fmt.Fprintf(&b, "  ----  ")
+		}
+		if i < len(contour.YCoordinates) {
+			fmt.Fprintf(&b, " %8v", contour.YCoordinates[i])
+		} else {
+			fmt.Fprintf(&b, "   ----  ")
+		}
+		if i < len(contour.OnCurve) {
+			onCurve := "Off"
+			if contour.OnCurve[i] {
+				onCurve = "On"
+			}
+			fmt.Fprintf(&b, " %3v\n", onCurve)
+		} else {
+			fmt.Fprintf(&b, " ---\n")
+		}
+	}
+	return b.String()
+}
+
+type glyfTable struct {
+	data          []byte
+	loca          *locaTable
+	maxComponents int // zero means no limit
+}
+
+func (glyf *glyfTable) Get(glyphID uint16) ([]byte, error) {
+	if glyf == nil {
+		return nil, fmt.Errorf("glyf: outlines not loaded")
+	} else if len(glyf.loca.Offsets) <= int(glyphID)+1 {
+		return nil, fmt.Errorf("glyf: bad glyphID %v", glyphID)
+	}
+	start := glyf.loca.Offsets[glyphID]
+	end := glyf.loca.Offsets[glyphID+1]
+	if end < start || uint32(len(glyf.data)) < end {
+		return nil, fmt.Errorf("glyf: bad offsets for glyphID %v", glyphID)
+	}
+	return glyf.data[start:end], nil
+}
+
+// Bounds returns the bounding box of the glyph as stored in its header, or false if the glyph is empty or malformed.
+func (glyf *glyfTable) Bounds(glyphID uint16) (int16, int16, int16, int16, bool) {
+	b, err := glyf.Get(glyphID)
+	if err != nil || len(b) < 10 {
+		return 0, 0, 0, 0, false
+	}
+	r := newBinaryReader(b[2:10])
+	return r.ReadInt16(), r.ReadInt16(), r.ReadInt16(), r.ReadInt16(), true
+}
+
+func (glyf *glyfTable) Contour(glyphID uint16, level int) (*glyfContour, error) {
+	components := 0
+	return glyf.contour(glyphID, level, &components)
+}
+
+// contour assembles the glyph, where components counts the components of composite glyphs over all levels.
+func (glyf *glyfTable) contour(glyphID uint16, level int, components *int) (*glyfContour, error) {
+	b, err := glyf.Get(glyphID)
+	if err != nil {
+		return nil, err
+	} else if len(b) == 0 {
+		return nil, nil
+	}
+	r := newBinaryReader(b)
+	if r.Len() < 10 {
+		return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+	}
+
+	contour := &glyfContour{}
+	contour.GlyphID = glyphID
+	numberOfContours := r.ReadInt16()
+	contour.XMin = r.ReadInt16()
+	contour.YMin = r.ReadInt16()
+	contour.XMax = r.ReadInt16()
+	contour.YMax = r.ReadInt16()
+	if 0 <= numberOfContours {
+		// simple glyph
+		if r.Len() < 2*uint32(numberOfContours)+2 {
+			return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+		}
+		contour.EndPoints = make([]uint16, numberOfContours)
+		for i := 0; i < int(numberOfContours); i++ {
+			contour.EndPoints[i] = r.ReadUint16()
+			if 0 < i && contour.EndPoints[i] <= contour.EndPoints[i-1] {
+				return nil, fmt.Errorf("glyf: bad endPtsOfContours for glyphID %v", glyphID)
+			}
+		}
+
+		instructionLength := r.ReadUint16()
+		if r.Len() < uint32(instructionLength) {
+			return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+		}
+		contour.Instructions = r.ReadBytes(uint32(instructionLength))
+		if numberOfContours == 0 {
+			return contour, nil
+		}
+
+		numPoints := int(contour.EndPoints[numberOfContours-1]) + 1
+		if 128*int(r.Len()) < numPoints {
+			// each flag byte with a repeat byte can describe at most 256 points
+			return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+		}
+		flags := make([]byte, numPoints)
+		contour.OnCurve = make([]bool, numPoints)
+		for i := 0; i < numPoints; i++ {
+			if r.Len() < 1 {
+				return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+			}
+
+			flags[i] = r.ReadByte()
+			contour.OnCurve[i] = flags[i]&0x01 != 0
+			if flags[i]&0x08 != 0 { // REPEAT_FLAG
+				if r.Len() < 1 {
+					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+				}
+				repeat := r.ReadByte()
+				if numPoints <= i+int(repeat) {
+					return nil, fmt.Errorf("glyf: bad flags for glyphID %v", glyphID)
+				}
+				for j := 1; j <= int(repeat); j++ {
+					flags[i+j] = flags[i]
+					contour.OnCurve[i+j] = contour.OnCurve[i]
+				}
+				i += int(repeat)
+			}
+		}
+
+		var x int16
+		contour.XCoordinates = make([]int16, numPoints)
+		for i := 0; i < numPoints; i++ {
+			xShortVector := flags[i]&0x02 != 0
+			xIsSameOrPositiveXShortVector := flags[i]&0x10 != 0
+			if xShortVector {
+				if r.Len() < 1 {
+					return nil, fmt.Errorf("glyf: bad table or flags for glyphID %v", glyphID)
+				}
+				if xIsSameOrPositiveXShortVector {
+					x += int16(r.ReadUint8())
+				} else {
+					x -= int16(r.ReadUint8())
+				}
+			} else if !xIsSameOrPositiveXShortVector {
+				if r.Len() < 2 {
+					return nil, fmt.Errorf("glyf: bad table or flags for glyphID %v", glyphID)
+				}
+				x += r.ReadInt16()
+			}
+			contour.XCoordinates[i] = x
+		}
+
+		var y int16
+		contour.YCoordinates = make([]int16, numPoints)
+		for i := 0; i < numPoints; i++ {
+			yShortVector := flags[i]&0x04 != 0
+			yIsSameOrPositiveYShortVector := flags[i]&0x20 != 0
+			if yShortVector {
+				if r.Len() < 1 {
+					return nil, fmt.Errorf("glyf: bad table or flags for glyphID %v", glyphID)
+				}
+				if yIsSameOrPositiveYShortVector {
+					y += int16(r.ReadUint8())
+				} else {
+					y -= int16(r.ReadUint8())
+				}
+			} else if !yIsSameOrPositiveYShortVector {
+				if r.Len() < 2 {
+					return nil, fmt.Errorf("glyf: bad table or flags for glyphID %v", glyphID)
+				}
+				y += r.ReadInt16()
+			}
+			contour.YCoordinates[i] = y
+		}
+	} else {
+		if 7 < level {
+			return nil, fmt.Errorf("glyf: compound glyphs too deeply nested")
+		}
+
+		// composite glyph
+		for {
+			if r.Len() < 4 {
+				return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+			}
+
+			*components++
+			if 0 < glyf.maxComponents && glyf.maxComponents < *components {
+				return nil, ErrLimitExceeded
+			}
+
+			flags := r.ReadUint16()
+			subGlyphID := r.ReadUint16()
+			if flags&0x0002 == 0 { // ARGS_ARE_XY_VALUES
+				return nil, fmt.Errorf("glyf: composite glyph not supported")
+			}
+			var dx, dy int16
+			if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+				if r.Len() < 4 {
+					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+				}
+				dx = r.ReadInt16()
+				dy = r.ReadInt16()
+			} else {
+				if r.Len() < 2 {
+					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+				}
+				dx = int16(r.ReadInt8())
+				dy = int16(r.ReadInt8())
+			}
+			var txx, txy, tyx, tyy int16
+			if flags&0x0008 != 0 { // WE_HAVE_A_SCALE
+				if r.Len() < 2 {
+					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+				}
+				txx = r.ReadInt16()
+				tyy = txx
+			} else if flags&0x0040 != 0 { // WE_HAVE_AN_X_AND_Y_SCALE
+				if r.Len() < 4 {
+					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+				}
+				txx = r.ReadInt16()
+				tyy = r.ReadInt16()
+			} else if flags&0x0080 != 0 { // WE_HAVE_A_TWO_BY_TWO
+				if r.Len() < 8 {
+					return nil, fmt.Errorf("glyf: bad table for glyphID %v", glyphID)
+				}
+				txx = r.ReadInt16()
+				txy = r.ReadInt16()
+				tyx = r.ReadInt16()
+				tyy = r.ReadInt16()
+			}
+
+			subContour, err := glyf.contour(subGlyphID, level+1, components)
+			if err != nil {
+				return nil, err
+			} else if subContour == nil {
+				// empty component glyph
+				if flags&0x0020 == 0 { // MORE_COMPONENTS
+					break
+				}
+				continue
+			}
+
+			var numPoints uint16
+			if 0 < len(contour.EndPoints) {
+				numPoints = contour.EndPoints[len(contour.EndPoints)-1] + 1
+			}
+			if math.MaxUint16-uint32(numPoints) < uint32(len(subContour.XCoordinates)) {
+				return nil, fmt.Errorf("glyf: too many points for glyphID %v", glyphID)
+			}
+			for i := 0; i < len(subContour.EndPoints); i++ {
+				contour.EndPoints = append(contour.EndPoints, numPoints+subContour.EndPoints[i])
+			}
+			contour.OnCurve = append(contour.OnCurve, subContour.OnCurve...)
+			for i := 0; i < len(subContour.XCoordinates); i++ {
+				x := subContour.XCoordinates[i]
+				y := subContour.YCoordinates[i]
+				if flags&0x00C8 != 0 { // has transformation
+					const half = 1 << 13
+					xt := int16((int64(x)*int64(txx)+half)>>14) + int16((int64(y)*int64(tyx)+half)>>14)
+					yt := int16((int64(x)*int64(txy)+half)>>14) + int16((int64(y)*int64(tyy)+half)>>14)
+					x, y = xt, yt
+				}
+				contour.XCoordinates = append(contour.XCoordinates, dx+x)
+				contour.YCoordinates = append(contour.YCoordinates, dy+y)
+			}
+			if flags&0x0020 == 0 { // MORE_COMPONENTS
+				break
+			}
+		}
+	}
+	return contour, nil
+}
+
+// stripGlyphInstructions returns a copy of the glyph data without its instructions. Empty glyphs are returned as is.
+func stripGlyphInstructions(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return b, nil
+	} else if len(b) < 10 {
+		return nil, ErrInvalidFontData
+	}
+
+	numberOfContours := int16(binary.BigEndian.Uint16(b))
+	if 0 <= numberOfContours {
+		// simple glyph, set the instruction length to zero
+		pos := 10 + 2*int(numberOfContours)
+		if len(b) < pos+2 {
+			return nil, ErrInvalidFontData
+		}
+		n := int(binary.BigEndian.Uint16(b[pos:]))
+		if len(b) < pos+2+n {
+			return nil, ErrInvalidFontData
+		}
+		glyph := make([]byte, 0, len(b)-n)
+		glyph = append(glyph, b[:pos]...)
+		glyph = append(glyph, 0, 0)
+		return append(glyph, b[pos+2+n:]...), nil
+	}
+
+	// composite glyph, remove the instructions that follow the last component
+	glyph := append([]byte{}, b...)
+	pos := 10 // skip header
+	for {
+		if len(glyph) < pos+4 {
+			return nil, ErrInvalidFontData
+		}
+		flags := binary.BigEndian.Uint16(glyph[pos:])
+		if flags&0x0020 == 0 { // MORE_COMPONENTS
+			binary.BigEndian.PutUint16(glyph[pos:], flags&^0x0100) // WE_HAVE_INSTRUCTIONS
+		}
+
+		pos += 6
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+			pos += 2
+		}
+		if flags&0x0008 != 0 { // WE_HAVE_A_SCALE
+			pos += 2
+		} else if flags&0x0040 != 0 { // WE_HAVE_AN_X_AND_Y_SCALE
+			pos += 4
+		} else if flags&0x0080 != 0 { // WE_HAVE_A_TWO_BY_TWO
+			pos += 8
+		}
+		if len(glyph) < pos {
+			return nil, ErrInvalidFontData
+		} else if flags&0x0020 == 0 { // MORE_COMPONENTS
+			return glyph[:pos], nil
+		}
+	}
+}
+
+// Components returns the glyph IDs directly referenced by a composite glyph without assembling its contour. It returns false for simple, empty, or malformed glyphs.
+func (glyf *glyfTable) Components(glyphID uint16) ([]uint16, bool) {
+	b, err := glyf.Get(glyphID)
+	if err != nil || len(b) < 10 {
+		return nil, false
+	}
+	r := newBinaryReader(b)
+	if numberOfContours := r.ReadInt16(); 0 <= numberOfContours {
+		return nil, false
+	}
+	_ = r.ReadBytes(8) // bounding box
+
+	components := []uint16{}
+	for {
+		if r.Len() < 4 {
+			return nil, false
+		}
+		flags := r.ReadUint16()
+		components = append(components, r.ReadUint16())
+
+		n := uint32(2)
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+			n = 4
+		}
+		if flags&0x0008 != 0 { // WE_HAVE_A_SCALE
+			n += 2
+		} else if flags&0x0040 != 0 { // WE_HAVE_AN_X_AND_Y_SCALE
+			n += 4
+		} else if flags&0x0080 != 0 { // WE_HAVE_A_TWO_BY_TWO
+			n += 8
+		}
+		if r.Len() < n {
+			return nil, false
+		}
+		_ = r.ReadBytes(n)
+		if flags&0x0020 == 0 { // MORE_COMPONENTS
+			break
+		}
+	}
+	return components, true
+}
+
+func (sfnt *SFNT) parseGlyf() error {
+	// requires data from loca
+	b, ok := sfnt.Tables["glyf"]
+	if !ok {
+		return fmt.Errorf("glyf: missing table")
+	}
+	if end := sfnt.Loca.Offsets[len(sfnt.Loca.Offsets)-1]; uint32(len(b)) != end {
+		if !sfnt.options.Lenient {
+			return fmt.Errorf("glyf: bad table")
+		} else if end < uint32(len(b)) {
+			if 4 <= uint32(len(b))-end {
+				return fmt.Errorf("glyf: bad table")
+			}
+			b = b[:end:end] // ignore padding
+		} else {
+			// clamp the offsets of truncated glyphs, loca offsets are increasing
+			offsets := append([]uint32{}, sfnt.Loca.Offsets...)
+			for i := len(offsets) - 1; 0 <= i && uint32(len(b)) < offsets[i]; i-- {
+				offsets[i] = uint32(len(b))
+			}
+			sfnt.Loca.Offsets = offsets
+			sfnt.Repaired = true
+		}
+	}
+	for i := 1; i < len(sfnt.Loca.Offsets); i++ {
+		if sfnt.Loca.Offsets[i] < sfnt.Loca.Offsets[i-1] || uint32(len(b)) < sfnt.Loca.Offsets[i] {
+			return fmt.Errorf("glyf: bad loca offset for glyphID %v", i-1)
+		}
+	}
+
+	sfnt.Glyf = &glyfTable{
+		data:          b,
+		loca:          sfnt.Loca,
+		maxComponents: sfnt.options.MaxComponents,
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type headTable struct {
+	FontRevision           uint32
+	Flags                  [16]bool
+	UnitsPerEm             uint16
+	Created, Modified      time.Time
+	XMin, YMin, XMax, YMax int16
+	MacStyle               [16]bool
+	LowestRecPPEM          uint16
+	FontDirectionHint      int16
+	IndexToLocFormat       int16
+	GlyphDataFormat        int16
+}
+
+func (sfnt *SFNT) parseHead() error {
+	b, ok := sfnt.Tables["head"]
+	if !ok {
+		return fmt.Errorf("head: missing table")
+	} else if len(b) != 54 {
+		return fmt.Errorf("head: bad table")
+	}
+
+	sfnt.Head = &headTable{}
+	r := newBinaryReader(b)
+	majorVersion := r.ReadUint16()
+	minorVersion := r.ReadUint16()
+	if majorVersion != 1 && minorVersion != 0 {
+		return fmt.Errorf("head: bad version")
+	}
+	sfnt.Head.FontRevision = r.ReadUint32()
+	_ = r.ReadUint32()                // checksumAdjustment
+	if r.ReadUint32() != 0x5F0F3CF5 { // magicNumber
+		return fmt.Errorf("head: bad magic version")
+	}
+	sfnt.Head.Flags = uint16ToFlags(r.ReadUint16())
+	sfnt.Head.UnitsPerEm = r.ReadUint16()
+	created := r.ReadUint64()
+	modified := r.ReadUint64()
+	if math.MaxInt64 < created || math.MaxInt64 < modified {
+		return fmt.Errorf("head: created and/or modified dates too large")
+	}
+	sfnt.Head.Created = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Second * time.Duration(created))
+	sfnt.Head.Modified = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Second * time.Duration(modified))
+	sfnt.Head.XMin = r.ReadInt16()
+	sfnt.Head.YMin = r.ReadInt16()
+	sfnt.Head.XMax = r.ReadInt16()
+	sfnt.Head.YMax = r.ReadInt16()
+	sfnt.Head.MacStyle = uint16ToFlags(r.ReadUint16())
+	sfnt.Head.LowestRecPPEM = r.ReadUint16()
+	sfnt.Head.FontDirectionHint = r.ReadInt16()
+	sfnt.Head.IndexToLocFormat = r.ReadInt16()
+	if sfnt.Head.IndexToLocFormat != 0 && sfnt.Head.IndexToLocFormat != 1 {
+		return fmt.Errorf("head: bad indexToLocFormat")
+	}
+	sfnt.Head.GlyphDataFormat = r.ReadInt16()
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type hheaTable struct {
+	Ascender            int16
+	Descender           int16
+	LineGap             int16
+	AdvanceWidthMax     uint16
+	MinLeftSideBearing  int16
+	MinRightSideBearing int16
+	XMaxExtent          int16
+	CaretSlopeRise      int16
+	CaretSlopeRun       int16
+	CaretOffset         int16
+	MetricDataFormat    int16
+	NumberOfHMetrics    uint16
+}
+
+func (sfnt *SFNT) parseHhea() error {
+	// requires data from maxp
+	b, ok := sfnt.Tables["hhea"]
+	if !ok {
+		return fmt.Errorf("hhea: missing table")
+	} else if len(b) != 36 {
+		return fmt.Errorf("hhea: bad table")
+	}
+
+	sfnt.Hhea = &hheaTable{}
+	r := newBinaryReader(b)
+	majorVersion := r.ReadUint16()
+	minorVersion := r.ReadUint16()
+	if majorVersion != 1 && minorVersion != 0 {
+		return fmt.Errorf("hhea: bad version")
+	}
+	sfnt.Hhea.Ascender = r.ReadInt16()
+	sfnt.Hhea.Descender = r.ReadInt16()
+	sfnt.Hhea.LineGap = r.ReadInt16()
+	sfnt.Hhea.AdvanceWidthMax = r.ReadUint16()
+	sfnt.Hhea.MinLeftSideBearing = r.ReadInt16()
+	sfnt.Hhea.MinRightSideBearing = r.ReadInt16()
+	sfnt.Hhea.XMaxExtent = r.ReadInt16()
+	sfnt.Hhea.CaretSlopeRise = r.ReadInt16()
+	sfnt.Hhea.CaretSlopeRun = r.ReadInt16()
+	sfnt.Hhea.CaretOffset = r.ReadInt16()
+	_ = r.ReadInt16() // reserved
+	_ = r.ReadInt16() // reserved
+	_ = r.ReadInt16() // reserved
+	_ = r.ReadInt16() // reserved
+	sfnt.Hhea.MetricDataFormat = r.ReadInt16()
+	sfnt.Hhea.NumberOfHMetrics = r.ReadUint16()
+	if sfnt.Maxp.NumGlyphs < sfnt.Hhea.NumberOfHMetrics || sfnt.Hhea.NumberOfHMetrics == 0 {
+		return fmt.Errorf("hhea: bad numberOfHMetrics")
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type hmtxLongHorMetric struct {
+	AdvanceWidth uint16
+	Lsb          int16
+}
+
+type hmtxTable struct {
+	HMetrics         []hmtxLongHorMetric
+	LeftSideBearings []int16
+}
+
+// LeftSideBearing returns the left side bearing of the glyph, or zero for glyph IDs beyond the number of glyphs.
+func (hmtx *hmtxTable) LeftSideBearing(glyphID uint16) int16 {
+	if uint16(len(hmtx.HMetrics)) <= glyphID {
+		if i := int(glyphID) - len(hmtx.HMetrics); i < len(hmtx.LeftSideBearings) {
+			return hmtx.LeftSideBearings[i]
+		}
+		return 0
+	}
+	return hmtx.HMetrics[glyphID].Lsb
+}
+
+// Advance returns the advance width of the glyph. Glyphs beyond the long horizontal metrics share the advance of the last one, which includes glyph IDs beyond the number of glyphs and all glyphs of fonts with a single metric, such as monospaced fonts or CFF2 fonts that rely on the HVAR table for their advances.
+func (hmtx *hmtxTable) Advance(glyphID uint16) uint16 {
+	if uint16(len(hmtx.HMetrics)) <= glyphID {
+		glyphID = uint16(len(hmtx.HMetrics)) - 1
+	}
+	return hmtx.HMetrics[glyphID].AdvanceWidth
+}
+
+func (sfnt *SFNT) parseHmtx() error {
+	// requires data from hhea and maxp
+	b, ok := sfnt.Tables["hmtx"]
+	length := 4*uint32(sfnt.Hhea.NumberOfHMetrics) + 2*uint32(sfnt.Maxp.NumGlyphs-sfnt.Hhea.NumberOfHMetrics)
+	if !ok {
+		return fmt.Errorf("hmtx: missing table")
+	} else if uint32(len(b)) != length {
+		return fmt.Errorf("hmtx: bad table")
+	}
+
+	sfnt.Hmtx = &hmtxTable{}
+	// numberOfHMetrics is smaller than numGlyphs
+	sfnt.Hmtx.HMetrics = make([]hmtxLongHorMetric, sfnt.Hhea.NumberOfHMetrics)
+	sfnt.Hmtx.LeftSideBearings = make([]int16, sfnt.Maxp.NumGlyphs-sfnt.Hhea.NumberOfHMetrics)
+
+	r := newBinaryReader(b)
+	for i := 0; i < int(sfnt.Hhea.NumberOfHMetrics); i++ {
+		sfnt.Hmtx.HMetrics[i].AdvanceWidth = r.ReadUint16()
+		sfnt.Hmtx.HMetrics[i].Lsb = r.ReadInt16()
+	}
+	for i := 0; i < int(sfnt.Maxp.NumGlyphs-sfnt.Hhea.NumberOfHMetrics); i++ {
+		sfnt.Hmtx.LeftSideBearings[i] = r.ReadInt16()
+	}
+	return nil
+}
+
+// BuildHmtx builds an hmtx table from the advance widths and left side bearings of all glyphs. Trailing glyphs with the same advance width as the last long metric are stored as left side bearings only. It returns the table and the numberOfHMetrics value for the hhea table.
+func BuildHmtx(advances []uint16, lsbs []int16) ([]byte, uint16, error) {
+	if len(advances) != len(lsbs) {
+		return nil, 0, fmt.Errorf("hmtx: advances and left side bearings must have the same length")
+	} else if len(advances) == 0 || math.MaxUint16 < len(advances) {
+		return nil, 0, fmt.Errorf("hmtx: bad number of glyphs")
+	}
+
+	numberOfHMetrics := len(advances)
+	for 1 < numberOfHMetrics && advances[numberOfHMetrics-2] == advances[numberOfHMetrics-1] {
+		numberOfHMetrics--
+	}
+
+	w := newBinaryWriter(make([]byte, 0, 4*numberOfHMetrics+2*(len(advances)-numberOfHMetrics)))
+	for i := 0; i < numberOfHMetrics; i++ {
+		w.WriteUint16(advances[i])
+		w.WriteInt16(lsbs[i])
+	}
+	for i := numberOfHMetrics; i < len(advances); i++ {
+		w.WriteInt16(lsbs[i])
+	}
+	return w.Bytes(), uint16(numberOfHMetrics), nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type kernPair struct {
+	Key   uint32
+	Value int16
+}
+
+type kernFormat0 struct {
+	Coverage [8]bool
+	Pairs    []kernPair
+}
+
+func (subtable *kernFormat0) Get(l, r uint16) int16 {
+	key := uint32(l)<<16 | uint32(r)
+	lo, hi := 0, len(subtable.Pairs)
+	for lo < hi {
+		mid := (lo + hi) / 2 // can be rounded down if odd
+		pair := subtable.Pairs[mid]
+		if pair.Key < key {
+			lo = mid + 1
+		} else if key < pair.Key {
+			hi = mid
+		} else {
+			return pair.Value
+		}
+	}
+	return 0
+}
+
+type kernTable struct {
+	Subtables []kernFormat0
+}
+
+func (kern *kernTable) Get(l, r uint16) (k int16) {
+	for _, subtable := range kern.Subtables {
+		if !subtable.Coverage[1] {
+			k += subtable.Get(l, r)
+		} else if min := subtable.Get(l, r); k < min {
+			// TODO: test
+			k = min
+		}
+	}
+	return
+}
+
+func (sfnt *SFNT) parseKern() error {
+	b, ok := sfnt.Tables["kern"]
+	if !ok {
+		return fmt.Errorf("kern: missing table")
+	} else if len(b) < 4 {
+		return fmt.Errorf("kern: bad table")
+	}
+
+	r := newBinaryReader(b)
+	version := r.ReadUint16()
+	if version != 0 {
+		// TODO: supported other kern versions
+		return fmt.Errorf("kern: bad version")
+	}
+
+	nTables := r.ReadUint16()
+	sfnt.Kern = &kernTable{}
+	for j := 0; j < int(nTables); j++ {
+		subtable := kernFormat0{}
+		startPos := r.Pos()
+		subtableVersion := r.ReadUint16()
+		length := r.ReadUint16()
+		format := r.ReadUint8()
+		subtable.Coverage = uint8ToFlags(r.ReadUint8())
+		if r.Err() != nil || length < 6 {
+			return fmt.Errorf("kern: bad subtable %d", j)
+		} else if subtableVersion != 0 || format != 0 {
+			// TODO: supported other kern subtable versions and formats
+			_ = r.ReadBytes(uint32(length) - 6) // skip the rest of the subtable
+			continue
+		}
+		nPairs := r.ReadUint16()
+		_ = r.ReadUint16() // searchRange
+		_ = r.ReadUint16() // entrySelector
+		_ = r.ReadUint16() // rangeShift
+		if r.Err() != nil {
+			return fmt.Errorf("kern: bad subtable %d", j)
+		} else if uint32(length) < 14+6*uint32(nPairs) || r.Len() < 6*uint32(nPairs) {
+			return fmt.Errorf("kern: bad length for subtable %d", j)
+		}
+
+		subtable.Pairs = make([]kernPair, nPairs)
+		for i := 0; i < int(nPairs); i++ {
+			subtable.Pairs[i].Key = r.ReadUint32()
+			subtable.Pairs[i].Value = r.ReadInt16()
+			if 0 < i && subtable.Pairs[i].Key <= subtable.Pairs[i-1].Key {
+				return fmt.Errorf("kern: bad left right pair for subtable %d", j)
+			}
+		}
+
+		// read unread bytes if length is bigger
+		_ = r.ReadBytes(uint32(length) - (r.Pos() - startPos))
+		sfnt.Kern.Subtables = append(sfnt.Kern.Subtables, subtable)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////
+
+type locaTable struct {
+	Offsets []uint32
+}
+
+func (sfnt *SFNT) parseLoca() error {
+	b, ok := sfnt.Tables["loca"]
+	if !ok {
+		return fmt.Errorf("loca: missing table")
+	}
+
+	sfnt.Loca = &locaTable{}
+	if sfnt.Head.IndexToLocFormat == 0 && uint32(len(b)) != 2*(uint32(sfnt.Maxp.NumGlyphs)+1) ||
+		sfnt.Head.IndexToLocFormat == 1 && uint32(len(b)) != 4*(uint32(sfnt.Maxp.NumGlyphs)+1) {
+		return fmt.Errorf("loca: bad table")
+	}
+	sfnt.Loca.Offsets = make([]uint32, sfnt.Maxp.NumGlyphs+1)
+	r := newBinaryReader(b)
+	if sfnt.Head.IndexToLocFormat == 0 {
+		for i := 0; i < int(sfnt.Maxp.NumGlyphs+1); i++ {
+			sfnt.Loca.Offsets[i] = uint32(r.ReadUint16())
+			if 0 < i && sfnt.Loca.Offsets[i] < sfnt.Loca.Offsets[i-1] {
+				return fmt.Errorf("loca: bad offsets")
+			}
+		}
+	} else if sfnt.Head.IndexToLocFormat == 1 {
+		for i := 0; i < int(sfnt.Maxp.NumGlyphs+1); i++ {
+			sfnt.Loca.Offsets[i] = r.ReadUint32()
+			if 0 < i && sfnt.Loca.Offsets[i] < sfnt.Loca.Offsets[i-1] {
+				return fmt.Errorf("loca: bad offsets")
+			}
+		}
+	}
+	return nil
 }
 
-func (sfnt *SFNT) parseGlyf() error {
-	// requires data from loca
-	b, ok := sfnt.Tables["glyf"]
+////////////////////////////////////////////////////////////////
+
+type maxpTable struct {
+	NumGlyphs             uint16
+	MaxPoints             uint16
+	MaxContours           uint16
+	MaxCompositePoints    uint16
+	MaxCompositeContours  uint16
+	MaxZones              uint16
+	MaxTwilightPoints     uint16
+	MaxStorage            uint16
+	MaxFunctionDefs       uint16
+	MaxInstructionDefs    uint16
+	MaxStackElements      uint16
+	MaxSizeOfInstructions uint16
+	MaxComponentElements  uint16
+	MaxComponentDepth     uint16
+}
+
+func (sfnt *SFNT) parseMaxp() error {
+	b, ok := sfnt.Tables["maxp"]
 	if !ok {
-		return fmt.Errorf("glyf: missing table")
-	} else if uint32(len(b)) != sfnt.Loca.Offsets[len(sfnt.Loca.Offsets)-1] {
-		return fmt.Errorf("glyf: bad table")
+		return fmt.Errorf("maxp: missing table")
 	}
 
-	sfnt.Glyf = &glyfTable{
-		data: b,
-		loca: sfnt.Loca,
+	sfnt.Maxp = &maxpTable{}
+	r := newBinaryReader(b)
+	version := r.ReadBytes(4)
+	sfnt.Maxp.NumGlyphs = r.ReadUint16()
+	if 0 < sfnt.options.MaxGlyphs && sfnt.options.MaxGlyphs < int(sfnt.Maxp.NumGlyphs) {
+		return ErrLimitExceeded
 	}
-	return nil
+	if binary.BigEndian.Uint32(version) == 0x00005000 && !sfnt.IsTrueType && len(b) == 6 {
+		return nil
+	} else if binary.BigEndian.Uint32(version) == 0x00010000 && !sfnt.IsCFF && len(b) == 32 {
+		sfnt.Maxp.MaxPoints = r.ReadUint16()
+		sfnt.Maxp.MaxContours = r.ReadUint16()
+		sfnt.Maxp.MaxCompositePoints = r.ReadUint16()
+		sfnt.Maxp.MaxCompositeContours = r.ReadUint16()
+		sfnt.Maxp.MaxZones = r.ReadUint16()
+		sfnt.Maxp.MaxTwilightPoints = r.ReadUint16()
+		sfnt.Maxp.MaxStorage = r.ReadUint16()
+		sfnt.Maxp.MaxFunctionDefs = r.ReadUint16()
+		sfnt.Maxp.MaxInstructionDefs = r.ReadUint16()
+		sfnt.Maxp.MaxStackElements = r.ReadUint16()
+		sfnt.Maxp.MaxSizeOfInstructions = r.ReadUint16()
+		sfnt.Maxp.MaxComponentElements = r.ReadUint16()
+		sfnt.Maxp.MaxComponentDepth = r.ReadUint16()
+		return nil
+	}
+	return fmt.Errorf("maxp: bad table")
 }
 
 ////////////////////////////////////////////////////////////////
 
-type headTable struct {
-	FontRevision           uint32
-	Flags                  [16]bool
-	UnitsPerEm             uint16
-	Created, Modified      time.Time
-	XMin, YMin, XMax, YMax int16
-	MacStyle               [16]bool
-	LowestRecPPEM          uint16
-	FontDirectionHint      int16
-	IndexToLocFormat       int16
-	GlyphDataFormat        int16
+// AATFeature is a feature type of the AAT feat table, such as ligatures or number case, with its selectors. Selectors of exclusive features are mutually exclusive, while non-exclusive features usually have pairs of selectors that turn a setting on and off.
+type AATFeature struct {
+	Type      uint16
+	Name      string
+	Exclusive bool
+	Default   int // index of the default selector
+	Selectors []AATFeatureSelector
 }
 
-func (sfnt *SFNT) parseHead() error {
-	b, ok := sfnt.Tables["head"]
+// AATFeatureSelector is a selector of an AAT feature.
+type AATFeatureSelector struct {
+	Setting uint16
+	Name    string
+}
+
+type featSetting struct {
+	Setting   uint16
+	NameIndex uint16
+}
+
+type featFeatureName struct {
+	Feature   uint16
+	Flags     uint16
+	NameIndex uint16
+	Settings  []featSetting
+}
+
+type featTable struct {
+	Features []featFeatureName
+}
+
+func (sfnt *SFNT) parseFeat() error {
+	b, ok := sfnt.Tables["feat"]
 	if !ok {
-		return fmt.Errorf("head: missing table")
-	} else if len(b) != 54 {
-		return fmt.Errorf("head: bad table")
+		return fmt.Errorf("feat: missing table")
+	} else if len(b) < 12 {
+		return fmt.Errorf("feat: bad table")
 	}
 
-	sfnt.Head = &headTable{}
 	r := newBinaryReader(b)
-	majorVersion := r.ReadUint16()
-	minorVersion := r.ReadUint16()
-	if majorVersion != 1 && minorVersion != 0 {
-		return fmt.Errorf("head: bad version")
-	}
-	sfnt.Head.FontRevision = r.ReadUint32()
-	_ = r.ReadUint32()                // checksumAdjustment
-	if r.ReadUint32() != 0x5F0F3CF5 { // magicNumber
-		return fmt.Errorf("head: bad magic version")
+	if version := r.ReadUint32(); version>>16 != 1 {
+		return fmt.Errorf("feat: bad version")
 	}
-	sfnt.Head.Flags = uint16ToFlags(r.ReadUint16())
-	sfnt.Head.UnitsPerEm = r.ReadUint16()
-	created := r.ReadUint64()
-	modified := r.ReadUint64()
-	if math.MaxInt64 < created || math.MaxInt64 < modified {
-		return fmt.Errorf("head: created and/or modified dates too large")
+	featureNameCount := r.ReadUint16()
+	_ = r.ReadUint16() // reserved
+	_ = r.ReadUint32() // reserved
+	if uint32(len(b)) < 12+12*uint32(featureNameCount) {
+		return fmt.Errorf("feat: bad table")
 	}
-	sfnt.Head.Created = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Second * time.Duration(created))
-	sfnt.Head.Modified = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Second * time.Duration(modified))
-	sfnt.Head.XMin = r.ReadInt16()
-	sfnt.Head.YMin = r.ReadInt16()
-	sfnt.Head.XMax = r.ReadInt16()
-	sfnt.Head.YMax = r.ReadInt16()
-	sfnt.Head.MacStyle = uint16ToFlags(r.ReadUint16())
-	sfnt.Head.LowestRecPPEM = r.ReadUint16()
-	sfnt.Head.FontDirectionHint = r.ReadInt16()
-	sfnt.Head.IndexToLocFormat = r.ReadInt16()
-	if sfnt.Head.IndexToLocFormat != 0 && sfnt.Head.IndexToLocFormat != 1 {
-		return fmt.Errorf("head: bad indexToLocFormat")
+
+	sfnt.Feat = &featTable{}
+	sfnt.Feat.Features = make([]featFeatureName, featureNameCount)
+	for i := range sfnt.Feat.Features {
+		sfnt.Feat.Features[i].Feature = r.ReadUint16()
+		nSettings := r.ReadUint16()
+		settingTable := r.ReadUint32()
+		sfnt.Feat.Features[i].Flags = r.ReadUint16()
+		sfnt.Feat.Features[i].NameIndex = r.ReadUint16()
+		if uint32(len(b)) < settingTable || (uint32(len(b))-settingTable)/4 < uint32(nSettings) {
+			return fmt.Errorf("feat: bad setting table for feature %d", i)
+		}
+
+		rs := newBinaryReader(b[settingTable:])
+		sfnt.Feat.Features[i].Settings = make([]featSetting, nSettings)
+		for j := range sfnt.Feat.Features[i].Settings {
+			sfnt.Feat.Features[i].Settings[j].Setting = rs.ReadUint16()
+			sfnt.Feat.Features[i].Settings[j].NameIndex = rs.ReadUint16()
+		}
 	}
-	sfnt.Head.GlyphDataFormat = r.ReadInt16()
 	return nil
 }
 
 ////////////////////////////////////////////////////////////////
 
-type hheaTable struct {
-	Ascender            int16
-	Descender           int16
-	LineGap             int16
-	AdvanceWidthMax     uint16
-	MinLeftSideBearing  int16
-	MinRightSideBearing int16
-	XMaxExtent          int16
-	CaretSlopeRise      int16
-	CaretSlopeRun       int16
-	CaretOffset         int16
-	MetricDataFormat    int16
-	NumberOfHMetrics    uint16
+// aatDeletedGlyph is the glyph ID of glyphs deleted by AAT state machines, which are removed after processing.
+const aatDeletedGlyph = 0xFFFF
+
+type aatLookupSegment struct {
+	First, Last uint16
+	Value       uint16   // used when Values is nil
+	Values      []uint16 // per glyph from First to Last
 }
 
-func (sfnt *SFNT) parseHhea() error {
-	// requires data from maxp
-	b, ok := sfnt.Tables["hhea"]
-	if !ok {
-		return fmt.Errorf("hhea: missing table")
-	} else if len(b) != 36 {
-		return fmt.Errorf("hhea: bad table")
+// aatLookup is an AAT lookup table that maps glyph IDs to 16-bit values.
+type aatLookup struct {
+	Segments []aatLookupSegment // sorted
+}
+
+func (lookup *aatLookup) Get(glyphID uint16) (uint16, bool) {
+	i := sort.Search(len(lookup.Segments), func(i int) bool { return glyphID <= lookup.Segments[i].Last })
+	if i == len(lookup.Segments) || glyphID < lookup.Segments[i].First {
+		return 0, false
+	}
+	segment := lookup.Segments[i]
+	if segment.Values == nil {
+		return segment.Value, true
 	}
+	return segment.Values[glyphID-segment.First], true
+}
 
-	sfnt.Hhea = &hheaTable{}
+func parseAATLookup(b []byte, numGlyphs uint16) (*aatLookup, error) {
 	r := newBinaryReader(b)
-	majorVersion := r.ReadUint16()
-	minorVersion := r.ReadUint16()
-	if majorVersion != 1 && minorVersion != 0 {
-		return fmt.Errorf("hhea: bad version")
+	format := r.ReadUint16()
+	lookup := &aatLookup{}
+	switch format {
+	case 0:
+		values := make([]uint16, numGlyphs)
+		for i := range values {
+			values[i] = r.ReadUint16()
+		}
+		if 0 < numGlyphs {
+			lookup.Segments = []aatLookupSegment{{0, numGlyphs - 1, 0, values}}
+		}
+	case 2, 4, 6:
+		unitSize := r.ReadUint16()
+		nUnits := r.ReadUint16()
+		_ = r.ReadUint16() // searchRange
+		_ = r.ReadUint16() // entrySelector
+		_ = r.ReadUint16() // rangeShift
+		if format == 6 && unitSize < 4 || format != 6 && unitSize < 6 || r.Len() < uint32(unitSize)*uint32(nUnits) {
+			return nil, fmt.Errorf("bad lookup table")
+		}
+		for i := 0; i < int(nUnits); i++ {
+			unit := newBinaryReader(r.ReadBytes(uint32(unitSize)))
+			var segment aatLookupSegment
+			if format == 6 {
+				segment.First = unit.ReadUint16()
+				segment.Last = segment.First
+			} else {
+				segment.Last = unit.ReadUint16()
+				segment.First = unit.ReadUint16()
+			}
+			if segment.Last == 0xFFFF {
+				continue // terminator
+			} else if segment.Last < segment.First || 0 < len(lookup.Segments) && segment.First <= lookup.Segments[len(lookup.Segments)-1].Last {
+				return nil, fmt.Errorf("bad lookup table")
+			}
+			segment.Value = unit.ReadUint16()
+			if format == 4 {
+				// the value is an offset to an array of values
+				offset := uint32(segment.Value)
+				n := uint32(segment.Last-segment.First) + 1
+				if uint32(len(b)) < offset || uint32(len(b))-offset < 2*n {
+					return nil, fmt.Errorf("bad lookup table")
+				}
+				rv := newBinaryReader(b[offset:])
+				segment.Values = make([]uint16, n)
+				for j := range segment.Values {
+					segment.Values[j] = rv.ReadUint16()
+				}
+			}
+			lookup.Segments = append(lookup.Segments, segment)
+		}
+	case 8:
+		firstGlyph := r.ReadUint16()
+		glyphCount := r.ReadUint16()
+		if r.Len() < 2*uint32(glyphCount) || 0xFFFF-uint32(firstGlyph) < uint32(glyphCount) {
+			return nil, fmt.Errorf("bad lookup table")
+		}
+		values := make([]uint16, glyphCount)
+		for i := range values {
+			values[i] = r.ReadUint16()
+		}
+		if 0 < glyphCount {
+			lookup.Segments = []aatLookupSegment{{firstGlyph, firstGlyph + glyphCount - 1, 0, values}}
+		}
+	default:
+		return nil, fmt.Errorf("bad lookup table format %d", format)
 	}
-	sfnt.Hhea.Ascender = r.ReadInt16()
-	sfnt.Hhea.Descender = r.ReadInt16()
-	sfnt.Hhea.LineGap = r.ReadInt16()
-	sfnt.Hhea.AdvanceWidthMax = r.ReadUint16()
-	sfnt.Hhea.MinLeftSideBearing = r.ReadInt16()
-	sfnt.Hhea.MinRightSideBearing = r.ReadInt16()
-	sfnt.Hhea.XMaxExtent = r.ReadInt16()
-	sfnt.Hhea.CaretSlopeRise = r.ReadInt16()
-	sfnt.Hhea.CaretSlopeRun = r.ReadInt16()
-	sfnt.Hhea.CaretOffset = r.ReadInt16()
-	_ = r.ReadInt16() // reserved
-	_ = r.ReadInt16() // reserved
-	_ = r.ReadInt16() // reserved
-	_ = r.ReadInt16() // reserved
-	sfnt.Hhea.MetricDataFormat = r.ReadInt16()
-	sfnt.Hhea.NumberOfHMetrics = r.ReadUint16()
-	if sfnt.Maxp.NumGlyphs < sfnt.Hhea.NumberOfHMetrics || sfnt.Hhea.NumberOfHMetrics == 0 {
-		return fmt.Errorf("hhea: bad numberOfHMetrics")
+	if r.EOF() {
+		return nil, fmt.Errorf("bad lookup table")
 	}
-	return nil
+	return lookup, nil
 }
 
-////////////////////////////////////////////////////////////////
-
-type hmtxLongHorMetric struct {
-	AdvanceWidth uint16
-	Lsb          int16
+// aatStateTable is an extended state table that drives the state machine of a morx subtable.
+type aatStateTable struct {
+	NClasses   uint32
+	ClassTable *aatLookup
+	States     [][]uint16 // entry index per state and class
+	Entries    []byte     // entry table, its entry size depends on the subtable type
+	EntrySize  uint32
 }
 
-type hmtxTable struct {
-	HMetrics         []hmtxLongHorMetric
-	LeftSideBearings []int16
+// class returns the class of the glyph, where 1 is out of bounds and 2 is a deleted glyph.
+func (table *aatStateTable) class(glyphID uint16) uint32 {
+	if glyphID == aatDeletedGlyph {
+		return 2
+	} else if class, ok := table.ClassTable.Get(glyphID); ok && uint32(class) < table.NClasses {
+		return uint32(class)
+	}
+	return 1
 }
 
-func (hmtx *hmtxTable) LeftSideBearing(glyphID uint16) int16 {
-	if uint16(len(hmtx.HMetrics)) <= glyphID {
-		return hmtx.LeftSideBearings[glyphID-uint16(len(hmtx.HMetrics))]
+// entry returns the entry reader for the state and class, positioned after the new state and flags, or false if the state or entry does not exist.
+func (table *aatStateTable) entry(state uint16, class uint32) (uint16, uint16, *binaryReader, bool) {
+	if len(table.States) <= int(state) {
+		return 0, 0, nil, false
 	}
-	return hmtx.HMetrics[glyphID].Lsb
+	index := uint32(table.States[state][class])
+	r := newBinaryReader(table.Entries[index*table.EntrySize : (index+1)*table.EntrySize])
+	newState := r.ReadUint16()
+	flags := r.ReadUint16()
+	return newState, flags, r, true
 }
 
-func (hmtx *hmtxTable) Advance(glyphID uint16) uint16 {
-	if uint16(len(hmtx.HMetrics)) <= glyphID {
-		glyphID = uint16(len(hmtx.HMetrics)) - 1
+// run runs the state machine over the glyphs and calls action for each transition with the glyph position, which equals len(glyphs) at the end of text.
+func (table *aatStateTable) run(glyphs []uint16, action func(i int, flags uint16, r *binaryReader)) {
+	state := uint16(0)
+	stuck := 0
+	for i := 0; i <= len(glyphs); {
+		class := uint32(0) // end of text
+		if i < len(glyphs) {
+			class = table.class(glyphs[i])
+		}
+		newState, flags, r, ok := table.entry(state, class)
+		if !ok {
+			return
+		}
+		action(i, flags, r)
+		state = newState
+		if flags&0x4000 == 0 || i == len(glyphs) || 100 < stuck { // DONT_ADVANCE
+			i++
+			stuck = 0
+		} else {
+			stuck++
+		}
 	}
-	return hmtx.HMetrics[glyphID].AdvanceWidth
 }
 
-func (sfnt *SFNT) parseHmtx() error {
-	// requires data from hhea and maxp
-	b, ok := sfnt.Tables["hmtx"]
-	length := 4*uint32(sfnt.Hhea.NumberOfHMetrics) + 2*uint32(sfnt.Maxp.NumGlyphs-sfnt.Hhea.NumberOfHMetrics)
-	if !ok {
-		return fmt.Errorf("hmtx: missing table")
-	} else if uint32(len(b)) != length {
-		return fmt.Errorf("hmtx: bad table")
+func parseAATStateTable(b []byte, numGlyphs uint16, entrySize uint32) (*aatStateTable, error) {
+	r := newBinaryReader(b)
+	table := &aatStateTable{EntrySize: entrySize}
+	table.NClasses = r.ReadUint32()
+	classTableOffset := r.ReadUint32()
+	stateArrayOffset := r.ReadUint32()
+	entryTableOffset := r.ReadUint32()
+	if r.EOF() || table.NClasses < 4 || 0xFFFF < table.NClasses || uint32(len(b)) < classTableOffset || uint32(len(b)) < stateArrayOffset || uint32(len(b)) < entryTableOffset {
+		return nil, fmt.Errorf("bad state table")
 	}
 
-	sfnt.Hmtx = &hmtxTable{}
-	// numberOfHMetrics is smaller than numGlyphs
-	sfnt.Hmtx.HMetrics = make([]hmtxLongHorMetric, sfnt.Hhea.NumberOfHMetrics)
-	sfnt.Hmtx.LeftSideBearings = make([]int16, sfnt.Maxp.NumGlyphs-sfnt.Hhea.NumberOfHMetrics)
+	var err error
+	if table.ClassTable, err = parseAATLookup(b[classTableOffset:], numGlyphs); err != nil {
+		return nil, err
+	}
 
-	r := newBinaryReader(b)
-	for i := 0; i < int(sfnt.Hhea.NumberOfHMetrics); i++ {
-		sfnt.Hmtx.HMetrics[i].AdvanceWidth = r.ReadUint16()
-		sfnt.Hmtx.HMetrics[i].Lsb = r.ReadInt16()
+	// the number of states is not stored, but the state array usually ends at the entry table
+	n := (uint32(len(b)) - stateArrayOffset) / (2 * table.NClasses)
+	if stateArrayOffset < entryTableOffset {
+		n = (entryTableOffset - stateArrayOffset) / (2 * table.NClasses)
 	}
-	for i := 0; i < int(sfnt.Maxp.NumGlyphs-sfnt.Hhea.NumberOfHMetrics); i++ {
-		sfnt.Hmtx.LeftSideBearings[i] = r.ReadInt16()
+	nEntries := uint32(0)
+	rs := newBinaryReader(b[stateArrayOffset:])
+	table.States = make([][]uint16, n)
+	for i := range table.States {
+		table.States[i] = make([]uint16, table.NClasses)
+		for j := range table.States[i] {
+			table.States[i][j] = rs.ReadUint16()
+			if nEntries <= uint32(table.States[i][j]) {
+				nEntries = uint32(table.States[i][j]) + 1
+			}
+		}
 	}
-	return nil
+
+	// the number of entries is not stored either, but follows from the state array
+	if (uint32(len(b))-entryTableOffset)/entrySize < nEntries {
+		return nil, fmt.Errorf("bad state table")
+	}
+	table.Entries = b[entryTableOffset : entryTableOffset+nEntries*entrySize]
+	return table, nil
+}
+
+type morxContextualSubtable struct {
+	*aatStateTable
+	Substitutions []*aatLookup
+}
+
+func (subtable *morxContextualSubtable) Apply(glyphs []uint16) []uint16 {
+	mark := -1
+	substitute := func(i int, index uint16) {
+		if index != 0xFFFF && int(index) < len(subtable.Substitutions) && 0 <= i && i < len(glyphs) {
+			if glyphID, ok := subtable.Substitutions[index].Get(glyphs[i]); ok {
+				glyphs[i] = glyphID
+			}
+		}
+	}
+	subtable.run(glyphs, func(i int, flags uint16, r *binaryReader) {
+		markIndex := r.ReadUint16()
+		currentIndex := r.ReadUint16()
+		if mark != -1 {
+			substitute(mark, markIndex)
+		}
+		if i == len(glyphs) {
+			i-- // the end of text substitutes the last glyph
+		}
+		substitute(i, currentIndex)
+		if flags&0x8000 != 0 { // SET_MARK
+			mark = i
+		}
+	})
+	return glyphs
+}
+
+type morxLigatureSubtable struct {
+	*aatStateTable
+	LigActions []byte // uint32 actions
+	Components []byte // uint16 ligature index increments
+	Ligatures  []byte // uint16 glyph IDs
+}
+
+func (subtable *morxLigatureSubtable) Apply(glyphs []uint16) []uint16 {
+	var stack []int // positions of the components
+	subtable.run(glyphs, func(i int, flags uint16, r *binaryReader) {
+		ligActionIndex := uint32(r.ReadUint16())
+		if flags&0x8000 != 0 && i < len(glyphs) { // SET_COMPONENT
+			if 64 <= len(stack) {
+				stack = stack[1:]
+			}
+			stack = append(stack, i)
+		}
+		if flags&0x2000 == 0 { // PERFORM_ACTION
+			return
+		}
+
+		ligatureIndex := uint32(0)
+		var popped []int
+		for ; 0 < len(stack); ligActionIndex++ {
+			if uint32(len(subtable.LigActions))/4 <= ligActionIndex {
+				return
+			}
+			action := binary.BigEndian.Uint32(subtable.LigActions[4*ligActionIndex:])
+			pos := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			popped = append(popped, pos)
+
+			offset := int32(action<<2) >> 2 // sign-extend 30-bit offset
+			componentIndex := int64(glyphs[pos]) + int64(offset)
+			if componentIndex < 0 || int64(len(subtable.Components))/2 <= componentIndex {
+				return
+			}
+			ligatureIndex += uint32(binary.BigEndian.Uint16(subtable.Components[2*componentIndex:]))
+			if action&0xC0000000 != 0 { // LAST or STORE
+				if uint32(len(subtable.Ligatures))/2 <= ligatureIndex {
+					return
+				}
+				glyphs[pos] = binary.BigEndian.Uint16(subtable.Ligatures[2*ligatureIndex:])
+				for _, j := range popped[:len(popped)-1] {
+					glyphs[j] = aatDeletedGlyph
+				}
+				stack = append(stack, pos) // the ligature is a component of following ligatures
+				popped = popped[:0]
+				ligatureIndex = 0
+			}
+			if action&0x80000000 != 0 { // LAST
+				break
+			}
+		}
+	})
+	return glyphs
+}
+
+type morxNoncontextualSubtable struct {
+	Lookup *aatLookup
+}
+
+func (subtable *morxNoncontextualSubtable) Apply(glyphs []uint16) []uint16 {
+	for i, glyphID := range glyphs {
+		if glyphID != aatDeletedGlyph {
+			if substitute, ok := subtable.Lookup.Get(glyphID); ok {
+				glyphs[i] = substitute
+			}
+		}
+	}
+	return glyphs
+}
+
+type morxSubtable interface {
+	Apply([]uint16) []uint16
 }
 
-////////////////////////////////////////////////////////////////
+type morxChainSubtable struct {
+	morxSubtable
+	Coverage        uint32
+	SubFeatureFlags uint32
+}
 
-type kernPair struct {
-	Key   uint32
-	Value int16
+type morxChain struct {
+	DefaultFlags uint32
+	Subtables    []morxChainSubtable
 }
 
-type kernFormat0 struct {
-	Coverage [8]bool
-	Pairs    []kernPair
+type morxTable struct {
+	Chains []morxChain
 }
 
-func (subtable *kernFormat0) Get(l, r uint16) int16 {
-	key := uint32(l)<<16 | uint32(r)
-	lo, hi := 0, len(subtable.Pairs)
-	for lo < hi {
-		mid := (lo + hi) / 2 // can be rounded down if odd
-		pair := subtable.Pairs[mid]
-		if pair.Key < key {
-			lo = mid + 1
-		} else if key < pair.Key {
-			hi = mid
-		} else {
-			return pair.Value
+// Apply applies the subtables of all chains that are enabled by default to the glyphs in logical order, substituting glyphs and forming ligatures, and returns the resulting glyphs.
+func (morx *morxTable) Apply(glyphs []uint16) []uint16 {
+	glyphs = append([]uint16{}, glyphs...)
+	for _, chain := range morx.Chains {
+		for _, subtable := range chain.Subtables {
+			if subtable.SubFeatureFlags&chain.DefaultFlags == 0 || subtable.Coverage&0xA0000000 == 0x80000000 {
+				continue // disabled or vertical only
+			}
+			descending := subtable.Coverage&0x40000000 != 0
+			if descending {
+				reverseGlyphs(glyphs)
+			}
+			glyphs = subtable.Apply(glyphs)
+			if descending {
+				reverseGlyphs(glyphs)
+			}
 		}
 	}
-	return 0
-}
 
-type kernTable struct {
-	Subtables []kernFormat0
+	n := 0
+	for _, glyphID := range glyphs {
+		if glyphID != aatDeletedGlyph {
+			glyphs[n] = glyphID
+			n++
+		}
+	}
+	return glyphs[:n]
 }
 
-func (kern *kernTable) Get(l, r uint16) (k int16) {
-	for _, subtable := range kern.Subtables {
-		if !subtable.Coverage[1] {
-			k += subtable.Get(l, r)
-		} else if min := subtable.Get(l, r); k < min {
-			// TODO: test
-			k = min
-		}
+func reverseGlyphs(glyphs []uint16) {
+	for i, j := 0, len(glyphs)-1; i < j; i, j = i+1, j-1 {
+		glyphs[i], glyphs[j] = glyphs[j], glyphs[i]
 	}
-	return
 }
 
-func (sfnt *SFNT) parseKern() error {
-	b, ok := sfnt.Tables["kern"]
+func (sfnt *SFNT) parseMorx() error {
+	// requires data from maxp
+	b, ok := sfnt.Tables["morx"]
 	if !ok {
-		return fmt.Errorf("kern: missing table")
-	} else if len(b) < 4 {
-		return fmt.Errorf("kern: bad table")
+		return fmt.Errorf("morx: missing table")
+	} else if len(b) < 8 {
+		return fmt.Errorf("morx: bad table")
 	}
 
 	r := newBinaryReader(b)
-	version := r.ReadUint16()
-	if version != 0 {
-		// TODO: supported other kern versions
-		return fmt.Errorf("kern: bad version")
+	if version := r.ReadUint16(); version != 2 && version != 3 {
+		return fmt.Errorf("morx: bad version")
 	}
+	_ = r.ReadUint16() // unused
+	nChains := r.ReadUint32()
 
-	nTables := r.ReadUint16()
-	sfnt.Kern = &kernTable{}
-	for j := 0; j < int(nTables); j++ {
-		if r.Len() < 6 {
-			return fmt.Errorf("kern: bad subtable %d", j)
+	sfnt.Morx = &morxTable{}
+	for k := 0; k < int(nChains); k++ {
+		chainStart := r.Pos()
+		defaultFlags := r.ReadUint32()
+		chainLength := r.ReadUint32()
+		nFeatureEntries := r.ReadUint32()
+		nSubtables := r.ReadUint32()
+		if r.EOF() || chainLength < 16 || uint32(len(b))-chainStart < chainLength || (chainLength-16)/12 < nFeatureEntries {
+			return fmt.Errorf("morx: bad chain %d", k)
 		}
+		_ = r.ReadBytes(12 * nFeatureEntries) // feature entries
 
-		subtable := kernFormat0{}
-		startPos := r.Pos()
-		subtableVersion := r.ReadUint16()
-		if subtableVersion != 0 {
-			// TODO: supported other kern subtable versions
-			continue
-		}
-		length := r.ReadUint16()
-		format := r.ReadUint8()
-		subtable.Coverage = uint8ToFlags(r.ReadUint8())
-		if format != 0 {
-			// TODO: supported other kern subtable formats
-			continue
-		}
-		if r.Len() < 8 {
-			return fmt.Errorf("kern: bad subtable %d", j)
-		}
-		nPairs := r.ReadUint16()
-		_ = r.ReadUint16() // searchRange
-		_ = r.ReadUint16() // entrySelector
-		_ = r.ReadUint16() // rangeShift
-		if uint32(length) < 14+6*uint32(nPairs) {
-			return fmt.Errorf("kern: bad length for subtable %d", j)
-		}
+		chain := morxChain{DefaultFlags: defaultFlags}
+		chainEnd := chainStart + chainLength
+		for j := 0; j < int(nSubtables); j++ {
+			subtableStart := r.Pos()
+			length := r.ReadUint32()
+			coverage := r.ReadUint32()
+			subFeatureFlags := r.ReadUint32()
+			if r.EOF() || length < 12 || chainEnd < subtableStart || chainEnd-subtableStart < length {
+				return fmt.Errorf("morx: bad subtable %d in chain %d", j, k)
+			}
+			body := r.ReadBytes(length - 12)
 
-		subtable.Pairs = make([]kernPair, nPairs)
-		for i := 0; i < int(nPairs); i++ {
-			subtable.Pairs[i].Key = r.ReadUint32()
-			subtable.Pairs[i].Value = r.ReadInt16()
-			if 0 < i && subtable.Pairs[i].Key <= subtable.Pairs[i-1].Key {
-				return fmt.Errorf("kern: bad left right pair for subtable %d", j)
+			var subtable morxSubtable
+			switch coverage & 0xFF {
+			case 1:
+				rs := newBinaryReader(body)
+				_ = rs.ReadBytes(16) // state table header
+				substitutionTableOffset := rs.ReadUint32()
+				stateTable, err := parseAATStateTable(body, sfnt.Maxp.NumGlyphs, 8)
+				if err != nil || rs.EOF() || uint32(len(body)) < substitutionTableOffset {
+					return fmt.Errorf("morx: bad contextual subtable %d in chain %d", j, k)
+				}
+
+				// the number of substitution tables is the highest index in the entries plus one
+				n := 0
+				for i := 0; i+8 <= len(stateTable.Entries); i += 8 {
+					for _, index := range []uint16{binary.BigEndian.Uint16(stateTable.Entries[i+4:]), binary.BigEndian.Uint16(stateTable.Entries[i+6:])} {
+						if index != 0xFFFF && n <= int(index) {
+							n = int(index) + 1
+						}
+					}
+				}
+				contextual := &morxContextualSubtable{aatStateTable: stateTable}
+				bs := body[substitutionTableOffset:]
+				for i := 0; i < n && 4*uint32(i+1) <= uint32(len(bs)); i++ {
+					offset := binary.BigEndian.Uint32(bs[4*i:])
+					if uint32(len(bs)) < offset {
+						return fmt.Errorf("morx: bad contextual subtable %d in chain %d", j, k)
+					}
+					lookup, err := parseAATLookup(bs[offset:], sfnt.Maxp.NumGlyphs)
+					if err != nil {
+						return fmt.Errorf("morx: %v in subtable %d in chain %d", err, j, k)
+					}
+					contextual.Substitutions = append(contextual.Substitutions, lookup)
+				}
+				subtable = contextual
+			case 2:
+				rs := newBinaryReader(body)
+				_ = rs.ReadBytes(16) // state table header
+				ligActionOffset := rs.ReadUint32()
+				componentOffset := rs.ReadUint32()
+				ligatureOffset := rs.ReadUint32()
+				stateTable, err := parseAATStateTable(body, sfnt.Maxp.NumGlyphs, 6)
+				if err != nil || rs.EOF() || uint32(len(body)) < ligActionOffset || uint32(len(body)) < componentOffset || uint32(len(body)) < ligatureOffset {
+					return fmt.Errorf("morx: bad ligature subtable %d in chain %d", j, k)
+				}
+				subtable = &morxLigatureSubtable{
+					aatStateTable: stateTable,
+					LigActions:    body[ligActionOffset:],
+					Components:    body[componentOffset:],
+					Ligatures:     body[ligatureOffset:],
+				}
+			case 4:
+				lookup, err := parseAATLookup(body, sfnt.Maxp.NumGlyphs)
+				if err != nil {
+					return fmt.Errorf("morx: %v in subtable %d in chain %d", err, j, k)
+				}
+				subtable = &morxNoncontextualSubtable{lookup}
+			default:
+				// TODO: support rearrangement and insertion subtables
+				continue
 			}
+			chain.Subtables = append(chain.Subtables, morxChainSubtable{subtable, coverage, subFeatureFlags})
 		}
-
-		// read unread bytes if length is bigger
-		_ = r.ReadBytes(uint32(length) - (r.Pos() - startPos))
-		sfnt.Kern.Subtables = append(sfnt.Kern.Subtables, subtable)
+		sfnt.Morx.Chains = append(sfnt.Morx.Chains, chain)
+		r.Seek(chainEnd)
 	}
 	return nil
 }
 
 ////////////////////////////////////////////////////////////////
 
-type locaTable struct {
-	Offsets []uint32
+type variationRegionAxis struct {
+	Start, Peak, End float64
 }
 
-func (sfnt *SFNT) parseLoca() error {
-	b, ok := sfnt.Tables["loca"]
-	if !ok {
-		return fmt.Errorf("loca: missing table")
+// itemVariationStore is the item variation store of OpenType variable fonts that holds the deltas of values for the regions of the design space, see https://learn.microsoft.com/en-us/typography/opentype/spec/otvarcommonformats#item-variation-store
+type itemVariationStore struct {
+	Regions [][]variationRegionAxis // per region per axis
+	Data    []itemVariationData
+}
+
+type itemVariationData struct {
+	RegionIndices []uint16
+	Deltas        [][]int32 // per item per region index
+}
+
+// Delta returns the interpolated delta of the item at the given normalized coordinates in [-1,1] per axis, where missing coordinates are zero.
+func (store *itemVariationStore) Delta(outer, inner uint16, coords []float64) (float64, bool) {
+	if len(store.Data) <= int(outer) || len(store.Data[outer].Deltas) <= int(inner) {
+		return 0.0, false
 	}
+	data := store.Data[outer]
+	delta := 0.0
+	for i, regionIndex := range data.RegionIndices {
+		if scalar := store.scalar(regionIndex, coords); scalar != 0.0 {
+			delta += scalar * float64(data.Deltas[inner][i])
+		}
+	}
+	return delta, true
+}
 
-	sfnt.Loca = &locaTable{}
-	sfnt.Loca.Offsets = make([]uint32, sfnt.Maxp.NumGlyphs+1)
+// scalar returns the contribution of the region at the given normalized coordinates.
+func (store *itemVariationStore) scalar(regionIndex uint16, coords []float64) float64 {
+	scalar := 1.0
+	for i, axis := range store.Regions[regionIndex] {
+		coord := 0.0
+		if i < len(coords) {
+			coord = coords[i]
+		}
+		if axis.Peak == 0.0 || coord == axis.Peak || axis.Peak < axis.Start || axis.End < axis.Peak || axis.Start < 0.0 && 0.0 < axis.End {
+			continue // axis does not participate or is invalid
+		} else if coord <= axis.Start || axis.End <= coord {
+			return 0.0
+		} else if coord < axis.Peak {
+			scalar *= (coord - axis.Start) / (axis.Peak - axis.Start)
+		} else {
+			scalar *= (axis.End - coord) / (axis.End - axis.Peak)
+		}
+	}
+	return scalar
+}
+
+func parseItemVariationStore(b []byte, offset uint32) (*itemVariationStore, error) {
+	if uint32(len(b)) < offset || len(b)-int(offset) < 8 {
+		return nil, fmt.Errorf("bad item variation store")
+	}
+	b = b[offset:]
 	r := newBinaryReader(b)
-	if sfnt.Head.IndexToLocFormat == 0 {
-		if uint32(len(b)) != 2*(uint32(sfnt.Maxp.NumGlyphs)+1) {
-			return fmt.Errorf("loca: bad table")
+	if format := r.ReadUint16(); format != 1 {
+		return nil, fmt.Errorf("bad item variation store format")
+	}
+	regionListOffset := r.ReadUint32()
+	dataCount := r.ReadUint16()
+	if r.Len() < 4*uint32(dataCount) {
+		return nil, fmt.Errorf("bad item variation store")
+	}
+	dataOffsets := make([]uint32, dataCount)
+	for i := range dataOffsets {
+		dataOffsets[i] = r.ReadUint32()
+	}
+
+	store := &itemVariationStore{}
+	r.Seek(regionListOffset)
+	axisCount := r.ReadUint16()
+	regionCount := r.ReadUint16()
+	if r.Err() != nil || r.Len()/6 < uint32(axisCount)*uint32(regionCount) {
+		return nil, fmt.Errorf("bad variation region list")
+	}
+	f2dot14 := func() float64 {
+		return float64(r.ReadInt16()) / 16384.0
+	}
+	store.Regions = make([][]variationRegionAxis, regionCount)
+	for i := range store.Regions {
+		store.Regions[i] = make([]variationRegionAxis, axisCount)
+		for j := range store.Regions[i] {
+			store.Regions[i][j].Start = f2dot14()
+			store.Regions[i][j].Peak = f2dot14()
+			store.Regions[i][j].End = f2dot14()
 		}
-		for i := 0; i < int(sfnt.Maxp.NumGlyphs+1); i++ {
-			sfnt.Loca.Offsets[i] = uint32(r.ReadUint16())
-			if 0 < i && sfnt.Loca.Offsets[i] < sfnt.Loca.Offsets[i-1] {
-				return fmt.Errorf("loca: bad offsets")
+	}
+
+	store.Data = make([]itemVariationData, dataCount)
+	for i, dataOffset := range dataOffsets {
+		r.Seek(dataOffset)
+		itemCount := r.ReadUint16()
+		wordDeltaCount := r.ReadUint16()
+		regionIndexCount := r.ReadUint16()
+		longWords := wordDeltaCount&0x8000 != 0
+		wordCount := wordDeltaCount & 0x7FFF
+		if r.Err() != nil || regionIndexCount < wordCount || r.Len()/2 < uint32(regionIndexCount) {
+			return nil, fmt.Errorf("bad item variation data %d", i)
+		}
+
+		data := &store.Data[i]
+		data.RegionIndices = make([]uint16, regionIndexCount)
+		for j := range data.RegionIndices {
+			data.RegionIndices[j] = r.ReadUint16()
+			if regionCount <= data.RegionIndices[j] {
+				return nil, fmt.Errorf("bad region index in item variation data %d", i)
 			}
 		}
-	} else if sfnt.Head.IndexToLocFormat == 1 {
-		if uint32(len(b)) != 4*(uint32(sfnt.Maxp.NumGlyphs)+1) {
-			return fmt.Errorf("loca: bad table")
+
+		rowSize := 2*uint32(wordCount) + uint32(regionIndexCount-wordCount)
+		if longWords {
+			rowSize *= 2
 		}
-		for i := 0; i < int(sfnt.Maxp.NumGlyphs+1); i++ {
-			sfnt.Loca.Offsets[i] = r.ReadUint32()
-			if 0 < i && sfnt.Loca.Offsets[i] < sfnt.Loca.Offsets[i-1] {
-				return fmt.Errorf("loca: bad offsets")
+		if rowSize != 0 && r.Len()/rowSize < uint32(itemCount) {
+			return nil, fmt.Errorf("bad item variation data %d", i)
+		}
+		data.Deltas = make([][]int32, itemCount)
+		for j := range data.Deltas {
+			data.Deltas[j] = make([]int32, regionIndexCount)
+			for k := range data.Deltas[j] {
+				if longWords && k < int(wordCount) {
+					data.Deltas[j][k] = r.ReadInt32()
+				} else if longWords || k < int(wordCount) {
+					data.Deltas[j][k] = int32(r.ReadInt16())
+				} else {
+					data.Deltas[j][k] = int32(r.ReadInt8())
+				}
 			}
 		}
 	}
-	return nil
+	return store, nil
 }
 
 ////////////////////////////////////////////////////////////////
 
-type maxpTable struct {
-	NumGlyphs             uint16
-	MaxPoints             uint16
-	MaxContours           uint16
-	MaxCompositePoints    uint16
-	MaxCompositeContours  uint16
-	MaxZones              uint16
-	MaxTwilightPoints     uint16
-	MaxStorage            uint16
-	MaxFunctionDefs       uint16
-	MaxInstructionDefs    uint16
-	MaxStackElements      uint16
-	MaxSizeOfInstructions uint16
-	MaxComponentElements  uint16
-	MaxComponentDepth     uint16
+type mvarValueRecord struct {
+	Tag        string
+	OuterIndex uint16
+	InnerIndex uint16
 }
 
-func (sfnt *SFNT) parseMaxp() error {
-	b, ok := sfnt.Tables["maxp"]
+type mvarTable struct {
+	Values []mvarValueRecord // sorted by tag
+	Store  *itemVariationStore
+}
+
+// Delta returns the delta in font units of the metric with the given value tag at the normalized coordinates.
+func (mvar *mvarTable) Delta(tag string, coords []float64) (float64, bool) {
+	i := sort.Search(len(mvar.Values), func(i int) bool { return tag <= mvar.Values[i].Tag })
+	if i == len(mvar.Values) || mvar.Values[i].Tag != tag || mvar.Store == nil {
+		return 0.0, false
+	}
+	return mvar.Store.Delta(mvar.Values[i].OuterIndex, mvar.Values[i].InnerIndex, coords)
+}
+
+func (sfnt *SFNT) parseMVAR() error {
+	b, ok := sfnt.Tables["MVAR"]
 	if !ok {
-		return fmt.Errorf("maxp: missing table")
+		return fmt.Errorf("MVAR: missing table")
+	} else if len(b) < 12 {
+		return fmt.Errorf("MVAR: bad table")
 	}
 
-	sfnt.Maxp = &maxpTable{}
 	r := newBinaryReader(b)
-	version := r.ReadBytes(4)
-	sfnt.Maxp.NumGlyphs = r.ReadUint16()
-	if binary.BigEndian.Uint32(version) == 0x00005000 && !sfnt.IsTrueType && len(b) == 6 {
-		return nil
-	} else if binary.BigEndian.Uint32(version) == 0x00010000 && !sfnt.IsCFF && len(b) == 32 {
-		sfnt.Maxp.MaxPoints = r.ReadUint16()
-		sfnt.Maxp.MaxContours = r.ReadUint16()
-		sfnt.Maxp.MaxCompositePoints = r.ReadUint16()
-		sfnt.Maxp.MaxCompositeContours = r.ReadUint16()
-		sfnt.Maxp.MaxZones = r.ReadUint16()
-		sfnt.Maxp.MaxTwilightPoints = r.ReadUint16()
-		sfnt.Maxp.MaxStorage = r.ReadUint16()
-		sfnt.Maxp.MaxFunctionDefs = r.ReadUint16()
-		sfnt.Maxp.MaxInstructionDefs = r.ReadUint16()
-		sfnt.Maxp.MaxStackElements = r.ReadUint16()
-		sfnt.Maxp.MaxSizeOfInstructions = r.ReadUint16()
-		sfnt.Maxp.MaxComponentElements = r.ReadUint16()
-		sfnt.Maxp.MaxComponentDepth = r.ReadUint16()
-		return nil
+	if majorVersion := r.ReadUint16(); majorVersion != 1 {
+		return fmt.Errorf("MVAR: bad version")
 	}
-	return fmt.Errorf("maxp: bad table")
+	_ = r.ReadUint16() // minorVersion
+	_ = r.ReadUint16() // reserved
+	valueRecordSize := r.ReadUint16()
+	valueRecordCount := r.ReadUint16()
+	itemVariationStoreOffset := r.ReadUint16()
+	if valueRecordCount != 0 && (valueRecordSize < 8 || r.Len()/uint32(valueRecordSize) < uint32(valueRecordCount)) {
+		return fmt.Errorf("MVAR: bad table")
+	}
+
+	sfnt.Mvar = &mvarTable{}
+	sfnt.Mvar.Values = make([]mvarValueRecord, valueRecordCount)
+	for i := range sfnt.Mvar.Values {
+		r.Seek(12 + uint32(i)*uint32(valueRecordSize))
+		sfnt.Mvar.Values[i].Tag = r.ReadString(4)
+		sfnt.Mvar.Values[i].OuterIndex = r.ReadUint16()
+		sfnt.Mvar.Values[i].InnerIndex = r.ReadUint16()
+		if 0 < i && sfnt.Mvar.Values[i].Tag <= sfnt.Mvar.Values[i-1].Tag {
+			return fmt.Errorf("MVAR: value records not in order")
+		}
+	}
+	if itemVariationStoreOffset != 0 {
+		var err error
+		if sfnt.Mvar.Store, err = parseItemVariationStore(b, uint32(itemVariationStoreOffset)); err != nil {
+			return fmt.Errorf("MVAR: %w", err)
+		}
+	}
+	return nil
 }
 
 ////////////////////////////////////////////////////////////////
@@ -1148,6 +4223,52 @@ type nameTable struct {
 	Data          []byte
 }
 
+// Get returns the name for the name ID, preferring English names of the Windows platform over those of the Unicode and Macintosh platforms. Macintosh names are only decoded correctly for ASCII.
+func (name *nameTable) Get(nameID uint16) (string, bool) {
+	if name == nil {
+		return "", false
+	}
+
+	best, bestRank := -1, 0
+	for i, record := range name.NameRecord {
+		if record.NameID != nameID || len(name.Data) < int(record.Offset)+int(record.Length) {
+			continue
+		}
+		rank := 0
+		if record.PlatformID == 3 && (record.EncodingID == 0 || record.EncodingID == 1 || record.EncodingID == 10) {
+			rank = 3
+			if record.LanguageID == 0x0409 {
+				rank = 4
+			}
+		} else if record.PlatformID == 0 {
+			rank = 2
+		} else if record.PlatformID == 1 && record.EncodingID == 0 && record.LanguageID == 0 {
+			rank = 1
+		}
+		if bestRank < rank {
+			best, bestRank = i, rank
+		}
+	}
+	if best == -1 {
+		return "", false
+	}
+
+	record := name.NameRecord[best]
+	b := name.Data[int(record.Offset) : int(record.Offset)+int(record.Length)]
+	if record.PlatformID == 1 {
+		rs := make([]rune, len(b))
+		for i, c := range b {
+			rs[i] = rune(c)
+		}
+		return string(rs), true
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u)), true
+}
+
 func (sfnt *SFNT) parseName() error {
 	b, ok := sfnt.Tables["name"]
 	if !ok {
@@ -1163,7 +4284,7 @@ func (sfnt *SFNT) parseName() error {
 		return fmt.Errorf("name: bad version")
 	}
 	count := r.ReadUint16()
-	_ = r.ReadUint16() // storageOffset
+	storageOffset := r.ReadUint16()
 	if uint32(len(b)) < 6+12*uint32(count) {
 		return fmt.Errorf("name: bad table")
 	}
@@ -1184,12 +4305,16 @@ func (sfnt *SFNT) parseName() error {
 		if uint32(len(b)) < 6+12*uint32(count)+2+4*uint32(langTagCount) {
 			return fmt.Errorf("name: bad table")
 		}
+		sfnt.Name.LangTagRecord = make([]nameLangTagRecord, langTagCount)
 		for i := 0; i < int(langTagCount); i++ {
 			sfnt.Name.LangTagRecord[i].Length = r.ReadUint16()
 			sfnt.Name.LangTagRecord[i].Offset = r.ReadUint16()
 		}
 	}
-	sfnt.Name.Data = b[r.Pos():]
+	if uint32(len(b)) < uint32(storageOffset) || uint32(storageOffset) < r.Pos() {
+		return fmt.Errorf("name: bad storage offset")
+	}
+	sfnt.Name.Data = b[storageOffset:]
 	return nil
 }
 
@@ -1243,6 +4368,8 @@ type os2Table struct {
 	UsMaxContent            uint16
 	UsLowerOpticalPointSize uint16
 	UsUpperOpticalPointSize uint16
+
+	HasTypoMetrics bool // false for the short version 0 layout without typographic and Windows metrics
 }
 
 func (sfnt *SFNT) parseOS2() error {
@@ -1258,10 +4385,10 @@ func (sfnt *SFNT) parseOS2() error {
 	version := r.ReadUint16()
 	if 5 < version {
 		return fmt.Errorf("OS/2: bad version")
-	} else if version == 0 && len(b) != 68 && len(b) != 78 ||
-		version == 1 && len(b) != 86 ||
-		2 <= version && version <= 4 && len(b) != 96 ||
-		version == 5 && len(b) != 100 {
+	} else if version == 1 && len(b) < 86 ||
+		2 <= version && version <= 4 && len(b) < 96 ||
+		version == 5 && len(b) < 100 {
+		// tables may be longer than defined by their version, trailing bytes are ignored
 		return fmt.Errorf("OS/2: bad table")
 	}
 	sfnt.OS2.XAvgCharWidth = r.ReadInt16()
@@ -1298,6 +4425,7 @@ func (sfnt *SFNT) parseOS2() error {
 	sfnt.OS2.UsFirstCharIndex = r.ReadUint16()
 	sfnt.OS2.UsLastCharIndex = r.ReadUint16()
 	if 78 <= len(b) {
+		sfnt.OS2.HasTypoMetrics = true
 		sfnt.OS2.STypoAscender = r.ReadInt16()
 		sfnt.OS2.STypoDescender = r.ReadInt16()
 		sfnt.OS2.STypoLineGap = r.ReadInt16()
@@ -1367,6 +4495,13 @@ func (sfnt *SFNT) parsePost() error {
 	sfnt.Post.MinMemType1 = r.ReadUint32()
 	sfnt.Post.MaxMemType1 = r.ReadUint32()
 	if binary.BigEndian.Uint32(version) == 0x00010000 && !sfnt.IsCFF && len(b) == 32 {
+		// glyphs use the standard Macintosh glyph names in order
+		numGlyphs := int(sfnt.Maxp.NumGlyphs)
+		if len(macintoshGlyphNames) < numGlyphs {
+			numGlyphs = len(macintoshGlyphNames)
+		}
+		sfnt.Post.GlyphName = make([]string, numGlyphs)
+		copy(sfnt.Post.GlyphName, macintoshGlyphNames)
 		return nil
 	} else if binary.BigEndian.Uint32(version) == 0x00020000 && !sfnt.IsCFF && 34 <= len(b) {
 		if r.ReadUint16() != sfnt.Maxp.NumGlyphs {
@@ -1378,6 +4513,9 @@ func (sfnt *SFNT) parsePost() error {
 
 		// get string data first
 		r.Seek(34 + 2*uint32(sfnt.Maxp.NumGlyphs))
+		if 0 < sfnt.options.MaxPostStringBytes && uint32(sfnt.options.MaxPostStringBytes) < r.Len() {
+			return ErrLimitExceeded
+		}
 		stringData := []string{}
 		for 2 <= r.Len() {
 			length := r.ReadUint8()
@@ -1396,7 +4534,7 @@ func (sfnt *SFNT) parsePost() error {
 			index := r.ReadUint16()
 			if index < 258 {
 				sfnt.Post.GlyphName[i] = macintoshGlyphNames[index]
-			} else if len(stringData) < int(index)-258 {
+			} else if len(stringData) <= int(index)-258 {
 				return fmt.Errorf("post: bad table")
 			} else {
 				sfnt.Post.GlyphName[i] = stringData[index-258]
@@ -1410,3 +4548,154 @@ func (sfnt *SFNT) parsePost() error {
 	}
 	return fmt.Errorf("post: bad table")
 }
+
+////////////////////////////////////////////////////////////////
+
+// StyleAxis is a design axis of the STAT table, such as weight or width, with the named values of the font family along the axis.
+type StyleAxis struct {
+	Tag      string
+	Name     string
+	Ordering uint16 // order of the axis when composing style names
+	Values   []StyleValue
+}
+
+// StyleValue is a named value on a design axis, such as "SemiBold" at weight 600. Min and Max are the range of the value for format 2 axis values and equal to Value otherwise, and LinkedValue is the style-linked value for format 3 axis values (such as Bold for Regular) and zero otherwise.
+type StyleValue struct {
+	Name        string
+	Flags       uint16 // 0x0001 is OLDER_SIBLING_FONT_ATTRIBUTE and 0x0002 is ELIDABLE_AXIS_VALUE_NAME
+	Value       float64
+	Min, Max    float64
+	LinkedValue float64
+}
+
+// StyleCombination is a named combination of values on several axes of format 4 axis values, such as "Caption" for a particular weight and optical size. Values maps the axis tags to their values.
+type StyleCombination struct {
+	Name   string
+	Flags  uint16
+	Values map[string]float64
+}
+
+type statAxisRecord struct {
+	Tag      string
+	NameID   uint16
+	Ordering uint16
+}
+
+type statAxisValue struct {
+	Format      uint16
+	AxisIndex   uint16 // for formats 1-3
+	Flags       uint16
+	NameID      uint16
+	Value       float64
+	Min, Max    float64   // for format 2
+	LinkedValue float64   // for format 3
+	AxisIndices []uint16  // for format 4
+	Values      []float64 // for format 4
+}
+
+type statTable struct {
+	DesignAxes           []statAxisRecord
+	AxisValues           []statAxisValue
+	ElidedFallbackNameID uint16
+}
+
+func (sfnt *SFNT) parseSTAT() error {
+	b, ok := sfnt.Tables["STAT"]
+	if !ok {
+		return fmt.Errorf("STAT: missing table")
+	} else if len(b) < 18 {
+		return fmt.Errorf("STAT: bad table")
+	}
+
+	r := newBinaryReader(b)
+	majorVersion := r.ReadUint16()
+	minorVersion := r.ReadUint16()
+	if majorVersion != 1 {
+		return fmt.Errorf("STAT: bad version")
+	}
+	designAxisSize := r.ReadUint16()
+	designAxisCount := r.ReadUint16()
+	designAxesOffset := r.ReadUint32()
+	axisValueCount := r.ReadUint16()
+	offsetToAxisValueOffsets := r.ReadUint32()
+
+	sfnt.Stat = &statTable{}
+	if 1 <= minorVersion {
+		if len(b) < 20 {
+			return fmt.Errorf("STAT: bad table")
+		}
+		sfnt.Stat.ElidedFallbackNameID = r.ReadUint16()
+	}
+
+	if designAxisCount != 0 && (designAxisSize < 8 || uint32(len(b)) < designAxesOffset || (uint32(len(b))-designAxesOffset)/uint32(designAxisSize) < uint32(designAxisCount)) {
+		return fmt.Errorf("STAT: bad design axes")
+	}
+	sfnt.Stat.DesignAxes = make([]statAxisRecord, designAxisCount)
+	for i := range sfnt.Stat.DesignAxes {
+		r.Seek(designAxesOffset + uint32(i)*uint32(designAxisSize))
+		sfnt.Stat.DesignAxes[i].Tag = r.ReadString(4)
+		sfnt.Stat.DesignAxes[i].NameID = r.ReadUint16()
+		sfnt.Stat.DesignAxes[i].Ordering = r.ReadUint16()
+	}
+
+	if axisValueCount == 0 {
+		return nil
+	} else if uint32(len(b)) < offsetToAxisValueOffsets || (uint32(len(b))-offsetToAxisValueOffsets)/2 < uint32(axisValueCount) {
+		return fmt.Errorf("STAT: bad axis values")
+	}
+	fixed := func(r *binaryReader) float64 {
+		return float64(int32(r.ReadUint32())) / 65536.0
+	}
+	sfnt.Stat.AxisValues = make([]statAxisValue, 0, axisValueCount)
+	for i := 0; i < int(axisValueCount); i++ {
+		r.Seek(offsetToAxisValueOffsets + 2*uint32(i))
+		offset := offsetToAxisValueOffsets + uint32(r.ReadUint16())
+		if uint32(len(b)) < offset+2 {
+			return fmt.Errorf("STAT: bad axis value %d", i)
+		}
+
+		rv := newBinaryReader(b[offset:])
+		value := statAxisValue{}
+		value.Format = rv.ReadUint16()
+		switch value.Format {
+		case 1, 2, 3:
+			value.AxisIndex = rv.ReadUint16()
+			value.Flags = rv.ReadUint16()
+			value.NameID = rv.ReadUint16()
+			value.Value = fixed(rv)
+			value.Min, value.Max = value.Value, value.Value
+			if value.Format == 2 {
+				value.Min = fixed(rv)
+				value.Max = fixed(rv)
+			} else if value.Format == 3 {
+				value.LinkedValue = fixed(rv)
+			}
+			if designAxisCount <= value.AxisIndex {
+				return fmt.Errorf("STAT: bad axis index for axis value %d", i)
+			}
+		case 4:
+			axisCount := rv.ReadUint16()
+			value.Flags = rv.ReadUint16()
+			value.NameID = rv.ReadUint16()
+			value.AxisIndices = make([]uint16, axisCount)
+			value.Values = make([]float64, axisCount)
+			for j := 0; j < int(axisCount); j++ {
+				value.AxisIndices[j] = rv.ReadUint16()
+				value.Values[j] = fixed(rv)
+				if designAxisCount <= value.AxisIndices[j] {
+					return fmt.Errorf("STAT: bad axis index for axis value %d", i)
+				}
+			}
+		default:
+			continue // ignore unknown formats
+		}
+		if rv.Err() != nil {
+			return fmt.Errorf("STAT: bad axis value %d", i)
+		}
+		sfnt.Stat.AxisValues = append(sfnt.Stat.AxisValues, value)
+	}
+	if r.Err() != nil {
+		return fmt.Errorf("STAT: bad table")
+	}
+	return nil
+}
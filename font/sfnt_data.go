@@ -260,3 +260,192 @@ var macintoshGlyphNames []string = []string{
 	"ccaron",
 	"dcroat",
 }
+
+// os2UnicodeRanges are the names of the Unicode ranges for each bit in the OS/2 ulUnicodeRange fields, see https://docs.microsoft.com/en-us/typography/opentype/spec/os2#ur
+var os2UnicodeRanges = []string{
+	"Basic Latin",                 // 0
+	"Latin-1 Supplement",          // 1
+	"Latin Extended-A",            // 2
+	"Latin Extended-B",            // 3
+	"IPA Extensions",              // 4
+	"Spacing Modifier Letters",    // 5
+	"Combining Diacritical Marks", // 6
+	"Greek and Coptic",            // 7
+	"Coptic",                      // 8
+	"Cyrillic",                    // 9
+	"Armenian",                    // 10
+	"Hebrew",                      // 11
+	"Vai",                         // 12
+	"Arabic",                      // 13
+	"NKo",                         // 14
+	"Devanagari",                  // 15
+	"Bengali",                     // 16
+	"Gurmukhi",                    // 17
+	"Gujarati",                    // 18
+	"Oriya",                       // 19
+	"Tamil",                       // 20
+	"Telugu",                      // 21
+	"Kannada",                     // 22
+	"Malayalam",                   // 23
+	"Thai",                        // 24
+	"Lao",                         // 25
+	"Georgian",                    // 26
+	"Balinese",                    // 27
+	"Hangul Jamo",                 // 28
+	"Latin Extended Additional",   // 29
+	"Greek Extended",              // 30
+	"General Punctuation",         // 31
+	"Superscripts And Subscripts", // 32
+	"Currency Symbols",            // 33
+	"Combining Diacritical Marks For Symbols", // 34
+	"Letterlike Symbols",                      // 35
+	"Number Forms",                            // 36
+	"Arrows",                                  // 37
+	"Mathematical Operators",                  // 38
+	"Miscellaneous Technical",                 // 39
+	"Control Pictures",                        // 40
+	"Optical Character Recognition",           // 41
+	"Enclosed Alphanumerics",                  // 42
+	"Box Drawing",                             // 43
+	"Block Elements",                          // 44
+	"Geometric Shapes",                        // 45
+	"Miscellaneous Symbols",                   // 46
+	"Dingbats",                                // 47
+	"CJK Symbols And Punctuation",             // 48
+	"Hiragana",                                // 49
+	"Katakana",                                // 50
+	"Bopomofo",                                // 51
+	"Hangul Compatibility Jamo",               // 52
+	"Phags-pa",                                // 53
+	"Enclosed CJK Letters And Months",         // 54
+	"CJK Compatibility",                       // 55
+	"Hangul Syllables",                        // 56
+	"Non-Plane 0",                             // 57
+	"Phoenician",                              // 58
+	"CJK Unified Ideographs",                  // 59
+	"Private Use Area (plane 0)",              // 60
+	"CJK Strokes",                             // 61
+	"Alphabetic Presentation Forms",           // 62
+	"Arabic Presentation Forms-A",             // 63
+	"Combining Half Marks",                    // 64
+	"Vertical Forms",                          // 65
+	"Small Form Variants",                     // 66
+	"Arabic Presentation Forms-B",             // 67
+	"Halfwidth And Fullwidth Forms",           // 68
+	"Specials",                                // 69
+	"Tibetan",                                 // 70
+	"Syriac",                                  // 71
+	"Thaana",                                  // 72
+	"Sinhala",                                 // 73
+	"Myanmar",                                 // 74
+	"Ethiopic",                                // 75
+	"Cherokee",                                // 76
+	"Unified Canadian Aboriginal Syllabics",   // 77
+	"Ogham",                                   // 78
+	"Runic",                                   // 79
+	"Khmer",                                   // 80
+	"Mongolian",                               // 81
+	"Braille Patterns",                        // 82
+	"Yi Syllables",                            // 83
+	"Tagalog",                                 // 84
+	"Old Italic",                              // 85
+	"Gothic",                                  // 86
+	"Deseret",                                 // 87
+	"Byzantine Musical Symbols",               // 88
+	"Mathematical Alphanumeric Symbols",       // 89
+	"Private Use (plane 15)",                  // 90
+	"Variation Selectors",                     // 91
+	"Tags",                                    // 92
+	"Limbu",                                   // 93
+	"Tai Le",                                  // 94
+	"New Tai Lue",                             // 95
+	"Buginese",                                // 96
+	"Glagolitic",                              // 97
+	"Tifinagh",                                // 98
+	"Yijing Hexagram Symbols",                 // 99
+	"Syloti Nagri",                            // 100
+	"Linear B Syllabary",                      // 101
+	"Ancient Greek Numbers",                   // 102
+	"Ugaritic",                                // 103
+	"Old Persian",                             // 104
+	"Shavian",                                 // 105
+	"Osmanya",                                 // 106
+	"Cypriot Syllabary",                       // 107
+	"Kharoshthi",                              // 108
+	"Tai Xuan Jing Symbols",                   // 109
+	"Cuneiform",                               // 110
+	"Counting Rod Numerals",                   // 111
+	"Sundanese",                               // 112
+	"Lepcha",                                  // 113
+	"Ol Chiki",                                // 114
+	"Saurashtra",                              // 115
+	"Kayah Li",                                // 116
+	"Rejang",                                  // 117
+	"Cham",                                    // 118
+	"Ancient Symbols",                         // 119
+	"Phaistos Disc",                           // 120
+	"Carian",                                  // 121
+	"Domino Tiles",                            // 122
+}
+
+// os2CodePageRanges are the names of the code pages for each bit in the OS/2 ulCodePageRange fields, where reserved bits are empty, see https://docs.microsoft.com/en-us/typography/opentype/spec/os2#cpr
+var os2CodePageRanges = [64]string{
+	0:  "1252 Latin 1",
+	1:  "1250 Latin 2: Eastern Europe",
+	2:  "1251 Cyrillic",
+	3:  "1253 Greek",
+	4:  "1254 Turkish",
+	5:  "1255 Hebrew",
+	6:  "1256 Arabic",
+	7:  "1257 Windows Baltic",
+	8:  "1258 Vietnamese",
+	16: "874 Thai",
+	17: "932 JIS/Japan",
+	18: "936 Chinese: Simplified chars--PRC and Singapore",
+	19: "949 Korean Wansung",
+	20: "950 Chinese: Traditional chars--Taiwan and Hong Kong",
+	21: "1361 Korean Johab",
+	29: "Macintosh Character Set (US Roman)",
+	30: "OEM Character Set",
+	31: "Symbol Character Set",
+	48: "869 IBM Greek",
+	49: "866 MS-DOS Russian",
+	50: "865 MS-DOS Nordic",
+	51: "864 Arabic",
+	52: "863 MS-DOS Canadian French",
+	53: "862 Hebrew",
+	54: "861 MS-DOS Icelandic",
+	55: "860 MS-DOS Portuguese",
+	56: "857 IBM Turkish",
+	57: "855 IBM Cyrillic; primarily Russian",
+	58: "852 Latin 2",
+	59: "775 MS-DOS Baltic",
+	60: "737 Greek; former 437 G",
+	61: "708 Arabic; ASMO 708",
+	62: "850 WE/Latin 1",
+	63: "437 US",
+}
+
+// vendorNames maps a selection of registered vendor IDs of the OS/2 achVendID field to their names, see https://docs.microsoft.com/en-us/typography/vendors/
+var vendorNames = map[string]string{
+	"1ASC": "Ascender Corporation",
+	"ADBE": "Adobe",
+	"AGFA": "Agfa Monotype Corporation",
+	"ALTS": "Altsys",
+	"APPL": "Apple",
+	"B&H":  "Bigelow & Holmes",
+	"BITS": "Bitstream",
+	"DAMA": "Dalton Maag",
+	"FSI":  "FSI FontShop International",
+	"GOOG": "Google",
+	"HP":   "Hewlett-Packard",
+	"IBM":  "IBM",
+	"ITC":  "International Typeface Corporation",
+	"LINO": "Linotype",
+	"MONO": "Monotype Imaging",
+	"MS":   "Microsoft",
+	"PARA": "ParaType",
+	"PfEd": "FontForge",
+	"SIL":  "SIL International",
+	"URW":  "URW++",
+}
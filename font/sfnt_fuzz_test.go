@@ -0,0 +1,75 @@
+//go:build go1.18
+// +build go1.18
+
+package font
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func FuzzSFNTGlyphContour(f *testing.F) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		font, err := ParseSFNT(b)
+		if err != nil {
+			return
+		}
+		for glyphID := 0; glyphID < int(font.Maxp.NumGlyphs); glyphID++ {
+			if contour, err := font.GlyphContour(uint16(glyphID)); err == nil && contour != nil {
+				_ = contour.String()
+			}
+		}
+	})
+}
+
+func FuzzParseSFNT(f *testing.F) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if font, err := ParseSFNT(b); err == nil {
+			_ = font.GlyphName(font.GlyphIndex('A'))
+		}
+	})
+}
+
+func FuzzSFNTCmap(f *testing.F) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	if err != nil {
+		f.Fatal(err)
+	}
+	font, err := ParseSFNT(b)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(font.Tables["cmap"])
+	f.Add(cmapFormat4Range(2))
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		font := &SFNT{
+			Tables: map[string][]byte{"cmap": b},
+			Maxp:   &maxpTable{NumGlyphs: 65535},
+		}
+		if err := font.parseCmap(); err == nil {
+			for _, subtable := range font.Cmap.Subtables {
+				if format4, ok := subtable.(*cmapFormat4); ok {
+					// the glyph ID array index is lowest and highest at the bounds of a segment
+					for i := range format4.StartCode {
+						_, _ = format4.Get(rune(format4.StartCode[i]))
+						_, _ = format4.Get(rune(format4.EndCode[i]))
+					}
+				}
+				subtable.ForEach(func(rune, uint16) {})
+			}
+		}
+	})
+}
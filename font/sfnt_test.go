@@ -1,8 +1,12 @@
 package font
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"image/color"
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/tdewolff/test"
@@ -22,3 +26,1562 @@ func TestSFNTDejaVuSerifTTF(t *testing.T) {
 	test.Error(t, err)
 	fmt.Println(contour)
 }
+
+func TestSFNTEachGlyph(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	n := 0
+	space := font.GlyphIndex(' ')
+	err = font.EachGlyph(func(glyphID uint16, contour *glyfContour) error {
+		test.That(t, glyphID != space, "space is empty")
+		test.That(t, contour != nil)
+		test.T(t, contour.GlyphID, glyphID)
+		n++
+		return nil
+	})
+	test.Error(t, err)
+	test.That(t, 0 < n && n < int(font.Maxp.NumGlyphs))
+
+	stop := fmt.Errorf("stop")
+	n = 0
+	err = font.EachGlyph(func(glyphID uint16, contour *glyfContour) error {
+		n++
+		return stop
+	})
+	test.T(t, err, stop)
+	test.T(t, n, 1)
+}
+
+func TestSFNTGlyphSVGPath(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	d, err := font.GlyphSVGPath(font.GlyphIndex('-'))
+	test.Error(t, err)
+	test.T(t, d, "M90 -627L602 -627L602 -471L90 -471Z")
+
+	d, err = font.GlyphSVGPath(font.GlyphIndex('.'))
+	test.Error(t, err)
+	test.T(t, d, "M193 -104Q193 -160 231 -199Q269 -238 326 -238Q381 -238 420 -199Q459 -160 459 -104Q459 -49 420 -10Q381 29 326 29Q269 29 231 -9.5Q193 -48 193 -104Z")
+
+	d, err = font.GlyphSVGPath(font.GlyphIndex('é')) // composite
+	test.Error(t, err)
+	test.T(t, strings.Count(d, "M"), 3)
+
+	d, err = font.GlyphSVGPath(font.GlyphIndex(' '))
+	test.Error(t, err)
+	test.T(t, d, "")
+}
+
+func TestSFNTGlyphsBounds(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	glyphIDs, _ := font.GlyphIndices([]rune("-.oé "))
+	xmin, ymin, xmax, ymax := font.GlyphsBounds(glyphIDs)
+	test.T(t, []int16{xmin, ymin, xmax, ymax}, []int16{90, -29, 1130, 1638})
+	xmin, ymin, xmax, ymax = font.GlyphsBoundsFast(glyphIDs)
+	test.T(t, []int16{xmin, ymin, xmax, ymax}, []int16{90, -29, 1130, 1638})
+
+	xmin, ymin, xmax, ymax = font.GlyphsBounds(glyphIDs[:1])
+	test.T(t, []int16{xmin, ymin, xmax, ymax}, []int16{90, 471, 602, 627})
+
+	xmin, ymin, xmax, ymax = font.GlyphsBounds([]uint16{font.GlyphIndex(' ')})
+	test.T(t, []int16{xmin, ymin, xmax, ymax}, []int16{0, 0, 0, 0})
+}
+
+func TestSFNTDecorationMetrics(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	position, thickness := font.UnderlineMetrics()
+	test.T(t, []int16{position, thickness}, []int16{-130, 90})
+	position, thickness = font.StrikeoutMetrics()
+	test.T(t, []int16{position, thickness}, []int16{530, 102})
+
+	// fallbacks
+	font.Post.UnderlinePosition, font.Post.UnderlineThickness = 0, 0
+	font.OS2.YStrikeoutPosition, font.OS2.YStrikeoutSize = 0, 0
+	position, thickness = font.UnderlineMetrics()
+	test.T(t, []int16{position, thickness}, []int16{-307, 154})
+	position, thickness = font.StrikeoutMetrics()
+	test.T(t, []int16{position, thickness}, []int16{608, 154}) // height of x is 1063
+
+	font.OS2.SxHeight = 1000
+	position, _ = font.StrikeoutMetrics()
+	test.T(t, position, int16(577))
+}
+
+func TestSFNTInfo(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	test.T(t, font.Info(), Info{
+		Family:     "DejaVu Serif",
+		Subfamily:  "Book",
+		NumGlyphs:  3528,
+		UnitsPerEm: 2048,
+		Weight:     400,
+		IsTrueType: true,
+	})
+
+	font.Tables["fvar"] = []byte{}
+	font.Tables["COLR"] = []byte{}
+	info := font.Info()
+	test.That(t, info.IsVariable && info.HasColor)
+}
+
+func TestSFNTIsEmptyGlyph(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	space := font.GlyphIndex(' ')
+	test.That(t, font.IsEmptyGlyph(space))
+	contour, err := font.GlyphContour(space)
+	test.Error(t, err)
+	test.That(t, contour == nil)
+
+	test.That(t, !font.IsEmptyGlyph(font.GlyphIndex('o')))
+	test.That(t, !font.IsEmptyGlyph(font.GlyphIndex('é'))) // composite
+	test.That(t, font.IsEmptyGlyph(font.Maxp.NumGlyphs))
+}
+
+func TestSFNTSubSuperscript(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	x, y := font.SubscriptSize()
+	test.T(t, x, int16(1331))
+	test.T(t, y, int16(1433))
+	x, y = font.SubscriptOffset()
+	test.T(t, x, int16(0))
+	test.T(t, y, int16(286))
+	x, y = font.SuperscriptOffset()
+	test.T(t, x, int16(0))
+	test.T(t, y, int16(983))
+
+	// fallbacks
+	font.OS2.YSubscriptYOffset = 0
+	font.OS2.YSuperscriptXSize = 0
+	font.OS2.YSuperscriptYOffset = 0
+	_, y = font.SubscriptOffset()
+	test.T(t, y, int16(241))
+	x, y = font.SuperscriptSize()
+	test.T(t, x, int16(1434))
+	test.T(t, y, int16(1434))
+	_, y = font.SuperscriptOffset()
+	test.T(t, y, int16(950))
+}
+
+func TestSFNTLineMetricsOS2Version0(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	ascender, descender, lineGap := font.TypoMetrics()
+	test.T(t, []int16{ascender, descender, lineGap}, []int16{1556, -492, 410})
+	winAscent, winDescent := font.WinMetrics()
+	test.T(t, []uint16{winAscent, winDescent}, []uint16{1901, 483})
+
+	// short version 0 layout without typographic and Windows metrics
+	os2 := append([]byte{}, font.Tables["OS/2"][:68]...)
+	os2[0], os2[1] = 0, 0
+	font.Tables["OS/2"] = os2
+	test.Error(t, font.parseOS2())
+	test.That(t, !font.OS2.HasTypoMetrics)
+
+	ascender, descender, lineGap = font.TypoMetrics()
+	test.T(t, []int16{ascender, descender, lineGap}, []int16{1901, -483, 0})
+	winAscent, winDescent = font.WinMetrics()
+	test.T(t, []uint16{winAscent, winDescent}, []uint16{1901, 483})
+	ascender, descender, lineGap = font.LineMetrics()
+	test.T(t, []int16{ascender, descender, lineGap}, []int16{1901, -483, 0})
+}
+
+func TestSFNTOS2Lengths(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	orig := font.Tables["OS/2"]
+	test.T(t, binary.BigEndian.Uint16(orig), uint16(1))
+	weight := font.OS2.UsWeightClass
+	codePages := font.OS2.UlCodePageRange1
+
+	// over-long table, trailing bytes are ignored
+	font.Tables["OS/2"] = append(append([]byte{}, orig...), 0xFF, 0xFF, 0xFF, 0xFF)
+	test.Error(t, font.parseOS2())
+	test.T(t, font.OS2.UsWeightClass, weight)
+	test.T(t, font.OS2.UlCodePageRange1, codePages)
+	test.T(t, font.OS2.SxHeight, int16(0), "not defined for version 1")
+
+	// truncated table
+	font.Tables["OS/2"] = orig[:len(orig)-2]
+	test.That(t, font.parseOS2() != nil, "truncated table")
+
+	// version 0 with an intermediate length
+	os2 := append([]byte{}, orig[:72]...)
+	os2[0], os2[1] = 0, 0
+	font.Tables["OS/2"] = os2
+	test.Error(t, font.parseOS2())
+	test.That(t, !font.OS2.HasTypoMetrics)
+	test.T(t, font.OS2.UsWeightClass, weight)
+}
+
+func TestSFNTAdvanceForRune(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	test.T(t, font.AdvanceForRune('A'), font.GlyphAdvance(font.GlyphIndex('A')))
+	test.T(t, font.AdvanceForRune('\U000F0000'), font.GlyphAdvance(0)) // not in font
+	test.T(t, font.AdvancesForRunes([]rune("AB")), []uint16{font.AdvanceForRune('A'), font.AdvanceForRune('B')})
+}
+
+func TestSFNTHasGlyph(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	test.That(t, font.HasGlyph('a'))
+	test.That(t, !font.HasGlyph('中'))
+
+	glyphIDs, missing := font.GlyphIndices([]rune("a中b"))
+	test.T(t, glyphIDs, []uint16{font.GlyphIndex('a'), 0, font.GlyphIndex('b')})
+	test.T(t, missing, []int{1})
+}
+
+func TestSFNTMarkToMark(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	// Vietnamese ế and ẫ decomposed as a base letter with stacked circumflex and acute or tilde
+	circumflex := font.GlyphIndex('\u0302')
+	dx, dy, ok := font.MarkToMark(circumflex, font.GlyphIndex('\u0301'))
+	test.That(t, ok)
+	test.T(t, dx, int16(0))
+	test.T(t, dy, int16(458))
+	dx, dy, ok = font.MarkToMark(circumflex, font.GlyphIndex('\u0303'))
+	test.That(t, ok)
+	test.T(t, dx, int16(0))
+	test.T(t, dy, int16(398))
+
+	_, _, ok = font.MarkToMark(font.GlyphIndex('e'), circumflex)
+	test.That(t, !ok, "base glyph is not a mark")
+}
+
+func TestSFNTGlyphClass(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	test.T(t, font.GlyphClass(font.GlyphIndex('a')), BaseGlyph)
+	test.T(t, font.GlyphClass(font.GlyphIndex('\u0301')), MarkGlyph)
+	test.T(t, font.GlyphClass(font.GlyphIndex('\uFB01')), LigatureGlyph)
+
+	b, err = ioutil.ReadFile("EBGaramond12-Regular.otf")
+	test.Error(t, err)
+
+	font, err = ParseSFNT(b)
+	test.Error(t, err)
+	carets, ok := font.LigatureCarets(font.GlyphIndex('\uFB03'))
+	test.That(t, ok)
+	test.T(t, carets, []int16{254, 504})
+	_, ok = font.LigatureCarets(font.GlyphIndex('a'))
+	test.That(t, !ok)
+}
+
+func TestSFNTGDEF(t *testing.T) {
+	w := newBinaryWriter([]byte{})
+	for _, v := range []uint16{
+		1, 0, 12, 0, 34, 24, // header
+		1, 5, 3, 1, 3, 2, // glyph class definition
+		2, 1, 6, 6, 2, // mark attachment class definition
+		6, 1, 12, // ligature caret list
+		1, 1, 7, // coverage
+		2, 6, 10, // ligature glyph
+		1, 300, // caret value by coordinate
+		2, 4, // caret value by contour point
+	} {
+		w.WriteUint16(v)
+	}
+
+	font := &SFNT{
+		Tables: map[string][]byte{"GDEF": w.Bytes()},
+	}
+	test.Error(t, font.parseGDEF())
+	test.T(t, font.GlyphClass(4), UnclassifiedGlyph)
+	test.T(t, font.GlyphClass(5), BaseGlyph)
+	test.T(t, font.GlyphClass(6), MarkGlyph)
+	test.T(t, font.GlyphClass(7), LigatureGlyph)
+	test.T(t, font.GlyphClass(8), UnclassifiedGlyph)
+	test.T(t, font.MarkAttachClass(5), uint16(0))
+	test.T(t, font.MarkAttachClass(6), uint16(2))
+
+	carets, ok := font.LigatureCarets(7)
+	test.That(t, ok)
+	test.T(t, carets, []int16{300})
+	_, ok = font.LigatureCarets(6)
+	test.That(t, !ok)
+}
+
+func TestSFNTBadGDEF(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+	b = overwriteSFNTTable(b, "GDEF", []byte{0xFF, 0xFF})
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	test.That(t, font.Gdef == nil, "malformed GDEF table is ignored")
+	test.T(t, font.GlyphClass(font.GlyphIndex('a')), UnclassifiedGlyph)
+}
+
+func TestSFNTKerningMerged(t *testing.T) {
+	gpos := newBinaryWriter([]byte{})
+	for _, v := range []uint16{
+		1, 0, 0, 10, 24, // header
+		1, 'k'<<8 | 'e', 'r'<<8 | 'n', 8, // feature list
+		0, 1, 0, // kern feature
+		1, 4, // lookup list
+		2, 0, 1, 8, // pair adjustment lookup
+		1, 12, 0x0004, 0, 1, 18, // pair adjustment subtable with advance of the first glyph
+		1, 1, 5, // coverage
+		2, 6, 0xFFCE, 7, 0, // pair set, glyph 6 at -50 and glyph 7 at 0
+	} {
+		gpos.WriteUint16(v)
+	}
+
+	kern := newBinaryWriter([]byte{})
+	for _, v := range []uint16{
+		0, 1, // header
+		0, 26, 0x0001, 2, 0, 0, 0, // subtable
+		5, 7, 0xFFE2, // glyphs 5 and 7 at -30
+		5, 8, 0xFFEC, // glyphs 5 and 8 at -20
+	} {
+		kern.WriteUint16(v)
+	}
+
+	font := &SFNT{
+		Tables: map[string][]byte{"GPOS": gpos.Bytes(), "kern": kern.Bytes()},
+	}
+	test.Error(t, font.parseGPOS())
+	test.Error(t, font.parseKern())
+	test.T(t, font.KerningMerged(5, 6), int16(-50))
+	test.T(t, font.KerningMerged(5, 7), int16(0)) // GPOS takes precedence over kern
+	test.T(t, font.KerningMerged(5, 8), int16(-20))
+	test.T(t, font.KerningMerged(6, 5), int16(0))
+
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err = ParseSFNT(b)
+	test.Error(t, err)
+	test.That(t, font.KerningMerged(font.GlyphIndex('A'), font.GlyphIndex('V')) < 0)
+	test.T(t, font.KerningMerged(font.GlyphIndex('M'), font.GlyphIndex('M')), int16(0))
+}
+
+func TestSFNTKernUnsupportedSubtable(t *testing.T) {
+	kern := newBinaryWriter([]byte{})
+	for _, v := range []uint16{
+		0, 2, // header
+		0, 10, 0x0201, 0xFFFF, 0xFFFF, // format 2 subtable, skipped
+		0, 20, 0x0001, 1, 0, 0, 0, // format 0 subtable
+		5, 7, 0xFFE2, // glyphs 5 and 7 at -30
+	} {
+		kern.WriteUint16(v)
+	}
+
+	font := &SFNT{
+		Tables: map[string][]byte{"kern": kern.Bytes()},
+	}
+	test.Error(t, font.parseKern())
+	test.T(t, len(font.Kern.Subtables), 1)
+	test.T(t, font.Kerning(5, 7), int16(-30))
+}
+
+func TestSFNTKerningScripts(t *testing.T) {
+	gpos := newBinaryWriter([]byte{})
+	for _, v := range []uint16{
+		1, 0, 10, 48, 74, // header
+		2, 'D'<<8 | 'F', 'L'<<8 | 'T', 14, 'c'<<8 | 'y', 'r'<<8 | 'l', 26, // script list
+		4, 0, 0, 0xFFFF, 1, 0, // DFLT script with the first kern feature
+		4, 0, 0, 0xFFFF, 1, 1, // cyrl script with the second kern feature
+		2, 'k'<<8 | 'e', 'r'<<8 | 'n', 14, 'k'<<8 | 'e', 'r'<<8 | 'n', 20, // feature list
+		0, 1, 0, // kern feature of DFLT
+		0, 1, 1, // kern feature of cyrl
+		2, 6, 42, // lookup list
+		2, 0, 1, 8, // pair adjustment lookup of DFLT
+		1, 12, 0x0004, 0, 1, 18, 1, 1, 5, 2, 6, 0xFFCE, 7, 0,
+		2, 0, 1, 8, // pair adjustment lookup of cyrl, covering the same pair
+		1, 12, 0x0004, 0, 1, 18, 1, 1, 5, 2, 6, 0xFFCE, 7, 0,
+	} {
+		gpos.WriteUint16(v)
+	}
+
+	font := &SFNT{
+		Tables: map[string][]byte{"GPOS": gpos.Bytes()},
+	}
+	test.Error(t, font.parseGPOS())
+	test.T(t, font.KerningMerged(5, 6), int16(-50))
+}
+
+func TestSFNTBadGPOS(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+	b = overwriteSFNTTable(b, "GPOS", []byte{0xFF, 0xFF})
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	test.That(t, font.Gpos == nil, "malformed GPOS table is ignored")
+
+	// bad subtables are skipped
+	gpos := newBinaryWriter([]byte{})
+	for _, v := range []uint16{
+		1, 0, 0, 10, 24, // header
+		1, 'k'<<8 | 'e', 'r'<<8 | 'n', 8, // feature list
+		0, 1, 0, // kern feature
+		1, 4, // lookup list
+		2, 0, 3, 0xFFF0, 12, 10, // pair adjustment lookup with an out-of-range and a bad subtable
+		1, 12, 0x0004, 0, 1, 18, // pair adjustment subtable with advance of the first glyph
+		1, 1, 5, // coverage
+		2, 6, 0xFFCE, 7, 0, // pair set, glyph 6 at -50 and glyph 7 at 0
+	} {
+		gpos.WriteUint16(v)
+	}
+	font = &SFNT{
+		Tables: map[string][]byte{"GPOS": gpos.Bytes()},
+	}
+	test.Error(t, font.parseGPOS())
+	test.T(t, font.KerningMerged(5, 6), int16(-50))
+}
+
+// overwriteSFNTTable returns a copy of the SFNT font where the start of the table with the given tag is overwritten by data, and updates the table's checksum.
+func overwriteSFNTTable(b []byte, tag string, data []byte) []byte {
+	b = append([]byte{}, b...)
+	numTables := int(binary.BigEndian.Uint16(b[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := b[12+16*i:]
+		if string(rec[:4]) != tag {
+			continue
+		}
+		offset, length := binary.BigEndian.Uint32(rec[8:]), binary.BigEndian.Uint32(rec[12:])
+		copy(b[offset:offset+length], data)
+		padding := (4 - length&3) & 3
+		binary.BigEndian.PutUint32(rec[4:], CalcChecksum(b[offset:offset+length+padding]))
+	}
+	return b
+}
+
+func TestSFNTMorx(t *testing.T) {
+	// glyphs: f=1, i=2, fi=3, a=4, a.alt=5
+	w := newBinaryWriter([]byte{})
+	u16 := func(vs ...uint16) {
+		for _, v := range vs {
+			w.WriteUint16(v)
+		}
+	}
+	u32 := func(vs ...uint32) {
+		for _, v := range vs {
+			w.WriteUint32(v)
+		}
+	}
+	u16(2, 0)         // version
+	u32(1)            // nChains
+	u32(1, 336, 1, 3) // chain header
+	u16(0, 0)         // feature type and setting
+	u32(1, 0)         // enable and disable flags
+
+	// ligature subtable: f+i => fi
+	u32(140, 2, 1)                    // subtable header
+	u32(6, 28, 58, 94, 112, 120, 124) // header
+	u16(2, 6, 3, 12, 1, 6)            // class lookup
+	u16(1, 1, 4, 2, 2, 5, 0xFFFF, 0xFFFF, 0)
+	u16(0, 0, 0, 0, 1, 0)                    // state 0
+	u16(0, 0, 0, 0, 1, 0)                    // state 1
+	u16(0, 0, 0, 0, 1, 2)                    // state 2
+	u16(0, 0, 0, 2, 0x8000, 0, 0, 0xA000, 0) // entries
+	u32(0x3FFFFFFF, 0xBFFFFFFF)              // ligature actions with offset -1
+	u16(0, 0)                                // components
+	u16(3, 0)                                // ligatures
+
+	// contextual subtable: a => a.alt after fi
+	u32(148, 1, 1)          // subtable header
+	u32(6, 20, 50, 86, 110) // header
+	u16(2, 6, 3, 12, 1, 6)  // class lookup
+	u16(3, 3, 4, 4, 4, 5, 0xFFFF, 0xFFFF, 0)
+	u16(0, 0, 0, 0, 1, 0)                                            // state 0
+	u16(0, 0, 0, 0, 1, 0)                                            // state 1
+	u16(0, 0, 1, 0, 1, 2)                                            // state 2
+	u16(0, 0, 0xFFFF, 0xFFFF, 2, 0, 0xFFFF, 0xFFFF, 0, 0, 0xFFFF, 0) // entries
+	u32(4)                                                           // substitution table
+	u16(6, 4, 2, 8, 1, 0)                                            // substitution lookup
+	u16(4, 5, 0xFFFF, 0, 0)
+
+	// noncontextual subtable: f => 9, disabled by default
+	u32(20, 4, 2) // subtable header
+	u16(8, 1, 1, 9)
+
+	font := &SFNT{
+		Tables: map[string][]byte{"morx": w.Bytes()},
+		Maxp:   &maxpTable{NumGlyphs: 10},
+	}
+	test.Error(t, font.parseMorx())
+	test.T(t, len(font.Morx.Chains), 1)
+	test.T(t, len(font.Morx.Chains[0].Subtables), 3)
+	test.T(t, font.ApplyMorx([]uint16{1, 2, 4}), []uint16{3, 5})
+	test.T(t, font.ApplyMorx([]uint16{1, 1, 2}), []uint16{1, 3})
+	test.T(t, font.ApplyMorx([]uint16{2, 1, 4}), []uint16{2, 1, 4})
+	test.T(t, font.ApplyMorx([]uint16{}), []uint16{})
+	test.T(t, (&SFNT{}).ApplyMorx([]uint16{1, 2}), []uint16{1, 2})
+}
+
+func TestSFNTAATFeatures(t *testing.T) {
+	feat := newBinaryWriter([]byte{})
+	feat.WriteUint32(0x00010000) // version
+	for _, v := range []uint16{
+		2, 0, 0, 0, // header
+		1, 2, 0, 36, 0x0000, 256, // ligatures
+		21, 2, 0, 44, 0xC001, 259, // number case
+		2, 257, 3, 258, // ligature settings
+		0, 260, 1, 261, // number case settings
+	} {
+		feat.WriteUint16(v)
+	}
+
+	strs := []string{"Ligaturen", "Ligatures", "On", "Off", "Case", "Upper"}
+	records := [][4]uint16{{3, 1, 0x0407, 256}, {3, 1, 0x0409, 256}, {3, 1, 0x0409, 257}, {3, 1, 0x0409, 258}, {1, 0, 0, 259}, {0, 3, 0, 260}}
+	name := newBinaryWriter([]byte{})
+	name.WriteUint16(0)                           // version
+	name.WriteUint16(uint16(len(records)))        // count
+	name.WriteUint16(uint16(6 + 12*len(records))) // storageOffset
+	data := newBinaryWriter([]byte{})
+	for i, record := range records {
+		offset := data.Len()
+		if record[0] == 1 {
+			data.WriteString(strs[i])
+		} else {
+			for _, r := range strs[i] {
+				data.WriteUint16(uint16(r))
+			}
+		}
+		name.WriteUint16(record[0])
+		name.WriteUint16(record[1])
+		name.WriteUint16(record[2])
+		name.WriteUint16(record[3])
+		name.WriteUint16(uint16(data.Len() - offset))
+		name.WriteUint16(uint16(offset))
+	}
+	name.WriteBytes(data.Bytes())
+
+	font := &SFNT{
+		Tables: map[string][]byte{"feat": feat.Bytes(), "name": name.Bytes()},
+	}
+	test.T(t, font.AATFeatures(), []AATFeature(nil))
+	test.Error(t, font.parseFeat())
+	test.Error(t, font.parseName())
+	test.T(t, font.AATFeatures(), []AATFeature{
+		{1, "Ligatures", false, 0, []AATFeatureSelector{{2, "On"}, {3, "Off"}}},
+		{21, "Case", true, 1, []AATFeatureSelector{{0, "Upper"}, {1, ""}}},
+	})
+}
+
+func TestSFNTNameOverflow(t *testing.T) {
+	// the end of the record exceeds the range of uint16
+	data := make([]byte, 0x10001)
+	copy(data[0xFFFF:], "ab")
+	name := &nameTable{
+		NameRecord: []nameNameRecord{{PlatformID: 1, NameID: 1, Offset: 0xFFFF, Length: 2}},
+		Data:       data,
+	}
+	s, ok := name.Get(1)
+	test.That(t, ok)
+	test.String(t, s, "ab")
+}
+
+func TestSFNTStyleAttributes(t *testing.T) {
+	fixed := func(v float64) uint32 {
+		return uint32(int32(v * 65536.0))
+	}
+	stat := newBinaryWriter([]byte{})
+	for _, v := range []uint16{1, 1, 8, 2} {
+		stat.WriteUint16(v)
+	}
+	stat.WriteUint32(20) // designAxesOffset
+	stat.WriteUint16(4)  // axisValueCount
+	stat.WriteUint32(36) // offsetToAxisValueOffsets
+	stat.WriteUint16(2)  // elidedFallbackNameID
+	stat.WriteString("wght")
+	stat.WriteUint16(256)
+	stat.WriteUint16(0)
+	stat.WriteString("opsz")
+	stat.WriteUint16(257)
+	stat.WriteUint16(1)
+	for _, offset := range []uint16{8, 20, 40, 56} {
+		stat.WriteUint16(offset)
+	}
+	for _, v := range []uint16{1, 0, 0x0000, 258} { // format 1
+		stat.WriteUint16(v)
+	}
+	stat.WriteUint32(fixed(300.0))
+	for _, v := range []uint16{2, 0, 0x0000, 259} { // format 2
+		stat.WriteUint16(v)
+	}
+	stat.WriteUint32(fixed(600.0))
+	stat.WriteUint32(fixed(550.0))
+	stat.WriteUint32(fixed(650.0))
+	for _, v := range []uint16{3, 0, 0x0002, 260} { // format 3
+		stat.WriteUint16(v)
+	}
+	stat.WriteUint32(fixed(400.0))
+	stat.WriteUint32(fixed(700.0))
+	for _, v := range []uint16{4, 2, 0x0000, 261, 0} { // format 4
+		stat.WriteUint16(v)
+	}
+	stat.WriteUint32(fixed(500.0))
+	stat.WriteUint16(1)
+	stat.WriteUint32(fixed(8.5))
+
+	strs := []string{"Weight", "Optical size", "Light", "SemiBold", "Regular", "Caption"}
+	name := newBinaryWriter([]byte{})
+	name.WriteUint16(0)                        // version
+	name.WriteUint16(uint16(len(strs)))        // count
+	name.WriteUint16(uint16(6 + 12*len(strs))) // storageOffset
+	data := newBinaryWriter([]byte{})
+	for i, str := range strs {
+		offset := data.Len()
+		for _, r := range str {
+			data.WriteUint16(uint16(r))
+		}
+		for _, v := range []uint16{3, 1, 0x0409, uint16(256 + i), uint16(data.Len() - offset), uint16(offset)} {
+			name.WriteUint16(v)
+		}
+	}
+	name.WriteBytes(data.Bytes())
+
+	font := &SFNT{
+		Tables: map[string][]byte{"STAT": stat.Bytes(), "name": name.Bytes()},
+	}
+	axes, combinations := font.StyleAttributes()
+	test.T(t, axes, []StyleAxis(nil))
+	test.T(t, combinations, []StyleCombination(nil))
+	test.Error(t, font.parseSTAT())
+	test.Error(t, font.parseName())
+	test.T(t, font.Stat.ElidedFallbackNameID, uint16(2))
+
+	axes, combinations = font.StyleAttributes()
+	test.T(t, axes, []StyleAxis{
+		{"wght", "Weight", 0, []StyleValue{
+			{"Light", 0x0000, 300.0, 300.0, 300.0, 0.0},
+			{"SemiBold", 0x0000, 600.0, 550.0, 650.0, 0.0},
+			{"Regular", 0x0002, 400.0, 400.0, 400.0, 700.0},
+		}},
+		{"opsz", "Optical size", 1, nil},
+	})
+	test.T(t, combinations, []StyleCombination{
+		{"Caption", 0x0000, map[string]float64{"wght": 500.0, "opsz": 8.5}},
+	})
+
+	// axis index out of range
+	b := append([]byte{}, stat.Bytes()...)
+	b[36+8+3] = 2
+	font.Tables["STAT"] = b
+	test.That(t, font.parseSTAT() != nil)
+}
+
+func TestSFNTMVAR(t *testing.T) {
+	mvar := newBinaryWriter([]byte{})
+	for _, v := range []uint16{1, 0, 0, 8, 2, 28} {
+		mvar.WriteUint16(v)
+	}
+	mvar.WriteString("hasc")
+	mvar.WriteUint16(0)
+	mvar.WriteUint16(0)
+	mvar.WriteString("undo")
+	mvar.WriteUint16(0)
+	mvar.WriteUint16(1)
+
+	// item variation store
+	mvar.WriteUint16(1)  // format
+	mvar.WriteUint32(12) // variationRegionListOffset
+	mvar.WriteUint16(1)  // itemVariationDataCount
+	mvar.WriteUint32(28) // itemVariationDataOffsets
+	for _, v := range []int16{1, 2, 0, 16384, 16384, -16384, -16384, 0} {
+		mvar.WriteInt16(v)
+	}
+	for _, v := range []int16{2, 1, 2, 0, 1} {
+		mvar.WriteInt16(v)
+	}
+	mvar.WriteInt16(100)
+	mvar.WriteByte(uint8(0xEC)) // -20
+	mvar.WriteInt16(-300)
+	mvar.WriteByte(10)
+
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	_, ok := font.MetricVariation("hasc", []float64{0.5})
+	test.That(t, !ok)
+
+	font.Tables["MVAR"] = mvar.Bytes()
+	test.Error(t, font.parseMVAR())
+
+	delta, ok := font.MetricVariation("hasc", []float64{0.5})
+	test.That(t, ok)
+	test.Float(t, delta, 50.0)
+	delta, _ = font.MetricVariation("hasc", []float64{-0.5})
+	test.Float(t, delta, -10.0)
+	delta, _ = font.MetricVariation("undo", []float64{1.0})
+	test.Float(t, delta, -300.0)
+	delta, _ = font.MetricVariation("undo", nil)
+	test.Float(t, delta, 0.0)
+	_, ok = font.MetricVariation("tasc", []float64{0.5})
+	test.That(t, !ok)
+
+	ascender, descender, lineGap := font.LineMetrics()
+	variedAscender, variedDescender, variedLineGap := font.LineMetricsAt([]float64{0.5})
+	test.T(t, []int16{variedAscender, variedDescender, variedLineGap}, []int16{ascender + 50, descender, lineGap})
+
+	position, thickness := font.UnderlineMetrics()
+	variedPosition, variedThickness := font.UnderlineMetricsAt([]float64{1.0})
+	test.T(t, []int16{variedPosition, variedThickness}, []int16{position - 300, thickness})
+	position, thickness = font.StrikeoutMetrics()
+	variedPosition, variedThickness = font.StrikeoutMetricsAt([]float64{1.0})
+	test.T(t, []int16{variedPosition, variedThickness}, []int16{position, thickness})
+	x, y := font.SuperscriptOffset()
+	variedX, variedY := font.SuperscriptOffsetAt([]float64{1.0})
+	test.T(t, []int16{variedX, variedY}, []int16{x, y})
+
+	// region index out of range
+	b = append([]byte{}, mvar.Bytes()...)
+	b[28+28+7] = 2
+	font.Tables["MVAR"] = b
+	test.That(t, font.parseMVAR() != nil)
+}
+
+func TestSFNTIsMonospaced(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	isMono, advance := font.IsMonospaced()
+	test.T(t, isMono, false)
+	test.T(t, advance, uint16(0))
+
+	font.Post.IsFixedPitch = 1
+	isMono, advance = font.IsMonospaced()
+	test.T(t, isMono, true)
+	test.T(t, advance, font.Hhea.AdvanceWidthMax)
+
+	font.Post.IsFixedPitch = 0
+	for i := range font.Hmtx.HMetrics {
+		font.Hmtx.HMetrics[i].AdvanceWidth = 1229
+	}
+	isMono, advance = font.IsMonospaced()
+	test.T(t, isMono, true)
+	test.T(t, advance, uint16(1229))
+}
+
+func TestSFNTUnicodeRangesCodePages(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	font.OS2.UlUnicodeRange1 = 0x00000203 // Basic Latin, Latin-1 Supplement, Cyrillic
+	font.OS2.UlUnicodeRange2 = 0x00000000
+	font.OS2.UlUnicodeRange3 = 0x00000000
+	font.OS2.UlUnicodeRange4 = 0x00000001 // Buginese
+	test.T(t, font.UnicodeRanges(), []string{"Basic Latin", "Latin-1 Supplement", "Cyrillic", "Buginese"})
+
+	font.OS2.UlCodePageRange1 = 0x00020201 // Latin 1, reserved, JIS/Japan
+	font.OS2.UlCodePageRange2 = 0x80000000 // US
+	test.T(t, font.CodePages(), []string{"1252 Latin 1", "932 JIS/Japan", "437 US"})
+}
+
+func TestSFNTVendor(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	test.T(t, font.VendorID(), "PfEd")
+	test.T(t, font.VendorName(), "FontForge")
+
+	font.OS2.AchVendID = [4]byte{'M', 'S', ' ', 0}
+	test.T(t, font.VendorID(), "MS")
+	test.T(t, font.VendorName(), "Microsoft")
+}
+
+func TestSFNTPostVersion1(t *testing.T) {
+	post := make([]byte, 32)
+	post[1] = 0x01 // version 1.0
+
+	font := &SFNT{
+		IsTrueType: true,
+		Tables:     map[string][]byte{"post": post},
+		Maxp:       &maxpTable{NumGlyphs: 5},
+	}
+	test.Error(t, font.parsePost())
+	test.T(t, font.GlyphName(3), "space")
+	test.T(t, font.GlyphName(4), "exclam")
+	test.T(t, font.GlyphName(5), "")
+}
+
+func TestSFNTGlyfBadOffsets(t *testing.T) {
+	glyf := &glyfTable{
+		data: make([]byte, 20),
+		loca: &locaTable{Offsets: []uint32{0, 10, 8, 30}},
+	}
+	_, err := glyf.Get(0)
+	test.Error(t, err)
+	_, err = glyf.Get(1)
+	test.T(t, err.Error(), "glyf: bad offsets for glyphID 1")
+	_, err = glyf.Get(2)
+	test.T(t, err.Error(), "glyf: bad offsets for glyphID 2")
+	_, err = glyf.Get(3)
+	test.T(t, err.Error(), "glyf: bad glyphID 3")
+}
+
+func TestSFNTGlyfLenient(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	glyf := font.Tables["glyf"]
+	n := len(glyf)
+
+	// trailing padding
+	font.Tables["glyf"] = append(glyf[:n:n], 0, 0)
+	test.That(t, font.parseGlyf() != nil, "strict mode")
+	font.options.Lenient = true
+	test.Error(t, font.parseGlyf())
+	test.That(t, !font.Repaired)
+	font.Tables["glyf"] = append(glyf[:n:n], 0, 0, 0, 0)
+	test.That(t, font.parseGlyf() != nil, "too much padding")
+
+	// truncated final glyph
+	font.Tables["glyf"] = glyf[:n-10]
+	font.options.Lenient = false
+	test.That(t, font.parseGlyf() != nil, "strict mode")
+	font.options.Lenient = true
+	test.Error(t, font.parseGlyf())
+	test.That(t, font.Repaired)
+	test.T(t, font.Loca.Offsets[font.Maxp.NumGlyphs], uint32(n-10))
+	_, err = font.GlyphContour(font.GlyphIndex('a'))
+	test.Error(t, err)
+}
+
+func TestSFNTGlyfContourMalformed(t *testing.T) {
+	var tts = []struct {
+		data string
+		err  string
+	}{
+		{"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00", ""},                                                         // no contours
+		{"\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x01\x00\x00", "glyf: bad endPtsOfContours for glyphID 0"}, // decreasing end points
+		{"\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x09\x05", "glyf: bad flags for glyphID 0"},            // repeat flag exceeds points
+		{"\xff\xff\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x01\x00\x00", ""},                                         // composite of empty glyph
+	}
+	for i, tt := range tts {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			glyf := &glyfTable{
+				data: []byte(tt.data),
+				loca: &locaTable{Offsets: []uint32{0, uint32(len(tt.data)), uint32(len(tt.data))}},
+			}
+			contour, err := glyf.Contour(0, 0)
+			if tt.err != "" {
+				test.T(t, err.Error(), tt.err)
+			} else {
+				test.Error(t, err)
+				_ = contour.String()
+			}
+		})
+	}
+}
+
+func TestSFNTGlyfComponents(t *testing.T) {
+	simple := "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	composite := "\xff\xff\x00\x00\x00\x00\x00\x00\x00\x00" +
+		"\x00\x23\x00\x00\x00\x00\x00\x00" + // MORE_COMPONENTS | ARGS_ARE_XY_VALUES | ARG_1_AND_2_ARE_WORDS, glyph 0
+		"\x00\x2a\x00\x02\x00\x00\x40\x00" + // MORE_COMPONENTS | ARGS_ARE_XY_VALUES | WE_HAVE_A_SCALE, glyph 2
+		"\x00\x02\x00\x00\x00\x00" // ARGS_ARE_XY_VALUES, glyph 0
+	glyf := &glyfTable{
+		data: []byte(simple + composite + composite[:len(composite)-2]),
+		loca: &locaTable{Offsets: []uint32{0, 12, 12, uint32(12 + len(composite)), uint32(12 + 2*len(composite) - 2)}},
+	}
+
+	_, ok := glyf.Components(0)
+	test.That(t, !ok, "simple glyph")
+	_, ok = glyf.Components(1)
+	test.That(t, !ok, "empty glyph")
+	components, ok := glyf.Components(2)
+	test.That(t, ok)
+	test.T(t, components, []uint16{0, 2, 0})
+	_, ok = glyf.Components(3)
+	test.That(t, !ok, "truncated glyph")
+}
+
+func TestSFNTSubset(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	glyphIDs, _ := font.GlyphIndices([]rune("Hé!"))
+	subsetIDs := append([]uint16{0}, glyphIDs...)
+	b, glyphMap, err := font.Subset(subsetIDs)
+	test.Error(t, err)
+	test.T(t, glyphMap[:4], subsetIDs)
+	test.T(t, len(glyphMap), 6) // é is composed of e and acute
+
+	subset, err := ParseSFNT(b)
+	test.Error(t, err)
+	test.T(t, subset.Maxp.NumGlyphs, uint16(6))
+	for newID, glyphID := range glyphMap {
+		test.T(t, subset.GlyphAdvance(uint16(newID)), font.GlyphAdvance(glyphID))
+
+		d, err := font.GlyphSVGPath(glyphID)
+		test.Error(t, err)
+		newD, err := subset.GlyphSVGPath(uint16(newID))
+		test.Error(t, err)
+		test.T(t, newD, d)
+	}
+	test.T(t, subset.GlyphIndex('H'), uint16(1))
+	test.T(t, subset.GlyphIndex('é'), uint16(2))
+	test.T(t, subset.GlyphIndex('e'), uint16(4)) // components keep their cmap entry
+	test.T(t, subset.GlyphIndex('x'), uint16(0))
+
+	components, ok := subset.GlyphComponents(2)
+	test.That(t, ok)
+	test.T(t, components, []uint16{4, 5})
+
+	_, _, err = font.Subset([]uint16{1, 2})
+	test.That(t, err != nil)
+}
+
+func TestSFNTChecksumRoundTrip(t *testing.T) {
+	test.T(t, CalcChecksum([]byte{1, 2, 3, 4, 5, 6}), uint32(0x01020304+0x05060000))
+
+	for _, filename := range []string{"DejaVuSerif.ttf", "EBGaramond12-Regular.otf"} {
+		t.Run(filename, func(t *testing.T) {
+			b, err := ioutil.ReadFile(filename)
+			test.Error(t, err)
+			font, err := ParseSFNT(b)
+			test.Error(t, err)
+
+			checksums := func(b []byte) map[string]uint32 {
+				m := map[string]uint32{}
+				numTables := int(binary.BigEndian.Uint16(b[4:]))
+				for i := 0; i < numTables; i++ {
+					m[string(b[12+16*i:16+16*i])] = binary.BigEndian.Uint32(b[16+16*i:])
+				}
+				return m
+			}
+
+			out := writeSFNT(binary.BigEndian.Uint32(b), font.Tables)
+			test.T(t, checksums(out), checksums(b))
+			test.T(t, CalcChecksum(b), uint32(0xB1B0AFBA))
+			test.T(t, CalcChecksum(out), uint32(0xB1B0AFBA))
+			for tag, checksum := range checksums(out) {
+				tableChecksum, _ := font.TableChecksum(tag)
+				test.T(t, tableChecksum, checksum, tag)
+			}
+			_, err = ParseSFNT(out)
+			test.Error(t, err)
+
+			// recompute a corrupted checksum adjustment
+			head := bytes.Index(out, font.Tables["head"][:8])
+			binary.BigEndian.PutUint32(out[head+8:], 0x12345678)
+			test.Error(t, SetChecksumAdjustment(out))
+			test.T(t, CalcChecksum(out), uint32(0xB1B0AFBA))
+		})
+	}
+	test.T(t, SetChecksumAdjustment([]byte("\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")).Error(), "head: missing table")
+	test.T(t, SetChecksumAdjustment([]byte{0, 1}), ErrInvalidFontData)
+}
+
+func TestParseSFNTReader(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNTReader(bytes.NewReader(b), len(b))
+	test.Error(t, err)
+	test.T(t, font.Maxp.NumGlyphs, uint16(3528))
+
+	_, err = ParseSFNTReader(bytes.NewReader(b), len(b)-1)
+	test.T(t, err, ErrExceedsMemory)
+
+	_, err = ParseSFNTReader(bytes.NewReader(b), 0)
+	test.Error(t, err)
+}
+
+func TestParseSFNTLimits(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	numGlyphs := int(font.Maxp.NumGlyphs)
+	postStringBytes := len(font.Tables["post"]) - 34 - 2*numGlyphs
+
+	_, err = ParseSFNTOptions(b, ParseOptions{MaxGlyphs: numGlyphs, MaxPostStringBytes: postStringBytes})
+	test.Error(t, err)
+	_, err = ParseSFNTOptions(b, ParseOptions{MaxGlyphs: numGlyphs - 1})
+	test.T(t, err, ErrLimitExceeded)
+	_, err = ParseSFNTOptions(b, ParseOptions{MaxPostStringBytes: postStringBytes - 1})
+	test.T(t, err, ErrLimitExceeded)
+
+	// components are counted over nested composite glyphs
+	simple := "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	composite := func(glyphID byte) string {
+		return "\xff\xff\x00\x00\x00\x00\x00\x00\x00\x00" +
+			"\x00\x22\x00" + string(glyphID) + "\x00\x00" + // MORE_COMPONENTS | ARGS_ARE_XY_VALUES
+			"\x00\x02\x00" + string(glyphID) + "\x00\x00" // ARGS_ARE_XY_VALUES
+	}
+	data := simple + composite(0) + composite(1)
+	glyf := &glyfTable{
+		data:          []byte(data),
+		loca:          &locaTable{Offsets: []uint32{0, 12, 34, uint32(len(data))}},
+		maxComponents: 6,
+	}
+	_, err = glyf.Contour(2, 0)
+	test.Error(t, err)
+	glyf.maxComponents = 5
+	_, err = glyf.Contour(2, 0)
+	test.T(t, err, ErrLimitExceeded)
+	_, err = glyf.Contour(1, 0)
+	test.Error(t, err)
+}
+
+func TestParseSFNTMetrics(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	metrics, err := ParseSFNTMetrics(b)
+	test.Error(t, err)
+	test.That(t, metrics.Glyf == nil && metrics.Loca == nil && metrics.Cmap == nil, "outlines and cmap not loaded")
+	test.That(t, metrics.Gpos == nil && metrics.Kern == nil, "layout tables not loaded")
+
+	glyphID := font.GlyphIndex('a')
+	test.T(t, metrics.GlyphAdvance(glyphID), font.GlyphAdvance(glyphID))
+	test.T(t, metrics.OS2.UsWeightClass, font.OS2.UsWeightClass)
+	test.T(t, metrics.Post.UnderlinePosition, font.Post.UnderlinePosition)
+	family, _ := metrics.Name.Get(1)
+	test.T(t, family, "DejaVu Serif")
+	test.T(t, metrics.GlyphIndex('a'), uint16(0))
+
+	_, err = metrics.GlyphContour(glyphID)
+	test.T(t, err.Error(), "glyf: outlines not loaded")
+	_, _, err = metrics.Subset([]uint16{0, glyphID})
+	test.That(t, err != nil)
+}
+
+func TestSFNTStripHinting(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+	orig := append([]byte{}, b...)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	stripped, err := ParseSFNTOptions(b, ParseOptions{StripHinting: true})
+	test.Error(t, err)
+	test.T(t, b, orig) // font data is not modified
+
+	_, ok := font.Tables["fpgm"]
+	test.That(t, ok, "hinted font")
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		_, ok := stripped.Tables[tag]
+		test.That(t, !ok, tag)
+	}
+	test.That(t, len(stripped.Tables["glyf"]) < len(font.Tables["glyf"]))
+	test.T(t, stripped.Maxp.MaxSizeOfInstructions, uint16(0))
+
+	for _, r := range "Hé!" {
+		glyphID := font.GlyphIndex(r)
+		contour, err := font.GlyphContour(glyphID)
+		test.Error(t, err)
+		strippedContour, err := stripped.GlyphContour(glyphID)
+		test.Error(t, err)
+		test.T(t, len(strippedContour.Instructions), 0)
+		test.T(t, strippedContour.XCoordinates, contour.XCoordinates)
+		test.T(t, strippedContour.YCoordinates, contour.YCoordinates)
+		test.T(t, strippedContour.OnCurve, contour.OnCurve)
+	}
+
+	// serialized output does not contain hinting either
+	b, _, err = stripped.Subset([]uint16{0, stripped.GlyphIndex('H'), stripped.GlyphIndex('é')})
+	test.Error(t, err)
+	subset, err := ParseSFNT(b)
+	test.Error(t, err)
+	_, ok = subset.Tables["fpgm"]
+	test.That(t, !ok)
+	contour, err := subset.GlyphContour(1)
+	test.Error(t, err)
+	test.T(t, len(contour.Instructions), 0)
+}
+
+func TestSFNTTable(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+
+	head, ok := font.Table("head")
+	test.That(t, ok)
+	test.T(t, head, font.Tables["head"])
+	head[0] = 0xFF
+	test.T(t, font.Tables["head"][0], byte(0x00)) // copy
+
+	_, ok = font.Table("XXXX")
+	test.That(t, !ok)
+
+	// compare against the checksums in the table directory
+	r := newBinaryReader(b[12:])
+	for i := 0; i < len(font.Tables); i++ {
+		tag := r.ReadString(4)
+		checksum := r.ReadUint32()
+		_ = r.ReadBytes(8)
+
+		calculated, ok := font.TableChecksum(tag)
+		test.That(t, ok)
+		test.T(t, calculated, checksum, tag)
+	}
+}
+
+func TestBinaryReader(t *testing.T) {
+	r := newBinaryReader([]byte{0x01, 0x02, 0x03, 0x04, 0xFF, 0xFE, 0xFF, 0xFF})
+	test.T(t, r.ReadUint16(), uint16(0x0102))
+	test.T(t, r.ReadUint16LE(), uint16(0x0403))
+	test.T(t, r.ReadInt32LE(), int32(-257))
+	test.Error(t, r.Err())
+	test.T(t, r.ReadUint16(), uint16(0))
+	test.That(t, r.EOF())
+	test.T(t, r.Err(), ErrInvalidFontData)
+
+	r.Seek(0)
+	test.That(t, !r.EOF())
+	test.T(t, r.Err(), ErrInvalidFontData) // sticky
+	test.T(t, r.ReadUint64LE(), uint64(0xFFFFFEFF04030201))
+
+	r = newBinaryReader([]byte{0x01, 0x02})
+	r.Seek(3)
+	test.T(t, r.Err(), ErrInvalidFontData)
+}
+
+func TestBuildCmap(t *testing.T) {
+	var tts = []struct {
+		m      map[rune]uint16
+		format uint16
+	}{
+		{map[rune]uint16{}, 4},
+		{map[rune]uint16{'a': 1, 'b': 2, 'c': 3, 'x': 10, 'z': 5, 0xFFFF: 7}, 4},
+		{map[rune]uint16{'a': 1, 'b': 2, 0x1F600: 3, 0x1F601: 4, 0x2A700: 50}, 12},
+	}
+	for i, tt := range tts {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			b, err := BuildCmap(tt.m)
+			test.Error(t, err)
+
+			font := &SFNT{
+				Tables: map[string][]byte{"cmap": b},
+				Maxp:   &maxpTable{NumGlyphs: 100},
+			}
+			test.Error(t, font.parseCmap())
+			test.T(t, len(font.Cmap.EncodingRecords), 1)
+			test.T(t, font.Cmap.EncodingRecords[0].Format, tt.format)
+			for r, glyphID := range tt.m {
+				test.T(t, font.GlyphIndex(r), glyphID, string(r))
+			}
+			test.T(t, font.GlyphIndex('y'), uint16(0))
+		})
+	}
+
+	_, err := BuildCmap(map[rune]uint16{-1: 1})
+	test.T(t, err.Error(), "cmap: bad rune -1")
+
+	// segments that do not fit in the length of a format 4 subtable
+	m := map[rune]uint16{}
+	for i := 0; i < 9000; i++ {
+		m[rune(2*i)] = uint16(i + 1)
+	}
+	b, err := BuildCmap(m)
+	test.Error(t, err)
+	font := &SFNT{
+		Tables: map[string][]byte{"cmap": b},
+		Maxp:   &maxpTable{NumGlyphs: 9001},
+	}
+	test.Error(t, font.parseCmap())
+	test.T(t, font.Cmap.EncodingRecords[0].Format, uint16(12))
+	for r, glyphID := range m {
+		if font.GlyphIndex(r) != glyphID {
+			test.Fail(t, "bad glyph ID for", r)
+		}
+	}
+	test.T(t, font.GlyphIndex(1), uint16(0))
+
+	for i := 0; i <= MaxCmapSegments; i++ {
+		m[rune(2*i)] = uint16(i + 1)
+	}
+	_, err = BuildCmap(m)
+	test.T(t, err.Error(), "cmap: too many segments")
+}
+
+// cmapFormat4Range returns a cmap table with a format 4 subtable mapping 'A' to 'C' using the glyph ID array at the given idRangeOffset.
+func cmapFormat4Range(idRangeOffset uint16) []byte {
+	w := newBinaryWriter([]byte{})
+	w.WriteUint16(0) // version
+	w.WriteUint16(1) // numTables
+	w.WriteUint16(3) // platformID
+	w.WriteUint16(1) // encodingID
+	w.WriteUint32(12)
+
+	w.WriteUint16(4)              // format
+	w.WriteUint16(16 + 2*2*4 + 6) // length
+	w.WriteUint16(0)              // language
+	w.WriteUint16(2 * 2)          // segCountX2
+	w.WriteUint16(4)              // searchRange
+	w.WriteUint16(1)              // entrySelector
+	w.WriteUint16(0)              // rangeShift
+	w.WriteUint16('C')            // endCode
+	w.WriteUint16(0xFFFF)
+	w.WriteUint16(0)   // reservedPad
+	w.WriteUint16('A') // startCode
+	w.WriteUint16(0xFFFF)
+	w.WriteInt16(0) // idDelta
+	w.WriteInt16(1)
+	w.WriteUint16(idRangeOffset)
+	w.WriteUint16(0)
+	w.WriteUint16(1) // glyphIdArray
+	w.WriteUint16(2)
+	w.WriteUint16(3)
+	return w.Bytes()
+}
+
+func TestSFNTCmapFormat4Range(t *testing.T) {
+	// the glyph ID array is indexed from -1 for 'A' up to 1 for 'C', which used to panic for 'A'
+	font := &SFNT{
+		Tables: map[string][]byte{"cmap": cmapFormat4Range(2)},
+		Maxp:   &maxpTable{NumGlyphs: 10},
+	}
+	test.T(t, font.parseCmap().Error(), "cmap: bad idRangeOffset in subtable 0")
+
+	font.Tables["cmap"] = cmapFormat4Range(4)
+	test.Error(t, font.parseCmap())
+	test.T(t, font.GlyphIndex('A'), uint16(1))
+	test.T(t, font.GlyphIndex('B'), uint16(2))
+	test.T(t, font.GlyphIndex('C'), uint16(3))
+
+	subtable := &cmapFormat4{
+		StartCode:     []uint16{'A'},
+		EndCode:       []uint16{'C'},
+		IdDelta:       []int16{0},
+		IdRangeOffset: []uint16{2},
+		GlyphIdArray:  []uint16{1},
+	}
+	glyphID, ok := subtable.Get('B')
+	test.T(t, glyphID, uint16(0))
+	test.That(t, !ok, "index out of range")
+}
+
+func TestSFNTCmapLanguage(t *testing.T) {
+	format6 := func(language uint16, firstCode uint16, glyphIDs ...uint16) []byte {
+		w := newBinaryWriter([]byte{})
+		w.WriteUint16(6)
+		w.WriteUint16(uint16(10 + 2*len(glyphIDs)))
+		w.WriteUint16(language)
+		w.WriteUint16(firstCode)
+		w.WriteUint16(uint16(len(glyphIDs)))
+		for _, glyphID := range glyphIDs {
+			w.WriteUint16(glyphID)
+		}
+		return w.Bytes()
+	}
+	subtables := [][]byte{
+		format6(12, 'A', 1),              // Macintosh, language-specific
+		format6(0, 'A', 2, 3),            // Macintosh, language-independent
+		{0, 14, 0, 0, 0, 10, 0, 0, 0, 0}, // Unicode variation sequences, unsupported
+		format6(3, 'A', 4, 5, 6),         // Macintosh, language-specific
+		format6(0, 'A', 7),               // Windows
+	}
+	records := []struct {
+		platformID, encodingID uint16
+		subtable               int
+	}{{1, 0, 0}, {1, 0, 1}, {0, 5, 2}, {1, 0, 3}, {3, 1, 4}, {1, 0, 0}}
+
+	w := newBinaryWriter([]byte{})
+	w.WriteUint16(0)
+	w.WriteUint16(uint16(len(records)))
+	offsets := []uint32{}
+	offset := 4 + 8*uint32(len(records))
+	for _, subtable := range subtables {
+		offsets = append(offsets, offset)
+		offset += uint32(len(subtable))
+	}
+	for _, record := range records {
+		w.WriteUint16(record.platformID)
+		w.WriteUint16(record.encodingID)
+		w.WriteUint32(offsets[record.subtable])
+	}
+	for _, subtable := range subtables {
+		w.WriteBytes(subtable)
+	}
+
+	font := &SFNT{
+		Tables: map[string][]byte{"cmap": w.Bytes()},
+		Maxp:   &maxpTable{NumGlyphs: 10},
+	}
+	test.Error(t, font.parseCmap())
+	test.T(t, len(font.Cmap.Subtables), 4)
+	test.T(t, len(font.Cmap.EncodingRecords), 5)
+	for i, language := range []uint32{12, 0, 3, 0, 12} {
+		test.T(t, font.Cmap.Language(i), language, fmt.Sprintf("record %d", i))
+	}
+	for i, subtable := range []uint16{0, 1, 2, 3, 0} {
+		test.T(t, font.Cmap.EncodingRecords[i].Subtable, subtable, fmt.Sprintf("record %d", i))
+	}
+	test.T(t, font.GlyphIndex('A'), uint16(7))
+	test.T(t, font.GlyphIndex('B'), uint16(3))
+	test.T(t, font.GlyphIndex('C'), uint16(6))
+	test.T(t, font.GlyphIndex('D'), uint16(0))
+}
+
+func TestBuildHmtx(t *testing.T) {
+	advances := []uint16{500, 600, 700, 700, 700}
+	lsbs := []int16{10, -20, 30, 40, 50}
+	b, numberOfHMetrics, err := BuildHmtx(advances, lsbs)
+	test.Error(t, err)
+	test.T(t, numberOfHMetrics, uint16(3))
+
+	font := &SFNT{
+		Tables: map[string][]byte{"hmtx": b},
+		Hhea:   &hheaTable{NumberOfHMetrics: numberOfHMetrics},
+		Maxp:   &maxpTable{NumGlyphs: uint16(len(advances))},
+	}
+	test.Error(t, font.parseHmtx())
+	for i := range advances {
+		test.T(t, font.GlyphAdvance(uint16(i)), advances[i])
+		test.T(t, font.Hmtx.LeftSideBearing(uint16(i)), lsbs[i])
+	}
+
+	_, _, err = BuildHmtx([]uint16{500}, []int16{})
+	test.T(t, err.Error(), "hmtx: advances and left side bearings must have the same length")
+}
+
+func TestSFNTHmtxSingleMetric(t *testing.T) {
+	b, numberOfHMetrics, err := BuildHmtx([]uint16{600, 600, 600}, []int16{10, 20, 30})
+	test.Error(t, err)
+	test.T(t, numberOfHMetrics, uint16(1))
+
+	font := &SFNT{
+		Tables: map[string][]byte{"hmtx": b},
+		Hhea:   &hheaTable{NumberOfHMetrics: numberOfHMetrics},
+		Maxp:   &maxpTable{NumGlyphs: 3},
+	}
+	test.Error(t, font.parseHmtx())
+	test.T(t, len(font.Hmtx.HMetrics), 1)
+	for i, lsb := range []int16{10, 20, 30} {
+		test.T(t, font.GlyphAdvance(uint16(i)), uint16(600))
+		test.T(t, font.Hmtx.LeftSideBearing(uint16(i)), lsb)
+	}
+
+	// glyph IDs beyond numGlyphs
+	test.T(t, font.GlyphAdvance(3), uint16(600))
+	test.T(t, font.GlyphAdvance(0xFFFF), uint16(600))
+	test.T(t, font.Hmtx.LeftSideBearing(3), int16(0))
+	test.T(t, font.Hmtx.LeftSideBearing(0xFFFF), int16(0))
+}
+
+func TestSFNTColorLayers(t *testing.T) {
+	w := newBinaryWriter([]byte{})
+	w.WriteUint16(0)  // version
+	w.WriteUint16(2)  // numBaseGlyphRecords
+	w.WriteUint32(14) // baseGlyphRecordsOffset
+	w.WriteUint32(26) // layerRecordsOffset
+	w.WriteUint16(3)  // numLayerRecords
+	for _, v := range []uint16{3, 0, 2, 5, 2, 1} {
+		w.WriteUint16(v) // base glyph records
+	}
+	for _, v := range []uint16{10, 0, 11, 0xFFFF, 12, 1} {
+		w.WriteUint16(v) // layer records
+	}
+	colr := w.Bytes()
+
+	w = newBinaryWriter([]byte{})
+	w.WriteUint16(0)  // version
+	w.WriteUint16(2)  // numPaletteEntries
+	w.WriteUint16(1)  // numPalettes
+	w.WriteUint16(2)  // numColorRecords
+	w.WriteUint32(14) // colorRecordsArrayOffset
+	w.WriteUint16(0)  // colorRecordIndices
+	w.WriteBytes([]byte{0x00, 0x00, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x80})
+	cpal := w.Bytes()
+
+	font := &SFNT{
+		Tables: map[string][]byte{"COLR": colr, "CPAL": cpal},
+	}
+	test.Error(t, font.parseColr())
+	test.Error(t, font.parseCpal())
+
+	layers, ok := font.ColorLayers(3, 0)
+	test.That(t, ok)
+	test.T(t, layers, []ColorLayer{{GlyphID: 10, Color: color.RGBA{255, 0, 0, 255}}, {GlyphID: 11, Foreground: true}})
+	layers, ok = font.ColorLayers(5, 0)
+	test.That(t, ok)
+	test.T(t, layers, []ColorLayer{{GlyphID: 12, Color: color.RGBA{0, 0, 128, 128}}})
+	_, ok = font.ColorLayers(4, 0)
+	test.That(t, !ok)
+
+	// bad palette
+	layers, _ = font.ColorLayers(5, 1)
+	test.T(t, layers, []ColorLayer{{GlyphID: 12, Foreground: true}})
+}
+
+func TestSFNTGlyphBitmapSbix(t *testing.T) {
+	w := newBinaryWriter([]byte{})
+	w.WriteUint16(1) // version
+	w.WriteUint16(1) // flags
+	w.WriteUint32(2) // numStrikes
+	w.WriteUint32(16)
+	w.WriteUint32(32)
+
+	// strike at 20 ppem with a PNG for glyph 1
+	w.WriteUint16(20) // ppem
+	w.WriteUint16(72) // ppi
+	w.WriteUint32(16) // glyph 0
+	w.WriteUint32(16) // glyph 1
+	w.WriteUint32(16) // end
+	w.WriteUint16(40) // ppem
+	w.WriteUint16(72) // ppi
+	w.WriteUint32(16) // glyph 0
+	w.WriteUint32(26) // glyph 1
+	w.WriteUint32(37) // end
+	w.WriteInt16(0)   // glyph 0 originOffsetX
+	w.WriteInt16(0)   // glyph 0 originOffsetY
+	w.WriteBytes([]byte("dupe"))
+	w.WriteUint16(1) // glyph 0 is a duplicate of glyph 1
+	w.WriteInt16(2)  // glyph 1 originOffsetX
+	w.WriteInt16(-3) // glyph 1 originOffsetY
+	w.WriteBytes([]byte("png "))
+	w.WriteBytes([]byte("PNG"))
+	w.WriteBytes([]byte("!")) // padding
+
+	font := &SFNT{
+		Tables: map[string][]byte{"sbix": w.Bytes()},
+		Maxp:   &maxpTable{NumGlyphs: 2},
+	}
+	test.Error(t, font.parseSbix())
+
+	_, ok := font.GlyphBitmap(1, 12) // nearest strike has no glyph data
+	test.That(t, !ok)
+	bitmap, ok := font.GlyphBitmap(1, 36)
+	test.That(t, ok)
+	test.T(t, *bitmap, GlyphBitmap{Format: "png", Data: []byte("PNG"), PPEM: 40, OriginX: 2, OriginY: -3})
+	bitmap, ok = font.GlyphBitmap(0, 100)
+	test.That(t, ok)
+	test.T(t, bitmap.Data, []byte("PNG"))
+	_, ok = font.GlyphBitmap(2, 40)
+	test.That(t, !ok)
+
+	for _, tt := range [][2]uint16{{12, 20}, {20, 20}, {21, 40}, {36, 40}, {100, 40}} {
+		strikePPEM, ok := font.BestStrike(tt[0])
+		test.That(t, ok)
+		test.T(t, strikePPEM, tt[1], tt[0])
+	}
+}
+
+func TestSFNTGlyphBitmapCBDT(t *testing.T) {
+	cbdt := newBinaryWriter([]byte{})
+	cbdt.WriteUint32(0x00030000)           // version
+	cbdt.WriteBytes([]byte{8, 6, 1, 7, 6}) // small glyph metrics: height, width, bearingX, bearingY, advance
+	cbdt.WriteUint32(3)                    // dataLen
+	cbdt.WriteBytes([]byte("PNG"))         // data
+
+	w := newBinaryWriter([]byte{})
+	w.WriteUint16(3)  // majorVersion
+	w.WriteUint16(0)  // minorVersion
+	w.WriteUint32(1)  // numSizes
+	w.WriteUint32(56) // indexSubTableArrayOffset
+	w.WriteUint32(24) // indexTablesSize
+	w.WriteUint32(1)  // numberOfIndexSubTables
+	w.WriteUint32(0)  // colorRef
+	w.WriteBytes(make([]byte, 24))
+	w.WriteUint16(5)  // startGlyphIndex
+	w.WriteUint16(6)  // endGlyphIndex
+	w.WriteByte(109)  // ppemX
+	w.WriteByte(109)  // ppemY
+	w.WriteByte(32)   // bitDepth
+	w.WriteByte(1)    // flags
+	w.WriteUint16(5)  // firstGlyphIndex
+	w.WriteUint16(6)  // lastGlyphIndex
+	w.WriteUint32(8)  // additionalOffsetToIndexSubtable
+	w.WriteUint16(1)  // indexFormat
+	w.WriteUint16(17) // imageFormat
+	w.WriteUint32(4)  // imageDataOffset
+	w.WriteUint32(0)  // glyph 5
+	w.WriteUint32(12) // glyph 6
+	w.WriteUint32(12) // end
+
+	font := &SFNT{
+		Tables: map[string][]byte{"CBLC": w.Bytes(), "CBDT": cbdt.Bytes()},
+	}
+	test.Error(t, font.parseCblc())
+
+	bitmap, ok := font.GlyphBitmap(5, 12)
+	test.That(t, ok)
+	test.T(t, *bitmap, GlyphBitmap{Format: "png", Data: []byte("PNG"), PPEM: 109, OriginX: 1, OriginY: -1})
+	_, ok = font.GlyphBitmap(6, 12) // empty
+	test.That(t, !ok)
+	_, ok = font.GlyphBitmap(7, 12)
+	test.That(t, !ok)
+
+	strikePPEM, ok := font.BestStrike(12)
+	test.That(t, ok)
+	test.T(t, strikePPEM, uint16(109))
+}
+
+func TestSFNTBestStrikeOutline(t *testing.T) {
+	b, err := ioutil.ReadFile("DejaVuSerif.ttf")
+	test.Error(t, err)
+	font, err := ParseSFNT(b)
+	test.Error(t, err)
+	_, ok := font.BestStrike(12)
+	test.That(t, !ok, "outline font")
+}
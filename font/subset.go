@@ -0,0 +1,195 @@
+package font
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Subset returns a TrueType font that only contains the given glyphs, where glyph ID i of the subset is glyphIDs[i]. The first glyph must be the .notdef glyph 0. Components of composite glyphs that are not in the list are appended, and the returned list holds the original glyph ID of every glyph in the subset. Only the tables required for rendering are kept, the cmap table is rebuilt for the retained glyphs, and glyph names are dropped from the post table. Layout tables such as GSUB, GPOS, and kern are removed as their glyph IDs are no longer valid.
+func (sfnt *SFNT) Subset(glyphIDs []uint16) ([]byte, []uint16, error) {
+	if !sfnt.IsTrueType {
+		return nil, nil, fmt.Errorf("CFF not supported")
+	} else if sfnt.Glyf == nil {
+		return nil, nil, fmt.Errorf("glyf: outlines not loaded")
+	} else if len(glyphIDs) == 0 || glyphIDs[0] != 0 {
+		return nil, nil, fmt.Errorf("first glyph must be .notdef")
+	}
+
+	// collect glyphs and the components of composite glyphs
+	newIDs := make(map[uint16]uint16, len(glyphIDs))
+	glyphIDs = append([]uint16{}, glyphIDs...)
+	for i, glyphID := range glyphIDs {
+		if sfnt.Maxp.NumGlyphs <= glyphID {
+			return nil, nil, fmt.Errorf("glyf: bad glyphID %v", glyphID)
+		} else if _, ok := newIDs[glyphID]; ok {
+			return nil, nil, fmt.Errorf("glyf: duplicate glyphID %v", glyphID)
+		}
+		newIDs[glyphID] = uint16(i)
+	}
+	for i := 0; i < len(glyphIDs); i++ {
+		components, _ := sfnt.Glyf.Components(glyphIDs[i])
+		for _, component := range components {
+			if _, ok := newIDs[component]; !ok {
+				if sfnt.Maxp.NumGlyphs <= component {
+					return nil, nil, fmt.Errorf("glyf: bad component glyphID %v", component)
+				}
+				newIDs[component] = uint16(len(glyphIDs))
+				glyphIDs = append(glyphIDs, component)
+			}
+		}
+	}
+
+	// glyf and loca tables, using long offsets
+	glyf := newBinaryWriter([]byte{})
+	loca := newBinaryWriter([]byte{})
+	advances := make([]uint16, len(glyphIDs))
+	lsbs := make([]int16, len(glyphIDs))
+	for i, glyphID := range glyphIDs {
+		b, err := sfnt.Glyf.Get(glyphID)
+		if err != nil {
+			return nil, nil, err
+		}
+		loca.WriteUint32(glyf.Len())
+		if _, ok := sfnt.Glyf.Components(glyphID); ok {
+			b = append([]byte{}, b...)
+			if err := remapComponents(b, newIDs); err != nil {
+				return nil, nil, err
+			}
+		}
+		glyf.WriteBytes(b)
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+		advances[i] = sfnt.Hmtx.Advance(glyphID)
+		lsbs[i] = sfnt.Hmtx.LeftSideBearing(glyphID)
+	}
+	loca.WriteUint32(glyf.Len())
+
+	hmtx, numberOfHMetrics, err := BuildHmtx(advances, lsbs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// cmap table for the retained glyphs
+	runes := map[rune]uint16{}
+	for _, subtable := range sfnt.Cmap.Subtables {
+		subtable.ForEach(func(r rune, glyphID uint16) {
+			if newID, ok := newIDs[sfnt.Cmap.Get(r)]; ok && newID != 0 {
+				runes[r] = newID
+			}
+		})
+	}
+	cmap, err := BuildCmap(runes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	head := append([]byte{}, sfnt.Tables["head"]...)
+	binary.BigEndian.PutUint16(head[50:], 1) // indexToLocFormat
+	hhea := append([]byte{}, sfnt.Tables["hhea"]...)
+	binary.BigEndian.PutUint16(hhea[34:], numberOfHMetrics)
+	maxp := append([]byte{}, sfnt.Tables["maxp"]...)
+	binary.BigEndian.PutUint16(maxp[4:], uint16(len(glyphIDs)))
+	post := append([]byte{}, sfnt.Tables["post"][:32]...)
+	binary.BigEndian.PutUint32(post[0:], 0x00030000) // version 3 has no glyph names
+
+	tables := map[string][]byte{
+		"cmap": cmap,
+		"glyf": glyf.Bytes(),
+		"head": head,
+		"hhea": hhea,
+		"hmtx": hmtx,
+		"loca": loca.Bytes(),
+		"maxp": maxp,
+		"name": sfnt.Tables["name"],
+		"OS/2": sfnt.Tables["OS/2"],
+		"post": post,
+	}
+	for _, tag := range []string{"cvt ", "fpgm", "prep", "gasp"} {
+		if b, ok := sfnt.Tables[tag]; ok {
+			tables[tag] = b
+		}
+	}
+	return writeSFNT(0x00010000, tables), glyphIDs, nil
+}
+
+// remapComponents replaces the glyph IDs of the components of a composite glyph in place.
+func remapComponents(b []byte, newIDs map[uint16]uint16) error {
+	pos := 10 // skip header
+	for {
+		if len(b) < pos+4 {
+			return fmt.Errorf("glyf: bad composite glyph")
+		}
+		flags := binary.BigEndian.Uint16(b[pos:])
+		newID, ok := newIDs[binary.BigEndian.Uint16(b[pos+2:])]
+		if !ok {
+			return fmt.Errorf("glyf: bad component")
+		}
+		binary.BigEndian.PutUint16(b[pos+2:], newID)
+
+		pos += 6
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+			pos += 2
+		}
+		if flags&0x0008 != 0 { // WE_HAVE_A_SCALE
+			pos += 2
+		} else if flags&0x0040 != 0 { // WE_HAVE_AN_X_AND_Y_SCALE
+			pos += 4
+		} else if flags&0x0080 != 0 { // WE_HAVE_A_TWO_BY_TWO
+			pos += 8
+		}
+		if flags&0x0020 == 0 { // MORE_COMPONENTS
+			return nil
+		}
+	}
+}
+
+// writeSFNT writes an SFNT font file with the tables sorted by tag, including their checksums and the checksum adjustment of the head table.
+func writeSFNT(sfntVersion uint32, tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	numTables := uint16(len(tags))
+	searchRange, entrySelector := uint16(1), uint16(0)
+	for searchRange*2 <= numTables {
+		searchRange *= 2
+		entrySelector++
+	}
+	searchRange *= 16
+	rangeShift := numTables*16 - searchRange
+
+	w := newBinaryWriter([]byte{})
+	w.WriteUint32(sfntVersion)
+	w.WriteUint16(numTables)
+	w.WriteUint16(searchRange)
+	w.WriteUint16(entrySelector)
+	w.WriteUint16(rangeShift)
+
+	offset := 12 + 16*uint32(numTables)
+	padded := make([][]byte, len(tags))
+	for i, tag := range tags {
+		b := tables[tag]
+		padded[i] = append(append([]byte{}, b...), make([]byte, (4-len(b)&3)&3)...)
+		if tag == "head" {
+			binary.BigEndian.PutUint32(padded[i][8:], 0) // checksumAdjustment
+		}
+		w.WriteString(tag)
+		w.WriteUint32(CalcChecksum(padded[i]))
+		w.WriteUint32(offset)
+		w.WriteUint32(uint32(len(b)))
+		offset += uint32(len(padded[i]))
+	}
+	for _, b := range padded {
+		w.WriteBytes(b)
+	}
+
+	b := w.Bytes()
+	if _, ok := tables["head"]; ok {
+		_ = SetChecksumAdjustment(b) // cannot fail as the table directory is valid
+	}
+	return b
+}
@@ -12,21 +12,53 @@ var MaxMemory uint32 = 30 * 1024 * 1024
 // ErrExceedsMemory is returned if the font is malformed.
 var ErrExceedsMemory = fmt.Errorf("memory limit exceded")
 
+// ErrLimitExceeded is returned if the font exceeds one of the limits set in ParseOptions.
+var ErrLimitExceeded = fmt.Errorf("limit exceeded")
+
 // ErrInvalidFontData is returned if the font is malformed.
 var ErrInvalidFontData = fmt.Errorf("invalid font data")
 
-func calcChecksum(b []byte) uint32 {
-	if len(b)%4 != 0 {
-		panic("data not multiple of four bytes")
-	}
+// CalcChecksum calculates the checksum of a table or font file as the sum of its big-endian uint32 values, where the data is padded with zeros to a multiple of four bytes. For the head table, the checksumAdjustment field must be set to zero first.
+func CalcChecksum(b []byte) uint32 {
 	var sum uint32
-	r := newBinaryReader(b)
-	for !r.EOF() {
-		sum += r.ReadUint32()
+	n := len(b) &^ 3
+	for i := 0; i < n; i += 4 {
+		sum += binary.BigEndian.Uint32(b[i:])
+	}
+	if n < len(b) {
+		var last [4]byte
+		copy(last[:], b[n:])
+		sum += binary.BigEndian.Uint32(last[:])
 	}
 	return sum
 }
 
+// SetChecksumAdjustment computes and sets the checksumAdjustment field of the head table of an assembled SFNT font file in place, so that the checksum of the whole file equals 0xB1B0AFBA. The table checksums in the table directory must already be set.
+func SetChecksumAdjustment(b []byte) error {
+	if len(b) < 12 {
+		return ErrInvalidFontData
+	}
+	numTables := int(binary.BigEndian.Uint16(b[4:]))
+	if len(b) < 12+16*numTables {
+		return ErrInvalidFontData
+	}
+	for i := 0; i < numTables; i++ {
+		entry := b[12+16*i:]
+		if string(entry[:4]) != "head" {
+			continue
+		}
+		offset := binary.BigEndian.Uint32(entry[8:])
+		length := binary.BigEndian.Uint32(entry[12:])
+		if length < 12 || uint32(len(b)) < offset || uint32(len(b))-offset < length {
+			return ErrInvalidFontData
+		}
+		binary.BigEndian.PutUint32(b[offset+8:], 0)
+		binary.BigEndian.PutUint32(b[offset+8:], 0xB1B0AFBA-CalcChecksum(b))
+		return nil
+	}
+	return fmt.Errorf("head: missing table")
+}
+
 func uint16ToFlags(v uint16) (flags [16]bool) {
 	for i := 0; i < 16; i++ {
 		flags[i] = v&(1<<i) != 0
@@ -47,22 +79,25 @@ func uint32ToString(v uint32) string {
 	return string(b)
 }
 
+// binaryReader reads big-endian (and little-endian with the LE suffix) values from a buffer. Reading past the end returns zero values and sets EOF, which is reset by Seek, and a sticky error that is not, so that parsers can check for short reads once after reading instead of checking the length before every read.
 type binaryReader struct {
 	buf []byte
 	pos uint32
 	eof bool
+	err error
 }
 
 func newBinaryReader(buf []byte) *binaryReader {
 	if math.MaxUint32 < uint64(len(buf)) {
-		return &binaryReader{nil, 0, true}
+		return &binaryReader{nil, 0, true, ErrExceedsMemory}
 	}
-	return &binaryReader{buf, 0, false}
+	return &binaryReader{buf, 0, false, nil}
 }
 
 func (r *binaryReader) ReadBytes(n uint32) []byte {
 	if r.eof || uint32(len(r.buf))-r.pos < n {
 		r.eof = true
+		r.err = ErrInvalidFontData
 		return nil
 	}
 	buf := r.buf[r.pos : r.pos+n]
@@ -118,6 +153,10 @@ func (r *binaryReader) ReadInt16() int16 {
 	return int16(r.ReadUint16())
 }
 
+func (r *binaryReader) ReadInt32() int32 {
+	return int32(r.ReadUint32())
+}
+
 func (r *binaryReader) ReadUint16LE() uint16 {
 	b := r.ReadBytes(2)
 	if b == nil {
@@ -134,13 +173,26 @@ func (r *binaryReader) ReadUint32LE() uint32 {
 	return binary.LittleEndian.Uint32(b)
 }
 
+func (r *binaryReader) ReadUint64LE() uint64 {
+	b := r.ReadBytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
 func (r *binaryReader) ReadInt16LE() int16 {
 	return int16(r.ReadUint16LE())
 }
 
+func (r *binaryReader) ReadInt32LE() int32 {
+	return int32(r.ReadUint32LE())
+}
+
 func (r *binaryReader) Seek(pos uint32) {
 	if uint32(len(r.buf)) < pos {
 		r.eof = true
+		r.err = ErrInvalidFontData
 		return
 	}
 	r.pos = pos
@@ -159,6 +211,11 @@ func (r *binaryReader) EOF() bool {
 	return r.eof
 }
 
+// Err returns ErrInvalidFontData if any read or seek went past the end of the buffer, even if the reader was seeked back since.
+func (r *binaryReader) Err() error {
+	return r.err
+}
+
 type bitmapReader struct {
 	buf []byte
 	pos uint32
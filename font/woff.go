@@ -199,7 +199,7 @@ func ParseWOFF(b []byte) ([]byte, error) {
 			// to check checksum for head table, replace the overal checksum with zero and reset it at the end
 			binary.BigEndian.PutUint32(data[8:], 0x00000000)
 		}
-		if calcChecksum(data) != table.origChecksum {
+		if CalcChecksum(data) != table.origChecksum {
 			return nil, fmt.Errorf("%s: bad checksum", table.tag)
 		}
 
@@ -212,7 +212,7 @@ func ParseWOFF(b []byte) ([]byte, error) {
 	if checksumAdjustmentPos == 0 {
 		return nil, ErrInvalidFontData
 	} else {
-		checksum := 0xB1B0AFBA - calcChecksum(w.Bytes())
+		checksum := 0xB1B0AFBA - CalcChecksum(w.Bytes())
 		// TODO: (WOFF) master checksum seems right, but we don't throw an error if it is off
 		//if checkSumAdjustment != checksum {
 		//	return nil, fmt.Errorf("bad checksum")
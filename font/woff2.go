@@ -324,7 +324,7 @@ func ParseWOFF2(b []byte) ([]byte, error) {
 		}
 
 		w.WriteUint32(binary.BigEndian.Uint32([]byte(tables[i].tag)))
-		w.WriteUint32(calcChecksum(tables[i].data))
+		w.WriteUint32(CalcChecksum(tables[i].data))
 		w.WriteUint32(sfntOffset)
 		w.WriteUint32(actualLength)
 		sfntOffset += uint32(len(tables[i].data))
@@ -341,7 +341,7 @@ func ParseWOFF2(b []byte) ([]byte, error) {
 	}
 
 	buf := w.Bytes()
-	checkSumAdjustment := 0xB1B0AFBA - calcChecksum(buf)
+	checkSumAdjustment := 0xB1B0AFBA - CalcChecksum(buf)
 	binary.BigEndian.PutUint32(buf[iCheckSumAdjustment:], checkSumAdjustment)
 	return buf, nil
 }
@@ -2,8 +2,10 @@ package canvas
 
 import (
 	"io/ioutil"
+	"math"
 	"testing"
 
+	canvasFont "github.com/tdewolff/canvas/font"
 	"github.com/tdewolff/test"
 )
 
@@ -31,6 +33,49 @@ func TestParseTTF(t *testing.T) {
 	test.T(t, len(indices), 4)
 }
 
+func TestGlyphOutline(t *testing.T) {
+	b, err := ioutil.ReadFile("font/DejaVuSerif.ttf")
+	test.Error(t, err)
+
+	sfnt, err := canvasFont.ParseSFNT(b)
+	test.Error(t, err)
+
+	// outlines lie within the bounding box of their on-curve and off-curve points
+	for glyphID := uint16(0); glyphID < sfnt.Maxp.NumGlyphs; glyphID++ {
+		contour, err := sfnt.GlyphContour(glyphID)
+		test.Error(t, err)
+		if contour == nil {
+			continue
+		}
+
+		xmin, xmax := math.Inf(1), math.Inf(-1)
+		ymin, ymax := math.Inf(1), math.Inf(-1)
+		for i := range contour.XCoordinates {
+			xmin, xmax = math.Min(xmin, float64(contour.XCoordinates[i])), math.Max(xmax, float64(contour.XCoordinates[i]))
+			ymin, ymax = math.Min(ymin, float64(contour.YCoordinates[i])), math.Max(ymax, float64(contour.YCoordinates[i]))
+		}
+
+		p, err := GlyphOutline(sfnt, glyphID)
+		test.Error(t, err)
+		bounds := p.Bounds()
+		test.That(t, xmin-Epsilon <= bounds.X && bounds.X+bounds.W <= xmax+Epsilon, glyphID)
+		test.That(t, ymin-Epsilon <= bounds.Y && bounds.Y+bounds.H <= ymax+Epsilon, glyphID)
+	}
+
+	p, err := GlyphOutline(sfnt, sfnt.GlyphIndex('o'))
+	test.Error(t, err)
+	test.T(t, len(p.Split()), 2)
+
+	q, err := GlyphPath(sfnt, sfnt.GlyphIndex('o'), 12.0, 1.0, 2.0)
+	test.Error(t, err)
+	f := 12.0 / float64(sfnt.Head.UnitsPerEm)
+	test.T(t, q, p.Transform(Identity.Translate(1.0, 2.0).Scale(f, f)))
+
+	p, err = GlyphOutline(sfnt, sfnt.GlyphIndex(' '))
+	test.Error(t, err)
+	test.That(t, p == nil, "empty glyph")
+}
+
 func TestParseOTF(t *testing.T) {
 	b, err := ioutil.ReadFile("font/EBGaramond12-Regular.otf")
 	test.Error(t, err)
@@ -188,12 +188,14 @@ type FontFace struct {
 	Color   color.RGBA
 	deco    []FontDecorator
 
+	Language string // BCP 47 language tag such as en-US, used by output formats that support it, empty for the document language
+
 	Scale, Voffset, FauxBold, FauxItalic float64 // consequences of font style and variant
 }
 
 // Equals returns true when two font face are equal. In particular this allows two adjacent text spans that use the same decoration to allow the decoration to span both elements instead of two separately.
 func (ff FontFace) Equals(other FontFace) bool {
-	return ff.Font == other.Font && ff.Size == other.Size && ff.Style == other.Style && ff.Variant == other.Variant && ff.Color == other.Color && reflect.DeepEqual(ff.deco, other.deco)
+	return ff.Font == other.Font && ff.Size == other.Size && ff.Style == other.Style && ff.Variant == other.Variant && ff.Color == other.Color && ff.Language == other.Language && reflect.DeepEqual(ff.deco, other.deco)
 }
 
 // Name returns the name of the underlying font
@@ -365,7 +367,7 @@ type FontDecorator interface {
 const underlineDistance = 0.15
 const underlineThickness = 0.075
 
-// FontUnderline is a font decoration that draws a line under the text at the base line.
+// FontUnderline is a font decoration that draws a line under the text at the base line, using the underline position and thickness of the font if available.
 var FontUnderline FontDecorator = underline{}
 
 type underline struct{}
@@ -373,6 +375,10 @@ type underline struct{}
 func (underline) Decorate(ff FontFace, w float64) *Path {
 	r := ff.Size * underlineThickness
 	y := -ff.Size * underlineDistance
+	if position, thickness, ok := ff.Font.UnderlineMetrics(ff.Size); ok {
+		r = thickness
+		y = position - thickness/2.0
+	}
 
 	p := &Path{}
 	p.MoveTo(0.0, y)
@@ -398,7 +404,7 @@ func (overline) Decorate(ff FontFace, w float64) *Path {
 	return p.Stroke(r, ButtCap, BevelJoin)
 }
 
-// FontStrikethrough is a font decoration that draws a line through the text in the middle between the base and X-Height line.
+// FontStrikethrough is a font decoration that draws a line through the text in the middle between the base and X-Height line, using the strikeout position and thickness of the font if available.
 var FontStrikethrough FontDecorator = strikethrough{}
 
 type strikethrough struct{}
@@ -406,6 +412,10 @@ type strikethrough struct{}
 func (strikethrough) Decorate(ff FontFace, w float64) *Path {
 	r := ff.Size * underlineThickness
 	y := ff.Metrics().XHeight / 2.0
+	if position, thickness, ok := ff.Font.StrikeoutMetrics(ff.Size); ok {
+		r = thickness
+		y = position - thickness/2.0
+	}
 
 	dx := ff.FauxItalic * y
 	w += ff.FauxItalic * y
@@ -55,13 +55,13 @@ func TestFontDecoration(t *testing.T) {
 	family.LoadFontFile("font/DejaVuSerif.ttf", FontRegular)
 
 	face := family.Face(12.0*ptPerMm, Black, FontRegular, FontNormal, FontUnderline)
-	test.T(t, face.Decorate(10.0), MustParseSVG("M0 -2.25L10 -2.25L10 -1.35L0 -1.35L0 -2.25z"))
+	test.T(t, face.Decorate(10.0), MustParseSVG("M0 -1.2890625L10 -1.2890625L10 -0.76171875L0 -0.76171875z"))
 
 	face = family.Face(12.0*ptPerMm, Black, FontRegular, FontNormal, FontOverline)
 	test.T(t, face.Decorate(10.0), MustParseSVG("M0 7.5844L10 7.5844L10 8.4844L0 8.4844L0 7.5844z"))
 
 	face = family.Face(12.0*ptPerMm, Black, FontRegular, FontNormal, FontStrikethrough)
-	test.T(t, face.Decorate(10.0), MustParseSVG("M0 2.6672L10 2.6672L10 3.5672L0 3.5672L0 2.6672z"))
+	test.T(t, face.Decorate(10.0), MustParseSVG("M0 2.5078125L10 2.5078125L10 3.10546875L0 3.10546875z"))
 
 	face = family.Face(12.0*ptPerMm, Black, FontRegular, FontNormal, FontDoubleUnderline)
 	test.T(t, face.Decorate(10.0), MustParseSVG("M0 -1.8L10 -1.8L10 -0.9L0 -0.9L0 -1.8zM0 -3.6L10 -3.6L10 -2.7L0 -2.7L0 -3.6z"))
@@ -0,0 +1,132 @@
+package pdf
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/tdewolff/canvas"
+)
+
+// AddSquareAnnotation adds a square annotation to the current page with the given rectangle in millimeters. The stroke color is used for the border and the fill color for the interior, which is omitted when transparent.
+func (r *PDF) AddSquareAnnotation(rect canvas.Rect, borderWidth float64, strokeColor, fillColor color.RGBA) {
+	r.w.AddShapeAnnotation("Square", rect, borderWidth, strokeColor, fillColor)
+}
+
+// AddCircleAnnotation adds a circle annotation to the current page, which is an ellipse inscribed in the given rectangle in millimeters. The stroke color is used for the border and the fill color for the interior, which is omitted when transparent.
+func (r *PDF) AddCircleAnnotation(rect canvas.Rect, borderWidth float64, strokeColor, fillColor color.RGBA) {
+	r.w.AddShapeAnnotation("Circle", rect, borderWidth, strokeColor, fillColor)
+}
+
+// AddLineAnnotation adds a line annotation to the current page between the given points in millimeters.
+func (r *PDF) AddLineAnnotation(start, end canvas.Point, borderWidth float64, strokeColor color.RGBA) {
+	r.w.AddLineAnnotation(start, end, borderWidth, strokeColor)
+}
+
+// AddTextAnnotation adds a text annotation (a sticky note) to the current page, shown as a note icon with its lower-left corner at the given position in millimeters.
+func (r *PDF) AddTextAnnotation(pos canvas.Point, contents string, col color.RGBA) {
+	r.w.AddTextAnnotation(pos, contents, col)
+}
+
+// AddHighlightAnnotation adds a highlight annotation to the current page that covers the given rectangles in millimeters, for example one for each line of a highlighted text region.
+func (r *PDF) AddHighlightAnnotation(contents string, col color.RGBA, rects ...canvas.Rect) {
+	r.w.AddHighlightAnnotation(contents, col, rects...)
+}
+
+// AddAnnotation appends an annotation dictionary to the page's annotations. The annotations are written as separate objects when the page is written.
+func (w *pdfPageWriter) AddAnnotation(annot pdfDict) {
+	if w.Buffer == nil {
+		panic("page has been flushed, call NewPage before adding annotations")
+	}
+	annot["Type"] = pdfName("Annot")
+	w.annots = append(w.annots, annot)
+}
+
+func (w *pdfPageWriter) AddShapeAnnotation(subtype string, rect canvas.Rect, borderWidth float64, strokeColor, fillColor color.RGBA) {
+	annot := pdfDict{
+		"Subtype": pdfName(subtype),
+		"Rect":    w.pdfRect(rect),
+		"BS":      pdfDict{"W": borderWidth * w.unitsPerMm()},
+		"C":       pdfColor(strokeColor),
+	}
+	if fillColor.A != 0 {
+		annot["IC"] = pdfColor(fillColor)
+	}
+	w.AddAnnotation(annot)
+}
+
+func (w *pdfPageWriter) AddLineAnnotation(start, end canvas.Point, borderWidth float64, strokeColor color.RGBA) {
+	// the bounding rectangle must enclose the line including its border
+	x0, x1 := math.Min(start.X, end.X), math.Max(start.X, end.X)
+	y0, y1 := math.Min(start.Y, end.Y), math.Max(start.Y, end.Y)
+	rect := canvas.Rect{X: x0 - borderWidth, Y: y0 - borderWidth, W: x1 - x0 + 2.0*borderWidth, H: y1 - y0 + 2.0*borderWidth}
+	startX, startY := w.pdfPoint(start)
+	endX, endY := w.pdfPoint(end)
+	w.AddAnnotation(pdfDict{
+		"Subtype": pdfName("Line"),
+		"Rect":    w.pdfRect(rect),
+		"L":       pdfArray{startX, startY, endX, endY},
+		"BS":      pdfDict{"W": borderWidth * w.unitsPerMm()},
+		"C":       pdfColor(strokeColor),
+	})
+}
+
+// pdfRect converts a rectangle in millimeters to a PDF rectangle in default user space units, which are points unless the page sets a user unit. The rectangle is the bounding box of the rectangle transformed as the page contents, i.e. by the base transform and relative to the lower-left corner of the media box.
+func (w *pdfPageWriter) pdfRect(rect canvas.Rect) pdfArray {
+	rect = rect.Transform(w.initialTransform())
+	return pdfArray{rect.X, rect.Y, rect.X + rect.W, rect.Y + rect.H}
+}
+
+// pdfPoint converts a point in millimeters to default user space units, see pdfRect.
+func (w *pdfPageWriter) pdfPoint(p canvas.Point) (float64, float64) {
+	p = w.initialTransform().Dot(p)
+	return p.X, p.Y
+}
+
+// pdfColor converts a premultiplied color to an RGB array with components between zero and one.
+func pdfColor(c color.RGBA) pdfArray {
+	if c.A == 0 {
+		return pdfArray{}
+	}
+	a := float64(c.A) / 255.0
+	return pdfArray{float64(c.R) / 255.0 / a, float64(c.G) / 255.0 / a, float64(c.B) / 255.0 / a}
+}
+
+func (w *pdfPageWriter) AddTextAnnotation(pos canvas.Point, contents string, col color.RGBA) {
+	size := 24.0 / ptPerMm // default icon size of 24pt
+	w.AddAnnotation(pdfDict{
+		"Subtype":  pdfName("Text"),
+		"Rect":     w.pdfRect(canvas.Rect{X: pos.X, Y: pos.Y, W: size, H: size}),
+		"Contents": pdfTextString(contents),
+		"Name":     pdfName("Note"),
+		"C":        pdfColor(col),
+	})
+}
+
+func (w *pdfPageWriter) AddHighlightAnnotation(contents string, col color.RGBA, rects ...canvas.Rect) {
+	if len(rects) == 0 {
+		return
+	}
+
+	bounds := rects[0]
+	quadPoints := pdfArray{}
+	for _, rect := range rects {
+		bounds = bounds.Add(rect)
+
+		// upper-left, upper-right, lower-left, lower-right as used by viewers
+		for _, p := range []canvas.Point{{X: rect.X, Y: rect.Y + rect.H}, {X: rect.X + rect.W, Y: rect.Y + rect.H}, {X: rect.X, Y: rect.Y}, {X: rect.X + rect.W, Y: rect.Y}} {
+			x, y := w.pdfPoint(p)
+			quadPoints = append(quadPoints, x, y)
+		}
+	}
+
+	annot := pdfDict{
+		"Subtype":    pdfName("Highlight"),
+		"Rect":       w.pdfRect(bounds),
+		"QuadPoints": quadPoints,
+		"C":          pdfColor(col),
+	}
+	if contents != "" {
+		annot["Contents"] = pdfTextString(contents)
+	}
+	w.AddAnnotation(annot)
+}
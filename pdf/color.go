@@ -0,0 +1,102 @@
+package pdf
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+// RegisterColor registers a named color that can be retrieved with NamedColor. If separation is true, the color is written as a Separation color space shared by all pages, and fills and strokes using exactly this color are drawn in that color space instead of DeviceRGB. This keeps brand colors consistent and recognizable throughout the document. It returns an error if a separation color is transparent or equal to the color of another separation.
+func (r *PDF) RegisterColor(name string, col color.RGBA, separation bool) error {
+	return r.w.pdf.RegisterColor(name, col, separation)
+}
+
+// NamedColor returns the color registered under the given name.
+func (r *PDF) NamedColor(name string) (color.RGBA, bool) {
+	if named, ok := r.w.pdf.colors[name]; ok {
+		return named.col, true
+	}
+	return color.RGBA{}, false
+}
+
+type pdfNamedColor struct {
+	name       string
+	col        color.RGBA
+	separation bool
+	ref        pdfRef // separation color space, written upon first use
+}
+
+func (w *pdfWriter) RegisterColor(name string, col color.RGBA, separation bool) error {
+	if separation {
+		if col.A == 0 {
+			return fmt.Errorf("separation color %v is transparent", name)
+		} else if other, ok := w.separations[col]; ok && other.name != name {
+			return fmt.Errorf("separation color %v is equal to %v", name, other.name)
+		}
+	}
+
+	if prev, ok := w.colors[name]; ok && prev.separation {
+		delete(w.separations, prev.col)
+	}
+	named := &pdfNamedColor{
+		name:       name,
+		col:        col,
+		separation: separation,
+	}
+	w.colors[name] = named
+	if separation {
+		w.separations[col] = named
+	}
+	return nil
+}
+
+// getSeparation returns the separation color space of a registered color that is equal to the given color.
+func (w *pdfWriter) getSeparation(col color.RGBA) (pdfRef, bool) {
+	named, ok := w.separations[col]
+	if !ok {
+		return 0, false
+	} else if named.ref == 0 {
+		a := float64(col.A) / 255.0
+		named.ref = w.writeObject(pdfArray{
+			pdfName("Separation"),
+			pdfName(escapeName(named.name)),
+			pdfName("DeviceRGB"),
+			pdfDict{
+				"FunctionType": 2,
+				"Domain":       pdfArray{0.0, 1.0},
+				"C0":           pdfArray{1.0, 1.0, 1.0},
+				"C1":           pdfArray{float64(col.R) / 255.0 / a, float64(col.G) / 255.0 / a, float64(col.B) / 255.0 / a},
+				"N":            1.0,
+			},
+		})
+	}
+	return named.ref, true
+}
+
+// getColorSpace returns the resource name of the color space on the page.
+func (w *pdfPageWriter) getColorSpace(ref pdfRef) pdfName {
+	if _, ok := w.resources["ColorSpace"]; !ok {
+		w.resources["ColorSpace"] = pdfDict{}
+	}
+	for name, csRef := range w.resources["ColorSpace"].(pdfDict) {
+		if ref == csRef {
+			return name
+		}
+	}
+	name := pdfName(fmt.Sprintf("CS%d", len(w.resources["ColorSpace"].(pdfDict))))
+	w.resources["ColorSpace"].(pdfDict)[name] = ref
+	return name
+}
+
+// escapeName escapes characters that are not allowed in PDF names.
+func escapeName(name string) string {
+	sb := strings.Builder{}
+	for _, c := range []byte(name) {
+		if c < '!' || '~' < c || strings.IndexByte("#()<>[]{}/%", c) != -1 {
+			fmt.Fprintf(&sb, "#%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,162 @@
+package pdf
+
+import (
+	"fmt"
+
+	"github.com/tdewolff/canvas"
+)
+
+// RawContent appends raw PDF content stream operators to the current page between drawing calls, for example for custom marked content or extensions. The content is wrapped in q/Q so that changes to the graphics state do not affect subsequent drawing. It returns an error if it is called inside a text object, or if the content does not have balanced q/Q, BT/ET, and BMC/BDC/EMC operators or has unterminated strings, arrays, or dictionaries. Resources referenced by the content are not added to the page, and the content is not drawn on thumbnails.
+func (r *PDF) RawContent(b []byte) error {
+	return r.w.RawContent(b)
+}
+
+// PathOperators returns the path construction operators of the path transformed by m, such as "0 0 m 1 0 l 1 1 l", for use in raw content. The closing h operator of the last subpath is removed and reported instead, so that closed paths can be painted with the closing stroke operators s and b as done by RenderPath. Append " h" to the operators when closed for other painting operators or for clipping paths, such as in "W n". Coordinates are in millimeters as for drawing on the page.
+func PathOperators(path *canvas.Path, m canvas.Matrix) (string, bool) {
+	data := path.Transform(m).ToPDF()
+	if 1 < len(data) && data[len(data)-1] == 'h' {
+		return data[:len(data)-2], true
+	}
+	return data, false
+}
+
+func (w *pdfPageWriter) RawContent(b []byte) error {
+	if w.inTextObject {
+		return fmt.Errorf("raw content not allowed in text object")
+	}
+	if err := validateContent(b); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, " q\n")
+	w.Write(b)
+	fmt.Fprintf(w, "\nQ")
+	return nil
+}
+
+// validateContent checks that the content stream is self-contained, i.e. that graphics states, text objects, and marked-content sequences are closed and properly nested, and that strings, arrays, dictionaries, and the data of inline images are terminated.
+func validateContent(b []byte) error {
+	var stack []string // open q, BT, and BMC/BDC operators
+	inText := false
+	arrays, dicts := 0, 0
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case isWhitespace(c):
+			i++
+		case c == '%':
+			for i < len(b) && b[i] != '\n' && b[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			// literal string with balanced parentheses and backslash escapes
+			depth := 0
+			for ; i < len(b); i++ {
+				if b[i] == '\\' {
+					i++
+				} else if b[i] == '(' {
+					depth++
+				} else if b[i] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if len(b) <= i {
+				return fmt.Errorf("unterminated string")
+			}
+			i++
+		case c == '<' && i+1 < len(b) && b[i+1] == '<':
+			dicts++
+			i += 2
+		case c == '>' && i+1 < len(b) && b[i+1] == '>':
+			if dicts == 0 {
+				return fmt.Errorf("unexpected >>")
+			}
+			dicts--
+			i += 2
+		case c == '<':
+			// hexadecimal string
+			for i < len(b) && b[i] != '>' {
+				i++
+			}
+			if len(b) <= i {
+				return fmt.Errorf("unterminated hexadecimal string")
+			}
+			i++
+		case c == '[':
+			arrays++
+			i++
+		case c == ']':
+			if arrays == 0 {
+				return fmt.Errorf("unexpected ]")
+			}
+			arrays--
+			i++
+		case c == '{' || c == '}' || c == ')' || c == '>':
+			return fmt.Errorf("unexpected %c", c)
+		default:
+			start := i
+			for i < len(b) && !isWhitespace(b[i]) && !isDelimiter(b[i]) {
+				i++
+			}
+			if i == start {
+				i++ // the slash of a name
+				continue
+			} else if 0 < start && b[start-1] == '/' {
+				continue // name
+			}
+
+			op := string(b[start:i])
+			switch op {
+			case "ID":
+				// binary data of an inline image, which ends at EI surrounded by whitespace
+				i++
+				for i < len(b) && !(b[i] == 'E' && i+1 < len(b) && b[i+1] == 'I' && isWhitespace(b[i-1]) && (i+2 == len(b) || isWhitespace(b[i+2]))) {
+					i++
+				}
+				if len(b) <= i {
+					return fmt.Errorf("unterminated inline image")
+				}
+				i += 2
+			case "q", "BT", "BMC", "BDC":
+				if op == "q" && inText {
+					return fmt.Errorf("q inside text object")
+				} else if op == "BT" {
+					if inText {
+						return fmt.Errorf("nested BT")
+					}
+					inText = true
+				}
+				stack = append(stack, op)
+			case "Q", "ET", "EMC":
+				open := map[string]string{"Q": "q", "ET": "BT", "EMC": "BMC"}[op]
+				if len(stack) == 0 {
+					return fmt.Errorf("unexpected %v", op)
+				} else if top := stack[len(stack)-1]; top != open && (op != "EMC" || top != "BDC") {
+					return fmt.Errorf("unexpected %v, expected closing of %v", op, top)
+				}
+				if op == "ET" {
+					inText = false
+				}
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if arrays != 0 {
+		return fmt.Errorf("unterminated array")
+	} else if dicts != 0 {
+		return fmt.Errorf("unterminated dictionary")
+	} else if len(stack) != 0 {
+		return fmt.Errorf("unclosed %v", stack[len(stack)-1])
+	}
+	return nil
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return c == '(' || c == ')' || c == '<' || c == '>' || c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%'
+}
@@ -0,0 +1,179 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+)
+
+// FieldFlag are flags that specify the behavior of form fields.
+type FieldFlag int
+
+// see FieldFlag
+const (
+	FieldReadOnly  FieldFlag = 1 << 0
+	FieldRequired  FieldFlag = 1 << 1
+	FieldMultiline FieldFlag = 1 << 12
+)
+
+// AddTextField adds a fillable text field to the current page and registers it in the document's interactive form. The field is placed at the given rectangle in millimeters, displays its value with the given font and font size in points, and must have a unique name.
+func (r *PDF) AddTextField(name string, rect canvas.Rect, value string, font *canvas.Font, size float64, flags FieldFlag) {
+	r.w.AddTextField(name, rect, value, font, size, flags)
+}
+
+func (w *pdfPageWriter) AddTextField(name string, rect canvas.Rect, value string, font *canvas.Font, size float64, flags FieldFlag) {
+	fontName := w.pdf.getFormFont(font)
+	da := fmt.Sprintf("/%v %v Tf 0 g", fontName, dec(size))
+
+	// appearance stream with the bounding box of the widget rectangle, with the text laid out in points and vertically centered for single line fields and starting at the top for multiline fields
+	bbox := rect.Transform(w.initialTransform())
+	height := bbox.H * w.userUnit
+	metrics := font.Metrics(size)
+	padding := 2.0
+	y := (height-metrics.Ascent-metrics.Descent)/2.0 + metrics.Descent
+	if flags&FieldMultiline != 0 {
+		y = height - padding - metrics.Ascent
+	}
+
+	appearance := &bytes.Buffer{}
+	fmt.Fprintf(appearance, "/Tx BMC q")
+	if w.userUnit != 1.0 {
+		fmt.Fprintf(appearance, " %v 0 0 %v 0 0 cm", dec(1.0/w.userUnit), dec(1.0/w.userUnit))
+	}
+	fmt.Fprintf(appearance, " BT %v", da)
+	for i, line := range strings.Split(value, "\n") {
+		if i == 0 {
+			fmt.Fprintf(appearance, " %v %v Td", dec(padding), dec(y))
+		} else if flags&FieldMultiline != 0 {
+			fmt.Fprintf(appearance, " 0 %v Td", dec(-metrics.LineHeight))
+		} else {
+			break
+		}
+		fmt.Fprintf(appearance, " (%s) Tj", w.pdf.glyphString(font, line))
+	}
+	fmt.Fprintf(appearance, " ET Q EMC")
+
+	ap := w.pdf.writeObject(w.pdf.flate(ContentStreams, pdfStream{
+		dict: pdfDict{
+			"Type":    pdfName("XObject"),
+			"Subtype": pdfName("Form"),
+			"BBox":    pdfArray{0.0, 0.0, bbox.W, bbox.H},
+			"Resources": pdfDict{
+				"Font": pdfDict{fontName: w.pdf.getFont(font)},
+			},
+		},
+		stream: appearance.Bytes(),
+	}))
+
+	// merged field and widget annotation
+	w.AddAnnotation(pdfDict{
+		"Subtype": pdfName("Widget"),
+		"FT":      pdfName("Tx"),
+		"T":       pdfTextString(name),
+		"V":       pdfTextString(value),
+		"DV":      pdfTextString(value),
+		"DA":      da,
+		"Ff":      int(flags),
+		"F":       4, // print
+		"Rect":    w.pdfRect(rect),
+		"AP":      pdfDict{"N": ap},
+	})
+}
+
+// AddSignatureField adds a signature field to the current page at the given rectangle in millimeters, which may be empty for an invisible signature. The field refers to a signature dictionary with a zero-filled /Contents of the given size in bytes and a /ByteRange covering the whole file except for /Contents, which is computed when closing the document. Signing the byte range and filling in /Contents is left to the caller. Only one signature field is supported per document, and an error is returned for a second signature field or a non-positive contents size.
+func (r *PDF) AddSignatureField(name string, rect canvas.Rect, contentsSize int) error {
+	return r.w.AddSignatureField(name, rect, contentsSize)
+}
+
+func (w *pdfPageWriter) AddSignatureField(name string, rect canvas.Rect, contentsSize int) error {
+	if w.pdf.signature != nil {
+		return fmt.Errorf("only one signature field supported")
+	} else if contentsSize <= 0 {
+		return fmt.Errorf("signature contents size must be positive")
+	}
+	w.pdf.requireVersion(1, 3, "signature fields")
+
+	// reserve the object number, the signature dictionary is written last when the file size is known
+	ref := w.pdf.reserveObject()
+	w.pdf.signature = &pdfSignature{
+		ref:  ref,
+		size: contentsSize,
+	}
+
+	w.AddAnnotation(pdfDict{
+		"Subtype": pdfName("Widget"),
+		"FT":      pdfName("Sig"),
+		"T":       pdfTextString(name),
+		"V":       ref,
+		"F":       4 | 128, // print, locked
+		"Rect":    w.pdfRect(rect),
+	})
+	return nil
+}
+
+type pdfSignature struct {
+	ref  pdfRef
+	size int // in bytes
+}
+
+// writeSignature writes the signature dictionary as the last object, so that the byte range can be calculated up to the end of the file. The byte range values are padded to a fixed width so that the length of the object does not depend on them.
+func (w *pdfWriter) writeSignature() {
+	sig := w.signature
+	headerFormat := "%v 0 obj\n<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached /ByteRange [0 %10d %10d %10d] /Contents "
+	header := fmt.Sprintf(headerFormat, sig.ref, 0, 0, 0)
+	footer := " >>\nendobj\n"
+
+	offset := w.pos
+	contentsStart := offset + len(header)
+	contentsEnd := contentsStart + 2*sig.size + 2
+	w.objOffsets[sig.ref-1] = offset
+
+	// calculate the file size by writing the cross-reference table and trailer to a discarding writer
+	tail := *w
+	tail.w = ioutil.Discard
+	tail.pos = contentsEnd + len(footer)
+	tail.writeXref()
+
+	w.write(headerFormat, sig.ref, contentsStart, contentsEnd, tail.pos-contentsEnd)
+	w.write("<%s>", strings.Repeat("0", 2*sig.size))
+	w.write(footer)
+	w.traceObject(sig.ref, pdfDict{"Type": pdfName("Sig")}, w.pos-offset)
+}
+
+// getFormFont returns the resource name of the font in the interactive form's default resources.
+func (w *pdfWriter) getFormFont(font *canvas.Font) pdfName {
+	ref := w.getFont(font)
+	for name, fontRef := range w.formFonts {
+		if ref == fontRef {
+			return name
+		}
+	}
+	// names of the original document's fonts are not reused for incremental updates
+	name := pdfName(fmt.Sprintf("F%d", len(w.formFonts)))
+	for i := len(w.formFonts) + 1; w.formFonts[name] != nil; i++ {
+		name = pdfName(fmt.Sprintf("F%d", i))
+	}
+	w.formFonts[name] = ref
+	return name
+}
+
+// glyphString returns the escaped string of CIDs of the text for a font with Identity-H encoding.
+func (w *pdfWriter) glyphString(font *canvas.Font, s string) string {
+	return pdfGlyphIDString(w.getCIDs(font, font.IndicesOf(s)))
+}
+
+// pdfGlyphIDString returns the escaped string of glyph IDs for a font with Identity-H encoding.
+func pdfGlyphIDString(glyphIDs []uint16) string {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, glyphIDs)
+
+	s := buf.String()
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "(", "\\(", -1)
+	s = strings.Replace(s, ")", "\\)", -1)
+	return s
+}
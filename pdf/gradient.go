@@ -0,0 +1,194 @@
+package pdf
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+
+	"github.com/tdewolff/canvas"
+)
+
+// GradientStop is a color at an offset between 0 and 1 along a gradient.
+type GradientStop struct {
+	Offset float64
+	Color  color.RGBA
+}
+
+// LinearGradient is a gradient along the line from Start to End, with colors interpolated between the stops and extended beyond both ends. The alpha of the stop colors is ignored.
+type LinearGradient struct {
+	Start, End canvas.Point
+	Stops      []GradientStop
+}
+
+// RenderPathGradientStroke renders a path like RenderPath, but strokes it with a linear gradient instead of the stroke color. The stroke is converted to its outline which is filled with the gradient, and the gradient coordinates are transformed by m as the path.
+func (r *PDF) RenderPathGradientStroke(path *canvas.Path, style canvas.Style, gradient LinearGradient, m canvas.Matrix) {
+	if len(gradient.Stops) == 0 {
+		panic("gradient must have at least one stop")
+	}
+
+	if style.FillColor.A != 0 {
+		fillStyle := style
+		fillStyle.StrokeColor = canvas.Transparent
+		r.RenderPath(path, fillStyle, m)
+	}
+	if style.StrokeWidth <= 0.0 {
+		return
+	}
+
+	if r.w.thumbnail != nil {
+		thumbnailStyle := style
+		thumbnailStyle.FillColor = canvas.Transparent
+		thumbnailStyle.StrokeColor = gradient.Stops[0].Color
+		r.w.thumbnail.RenderPath(path, thumbnailStyle, r.w.baseTransform.Mul(m))
+	}
+	if r.w.pdf.tagged && !r.w.inMarkedContent {
+		r.w.BeginArtifact()
+		defer r.w.EndMarkedContent()
+	}
+
+	if 0 < len(style.Dashes) {
+		path = path.Dash(style.DashOffset, style.Dashes...)
+	}
+	path = path.Stroke(style.StrokeWidth, style.StrokeCapper, style.StrokeJoiner)
+
+	r.w.SetAlpha(1.0)
+	name := r.w.getPattern(gradient, m)
+	fmt.Fprintf(r.w, " q /Pattern cs /%v scn %v f Q", name, path.Transform(m).ToPDF())
+}
+
+// RenderPathGradientFill renders a path like RenderPath, but fills it with a linear gradient instead of the fill color, while the stroke remains the solid stroke color. The gradient coordinates are transformed by m as the path.
+func (r *PDF) RenderPathGradientFill(path *canvas.Path, style canvas.Style, gradient LinearGradient, m canvas.Matrix) {
+	if len(gradient.Stops) == 0 {
+		panic("gradient must have at least one stop")
+	}
+
+	thumbnail := r.w.thumbnail
+	if thumbnail != nil {
+		thumbnailStyle := style
+		thumbnailStyle.FillColor = gradient.Stops[0].Color
+		thumbnail.RenderPath(path, thumbnailStyle, r.w.baseTransform.Mul(m))
+	}
+	if r.w.pdf.tagged && !r.w.inMarkedContent {
+		r.w.BeginArtifact()
+		defer r.w.EndMarkedContent()
+	}
+
+	stroke := style.StrokeColor.A != 0 && 0.0 < style.StrokeWidth
+	name := r.w.getPattern(gradient, m)
+	data, closed := PathOperators(path, m)
+	if stroke && style.StrokeColor.A == 255 && !isStrokeUnsupported(style) {
+		// fill and stroke at once, which requires the same opacity for both
+		r.w.SetStrokeColor(style.StrokeColor)
+		r.w.SetLineWidth(style.StrokeWidth)
+		r.w.SetLineCap(style.StrokeCapper)
+		r.w.SetLineJoin(style.StrokeJoiner)
+		r.w.SetDashes(style.DashOffset, style.Dashes)
+		fmt.Fprintf(r.w, " q /Pattern cs /%v scn %v ", name, data)
+		if closed {
+			r.w.Write([]byte("b"))
+		} else {
+			r.w.Write([]byte("B"))
+		}
+		if style.FillRule == canvas.EvenOdd {
+			r.w.Write([]byte("*"))
+		}
+		r.w.Write([]byte(" Q"))
+		return
+	}
+
+	if closed {
+		data += " h"
+	}
+	r.w.SetAlpha(1.0)
+	fmt.Fprintf(r.w, " q /Pattern cs /%v scn %v f", name, data)
+	if style.FillRule == canvas.EvenOdd {
+		r.w.Write([]byte("*"))
+	}
+	r.w.Write([]byte(" Q"))
+	if stroke {
+		// the stroke was already rendered on the thumbnail
+		strokeStyle := style
+		strokeStyle.FillColor = canvas.Transparent
+		r.w.thumbnail = nil
+		r.RenderPath(path, strokeStyle, m)
+		r.w.thumbnail = thumbnail
+	}
+}
+
+// getPattern returns the resource name on the page of a shading pattern for the gradient, where the gradient is transformed by m.
+func (w *pdfPageWriter) getPattern(gradient LinearGradient, m canvas.Matrix) pdfName {
+	// the pattern space is the default coordinate space of the page and not the current transformation
+	m = w.initialTransform().Mul(m)
+	w.pdf.requireVersion(1, 3, "shading patterns")
+	ref := w.pdf.writeObject(pdfDict{
+		"Type":        pdfName("Pattern"),
+		"PatternType": 2,
+		"Matrix":      pdfArray{m[0][0], m[1][0], m[0][1], m[1][1], m[0][2], m[1][2]},
+		"Shading": pdfDict{
+			"ShadingType": 2,
+			"ColorSpace":  pdfName("DeviceRGB"),
+			"Coords":      pdfArray{gradient.Start.X, gradient.Start.Y, gradient.End.X, gradient.End.Y},
+			"Function":    gradientFunction(gradient.Stops),
+			"Extend":      pdfArray{true, true},
+		},
+	})
+
+	if _, ok := w.resources["Pattern"]; !ok {
+		w.resources["Pattern"] = pdfDict{}
+	}
+	name := pdfName(fmt.Sprintf("P%d", len(w.resources["Pattern"].(pdfDict))))
+	w.resources["Pattern"].(pdfDict)[name] = ref
+	return name
+}
+
+// gradientFunction returns an exponential interpolation function between two stops, or a stitching function of those for more stops.
+func gradientFunction(stops []GradientStop) pdfDict {
+	stops = append([]GradientStop{}, stops...)
+	sort.SliceStable(stops, func(i, j int) bool {
+		return stops[i].Offset < stops[j].Offset
+	})
+	if 0.0 < stops[0].Offset {
+		stops = append([]GradientStop{{0.0, stops[0].Color}}, stops...)
+	}
+	if stops[len(stops)-1].Offset < 1.0 {
+		stops = append(stops, GradientStop{1.0, stops[len(stops)-1].Color})
+	}
+
+	functions := pdfArray{}
+	for i := 1; i < len(stops); i++ {
+		functions = append(functions, pdfDict{
+			"FunctionType": 2,
+			"Domain":       pdfArray{0.0, 1.0},
+			"C0":           opaqueColor(stops[i-1].Color),
+			"C1":           opaqueColor(stops[i].Color),
+			"N":            1.0,
+		})
+	}
+	if len(functions) == 1 {
+		return functions[0].(pdfDict)
+	}
+
+	bounds := pdfArray{}
+	encode := pdfArray{}
+	for i := 1; i < len(stops); i++ {
+		if i != len(stops)-1 {
+			bounds = append(bounds, stops[i].Offset)
+		}
+		encode = append(encode, 0.0, 1.0)
+	}
+	return pdfDict{
+		"FunctionType": 3,
+		"Domain":       pdfArray{0.0, 1.0},
+		"Functions":    functions,
+		"Bounds":       bounds,
+		"Encode":       encode,
+	}
+}
+
+// opaqueColor returns the un-premultiplied color components, or black for a transparent color.
+func opaqueColor(col color.RGBA) pdfArray {
+	if c := pdfColor(col); len(c) != 0 {
+		return c
+	}
+	return pdfArray{0.0, 0.0, 0.0}
+}
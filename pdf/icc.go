@@ -0,0 +1,152 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io/ioutil"
+	"sort"
+
+	"github.com/tdewolff/canvas"
+)
+
+// ICCImage is an image with an ICC profile that defines the color space of its pixels, which is embedded as an ICCBased color space of the image instead of DeviceRGB. Profiles of JPEG and PNG images loaded with canvas.NewJPEGImage and canvas.NewPNGImage are detected automatically, so that ICCImage is only needed for other images or to override the embedded profile.
+type ICCImage struct {
+	image.Image
+	Profile []byte
+}
+
+// imageICCProfile returns the ICC profile of the image, which is either given explicitly by ICCImage or embedded in the JPEG or PNG file. It returns nil if the image has no (valid) profile.
+func imageICCProfile(img image.Image) []byte {
+	var profile []byte
+	switch i := img.(type) {
+	case ICCImage:
+		profile = i.Profile
+	case *ICCImage:
+		profile = i.Profile
+	case canvas.Image:
+		if i.Mimetype == "image/jpeg" {
+			profile = jpegICCProfile(i.Bytes)
+		} else if i.Mimetype == "image/png" {
+			profile = pngICCProfile(i.Bytes)
+		}
+	}
+	if iccComponents(profile) == 0 {
+		return nil
+	}
+	return profile
+}
+
+// iccComponents returns the number of color components of the profile's data color space, or zero if it is not a gray, RGB, or CMYK profile.
+func iccComponents(profile []byte) int {
+	if len(profile) < 128 {
+		return 0
+	}
+	switch string(profile[16:20]) {
+	case "GRAY":
+		return 1
+	case "RGB ":
+		return 3
+	case "CMYK":
+		return 4
+	}
+	return 0
+}
+
+// jpegICCProfile returns the ICC profile stored in the APP2 segments of a JPEG file, where large profiles are split over several segments that are numbered from one.
+func jpegICCProfile(b []byte) []byte {
+	type chunk struct {
+		seq  byte
+		data []byte
+	}
+	chunks := []chunk{}
+	if len(b) < 2 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(b) && b[i] == 0xFF; {
+		marker := b[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break // start of scan or end of image
+		}
+		n := int(binary.BigEndian.Uint16(b[i+2:]))
+		if n < 2 || len(b) < i+2+n {
+			return nil
+		}
+		data := b[i+4 : i+2+n]
+		if marker == 0xE2 && 14 <= len(data) && string(data[:12]) == "ICC_PROFILE\x00" {
+			chunks = append(chunks, chunk{data[12], data[14:]})
+		}
+		i += 2 + n
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+	profile := []byte{}
+	for i, chunk := range chunks {
+		if int(chunk.seq) != i+1 {
+			return nil // missing or duplicate chunk
+		}
+		profile = append(profile, chunk.data...)
+	}
+	return profile
+}
+
+// pngICCProfile returns the ICC profile stored in the zlib-compressed iCCP chunk of a PNG file, which must precede the image data.
+func pngICCProfile(b []byte) []byte {
+	if len(b) < 8 || string(b[:8]) != "\x89PNG\r\n\x1a\n" {
+		return nil
+	}
+	for i := 8; i+8 <= len(b); {
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		typ := string(b[i+4 : i+8])
+		if typ == "IDAT" || n < 0 || len(b) < i+12+n {
+			break
+		}
+		if typ == "iCCP" {
+			data := b[i+8 : i+8+n]
+			name := bytes.IndexByte(data, 0) // profile name is followed by a null byte and the compression method
+			if name < 0 || len(data) < name+2 || data[name+1] != 0 {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(data[name+2:]))
+			if err != nil {
+				return nil
+			}
+			profile, err := ioutil.ReadAll(r)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		i += 12 + n
+	}
+	return nil
+}
+
+// getICCProfile returns the ICCBased color space of the profile, which is written once for all images that use the same profile.
+func (w *pdfWriter) getICCProfile(profile []byte) pdfArray {
+	ref, ok := w.iccProfiles[string(profile)]
+	if !ok {
+		n := iccComponents(profile)
+		alternate := pdfName("DeviceRGB")
+		if n == 1 {
+			alternate = pdfName("DeviceGray")
+		} else if n == 4 {
+			alternate = pdfName("DeviceCMYK")
+		}
+
+		w.requireVersion(1, 3, "ICC profiles")
+		ref = w.writeObject(w.flate(ImageStreams, pdfStream{
+			dict: pdfDict{
+				"N":         n,
+				"Alternate": alternate,
+			},
+			stream: profile,
+		}))
+		w.iccProfiles[string(profile)] = ref
+	}
+	return pdfArray{pdfName("ICCBased"), ref}
+}
@@ -0,0 +1,468 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/tdewolff/canvas"
+)
+
+// NewIncremental creates a portable document format renderer that appends pages to an existing document as an incremental update, which leaves the original bytes unchanged as required for example for documents that have been signed. The original document is written to w first, and upon closing the new pages with their annotations and form fields are appended together with updated versions of the page tree, the document catalog, and the document information, and a cross-reference section that refers to the previous one. Existing pages are not modified. Only documents with cross-reference tables are supported, not those with cross-reference streams, and encrypted documents and tagged output are not supported.
+func NewIncremental(w io.Writer, original []byte, width, height float64) (*PDF, error) {
+	pdf, err := newIncrementalPDFWriter(w, original)
+	if err != nil {
+		return nil, err
+	}
+	return &PDF{
+		w:      pdf.NewPage(width, height),
+		width:  width,
+		height: height,
+		imgEnc: canvas.Lossless,
+	}, nil
+}
+
+// pdfOriginal holds the objects of the original document of an incremental update that are updated when closing.
+type pdfOriginal struct {
+	xrefOffset int         // offset of the last cross-reference section
+	id         interface{} // file identifier of the trailer
+	catalog    pdfDict
+	info       pdfDict
+	pages      pdfDict // root of the page tree
+	acroForm   pdfDict
+}
+
+func newIncrementalPDFWriter(writer io.Writer, b []byte) (*pdfWriter, error) {
+	r, trailer, err := newPDFReader(b)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := trailer["Encrypt"]; ok {
+		return nil, fmt.Errorf("encrypted documents are not supported")
+	}
+
+	original := &pdfOriginal{
+		xrefOffset: r.xrefOffset,
+		id:         trailer["ID"],
+		info:       pdfDict{},
+	}
+	size, _ := trailer["Size"].(int)
+	catalogRef, ok := trailer["Root"].(pdfRef)
+	if !ok || size <= int(catalogRef) {
+		return nil, fmt.Errorf("invalid document catalog")
+	}
+	if original.catalog, err = r.getDict(catalogRef); err != nil {
+		return nil, err
+	}
+	pagesRef, ok := original.catalog["Pages"].(pdfRef)
+	if !ok {
+		return nil, fmt.Errorf("invalid page tree")
+	}
+	if original.pages, err = r.getDict(pagesRef); err != nil {
+		return nil, err
+	}
+	if kids, err := r.resolve(original.pages["Kids"]); err != nil {
+		return nil, err
+	} else if original.pages["Kids"], ok = kids.(pdfArray); !ok {
+		return nil, fmt.Errorf("invalid page tree")
+	}
+	infoRef, hasInfo := trailer["Info"].(pdfRef)
+	if hasInfo {
+		if original.info, err = r.getDict(infoRef); err != nil {
+			return nil, err
+		}
+	}
+
+	w := newPDFWriter(writer)
+	w.original = original
+	w.catalogRef = catalogRef
+	w.pagesRef = pagesRef
+	w.objOffsets = make([]int, size-1)
+	for i := range w.objOffsets {
+		w.objOffsets[i] = -1 // not part of the update
+	}
+	if hasInfo {
+		w.infoRef = infoRef
+	} else {
+		w.infoRef = w.reserveObject()
+	}
+
+	// existing form fields and their default resources are kept
+	if acroForm, ok := original.catalog["AcroForm"]; ok {
+		if original.acroForm, err = r.resolveDict(acroForm); err != nil {
+			return nil, err
+		}
+		if fields, err := r.resolve(original.acroForm["Fields"]); err != nil {
+			return nil, err
+		} else if fields, ok := fields.(pdfArray); ok {
+			w.fields = append(w.fields, fields...)
+		}
+		if dr, err := r.resolveDict(original.acroForm["DR"]); err != nil {
+			return nil, err
+		} else if fonts, err := r.resolveDict(dr["Font"]); err != nil {
+			return nil, err
+		} else {
+			for name, font := range fonts {
+				w.formFonts[name] = font
+			}
+		}
+	}
+
+	// the version of the update is that of the original document
+	if i := bytes.Index(b, []byte("%PDF-")); i != -1 && i+8 <= len(b) && b[i+6] == '.' {
+		w.version = 10*int(b[i+5]-'0') + int(b[i+7]-'0')
+	}
+	if version, ok := original.catalog["Version"].(pdfName); ok && len(version) == 3 && version[1] == '.' {
+		if v := 10*int(version[0]-'0') + int(version[2]-'0'); w.version < v {
+			w.version = v
+		}
+	}
+
+	w.headerWritten = true
+	w.writeBytes(b)
+	if 0 < len(b) && b[len(b)-1] != '\n' && b[len(b)-1] != '\r' {
+		w.write("\n")
+	}
+	return w, w.err
+}
+
+////////////////////////////////////////////////////////////////
+
+// pdfReader reads objects from an existing document using its cross-reference tables.
+type pdfReader struct {
+	b          []byte
+	offsets    map[pdfRef]int
+	xrefOffset int // offset of the last cross-reference section
+}
+
+// newPDFReader reads the cross-reference sections of a document, starting with the last one and following the Prev entries of the trailers, and returns the trailer of the last section.
+func newPDFReader(b []byte) (*pdfReader, pdfDict, error) {
+	i := bytes.LastIndex(b, []byte("startxref"))
+	if i == -1 {
+		return nil, nil, fmt.Errorf("startxref not found")
+	}
+	p := &pdfParser{b: b, pos: i + len("startxref")}
+	xrefOffset, ok := p.parseValue().(int)
+	if !ok || p.err != nil {
+		return nil, nil, fmt.Errorf("invalid startxref")
+	}
+
+	r := &pdfReader{
+		b:          b,
+		offsets:    map[pdfRef]int{},
+		xrefOffset: xrefOffset,
+	}
+	var trailer pdfDict
+	seen := map[int]bool{}
+	for offset := xrefOffset; ; {
+		if seen[offset] {
+			return nil, nil, fmt.Errorf("cross-reference sections form a cycle")
+		}
+		seen[offset] = true
+
+		dict, err := r.readXref(offset)
+		if err != nil {
+			return nil, nil, err
+		} else if trailer == nil {
+			trailer = dict
+		}
+		if offset, ok = dict["Prev"].(int); !ok {
+			break
+		}
+	}
+	return r, trailer, nil
+}
+
+// readXref reads a cross-reference section and returns its trailer. Objects that are already known from a later section are skipped.
+func (r *pdfReader) readXref(offset int) (pdfDict, error) {
+	if offset < 0 || len(r.b) <= offset || !bytes.HasPrefix(r.b[offset:], []byte("xref")) {
+		return nil, fmt.Errorf("cross-reference table not found, cross-reference streams are not supported")
+	}
+	p := &pdfParser{b: r.b, pos: offset + len("xref")}
+	for {
+		p.skipWhitespace()
+		if bytes.HasPrefix(r.b[p.pos:], []byte("trailer")) {
+			p.pos += len("trailer")
+			break
+		}
+		start, ok1 := p.parseValue().(int)
+		n, ok2 := p.parseValue().(int)
+		if !ok1 || !ok2 || p.err != nil || start < 0 || n < 0 {
+			return nil, fmt.Errorf("invalid cross-reference table")
+		}
+		for i := 0; i < n; i++ {
+			p.skipWhitespace()
+			if len(r.b) < p.pos+18 {
+				return nil, fmt.Errorf("invalid cross-reference table")
+			}
+			entry := r.b[p.pos : p.pos+18]
+			p.pos += 18
+			objOffset, err := strconv.Atoi(string(entry[:10]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid cross-reference table")
+			}
+			ref := pdfRef(start + i)
+			if _, ok := r.offsets[ref]; !ok {
+				if entry[17] == 'n' {
+					r.offsets[ref] = objOffset
+				} else {
+					r.offsets[ref] = -1 // free
+				}
+			}
+		}
+	}
+	trailer, ok := p.parseValue().(pdfDict)
+	if !ok || p.err != nil {
+		return nil, fmt.Errorf("invalid trailer")
+	}
+	return trailer, nil
+}
+
+// getObject returns the object, where streams are returned as their stream dictionary.
+func (r *pdfReader) getObject(ref pdfRef) (interface{}, error) {
+	offset, ok := r.offsets[ref]
+	if !ok || offset < 0 || len(r.b) <= offset {
+		return nil, fmt.Errorf("object %v not found", ref)
+	}
+	p := &pdfParser{b: r.b, pos: offset}
+	num, ok1 := p.parseValue().(int)
+	_, ok2 := p.parseValue().(int)
+	p.skipWhitespace()
+	if !ok1 || !ok2 || num != int(ref) || !bytes.HasPrefix(r.b[p.pos:], []byte("obj")) {
+		return nil, fmt.Errorf("object %v not found", ref)
+	}
+	p.pos += len("obj")
+	val := p.parseValue()
+	if p.err != nil {
+		return nil, fmt.Errorf("object %v: %v", ref, p.err)
+	}
+	return val, nil
+}
+
+func (r *pdfReader) getDict(ref pdfRef) (pdfDict, error) {
+	val, err := r.getObject(ref)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := val.(pdfDict)
+	if !ok {
+		return nil, fmt.Errorf("object %v: expected dictionary", ref)
+	}
+	return dict, nil
+}
+
+// resolve returns the object of a reference or else the value itself.
+func (r *pdfReader) resolve(val interface{}) (interface{}, error) {
+	if ref, ok := val.(pdfRef); ok {
+		return r.getObject(ref)
+	}
+	return val, nil
+}
+
+// resolveDict returns the dictionary of a reference or value, which is empty for a missing value.
+func (r *pdfReader) resolveDict(val interface{}) (pdfDict, error) {
+	if val == nil {
+		return pdfDict{}, nil
+	} else if ref, ok := val.(pdfRef); ok {
+		return r.getDict(ref)
+	} else if dict, ok := val.(pdfDict); ok {
+		return dict, nil
+	}
+	return nil, fmt.Errorf("expected dictionary")
+}
+
+////////////////////////////////////////////////////////////////
+
+// pdfParser parses PDF values into the types used for writing. Names are kept as written, literal and hexadecimal strings are decoded, and null is returned as nil.
+type pdfParser struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (p *pdfParser) skipWhitespace() {
+	for p.pos < len(p.b) {
+		if c := p.b[p.pos]; c == '%' {
+			for p.pos < len(p.b) && p.b[p.pos] != '\n' && p.b[p.pos] != '\r' {
+				p.pos++
+			}
+		} else if isWhitespace(c) {
+			p.pos++
+		} else {
+			break
+		}
+	}
+}
+
+func (p *pdfParser) parseValue() interface{} {
+	p.skipWhitespace()
+	if p.err != nil {
+		return nil
+	} else if len(p.b) <= p.pos {
+		p.err = fmt.Errorf("unexpected end of file")
+		return nil
+	}
+
+	c := p.b[p.pos]
+	switch {
+	case c == '/':
+		p.pos++
+		return pdfName(p.parseToken())
+	case c == '<' && p.pos+1 < len(p.b) && p.b[p.pos+1] == '<':
+		p.pos += 2
+		dict := pdfDict{}
+		for {
+			p.skipWhitespace()
+			if p.err != nil {
+				return nil
+			} else if bytes.HasPrefix(p.b[p.pos:], []byte(">>")) {
+				p.pos += 2
+				return dict
+			}
+			key, ok := p.parseValue().(pdfName)
+			if !ok {
+				p.err = fmt.Errorf("invalid dictionary key")
+				return nil
+			}
+			if val := p.parseValue(); val != nil {
+				dict[key] = val
+			}
+		}
+	case c == '<':
+		end := bytes.IndexByte(p.b[p.pos:], '>')
+		if end == -1 {
+			p.err = fmt.Errorf("unterminated hexadecimal string")
+			return nil
+		}
+		s := bytes.Map(func(r rune) rune {
+			if r < 128 && isWhitespace(byte(r)) {
+				return -1
+			}
+			return r
+		}, p.b[p.pos+1:p.pos+end])
+		p.pos += end + 1
+		if len(s)%2 == 1 {
+			s = append(s, '0')
+		}
+		b := make([]byte, len(s)/2)
+		if _, err := hex.Decode(b, s); err != nil {
+			p.err = fmt.Errorf("invalid hexadecimal string")
+			return nil
+		}
+		return string(b)
+	case c == '(':
+		return p.parseString()
+	case c == '[':
+		p.pos++
+		array := pdfArray{}
+		for {
+			p.skipWhitespace()
+			if p.err != nil {
+				return nil
+			} else if p.pos < len(p.b) && p.b[p.pos] == ']' {
+				p.pos++
+				return array
+			}
+			array = append(array, p.parseValue())
+		}
+	case c == '+' || c == '-' || c == '.' || '0' <= c && c <= '9':
+		token := p.parseToken()
+		if i, err := strconv.Atoi(token); err == nil {
+			// an object reference consists of the object number, generation number, and R
+			pos := p.pos
+			p.skipWhitespace()
+			if gen := p.parseToken(); gen != "" && '0' <= gen[0] && gen[0] <= '9' {
+				p.skipWhitespace()
+				if p.parseToken() == "R" {
+					if gen != "0" {
+						p.err = fmt.Errorf("object generations are not supported")
+						return nil
+					}
+					return pdfRef(i)
+				}
+			}
+			p.pos = pos
+			return i
+		} else if f, err := strconv.ParseFloat(token, 64); err == nil {
+			return f
+		}
+		p.err = fmt.Errorf("invalid number %v", token)
+		return nil
+	}
+
+	token := p.parseToken()
+	switch token {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	p.err = fmt.Errorf("unexpected %q", token)
+	return nil
+}
+
+// parseToken returns the regular characters up to the next whitespace or delimiter.
+func (p *pdfParser) parseToken() string {
+	start := p.pos
+	for p.pos < len(p.b) && !isWhitespace(p.b[p.pos]) && !isDelimiter(p.b[p.pos]) {
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
+
+// parseString parses a literal string with balanced parentheses and backslash escapes.
+func (p *pdfParser) parseString() interface{} {
+	s := []byte{}
+	depth := 0
+	for p.pos++; p.pos < len(p.b); p.pos++ {
+		c := p.b[p.pos]
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth == 0 {
+				p.pos++
+				return string(s)
+			}
+			depth--
+		} else if c == '\\' && p.pos+1 < len(p.b) {
+			p.pos++
+			c = p.b[p.pos]
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos+1 < len(p.b) && p.b[p.pos+1] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if '0' <= c && c <= '7' {
+					n := 0
+					for i := 0; i < 3 && p.pos < len(p.b) && '0' <= p.b[p.pos] && p.b[p.pos] <= '7'; i++ {
+						n = 8*n + int(p.b[p.pos]-'0')
+						p.pos++
+					}
+					p.pos--
+					c = byte(n)
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	p.err = fmt.Errorf("unterminated string")
+	return nil
+}
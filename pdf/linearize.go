@@ -0,0 +1,423 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// writeLinearized writes the objects kept in memory as a linearized document, see PDF 32000-1:2008 Annex F. The document consists of the linearization parameter dictionary, the cross-reference table and trailer of the first page, the document catalog, the primary hint stream, and the objects of the first page. These are followed by the objects of the other pages, the objects shared between those pages, the remaining objects such as the page tree and the document information, and finally the main cross-reference table. The objects of the first page are numbered after all other objects so that each cross-reference table has a single subsection.
+func (w *pdfWriter) writeLinearized(kids pdfArray) {
+	pages := make([]pdfRef, len(kids))
+	excluded := map[pdfRef]bool{w.catalogRef: true, w.infoRef: true, w.pagesRef: true} // catalog, document information, page tree
+	for i, kid := range kids {
+		pages[i] = kid.(pdfRef)
+		excluded[pages[i]] = true
+	}
+
+	// collect the objects needed by each page, the first page keeps all its objects
+	sections := make([][]pdfRef, len(pages))
+	for i, page := range pages {
+		sections[i] = w.pageObjects(page, excluded)
+	}
+	first := map[pdfRef]bool{}
+	for _, ref := range sections[0] {
+		first[ref] = true
+	}
+	users := map[pdfRef]int{}
+	for _, section := range sections[1:] {
+		for _, ref := range section {
+			if !first[ref] {
+				users[ref]++
+			}
+		}
+	}
+
+	// objects used by more than one page are moved to the shared objects section
+	shared := []pdfRef{}
+	sharedRefs := make([][]pdfRef, len(pages))
+	for i := 1; i < len(sections); i++ {
+		private := []pdfRef{}
+		for _, ref := range sections[i] {
+			if first[ref] {
+				sharedRefs[i] = append(sharedRefs[i], ref)
+			} else if users[ref] == 1 {
+				private = append(private, ref)
+			} else {
+				if users[ref] != -1 {
+					shared = append(shared, ref)
+					users[ref] = -1 // mark as added
+				}
+				sharedRefs[i] = append(sharedRefs[i], ref)
+			}
+		}
+		sections[i] = private
+	}
+
+	// renumber the objects in the order they are written, starting after the first page section
+	order := []pdfRef{}
+	for _, section := range sections[1:] {
+		order = append(order, section...)
+	}
+	order = append(order, shared...)
+	written := map[pdfRef]bool{1: true}
+	for _, ref := range order {
+		written[ref] = true
+	}
+	for _, ref := range sections[0] {
+		written[ref] = true
+	}
+	other := []pdfRef{}
+	for ref := range w.objects {
+		if !written[ref] {
+			other = append(other, ref)
+		}
+	}
+	sort.Slice(other, func(i, j int) bool { return other[i] < other[j] })
+	order = append(order, other...)
+
+	numbers := map[pdfRef]pdfRef{}
+	for i, ref := range order {
+		numbers[ref] = pdfRef(i + 1)
+	}
+	numMain := len(order)
+	linRef := pdfRef(numMain + 1)
+	numbers[1] = pdfRef(numMain + 2)
+	hintRef := pdfRef(numMain + 3)
+	for i, ref := range sections[0] {
+		numbers[ref] = pdfRef(numMain + 4 + i)
+	}
+	size := numMain + 4 + len(sections[0])
+
+	objs := map[pdfRef][]byte{}
+	for ref, val := range w.objects {
+		objs[ref] = w.serializeObject(numbers[ref], renumberRefs(val, numbers))
+	}
+
+	// the lengths of the linearization parameter dictionary and the first page's cross-reference table are fixed as the numbers are padded
+	linFormat := "%v 0 obj\n<< /Linearized 1 /L %10d /H [%10d %10d] /O %v /E %10d /N %d /T %10d >>\nendobj\n"
+	xrefFormat := "xref\n%v %d\n"
+	trailerFormat := "trailer\n<< /Info %v 0 R /Prev %10d /Root %v 0 R /Size %d >>\nstartxref\n0\n%%%%EOF\n"
+	if !w.headerWritten {
+		w.writeHeader()
+	}
+	linOffset := w.pos
+	xrefOffset := linOffset + len(fmt.Sprintf(linFormat, linRef, 0, 0, 0, numbers[pages[0]], 0, len(pages), 0))
+	xrefLen := len(fmt.Sprintf(xrefFormat, linRef, size-int(linRef))) + 20*(size-int(linRef))
+	xrefLen += len(fmt.Sprintf(trailerFormat, numbers[2], 0, numbers[1], size))
+	catalogOffset := xrefOffset + xrefLen
+	hintOffset := catalogOffset + len(objs[1])
+
+	// offsets as if the hint stream were not present, as required for the hint tables
+	offsets := map[pdfRef]int{}
+	pos := hintOffset
+	for _, ref := range sections[0] {
+		offsets[ref] = pos
+		pos += len(objs[ref])
+	}
+	endFirstPage := pos
+	for _, ref := range order {
+		offsets[ref] = pos
+		pos += len(objs[ref])
+	}
+	mainXrefOffset := pos
+
+	hint := w.hintStream(pages, sections, shared, sharedRefs, objs, offsets, numbers)
+	hintObj := w.serializeObject(hintRef, hint)
+	hintLen := len(hintObj)
+	for ref := range offsets {
+		offsets[ref] += hintLen
+	}
+	offsets[1] = catalogOffset
+	endFirstPage += hintLen
+	mainXrefOffset += hintLen
+	mainXref := fmt.Sprintf("xref\n0 %d", numMain+1)
+	mainXrefLen := len(mainXref) + 1 + 20*(numMain+1)
+	mainXrefLen += len(fmt.Sprintf("trailer\n<< /Size %d >>\nstartxref\n%d\n%%%%EOF", numMain+1, xrefOffset))
+	fileLen := mainXrefOffset + mainXrefLen
+
+	// linearization parameter dictionary and the first page's cross-reference table and trailer
+	w.write(linFormat, linRef, fileLen, hintOffset, hintLen, numbers[pages[0]], endFirstPage, len(pages), mainXrefOffset+len(mainXref))
+	w.traceObject(linRef, nil, xrefOffset-linOffset)
+	w.write(xrefFormat, linRef, size-int(linRef))
+	w.write("%010d 00000 n \n", linOffset)
+	w.write("%010d 00000 n \n", catalogOffset)
+	w.write("%010d 00000 n \n", hintOffset)
+	for _, ref := range sections[0] {
+		w.write("%010d 00000 n \n", offsets[ref])
+	}
+	w.write(trailerFormat, numbers[2], mainXrefOffset, numbers[1], size)
+
+	// objects of the first page followed by all other objects
+	w.writeBytes(objs[1])
+	w.traceObject(numbers[1], w.objects[1], len(objs[1]))
+	w.writeBytes(hintObj)
+	w.traceObject(hintRef, hint, hintLen)
+	for _, ref := range append(append([]pdfRef{}, sections[0]...), order...) {
+		w.writeBytes(objs[ref])
+		w.traceObject(numbers[ref], w.objects[ref], len(objs[ref]))
+	}
+
+	// main cross-reference table, startxref refers to the first page's cross-reference table
+	w.write("%s\n0000000000 65535 f \n", mainXref)
+	for _, ref := range order {
+		w.write("%010d 00000 n \n", offsets[ref])
+	}
+	w.write("trailer\n<< /Size %d >>\nstartxref\n%d\n%%%%EOF", numMain+1, xrefOffset)
+}
+
+// pageObjects returns the page object followed by all objects it refers to directly or indirectly, excluding the document-level objects and other pages.
+func (w *pdfWriter) pageObjects(page pdfRef, excluded map[pdfRef]bool) []pdfRef {
+	refs := []pdfRef{page}
+	seen := map[pdfRef]bool{page: true}
+	for i := 0; i < len(refs); i++ {
+		for _, ref := range pdfRefs(w.objects[refs[i]], nil) {
+			if _, ok := w.objects[ref]; ok && !seen[ref] && !excluded[ref] {
+				refs = append(refs, ref)
+				seen[ref] = true
+			}
+		}
+	}
+	return refs
+}
+
+// pdfRefs appends the object references in a value, in the order they are written.
+func pdfRefs(val interface{}, refs []pdfRef) []pdfRef {
+	switch v := val.(type) {
+	case pdfRef:
+		refs = append(refs, v)
+	case pdfArray:
+		for _, item := range v {
+			refs = pdfRefs(item, refs)
+		}
+	case pdfDict:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			refs = pdfRefs(v[pdfName(key)], refs)
+		}
+	case pdfStream:
+		refs = pdfRefs(v.dict, refs)
+	}
+	return refs
+}
+
+// renumberRefs returns a copy of a value with its object references renumbered.
+func renumberRefs(val interface{}, numbers map[pdfRef]pdfRef) interface{} {
+	switch v := val.(type) {
+	case pdfRef:
+		return numbers[v]
+	case pdfArray:
+		array := make(pdfArray, len(v))
+		for i, item := range v {
+			array[i] = renumberRefs(item, numbers)
+		}
+		return array
+	case pdfDict:
+		dict := make(pdfDict, len(v))
+		for key, item := range v {
+			dict[key] = renumberRefs(item, numbers)
+		}
+		return dict
+	case pdfStream:
+		return pdfStream{
+			dict:   renumberRefs(v.dict, numbers).(pdfDict),
+			stream: v.stream,
+		}
+	}
+	return val
+}
+
+// serializeObject returns the written object.
+func (w *pdfWriter) serializeObject(ref pdfRef, val interface{}) []byte {
+	buf := &bytes.Buffer{}
+	obj := &pdfWriter{
+		w:             buf,
+		headerWritten: true,
+	}
+	obj.write("%v 0 obj\n", ref)
+	obj.writeVal(val)
+	obj.write("\nendobj\n")
+	w.streamBytes += obj.streamBytes
+	return buf.Bytes()
+}
+
+// hintStream returns the primary hint stream with the page offset hint table and the shared object hint table, see PDF 32000-1:2008 section F.4. Every object in the first page section and in the shared objects section forms a shared object group of its own.
+func (w *pdfWriter) hintStream(pages []pdfRef, sections [][]pdfRef, shared []pdfRef, sharedRefs [][]pdfRef, objs map[pdfRef][]byte, offsets map[pdfRef]int, numbers map[pdfRef]pdfRef) pdfStream {
+	// shared object identifiers are indices into the groups of the first page followed by those of the shared objects section
+	groups := append(append([]pdfRef{}, sections[0]...), shared...)
+	groupIDs := map[pdfRef]int{}
+	for i, ref := range groups {
+		groupIDs[ref] = i
+	}
+
+	nobjs := make([]int, len(pages))
+	lengths := make([]int, len(pages))
+	contentOffsets := make([]int, len(pages))
+	contentLengths := make([]int, len(pages))
+	nshared := make([]int, len(pages))
+	maxSharedID := 0
+	for i, section := range sections {
+		nobjs[i] = len(section)
+		for _, ref := range section {
+			lengths[i] += len(objs[ref])
+		}
+		if page, ok := w.objects[pages[i]].(pdfDict); ok {
+			if contents, ok := page["Contents"].(pdfRef); ok {
+				if _, ok := offsets[contents]; ok {
+					contentOffsets[i] = offsets[contents] - offsets[pages[i]]
+					contentLengths[i] = len(objs[contents])
+				}
+			}
+		}
+		nshared[i] = len(sharedRefs[i])
+		for _, ref := range sharedRefs[i] {
+			if maxSharedID < groupIDs[ref] {
+				maxSharedID = groupIDs[ref]
+			}
+		}
+	}
+
+	// page offset hint table
+	bw := &pdfBitWriter{}
+	minObjs, maxObjs := minMaxInts(nobjs)
+	minLength, maxLength := minMaxInts(lengths)
+	minContentOffset, maxContentOffset := minMaxInts(contentOffsets)
+	minContentLength, maxContentLength := minMaxInts(contentLengths)
+	_, maxShared := minMaxInts(nshared)
+	bitsObjs := bitsNeeded(maxObjs - minObjs)
+	bitsLength := bitsNeeded(maxLength - minLength)
+	bitsContentOffset := bitsNeeded(maxContentOffset - minContentOffset)
+	bitsContentLength := bitsNeeded(maxContentLength - minContentLength)
+	bitsShared := bitsNeeded(maxShared)
+	bitsSharedID := bitsNeeded(maxSharedID)
+	bw.Write(minObjs, 32)
+	bw.Write(offsets[pages[0]], 32)
+	bw.Write(bitsObjs, 16)
+	bw.Write(minLength, 32)
+	bw.Write(bitsLength, 16)
+	bw.Write(minContentOffset, 32)
+	bw.Write(bitsContentOffset, 16)
+	bw.Write(minContentLength, 32)
+	bw.Write(bitsContentLength, 16)
+	bw.Write(bitsShared, 16)
+	bw.Write(bitsSharedID, 16)
+	bw.Write(0, 16) // bits for the numerator of the fractional position of shared objects
+	bw.Write(1, 16) // denominator of the fractional position of shared objects
+	for i := range pages {
+		bw.Write(nobjs[i]-minObjs, bitsObjs)
+	}
+	bw.Flush()
+	for i := range pages {
+		bw.Write(lengths[i]-minLength, bitsLength)
+	}
+	bw.Flush()
+	for i := range pages {
+		bw.Write(nshared[i], bitsShared)
+	}
+	bw.Flush()
+	for i := range pages {
+		for _, ref := range sharedRefs[i] {
+			bw.Write(groupIDs[ref], bitsSharedID)
+		}
+	}
+	bw.Flush()
+	for i := range pages {
+		bw.Write(contentOffsets[i]-minContentOffset, bitsContentOffset)
+	}
+	bw.Flush()
+	for i := range pages {
+		bw.Write(contentLengths[i]-minContentLength, bitsContentLength)
+	}
+	bw.Flush()
+	sharedOffset := len(bw.b)
+
+	// shared object hint table
+	groupLengths := make([]int, len(groups))
+	for i, ref := range groups {
+		groupLengths[i] = len(objs[ref])
+	}
+	minGroupLength, maxGroupLength := minMaxInts(groupLengths)
+	bitsGroupLength := bitsNeeded(maxGroupLength - minGroupLength)
+	if 0 < len(shared) {
+		bw.Write(int(numbers[shared[0]]), 32)
+		bw.Write(offsets[shared[0]], 32)
+	} else {
+		bw.Write(0, 32)
+		bw.Write(0, 32)
+	}
+	bw.Write(len(sections[0]), 32)
+	bw.Write(len(groups), 32)
+	bw.Write(0, 16) // bits for the number of objects in a group, which is always one
+	bw.Write(minGroupLength, 32)
+	bw.Write(bitsGroupLength, 16)
+	for _, length := range groupLengths {
+		bw.Write(length-minGroupLength, bitsGroupLength)
+	}
+	bw.Flush()
+	for range groups {
+		bw.Write(0, 1) // no MD5 signature
+	}
+	bw.Flush()
+
+	return pdfStream{
+		dict: pdfDict{
+			"S": sharedOffset,
+		},
+		stream: bw.b,
+	}
+}
+
+// pdfBitWriter writes integers of a given number of bits, most significant bit first, as used by the hint tables.
+type pdfBitWriter struct {
+	b    []byte
+	cur  byte
+	bits int
+}
+
+func (w *pdfBitWriter) Write(v, bits int) {
+	for i := bits - 1; 0 <= i; i-- {
+		w.cur = w.cur<<1 | byte(v>>uint(i)&1)
+		w.bits++
+		if w.bits == 8 {
+			w.b = append(w.b, w.cur)
+			w.cur, w.bits = 0, 0
+		}
+	}
+}
+
+// Flush pads the last byte with zero bits.
+func (w *pdfBitWriter) Flush() {
+	if 0 < w.bits {
+		w.b = append(w.b, w.cur<<uint(8-w.bits))
+		w.cur, w.bits = 0, 0
+	}
+}
+
+// bitsNeeded returns the number of bits needed to represent a non-negative integer.
+func bitsNeeded(v int) int {
+	n := 0
+	for 0 < v {
+		n++
+		v >>= 1
+	}
+	return n
+}
+
+func minMaxInts(vs []int) (int, int) {
+	if len(vs) == 0 {
+		return 0, 0
+	}
+	min, max := vs[0], vs[0]
+	for _, v := range vs[1:] {
+		if v < min {
+			min = v
+		} else if max < v {
+			max = v
+		}
+	}
+	return min, max
+}
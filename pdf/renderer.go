@@ -4,24 +4,30 @@ import (
 	"bytes"
 	"compress/zlib"
 	"encoding/ascii85"
-	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"math"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf16"
 
 	"github.com/tdewolff/canvas"
 	canvasFont "github.com/tdewolff/canvas/font"
+	"github.com/tdewolff/canvas/rasterizer"
+	"golang.org/x/image/draw"
 )
 
 type PDF struct {
 	w             *pdfPageWriter
 	width, height float64
 	imgEnc        canvas.ImageEncoding
+	buf           *bytes.Buffer // set when writing to memory
 }
 
 // NewPDF creates a portable document format renderer.
@@ -34,14 +40,67 @@ func New(w io.Writer, width, height float64) *PDF {
 	}
 }
 
+// NewBuffer creates a portable document format renderer that writes to memory, which is returned by Bytes after closing the document.
+func NewBuffer(width, height float64) *PDF {
+	buf := &bytes.Buffer{}
+	r := New(buf, width, height)
+	r.buf = buf
+	return r
+}
+
+// Bytes returns the document written by a renderer created with NewBuffer, which is complete only after Close.
+func (r *PDF) Bytes() []byte {
+	if r.buf == nil {
+		panic("PDF not created with NewBuffer")
+	}
+	return r.buf.Bytes()
+}
+
+// SetImageEncoding sets the encoding of embedded images, which is Lossless by default to compress images with Flate. Lossy encodes images as JPEG instead, while transparency remains lossless in a soft mask. JPEG images loaded with canvas.NewJPEGImage are embedded as is, and tiled images and images with a color key are always lossless.
 func (r *PDF) SetImageEncoding(enc canvas.ImageEncoding) {
 	r.imgEnc = enc
 }
 
+// SetCompression sets whether content streams are compressed, which is the same as SetStreamCompression(ContentStreams, compress). Image and font streams are compressed unless disabled by SetStreamCompression.
 func (r *PDF) SetCompression(compress bool) {
 	r.w.pdf.SetCompression(compress)
 }
 
+// SetStreamCompression sets whether streams of the given type are compressed with Flate, for example to keep content streams readable for debugging while compressing images. By default image and font streams are compressed and content streams are not. JPEG images are never compressed again. Unknown stream types are ignored.
+func (r *PDF) SetStreamCompression(typ StreamType, compress bool) {
+	r.w.pdf.SetStreamCompression(typ, compress)
+}
+
+// SetImageResolution sets the maximum resolution of embedded images in dots-per-millimeter. Images that are placed on the page with a higher resolution are downsampled before embedding. Zero disables downsampling, which is the default.
+func (r *PDF) SetImageResolution(resolution canvas.DPMM) {
+	r.w.pdf.SetImageResolution(resolution)
+}
+
+// SetImageClipping sets whether images are clipped by their outline for smooth edges. When disabled, images that are not rotated or sheared are drawn without clipping path, which avoids seams between adjacent images. Enabled by default.
+func (r *PDF) SetImageClipping(clip bool) {
+	r.w.pdf.SetImageClipping(clip)
+}
+
+// SetDashReset sets whether dashed strokes restart their dash pattern at each subpath by stroking every subpath separately, so that for example separate line segments each start with a full dash. Viewers should restart the dash pattern at each subpath already, but not all do. Disabled by default.
+func (r *PDF) SetDashReset(reset bool) {
+	r.w.pdf.SetDashReset(reset)
+}
+
+// SetWordKerning sets whether the kerning of text is applied at word boundaries only, so that each word is written as a single string in the TJ operator. Some text extractors insert spaces between the strings of a word that is split for its kerning, which breaks word selection and copy-paste. The kerning within a word is added after the word instead, so that the word and the text that follows keep their position, while glyphs within kerned words are slightly misplaced. Disabled by default.
+func (r *PDF) SetWordKerning(wordKerning bool) {
+	r.w.pdf.SetWordKerning(wordKerning)
+}
+
+// SetFlattenTransparency sets whether transparency is flattened for old viewers and print pipelines that mishandle transparency groups and opacity. Translucent colors and images are composited against the white page background into opaque colors, so that overlapping translucent shapes no longer show each other. Alpha masks are drawn as 1-bit image masks, and the transparency group of pages and opacity graphics states are omitted. It must be called before drawing.
+func (r *PDF) SetFlattenTransparency(flatten bool) {
+	r.w.pdf.SetFlattenTransparency(flatten)
+}
+
+// SetLinearized sets whether the document is linearized for fast web view, so that viewers can display the first page before the rest of the document has been downloaded. The document starts with the linearization parameter dictionary, followed by the objects of the first page and a hint stream that locates the objects of the other pages. All objects are kept in memory until Close, and signatures are not supported. It must be called before drawing.
+func (r *PDF) SetLinearized(linearized bool) {
+	r.w.pdf.SetLinearized(linearized)
+}
+
 func (r *PDF) SetInfo(title, subject, keywords, author string) {
 	r.w.pdf.SetTitle(title)
 	r.w.pdf.SetSubject(subject)
@@ -49,11 +108,98 @@ func (r *PDF) SetInfo(title, subject, keywords, author string) {
 	r.w.pdf.SetAuthor(author)
 }
 
+// SetTagged enables tagged PDF output for accessibility. Text is marked as paragraphs, images as figures and paths as artifacts, and a structure tree is written that links the marked content to the pages.
+func (r *PDF) SetTagged(tagged bool) {
+	r.w.pdf.SetTagged(tagged)
+}
+
+// SetVersion sets the PDF version of the document, which is 1.7 by default. It must be called before drawing. When set to version 1.5 or up, the version is also written to the document catalog. Transparency groups are omitted for versions before 1.4, and Close returns an error if features were used that the version does not support, such as transparency or OpenType fonts.
+func (r *PDF) SetVersion(major, minor int) {
+	r.w.pdf.SetVersion(major, minor)
+}
+
+// SetLanguage sets the natural language of the document as a BCP 47 language tag, such as en-US, which is used by screen readers and for text extraction. Text spans in a different language can set FontFace.Language.
+func (r *PDF) SetLanguage(lang string) {
+	r.w.pdf.SetLanguage(lang)
+}
+
+// SetDefaultSRGB sets whether DeviceRGB and DeviceGray colors and images are interpreted as sRGB, by declaring calibrated sRGB color spaces as the default color spaces of each page. This avoids color shifts between viewers without embedding an ICC profile.
+func (r *PDF) SetDefaultSRGB(srgb bool) {
+	r.w.pdf.SetDefaultSRGB(srgb)
+}
+
+// SetMissingGlyphFunc sets a function that is called by RenderText for every rune of a text span that is not in the span's font, which is rendered as the .notdef glyph instead. Control characters, whitespace, and invisible formatting characters are not reported. This allows font fallback systems to detect text that needs another font. Set to nil to disable, which is the default.
+func (r *PDF) SetMissingGlyphFunc(fn func(font *canvas.Font, r rune)) {
+	r.w.pdf.SetMissingGlyphFunc(fn)
+}
+
+// SetObjectTracer sets a function that is called for each object that is written to the output, with its object number, its /Type and /Subtype names joined by a slash such as "Page", "XObject/Image", or "Font/Type0", and its size in bytes. The type is empty for objects without either, such as content streams and embedded font files. This helps to find which objects make up most of the file size. Set to nil to disable, which is the default.
+func (r *PDF) SetObjectTracer(fn func(ref int, typ string, size int)) {
+	r.w.pdf.SetObjectTracer(fn)
+}
+
+// SetFontSubsetting sets whether TrueType fonts are embedded with only the glyphs that are used, which reduces the file size considerably for large fonts. Subset fonts are written when the document is closed. Disabled by default.
+func (r *PDF) SetFontSubsetting(subset bool) {
+	r.w.pdf.SetFontSubsetting(subset)
+}
+
+// SetThumbnailSize enables page thumbnails with the given maximum width and height in pixels, which are rasterized from the page contents and attached to each page. It applies to the current page and all following pages and must be called before drawing on the current page. Zero disables thumbnails.
+func (r *PDF) SetThumbnailSize(size int) {
+	r.w.pdf.SetThumbnailSize(size)
+	r.w.newThumbnail()
+}
+
+// SetMediaBox sets the media box of the current page in millimeters, which is written in points and as integers when the size is a whole number of points, allowing a non-zero lower-left corner for example for imposition. The page contents remain relative to the lower-left corner of the media box. It must be called before drawing on the page.
+func (r *PDF) SetMediaBox(box canvas.Rect) {
+	r.w.SetMediaBox(box)
+	r.width, r.height = box.W, box.H
+}
+
+// SetUserUnit sets the size of the default user space unit of the current page as a multiple of 1/72 inch, which is 1 by default. Pages are limited to 14400 units in width and height, which is 200 inches for the default unit, and larger units allow larger pages such as maps or engineering plots. The page contents remain in millimeters as the scaling from millimeters to points (ptPerMm) is divided by the factor, and annotations are converted likewise. It requires PDF 1.6 and must be called before drawing on the page.
+func (r *PDF) SetUserUnit(factor float64) {
+	r.w.SetUserUnit(factor)
+}
+
+// SetBaseTransform sets a transformation that is applied to the contents of the current page and all following pages, for example canvas.Identity.ReflectYAbout(height/2.0) to use a top-left origin with the y-axis pointing down. The matrices passed to the render functions are applied first, followed by the base transform and then the conversion from millimeters to points, so that coordinates are transformed as base·m. The base transform also applies to patterns, annotations, and thumbnails, but note that a reflection also mirrors text and images unless their matrices reflect them back. It must be called before drawing on the current page.
+func (r *PDF) SetBaseTransform(m canvas.Matrix) {
+	r.w.pdf.SetBaseTransform(m)
+	r.w.SetBaseTransform(m)
+}
+
 // NewPage starts adds a new page where further rendering will be written to
 func (r *PDF) NewPage(width, height float64) {
 	r.w = r.w.pdf.NewPage(width, height)
 }
 
+// FlushPage writes the current page to the output and frees its contents, so that memory does not grow with the number of pages. Nothing may be drawn on the page afterwards and drawing or adding annotations panics, so that NewPage must be called before drawing continues. The resources of each page list only the fonts, images, and graphics states used on that page. Shared objects such as fonts and images are written upon their first use and thus before the first page that uses them, except for subset fonts and Type3 fonts which are written when closing the document.
+func (r *PDF) FlushPage() {
+	r.w.writePage(r.w.pdf.pagesRef)
+}
+
+// StreamType is a type of stream whose compression can be set separately.
+type StreamType int
+
+// see StreamType
+const (
+	ContentStreams StreamType = iota // page contents, form appearances, and Type3 glyphs
+	ImageStreams                     // images and their soft masks
+	FontStreams                      // embedded font files and ToUnicode maps
+)
+
+// Stats are statistics of the objects in a PDF document.
+type Stats struct {
+	Objects     int // including the objects written when closing the document
+	Pages       int
+	Fonts       int
+	Images      int
+	StreamBytes int // length of the encoded streams written so far
+}
+
+// Stats returns the number of objects, pages, embedded fonts, and embedded images of the document, and the total length of the streams written so far. Since pages are written when flushed or when closing the document, call it after Close for the final statistics.
+func (r *PDF) Stats() Stats {
+	return r.w.pdf.Stats()
+}
+
 func (r *PDF) Close() error {
 	return r.w.pdf.Close()
 }
@@ -63,21 +209,19 @@ func (r *PDF) Size() (float64, float64) {
 }
 
 func (r *PDF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if r.w.thumbnail != nil {
+		r.w.thumbnail.RenderPath(path, style, r.w.baseTransform.Mul(m))
+	}
+	if r.w.pdf.tagged && !r.w.inMarkedContent {
+		r.w.BeginArtifact()
+		defer r.w.EndMarkedContent()
+	}
+
 	fill := style.FillColor.A != 0
 	stroke := style.StrokeColor.A != 0 && 0.0 < style.StrokeWidth
 	differentAlpha := fill && stroke && style.FillColor.A != style.StrokeColor.A
 
-	// PDFs don't support the arcs joiner, miter joiner (not clipped), or miter joiner (clipped) with non-bevel fallback
-	strokeUnsupported := false
-	if _, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok {
-		strokeUnsupported = true
-	} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok {
-		if math.IsNaN(miter.Limit) {
-			strokeUnsupported = true
-		} else if _, ok := miter.GapJoiner.(canvas.BevelJoiner); !ok {
-			strokeUnsupported = true
-		}
-	}
+	strokeUnsupported := isStrokeUnsupported(style)
 
 	// PDFs don't support connecting first and last dashes if path is closed, so we move the start of the path if this is the case
 	// TODO
@@ -85,11 +229,34 @@ func (r *PDF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 	//	strokeUnsupported = true
 	//}
 
-	closed := false
-	data := path.Transform(m).ToPDF()
-	if 1 < len(data) && data[len(data)-1] == 'h' {
-		data = data[:len(data)-2]
-		closed = true
+	data, closed := PathOperators(path, m)
+
+	// stroke every subpath separately to restart the dash pattern
+	var subpaths []*canvas.Path
+	if stroke && r.w.pdf.dashReset && 0 < len(style.Dashes) {
+		if subpaths = path.Split(); len(subpaths) < 2 {
+			subpaths = nil
+		}
+	}
+	writeStroke := func() {
+		if subpaths != nil {
+			for _, subpath := range subpaths {
+				r.w.Write([]byte(" "))
+				r.w.Write([]byte(subpath.Transform(m).ToPDF()))
+				r.w.Write([]byte(" S"))
+			}
+			return
+		}
+		r.w.Write([]byte(" "))
+		r.w.Write([]byte(data))
+		if closed {
+			r.w.Write([]byte(" s"))
+		} else {
+			r.w.Write([]byte(" S"))
+		}
+		if style.FillRule == canvas.EvenOdd {
+			r.w.Write([]byte("*"))
+		}
 	}
 
 	if !stroke || !strokeUnsupported {
@@ -107,18 +274,9 @@ func (r *PDF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 			r.w.SetLineCap(style.StrokeCapper)
 			r.w.SetLineJoin(style.StrokeJoiner)
 			r.w.SetDashes(style.DashOffset, style.Dashes)
-			r.w.Write([]byte(" "))
-			r.w.Write([]byte(data))
-			if closed {
-				r.w.Write([]byte(" s"))
-			} else {
-				r.w.Write([]byte(" S"))
-			}
-			if style.FillRule == canvas.EvenOdd {
-				r.w.Write([]byte("*"))
-			}
+			writeStroke()
 		} else if fill && stroke {
-			if !differentAlpha {
+			if !differentAlpha && subpaths == nil {
 				r.w.SetFillColor(style.FillColor)
 				r.w.SetStrokeColor(style.StrokeColor)
 				r.w.SetLineWidth(style.StrokeWidth)
@@ -149,16 +307,7 @@ func (r *PDF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 				r.w.SetLineCap(style.StrokeCapper)
 				r.w.SetLineJoin(style.StrokeJoiner)
 				r.w.SetDashes(style.DashOffset, style.Dashes)
-				r.w.Write([]byte(" "))
-				r.w.Write([]byte(data))
-				if closed {
-					r.w.Write([]byte(" s"))
-				} else {
-					r.w.Write([]byte(" S"))
-				}
-				if style.FillRule == canvas.EvenOdd {
-					r.w.Write([]byte("*"))
-				}
+				writeStroke()
 			}
 		}
 	} else {
@@ -189,20 +338,63 @@ func (r *PDF) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix)
 	}
 }
 
+// isStrokeUnsupported returns true for the arcs joiner, miter joiner (not clipped), or miter joiner (clipped) with non-bevel fallback, which PDFs don't support.
+func isStrokeUnsupported(style canvas.Style) bool {
+	if _, ok := style.StrokeJoiner.(canvas.ArcsJoiner); ok {
+		return true
+	} else if miter, ok := style.StrokeJoiner.(canvas.MiterJoiner); ok {
+		if math.IsNaN(miter.Limit) {
+			return true
+		} else if _, ok := miter.GapJoiner.(canvas.BevelJoiner); !ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *PDF) RenderText(text *canvas.Text, m canvas.Matrix) {
-	r.w.StartTextObject()
+	if r.w.pdf.tagged {
+		r.w.BeginMarkedContent("P")
+		defer r.w.EndMarkedContent()
+	}
 
+	// the text object is started lazily, so that it is not left empty by spans of color glyphs
 	text.WalkSpans(func(y, dx float64, span canvas.TextSpan) {
+		sfnt := r.w.pdf.getSFNT(span.Face.Font)
+		if sfnt != nil && r.w.pdf.missingGlyph != nil {
+			for _, rn := range span.Text {
+				if !sfnt.HasGlyph(rn) && isRendered(rn) {
+					r.w.pdf.missingGlyph(span.Face.Font, rn)
+				}
+			}
+		}
+		if sfnt != nil && (sfnt.Colr != nil || sfnt.Sbix != nil || sfnt.Cblc != nil) && hasColorGlyphs(sfnt, span.Text, glyphBitmapPPEM(span.Face.Size*span.Face.Scale)) {
+			// color glyphs are drawn as filled paths and images, which is not allowed inside a text object
+			if r.w.inTextObject {
+				r.w.EndTextObject()
+			}
+			r.w.beginSpanLanguage(span.Face.Language)
+			r.w.DrawColorSpan(sfnt, span, m.Translate(dx, y).Shear(span.Face.FauxItalic, 0.0))
+			r.w.endSpanLanguage(span.Face.Language)
+			return
+		}
+		if !r.w.inTextObject {
+			r.w.StartTextObject()
+		}
+		r.w.beginSpanLanguage(span.Face.Language)
+		defer r.w.endSpanLanguage(span.Face.Language)
+
 		r.w.SetFillColor(span.Face.Color)
 		r.w.SetFont(span.Face.Font, span.Face.Size*span.Face.Scale)
+		// the faux italic shear is applied last so that it acts in glyph space, keeping the slant relative to the (rotated) baseline
 		r.w.SetTextPosition(m.Translate(dx, y).Shear(span.Face.FauxItalic, 0.0))
 		r.w.SetTextCharSpace(span.GlyphSpacing)
 
 		if 0.0 < span.Face.FauxBold {
-			r.w.SetTextRenderMode(2)
+			r.w.SetTextRenderMode(r.w.textMode(span.Face.Color, 2))
 			fmt.Fprintf(r.w, " %v w", dec(span.Face.FauxBold*2.0))
 		} else {
-			r.w.SetTextRenderMode(0)
+			r.w.SetTextRenderMode(r.w.textMode(span.Face.Color, 0))
 		}
 
 		TJ := []interface{}{}
@@ -215,13 +407,282 @@ func (r *PDF) RenderText(text *canvas.Text, m canvas.Matrix) {
 		}
 		r.w.WriteText(TJ...)
 	})
-	r.w.EndTextObject()
+	if r.w.inTextObject {
+		r.w.EndTextObject()
+	}
 
+	// the thumbnail renders the decoration together with the text
+	thumbnail := r.w.thumbnail
+	if thumbnail != nil {
+		thumbnail.RenderText(text, r.w.baseTransform.Mul(m))
+		r.w.thumbnail = nil
+	}
 	text.RenderDecoration(r, m)
+	r.w.thumbnail = thumbnail
+}
+
+// MeasureText returns the width in millimeters of the string when written with the given font and font size in millimeters, including kerning.
+func (r *PDF) MeasureText(font *canvas.Font, size float64, s string) float64 {
+	units := font.UnitsPerEm()
+	widths := font.Widths(units)
+
+	width := 0.0
+	for _, index := range font.IndicesOf(s) {
+		if int(index) < len(widths) {
+			width += widths[index]
+		}
+	}
+
+	var prev rune
+	for i, rn := range s {
+		if 0 < i {
+			width += r.w.pdf.kerning(font, prev, rn)
+		}
+		prev = rn
+	}
+	return width * size / units
+}
+
+// Glyph is a glyph of a shaped glyph run, with its advance and offsets in millimeters. Rune is the character that the glyph represents, which is used to extract text from the document, and may be zero for glyphs that do not represent a single character such as ligatures.
+type Glyph struct {
+	ID               uint16
+	Rune             rune
+	XAdvance         float64
+	XOffset, YOffset float64
+}
+
+// RenderGlyphs renders a run of glyphs that were shaped by the caller, with the font size in millimeters, starting at the origin transformed by m. Glyphs are positioned by their advances and offsets instead of the font's advances and kerning.
+func (r *PDF) RenderGlyphs(font *canvas.Font, size float64, glyphs []Glyph, col color.RGBA, m canvas.Matrix) {
+	r.renderGlyphs(font, size, glyphs, col, nil, m)
+}
+
+// RenderGlyphsColored renders a run of glyphs like RenderGlyphs, but fills each glyph with the color at the same index in colors. The fill color changes between groups of glyphs within a single text object, which is useful for syntax highlighting or colored math without splitting the run. It panics if the number of colors and glyphs differ.
+func (r *PDF) RenderGlyphsColored(font *canvas.Font, size float64, glyphs []Glyph, colors []color.RGBA, m canvas.Matrix) {
+	if len(colors) != len(glyphs) {
+		panic("number of colors must equal the number of glyphs")
+	} else if len(glyphs) == 0 {
+		return
+	}
+	r.renderGlyphs(font, size, glyphs, colors[0], colors, m)
+}
+
+// RenderGlyphsAt renders glyphs with the font size in millimeters, where each glyph is placed with its origin and orientation given by the matrix at the same index in matrices, for example to render text along a path. All glyphs are rendered in a single text object. Glyphs are not advanced or kerned, which is the responsibility of the caller when computing the matrices. It panics if the number of matrices and glyphs differ.
+func (r *PDF) RenderGlyphsAt(font *canvas.Font, size float64, glyphIDs []uint16, matrices []canvas.Matrix, col color.RGBA) {
+	if len(matrices) != len(glyphIDs) {
+		panic("number of matrices must equal the number of glyphs")
+	} else if len(glyphIDs) == 0 {
+		return
+	}
+	if r.w.pdf.tagged {
+		r.w.BeginMarkedContent("P")
+		defer r.w.EndMarkedContent()
+	}
+
+	r.w.StartTextObject()
+	r.w.SetFillColor(col)
+	r.w.SetFont(font, size)
+	r.w.SetTextCharSpace(0.0)
+	r.w.SetTextRenderMode(r.w.textMode(col, 0))
+	for i, glyphID := range glyphIDs {
+		r.w.SetTextPosition(matrices[i])
+		r.w.WriteText([]uint16{glyphID})
+		r.w.thumbnailGlyph(font, size, glyphID, col, matrices[i])
+	}
+	r.w.EndTextObject()
+}
+
+func (r *PDF) renderGlyphs(font *canvas.Font, size float64, glyphs []Glyph, col color.RGBA, colors []color.RGBA, m canvas.Matrix) {
+	if r.w.pdf.tagged {
+		r.w.BeginMarkedContent("P")
+		defer r.w.EndMarkedContent()
+	}
+
+	r.w.StartTextObject()
+	r.w.SetFillColor(col)
+	r.w.SetFont(font, size)
+	r.w.SetTextPosition(m)
+	r.w.SetTextCharSpace(0.0)
+	r.w.SetTextRenderMode(r.w.textMode(col, 0))
+
+	widths := r.w.pdf.getGlyphWidths(font)
+	TJ := []interface{}{}
+	x := 0.0
+	moved := false // text position is not at the pen position
+	for i, glyph := range glyphs {
+		if colors != nil && colors[i] != col {
+			// flush the glyphs of the previous color
+			r.w.WriteText(TJ...)
+			TJ = TJ[:0]
+			col = colors[i]
+			r.w.SetFillColor(col)
+			r.w.SetTextRenderMode(r.w.textMode(col, 0))
+		}
+		if glyph.XOffset != 0.0 || glyph.YOffset != 0.0 || moved {
+			r.w.WriteText(TJ...)
+			TJ = TJ[:0]
+			r.w.SetTextPosition(m.Translate(x+glyph.XOffset, glyph.YOffset))
+			moved = glyph.XOffset != 0.0 || glyph.YOffset != 0.0
+		}
+		if ids, ok := lastGlyphIDs(TJ); ok {
+			TJ[len(TJ)-1] = append(ids, glyph.ID)
+		} else {
+			TJ = append(TJ, []uint16{glyph.ID})
+		}
+		if glyph.Rune != 0 {
+			r.w.pdf.addToUnicode(font, r.w.pdf.getCIDs(font, []uint16{glyph.ID}), []rune{glyph.Rune})
+		}
+		r.w.thumbnailGlyph(font, size, glyph.ID, col, m.Translate(x+glyph.XOffset, glyph.YOffset))
+
+		// adjust the advance used by the viewer to the shaped advance, when it differs by at least half a glyph space unit
+		advance := 0.0
+		if int(glyph.ID) < len(widths) {
+			advance = float64(widths[glyph.ID]) * size / 1000.0
+		}
+		if !moved && 0.5 <= math.Abs(glyph.XAdvance-advance)*1000.0/size {
+			TJ = append(TJ, glyph.XAdvance-advance)
+		}
+		x += glyph.XAdvance
+	}
+	r.w.WriteText(TJ...)
+	r.w.EndTextObject()
+}
+
+func lastGlyphIDs(TJ []interface{}) ([]uint16, bool) {
+	if 0 < len(TJ) {
+		ids, ok := TJ[len(TJ)-1].([]uint16)
+		return ids, ok
+	}
+	return nil, false
 }
 
 func (r *PDF) RenderImage(img image.Image, m canvas.Matrix) {
-	r.w.DrawImage(img, r.imgEnc, m)
+	r.RenderImageAlt(img, m, "")
+}
+
+// RenderImageAlt renders an image like RenderImage, with alternate text that describes the image for screen readers in tagged PDFs. The alternate text is ignored for untagged PDFs.
+func (r *PDF) RenderImageAlt(img image.Image, m canvas.Matrix, alt string) {
+	r.renderImage(img, m, alt, nil, nil)
+}
+
+// renderImage renders an image with alternate text, and with a decode array and color key if not nil. The image is downsampled before validating the lengths of the decode array and color key, since they depend on the number of color components of the embedded image.
+func (r *PDF) renderImage(img image.Image, m canvas.Matrix, alt string, decode []float64, colorKey []int) error {
+	if r.w.pdf.imgResolution != 0.0 {
+		img, m = downsampleImage(img, m, float64(r.w.pdf.imgResolution))
+	}
+	n := 2 * imageColorComponents(img)
+	if decode != nil && len(decode) != n {
+		return fmt.Errorf("decode array must have %d values, got %d", n, len(decode))
+	}
+	if colorKey != nil {
+		if len(colorKey) != n {
+			return fmt.Errorf("color key must have %d values, got %d", n, len(colorKey))
+		}
+		for i := 0; i < len(colorKey); i += 2 {
+			if colorKey[i] < 0 || 255 < colorKey[i+1] || colorKey[i+1] < colorKey[i] {
+				return fmt.Errorf("color key range %d-%d must be within 0-255", colorKey[i], colorKey[i+1])
+			}
+		}
+	}
+
+	if r.w.thumbnail != nil {
+		r.w.thumbnail.RenderImage(img, r.w.baseTransform.Mul(m))
+	}
+	if r.w.pdf.tagged {
+		r.w.BeginFigure(alt)
+		defer r.w.EndMarkedContent()
+	}
+	r.w.drawImage(img, r.imgEnc, m, nil, decode, colorKey)
+	return nil
+}
+
+// RenderImageClipped renders an image that is clipped by the given path. The clip path is in page coordinates and is not transformed by m. The image is marked as an artifact in tagged PDFs, use RenderImageClippedAlt for images that are part of the content.
+func (r *PDF) RenderImageClipped(img image.Image, m canvas.Matrix, clip *canvas.Path) {
+	r.RenderImageClippedAlt(img, m, clip, "")
+}
+
+// RenderImageClippedAlt renders an image that is clipped by the given path like RenderImageClipped, with alternate text that describes the image for screen readers in tagged PDFs. Images without alternate text are marked as artifacts.
+func (r *PDF) RenderImageClippedAlt(img image.Image, m canvas.Matrix, clip *canvas.Path, alt string) {
+	if r.w.thumbnail != nil {
+		r.w.thumbnail.RenderImage(img, r.w.baseTransform.Mul(m)) // thumbnails ignore the clipping path
+	}
+	if r.w.pdf.tagged {
+		if alt == "" {
+			r.w.BeginArtifact()
+		} else {
+			r.w.BeginFigure(alt)
+		}
+		defer r.w.EndMarkedContent()
+	}
+	r.w.DrawImageClipped(img, r.imgEnc, m, clip)
+}
+
+// RenderImageTiled fills the region with the image repeated in both directions, where m places the first tile as in RenderImage. The image is embedded once in a tiling pattern that is repeated by the viewer, which is much smaller than rendering every tile. The region is in page coordinates and is not transformed by m. The image is marked as an artifact in tagged PDFs.
+func (r *PDF) RenderImageTiled(img image.Image, m canvas.Matrix, region *canvas.Path) {
+	if r.w.thumbnail != nil {
+		r.w.thumbnail.RenderImage(img, r.w.baseTransform.Mul(m)) // thumbnails only render the first tile
+	}
+	if r.w.pdf.tagged {
+		// tiled images are decorative backgrounds
+		r.w.BeginArtifact()
+		defer r.w.EndMarkedContent()
+	}
+	r.w.DrawImageTiled(img, m, region)
+}
+
+// RenderAlphaMask paints the color through the mask image, which is placed by m as in RenderImage. The coverage is the luminance of the mask image, so that both grayscale images and alpha images (image.Alpha) can be used, for example for pre-rasterized antialiased shapes or icons. Unlike a 1-bit stencil mask, the coverage has 8 bits so that edges remain smooth. The color is set as the fill color, so that registered colors are painted as spot colors. The mask is marked as an artifact in tagged PDFs. It requires PDF 1.4.
+func (r *PDF) RenderAlphaMask(mask image.Image, col color.RGBA, m canvas.Matrix) {
+	if r.w.thumbnail != nil {
+		size := mask.Bounds().Size()
+		img := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				a := uint32(color.GrayModel.Convert(mask.At(mask.Bounds().Min.X+x, mask.Bounds().Min.Y+y)).(color.Gray).Y)
+				img.SetRGBA(x, y, color.RGBA{uint8(uint32(col.R) * a / 255), uint8(uint32(col.G) * a / 255), uint8(uint32(col.B) * a / 255), uint8(uint32(col.A) * a / 255)})
+			}
+		}
+		r.w.thumbnail.RenderImage(img, r.w.baseTransform.Mul(m))
+	}
+	if r.w.pdf.tagged {
+		// without alternate text the mask cannot be tagged as a Figure
+		r.w.BeginArtifact()
+		defer r.w.EndMarkedContent()
+	}
+	r.w.DrawAlphaMask(mask, col, m)
+}
+
+// SetLineWidth sets the line width in millimeters for strokes in raw content added with RawContent. Paths rendered with RenderPath set their own stroke state.
+func (r *PDF) SetLineWidth(lineWidth float64) {
+	r.w.SetLineWidth(lineWidth)
+}
+
+// SetLineCap sets the line cap for strokes, which must be a butt, round, or square capper.
+func (r *PDF) SetLineCap(capper canvas.Capper) {
+	r.w.SetLineCap(capper)
+}
+
+// SetLineJoin sets the line join for strokes, which must be a bevel, round, or miter joiner. Miter joiners also set the miter limit.
+func (r *PDF) SetLineJoin(joiner canvas.Joiner) {
+	r.w.SetLineJoin(joiner)
+}
+
+// SetMiterLimit sets the miter limit for strokes with miter joins.
+func (r *PDF) SetMiterLimit(miterLimit float64) {
+	r.w.SetMiterLimit(miterLimit)
+}
+
+// SetDashPattern sets the dash pattern for strokes with the dash lengths and offset in millimeters. An empty dash array draws solid lines.
+func (r *PDF) SetDashPattern(dashPhase float64, dashArray []float64) {
+	r.w.SetDashes(dashPhase, dashArray)
+}
+
+// RenderImageDecode renders an image with a Decode array that maps the image samples to color component values, for example [1 0] to invert grayscale scans where zero is white. The array must have a minimum and maximum value for each color component of the embedded image. Baseline JPEG images in grayscale or CMYK are embedded with one or four components respectively, all other images are embedded in RGB with three components. An error is returned if the array has the wrong length.
+func (r *PDF) RenderImageDecode(img image.Image, m canvas.Matrix, decode []float64) error {
+	return r.renderImage(img, m, "", decode, nil)
+}
+
+// RenderImageColorKey renders an image where the pixels with a color in the given range are transparent, such as to knock out the background color of an image without an alpha channel. The color key has a minimum and maximum sample value between 0 and 255 for each color component of the embedded image, see RenderImageDecode, so that [255 255 255 255 255 255] makes white transparent for RGB images. The alpha channel of an image takes precedence over its color key. An error is returned if the color key has the wrong length or values out of range.
+func (r *PDF) RenderImageColorKey(img image.Image, m canvas.Matrix, colorKey []int) error {
+	return r.renderImage(img, m, "", nil, colorKey)
 }
 
 type pdfWriter struct {
@@ -229,30 +690,226 @@ type pdfWriter struct {
 	err error
 
 	pos        int
-	objOffsets []int
-
-	fonts    map[*canvas.Font]pdfRef
-	pages    []*pdfPageWriter
-	compress bool
-	title    string
-	subject  string
-	keywords string
-	author   string
+	objOffsets []int // offset of each object, or -1 for objects of the original document of an incremental update
+	catalogRef pdfRef
+	infoRef    pdfRef
+	pagesRef   pdfRef
+	original   *pdfOriginal // set for incremental updates
+
+	fonts          map[*canvas.Font]pdfRef
+	fontSubsets    map[*canvas.Font]*pdfFontSubset
+	type3Fonts     map[*Type3Font]pdfRef
+	standardFonts  map[StandardFont]pdfRef
+	toUnicode      map[*canvas.Font]*pdfToUnicode
+	sfnts          map[*canvas.Font]*canvasFont.SFNT
+	widths         map[*canvas.Font][]int
+	graphicsStates map[float64]pdfRef
+	colors         map[string]*pdfNamedColor
+	separations    map[color.RGBA]*pdfNamedColor // registered separation colors by color
+	iccProfiles    map[string]pdfRef             // ICCBased color streams by profile
+	fields         pdfArray
+	signature      *pdfSignature
+	formFonts      pdfDict
+	pages          []*pdfPageWriter
+	compress       [3]bool // per StreamType
+	imgClip        bool
+	dashReset      bool
+	wordKerning    bool
+	flatten        bool // flatten transparency
+	baseTransform  canvas.Matrix
+	linearized     bool
+	objects        map[pdfRef]interface{} // objects kept until closing for linearization
+	subset         bool
+	tagged         bool
+	thumbSize      int
+	srgb           bool
+	srgbRefs       [2]pdfRef // DefaultRGB and DefaultGray color spaces, written upon first use
+	images         int
+	streamBytes    int
+
+	version         int // major and minor version as 10*major+minor
+	versionSet      bool
+	headerWritten   bool
+	requiredVersion int
+	requiredFeature string
+
+	imgResolution canvas.DPMM
+	missingGlyph  func(*canvas.Font, rune)
+	objectTracer  func(int, string, int)
+	lang          string
+	title         string
+	subject       string
+	keywords      string
+	author        string
 }
 
 func newPDFWriter(writer io.Writer) *pdfWriter {
 	w := &pdfWriter{
-		w:          writer,
-		fonts:      map[*canvas.Font]pdfRef{},
-		objOffsets: []int{0, 0, 0}, // catalog, metadata, page tree
+		w:              writer,
+		fonts:          map[*canvas.Font]pdfRef{},
+		fontSubsets:    map[*canvas.Font]*pdfFontSubset{},
+		type3Fonts:     map[*Type3Font]pdfRef{},
+		standardFonts:  map[StandardFont]pdfRef{},
+		toUnicode:      map[*canvas.Font]*pdfToUnicode{},
+		sfnts:          map[*canvas.Font]*canvasFont.SFNT{},
+		widths:         map[*canvas.Font][]int{},
+		graphicsStates: map[float64]pdfRef{},
+		formFonts:      pdfDict{},
+		colors:         map[string]*pdfNamedColor{},
+		separations:    map[color.RGBA]*pdfNamedColor{},
+		iccProfiles:    map[string]pdfRef{},
+		objOffsets:     []int{0, 0, 0}, // catalog, metadata, page tree
+		catalogRef:     1,
+		infoRef:        2,
+		pagesRef:       3,
+		imgClip:        true,
+		baseTransform:  canvas.Identity,
+		compress:       [3]bool{false, true, true},
+		version:        17,
 	}
-
-	w.write("%%PDF-1.7\n")
 	return w
 }
 
+// SetVersion sets the PDF version, which must be set before anything is written such as fonts and images, see PDF.SetVersion.
+func (w *pdfWriter) SetVersion(major, minor int) {
+	if w.headerWritten {
+		panic("PDF version must be set before writing")
+	} else if major < 1 || 2 < major || minor < 0 || 9 < minor || major == 2 && minor != 0 {
+		panic("unsupported PDF version")
+	}
+	w.version = 10*major + minor
+	w.versionSet = true
+}
+
+// requireVersion records that a feature requires at least the given PDF version, which is validated when closing the document.
+func (w *pdfWriter) requireVersion(major, minor int, feature string) {
+	if w.requiredVersion < 10*major+minor {
+		w.requiredVersion = 10*major + minor
+		w.requiredFeature = feature
+	}
+}
+
+// writeHeader writes the header with the PDF version, it is written upon the first write so that the version can be changed before. The header is followed by a comment with bytes above 127 that marks the file as binary for file transfer tools.
+func (w *pdfWriter) writeHeader() {
+	w.headerWritten = true
+	w.write("%%PDF-%d.%d\n%%\xe2\xe3\xcf\xd3\n", w.version/10, w.version%10)
+}
+
 func (w *pdfWriter) SetCompression(compress bool) {
-	w.compress = compress
+	w.compress[ContentStreams] = compress
+}
+
+func (w *pdfWriter) SetStreamCompression(typ StreamType, compress bool) {
+	if 0 <= typ && int(typ) < len(w.compress) {
+		w.compress[typ] = compress
+	}
+}
+
+// flate returns the stream with the Flate filter added when streams of the given type are compressed.
+func (w *pdfWriter) flate(typ StreamType, stream pdfStream) pdfStream {
+	if w.compress[typ] {
+		if stream.dict == nil {
+			stream.dict = pdfDict{}
+		}
+		stream.dict["Filter"] = pdfFilterFlate
+	}
+	return stream
+}
+
+func (w *pdfWriter) SetImageResolution(resolution canvas.DPMM) {
+	w.imgResolution = resolution
+}
+
+func (w *pdfWriter) SetImageClipping(clip bool) {
+	w.imgClip = clip
+}
+
+func (w *pdfWriter) SetDashReset(reset bool) {
+	w.dashReset = reset
+}
+
+func (w *pdfWriter) SetFlattenTransparency(flatten bool) {
+	w.flatten = flatten
+}
+
+func (w *pdfWriter) SetWordKerning(wordKerning bool) {
+	w.wordKerning = wordKerning
+}
+
+func (w *pdfWriter) SetBaseTransform(m canvas.Matrix) {
+	w.baseTransform = m
+}
+
+// SetLinearized sets whether the document is written linearized, which keeps all objects in memory until closing, see PDF.SetLinearized.
+func (w *pdfWriter) SetLinearized(linearized bool) {
+	if w.headerWritten || 0 < len(w.objects) {
+		panic("linearization must be set before writing")
+	}
+	w.linearized = linearized
+	w.objects = nil
+	if linearized {
+		w.objects = map[pdfRef]interface{}{}
+	}
+}
+
+// isRendered returns true if the rune is drawn with a visible glyph, which excludes control characters such as line feeds and tabs, whitespace, and invisible formatting characters such as zero-width joiners.
+func isRendered(r rune) bool {
+	return !unicode.IsControl(r) && !unicode.IsSpace(r) && !unicode.Is(unicode.Cf, r)
+}
+
+func (w *pdfWriter) SetMissingGlyphFunc(fn func(*canvas.Font, rune)) {
+	w.missingGlyph = fn
+}
+
+func (w *pdfWriter) SetObjectTracer(fn func(int, string, int)) {
+	w.objectTracer = fn
+}
+
+func (w *pdfWriter) SetFontSubsetting(subset bool) {
+	w.subset = subset
+}
+
+func (w *pdfWriter) SetThumbnailSize(size int) {
+	w.thumbSize = size
+}
+
+func (w *pdfWriter) Stats() Stats {
+	return Stats{
+		Objects:     len(w.objOffsets),
+		Pages:       len(w.pages),
+		Fonts:       len(w.fonts) + len(w.type3Fonts) + len(w.standardFonts),
+		Images:      w.images,
+		StreamBytes: w.streamBytes,
+	}
+}
+
+func (w *pdfWriter) SetDefaultSRGB(srgb bool) {
+	w.srgb = srgb
+}
+
+// getDefaultSRGB returns the CalRGB and CalGray color spaces that approximate sRGB with a D65 white point and a gamma of 2.2.
+func (w *pdfWriter) getDefaultSRGB() (pdfRef, pdfRef) {
+	if w.srgbRefs[0] == 0 {
+		whitePoint := pdfArray{0.9505, 1.0, 1.089}
+		w.srgbRefs[0] = w.writeObject(pdfArray{pdfName("CalRGB"), pdfDict{
+			"WhitePoint": whitePoint,
+			"Gamma":      pdfArray{2.2, 2.2, 2.2},
+			"Matrix":     pdfArray{0.4124, 0.2126, 0.0193, 0.3576, 0.7152, 0.1192, 0.1805, 0.0722, 0.9505},
+		}})
+		w.srgbRefs[1] = w.writeObject(pdfArray{pdfName("CalGray"), pdfDict{
+			"WhitePoint": whitePoint,
+			"Gamma":      2.2,
+		}})
+	}
+	return w.srgbRefs[0], w.srgbRefs[1]
+}
+
+func (w *pdfWriter) SetTagged(tagged bool) {
+	w.tagged = tagged
+}
+
+func (w *pdfWriter) SetLanguage(lang string) {
+	w.lang = lang
 }
 
 func (w *pdfWriter) SetTitle(title string) {
@@ -272,6 +929,9 @@ func (w *pdfWriter) SetAuthor(author string) {
 }
 
 func (w *pdfWriter) writeBytes(b []byte) {
+	if !w.headerWritten {
+		w.writeHeader()
+	}
 	if w.err != nil {
 		return
 	}
@@ -281,6 +941,9 @@ func (w *pdfWriter) writeBytes(b []byte) {
 }
 
 func (w *pdfWriter) write(s string, v ...interface{}) {
+	if !w.headerWritten {
+		w.writeHeader()
+	}
 	if w.err != nil {
 		return
 	}
@@ -305,8 +968,30 @@ const (
 	pdfFilterDCT     pdfFilter = "DCTDecode"
 )
 
+// pdfTextString encodes a text string, such as annotation contents or field values. ASCII strings are written as is since they coincide with PDFDocEncoding, other strings are encoded as UTF-16BE with a byte order mark.
+func pdfTextString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if 0x80 <= r {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+
+	b := []byte{0xFE, 0xFF}
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return string(b)
+}
+
 func (w *pdfWriter) writeVal(i interface{}) {
 	switch v := i.(type) {
+	case nil:
+		w.write("null")
 	case bool:
 		if v {
 			w.write("true")
@@ -317,10 +1002,13 @@ func (w *pdfWriter) writeVal(i interface{}) {
 		w.write("%d", v)
 	case float64:
 		w.write("%v", dec(v))
+	case pt:
+		w.write("%v", v)
 	case string:
 		v = strings.Replace(v, `\`, `\\`, -1)
 		v = strings.Replace(v, `(`, `\(`, -1)
 		v = strings.Replace(v, `)`, `\)`, -1)
+		v = strings.Replace(v, "\r", `\r`, -1) // an unescaped CR or CRLF is read as LF
 		w.write("(%v)", v)
 	case pdfRef:
 		w.write("%v 0 R", v)
@@ -403,6 +1091,7 @@ func (w *pdfWriter) writeVal(i interface{}) {
 		}
 
 		v.dict["Length"] = len(b)
+		w.streamBytes += len(b)
 		w.writeVal(v.dict)
 		w.write(" stream\n")
 		w.writeBytes(b)
@@ -413,18 +1102,135 @@ func (w *pdfWriter) writeVal(i interface{}) {
 }
 
 func (w *pdfWriter) writeObject(val interface{}) pdfRef {
+	if w.linearized {
+		ref := w.reserveObject()
+		w.objects[ref] = val
+		return ref
+	} else if !w.headerWritten {
+		w.writeHeader() // the object's offset must follow the header
+	}
 	w.objOffsets = append(w.objOffsets, w.pos)
 	w.write("%v 0 obj\n", len(w.objOffsets))
 	w.writeVal(val)
 	w.write("\nendobj\n")
+	w.traceObject(pdfRef(len(w.objOffsets)), val, w.pos-w.objOffsets[len(w.objOffsets)-1])
 	return pdfRef(len(w.objOffsets))
 }
 
+// reserveObject reserves an object number for an object that is written later using writeReservedObject, which allows objects to refer to each other.
+func (w *pdfWriter) reserveObject() pdfRef {
+	w.objOffsets = append(w.objOffsets, 0)
+	return pdfRef(len(w.objOffsets))
+}
+
+func (w *pdfWriter) writeReservedObject(ref pdfRef, val interface{}) {
+	if w.linearized {
+		w.objects[ref] = val
+		return
+	} else if !w.headerWritten {
+		w.writeHeader()
+	}
+	w.objOffsets[ref-1] = w.pos
+	w.write("%v 0 obj\n", ref)
+	w.writeVal(val)
+	w.write("\nendobj\n")
+	w.traceObject(ref, val, w.pos-w.objOffsets[ref-1])
+}
+
+// traceObject passes a written object to the object tracer.
+func (w *pdfWriter) traceObject(ref pdfRef, val interface{}, size int) {
+	if w.objectTracer == nil {
+		return
+	}
+
+	var dict pdfDict
+	if stream, ok := val.(pdfStream); ok {
+		dict = stream.dict
+	} else {
+		dict, _ = val.(pdfDict)
+	}
+	typ := ""
+	if name, ok := dict["Type"].(pdfName); ok {
+		typ = string(name)
+	}
+	if name, ok := dict["Subtype"].(pdfName); ok {
+		if typ != "" {
+			typ += "/"
+		}
+		typ += string(name)
+	}
+	w.objectTracer(int(ref), typ, size)
+}
+
+// getOpacityGS returns the graphics state object for the given opacity, which is written once and shared between pages.
+func (w *pdfWriter) getOpacityGS(a float64) pdfRef {
+	if ref, ok := w.graphicsStates[a]; ok {
+		return ref
+	}
+	w.requireVersion(1, 4, "transparency")
+	ref := w.writeObject(pdfDict{
+		"CA": a,
+		"ca": a,
+	})
+	w.graphicsStates[a] = ref
+	return ref
+}
+
+// getGlyphWidths returns the advances of all glyphs in glyph space units as they are embedded for the font.
+func (w *pdfWriter) getGlyphWidths(font *canvas.Font) []int {
+	if widths, ok := w.widths[font]; ok {
+		return widths
+	}
+	widths := glyphWidths(font)
+	w.widths[font] = widths
+	return widths
+}
+
+// getSFNT returns the parsed font data of the font, or nil if it could not be parsed.
+// kerning returns the kerning in font units between two runes, from the GPOS or kern table.
+func (w *pdfWriter) kerning(font *canvas.Font, left, right rune) float64 {
+	if sfnt := w.getSFNT(font); sfnt != nil {
+		return float64(sfnt.KerningMerged(sfnt.GlyphIndex(left), sfnt.GlyphIndex(right)))
+	}
+	kern, _ := font.Kerning(left, right, font.UnitsPerEm())
+	return kern
+}
+
+func (w *pdfWriter) getSFNT(font *canvas.Font) *canvasFont.SFNT {
+	if sfnt, ok := w.sfnts[font]; ok {
+		return sfnt
+	}
+
+	var sfnt *canvasFont.SFNT
+	if _, b := font.Raw(); b != nil {
+		if b, err := canvasFont.ToSFNT(b); err == nil {
+			sfnt, _ = canvasFont.ParseSFNT(b)
+		}
+	}
+	w.sfnts[font] = sfnt
+	return sfnt
+}
+
 func (w *pdfWriter) getFont(font *canvas.Font) pdfRef {
 	if ref, ok := w.fonts[font]; ok {
 		return ref
 	}
 
+	if w.subset {
+		if sfnt := w.getSFNT(font); sfnt != nil && sfnt.IsTrueType {
+			// the font is written when closing, but text extraction must be recorded from now on
+			ref := w.reserveObject()
+			w.fontSubsets[font] = &pdfFontSubset{
+				ref:      ref,
+				glyphIDs: []uint16{0},
+				cids:     map[uint16]uint16{0: 0},
+			}
+			w.getToUnicode(font)
+			w.fonts[font] = ref
+			return ref
+		}
+	}
+
 	mediatype, b := font.Raw()
 	if mediatype != "font/truetype" && mediatype != "font/opentype" {
 		var err error
@@ -438,70 +1244,43 @@ func (w *pdfWriter) getFont(font *canvas.Font) pdfRef {
 		}
 	}
 
-	ffSubtype := ""
+	baseFont := strings.ReplaceAll(font.Name(), " ", "_")
+	ref := w.writeObject(w.fontDict(font, baseFont, mediatype, b, w.getGlyphWidths(font)))
+	w.fonts[font] = ref
+	return ref
+}
+
+// fontDict writes the font program and returns the Type0 font dictionary for it, with the glyph widths in glyph space units indexed by CID.
+func (w *pdfWriter) fontDict(font *canvas.Font, baseFont, mediatype string, b []byte, widths []int) pdfDict {
+	// TrueType fonts are embedded as FontFile2, which is better supported than TrueType in FontFile3, and CFF-based OpenType fonts are embedded as FontFile3
+	fontfileKey := pdfName("")
+	fontfileDict := pdfDict{}
 	cidSubtype := ""
 	if mediatype == "font/truetype" {
-		ffSubtype = "TrueType"
+		fontfileKey = "FontFile2"
+		fontfileDict["Length1"] = len(b)
 		cidSubtype = "CIDFontType2"
 	} else if mediatype == "font/opentype" {
-		ffSubtype = "OpenType"
+		w.requireVersion(1, 6, "OpenType font embedding")
+		fontfileKey = "FontFile3"
+		fontfileDict["Subtype"] = pdfName("OpenType")
 		cidSubtype = "CIDFontType0"
 	}
 
 	units := font.UnitsPerEm()
-	f := 1000 / units // factor to cancel the units and scale to 1000 (pdf spec)
-
-	fWidths := font.Widths(units)
-	widths := make([]int, 0, len(fWidths))
-	for _, w := range fWidths {
-		widths = append(widths, int(w*f+0.5))
-	}
-
-	// shorten glyph widths array
-	DW := widths[0]
-	W := pdfArray{}
-	i, j := 1, 1
-	for k, width := range widths {
-		if k != 0 && width != widths[j] {
-			if 4 < k-j { // at about 5 equal widths, it would be shorter using the other notation format
-				if i < j {
-					arr := pdfArray{}
-					for _, w := range widths[i:j] {
-						arr = append(arr, w)
-					}
-					W = append(W, i, arr)
-				}
-				if widths[j] != DW {
-					W = append(W, j, k-1, widths[j])
-				}
-				i = k
-			}
-			j = k
-		}
-	}
-	if i < len(widths) {
-		arr := pdfArray{}
-		for _, w := range widths[i:] {
-			arr = append(arr, w)
-		}
-		W = append(W, i, arr)
-	}
-
-	baseFont := strings.ReplaceAll(font.Name(), " ", "_")
+	DW, W := widthArray(widths)
 	bounds := font.Bounds(units)
 	metrics := font.Metrics(units)
-	fontfileRef := w.writeObject(pdfStream{
-		dict: pdfDict{
-			"Subtype": pdfName(ffSubtype),
-			"Filter":  pdfFilterFlate,
-		},
+	fontfileRef := w.writeObject(w.flate(FontStreams, pdfStream{
+		dict:   fontfileDict,
 		stream: b,
-	})
-	ref := w.writeObject(pdfDict{
-		"Type":     pdfName("Font"),
-		"Subtype":  pdfName("Type0"),
-		"BaseFont": pdfName(baseFont),
-		"Encoding": pdfName("Identity-H"),
+	}))
+	return pdfDict{
+		"Type":      pdfName("Font"),
+		"Subtype":   pdfName("Type0"),
+		"BaseFont":  pdfName(baseFont),
+		"Encoding":  pdfName("Identity-H"),
+		"ToUnicode": w.getToUnicode(font),
 		"DescendantFonts": pdfArray{pdfDict{
 			"Type":        pdfName("Font"),
 			"Subtype":     pdfName(cidSubtype),
@@ -518,41 +1297,171 @@ func (w *pdfWriter) getFont(font *canvas.Font) pdfRef {
 				"Type":        pdfName("FontDescriptor"),
 				"FontName":    pdfName(baseFont),
 				"Flags":       4,
-				"FontBBox":    pdfArray{int(f * bounds.X), -int(f * (bounds.Y + bounds.H)), int(f * (bounds.X + bounds.W)), -int(f * bounds.Y)},
+				"FontBBox":    pdfArray{glyphSpace(bounds.X, units), -glyphSpace(bounds.Y+bounds.H, units), glyphSpace(bounds.X+bounds.W, units), -glyphSpace(bounds.Y, units)},
 				"ItalicAngle": font.ItalicAngle(),
-				"Ascent":      int(f * metrics.Ascent),
-				"Descent":     -int(f * metrics.Descent),
-				"CapHeight":   -int(f * metrics.CapHeight),
+				"Ascent":      glyphSpace(metrics.Ascent, units),
+				"Descent":     -glyphSpace(metrics.Descent, units),
+				"CapHeight":   -glyphSpace(metrics.CapHeight, units),
 				"StemV":       80, // taken from Inkscape, should be calculated somehow
 				"StemH":       80,
-				"FontFile3":   fontfileRef,
+				fontfileKey:   fontfileRef,
 			},
 		}},
-	})
-	w.fonts[font] = ref
-	return ref
+	}
+}
+
+// glyphSpace converts a distance in font units to glyph space units of which there are 1000 per em. The value is rounded only once so that fonts with any number of units per em keep their precision.
+func glyphSpace(v, unitsPerEm float64) int {
+	return int(math.Round(v * 1000.0 / unitsPerEm))
+}
+
+// glyphWidths returns the advances of all glyphs in glyph space units.
+func glyphWidths(font *canvas.Font) []int {
+	units := font.UnitsPerEm()
+	fWidths := font.Widths(units)
+	widths := make([]int, 0, len(fWidths))
+	for _, w := range fWidths {
+		widths = append(widths, glyphSpace(w, units))
+	}
+	return widths
+}
+
+type widthRun struct {
+	first, last int // glyph indices
+	width       int
+}
+
+// widthArray returns the default width and the W array of CID fonts for the glyph widths. The default width is the most common width, which is omitted from the array. Runs of equal widths are written as "first last width" and other widths as "first [width ...]", whichever is shorter.
+func widthArray(widths []int) (int, pdfArray) {
+	if len(widths) == 0 {
+		return 0, pdfArray{}
+	}
+
+	// group glyphs into runs of equal widths
+	runs := []widthRun{}
+	count := map[int]int{}
+	for i, width := range widths {
+		if 0 < len(runs) && runs[len(runs)-1].width == width {
+			runs[len(runs)-1].last = i
+		} else {
+			runs = append(runs, widthRun{i, i, width})
+		}
+		count[width]++
+	}
+	DW := widths[0]
+	for width, n := range count {
+		if count[DW] < n || count[DW] == n && width < DW {
+			DW = width
+		}
+	}
+
+	// a run of equal widths costs three numbers as a range, or one number per width in a list, so that runs of at least four widths are shorter as a range, as are runs of three that would otherwise start a new list
+	W := pdfArray{}
+	var list pdfArray
+	listLast := 0 // glyph index of the last width in the list
+	flush := func() {
+		for 0 < len(list) && list[len(list)-1] == DW {
+			list = list[:len(list)-1]
+			listLast--
+		}
+		if 0 < len(list) {
+			W = append(W, listLast-len(list)+1, list)
+			list = nil
+		}
+	}
+	for _, run := range runs {
+		n := run.last - run.first + 1
+		if run.width == DW && (list == nil || 1 < n) {
+			flush() // omitted
+		} else if 3 < n || 3 == n && list == nil {
+			flush()
+			W = append(W, run.first, run.last, run.width)
+		} else {
+			for i := 0; i < n; i++ {
+				list = append(list, run.width)
+			}
+			listLast = run.last
+		}
+	}
+	flush()
+	return DW, W
 }
 
 func (w *pdfWriter) Close() error {
-	// TODO: write pages directly to stream instead of using bytes.Buffer
+	if w.linearized && w.signature != nil {
+		return fmt.Errorf("signatures are not supported in linearized documents")
+	} else if w.original != nil && w.tagged {
+		return fmt.Errorf("tagged PDF is not supported for incremental updates")
+	}
+
+	// pages that have been flushed already return their reference
 	kids := pdfArray{}
 	for _, p := range w.pages {
-		kids = append(kids, p.writePage(pdfRef(3)))
+		kids = append(kids, p.writePage(w.pagesRef))
 	}
+	type3Fonts := make([]*Type3Font, 0, len(w.type3Fonts))
+	for font := range w.type3Fonts {
+		type3Fonts = append(type3Fonts, font)
+	}
+	sort.Slice(type3Fonts, func(i, j int) bool { return w.type3Fonts[type3Fonts[i]] < w.type3Fonts[type3Fonts[j]] })
+	for _, font := range type3Fonts {
+		w.writeType3Font(font, w.type3Fonts[font])
+	}
+	if err := w.writeFontSubsets(); err != nil {
+		return err
+	}
+	w.writeToUnicodes()
 
 	// document catalog
-	w.objOffsets[0] = w.pos
-	w.write("%v 0 obj\n", 1)
-	w.writeVal(pdfDict{
-		"Type":  pdfName("Catalog"),
-		"Pages": pdfRef(3),
-	})
-	w.write("\nendobj\n")
+	catalog := pdfDict{}
+	if w.original != nil {
+		for key, val := range w.original.catalog {
+			catalog[key] = val
+		}
+	}
+	catalog["Type"] = pdfName("Catalog")
+	catalog["Pages"] = w.pagesRef
+	if w.versionSet && 15 <= w.version {
+		catalog["Version"] = pdfName(fmt.Sprintf("%d.%d", w.version/10, w.version%10))
+	}
+	if w.lang != "" {
+		w.requireVersion(1, 4, "document language")
+		catalog["Lang"] = w.lang
+	}
+	if w.tagged {
+		w.requireVersion(1, 4, "tagged PDF")
+		catalog["StructTreeRoot"] = w.writeStructTree(kids)
+		catalog["MarkInfo"] = pdfDict{"Marked": true}
+	}
+	if 0 < len(w.fields) {
+		acroForm := pdfDict{}
+		if w.original != nil {
+			for key, val := range w.original.acroForm {
+				acroForm[key] = val
+			}
+		}
+		acroForm["Fields"] = w.fields
+		acroForm["DR"] = pdfDict{"Font": w.formFonts}
+		if w.signature != nil {
+			acroForm["SigFlags"] = 3 // signatures exist, append only
+		}
+		catalog["AcroForm"] = acroForm
+	}
+
+	w.writeReservedObject(w.catalogRef, catalog)
 
 	// metadata
+	now := time.Now().Format("D:20060102150405Z0700")
 	info := pdfDict{
 		"Producer":     "tdewolff/canvas",
-		"CreationDate": time.Now().Format("D:20060102150405Z0700"),
+		"CreationDate": now,
+	}
+	if w.original != nil {
+		info = pdfDict{"Producer": "tdewolff/canvas"}
+		for key, val := range w.original.info {
+			info[key] = val
+		}
+		info["ModDate"] = now
 	}
 	if w.title != "" {
 		info["title"] = w.title
@@ -567,57 +1476,119 @@ func (w *pdfWriter) Close() error {
 		info["author"] = w.author
 	}
 
-	w.objOffsets[1] = w.pos
-	w.write("%v 0 obj\n", 2)
-	w.writeVal(info)
-	w.write("\nendobj\n")
+	w.writeReservedObject(w.infoRef, info)
 
-	// page tree
-	w.objOffsets[2] = w.pos
-	w.write("%v 0 obj\n", 3)
-	w.writeVal(pdfDict{
+	// page tree, new pages are appended to the original page tree for incremental updates
+	pages := pdfDict{
 		"Type":  pdfName("Pages"),
 		"Kids":  pdfArray(kids),
 		"Count": len(kids),
-	})
-	w.write("\nendobj\n")
+	}
+	if w.original != nil {
+		for key, val := range w.original.pages {
+			pages[key] = val
+		}
+		count, _ := w.original.pages["Count"].(int)
+		pages["Kids"] = append(append(pdfArray{}, w.original.pages["Kids"].(pdfArray)...), kids...)
+		pages["Count"] = count + len(kids)
+	}
+	w.writeReservedObject(w.pagesRef, pages)
+
+	if w.linearized {
+		w.requireVersion(1, 2, "linearization")
+		w.writeLinearized(kids)
+	} else {
+		if w.signature != nil {
+			w.writeSignature()
+		}
+		w.writeXref()
+	}
+	if w.err == nil && w.version < w.requiredVersion {
+		return fmt.Errorf("%v requires PDF %d.%d, but the version is %d.%d", w.requiredFeature, w.requiredVersion/10, w.requiredVersion%10, w.version/10, w.version%10)
+	}
+	return w.err
+}
 
+func (w *pdfWriter) writeXref() {
 	xrefOffset := w.pos
-	w.write("xref\n0 %d\n0000000000 65535 f \n", len(w.objOffsets)+1)
-	for _, objOffset := range w.objOffsets {
-		w.write("%010d 00000 n \n", objOffset)
+	trailer := pdfDict{
+		"Root": w.catalogRef,
+		"Size": len(w.objOffsets) + 1,
+		"Info": w.infoRef,
+	}
+	if w.original == nil {
+		w.write("xref\n0 %d\n0000000000 65535 f \n", len(w.objOffsets)+1)
+		for _, objOffset := range w.objOffsets {
+			w.write("%010d 00000 n \n", objOffset)
+		}
+	} else {
+		// only the objects of the update are listed, in subsections of consecutive object numbers
+		w.write("xref\n")
+		for i := 0; i < len(w.objOffsets); {
+			if w.objOffsets[i] == -1 {
+				i++
+				continue
+			}
+			n := 1
+			for i+n < len(w.objOffsets) && w.objOffsets[i+n] != -1 {
+				n++
+			}
+			w.write("%d %d\n", i+1, n)
+			for _, objOffset := range w.objOffsets[i : i+n] {
+				w.write("%010d 00000 n \n", objOffset)
+			}
+			i += n
+		}
+		trailer["Prev"] = w.original.xrefOffset
+		if w.original.id != nil {
+			trailer["ID"] = w.original.id
+		}
 	}
 	w.write("trailer\n")
-	w.writeVal(pdfDict{
-		"Root": pdfRef(1),
-		"Size": len(w.objOffsets) + 1,
-		"Info": pdfRef(2),
-	})
+	w.writeVal(trailer)
 	w.write("\nstartxref\n%v\n%%%%EOF", xrefOffset)
-	return w.err
 }
 
 type pdfPageWriter struct {
 	*bytes.Buffer
 	pdf           *pdfWriter
+	x, y          float64 // lower-left corner of the media box
 	width, height float64
+	userUnit      float64 // size of the default user space unit in points
+	baseTransform canvas.Matrix
 	resources     pdfDict
+	initialLen    int // length of the contents after the initial transformation
+	thumbnail     *rasterizer.Renderer
+	thumbnailImg  *image.RGBA
+	annots        []pdfDict
+	ref           pdfRef // page object, set when the page has been written
+
+	graphicsStates  map[float64]pdfName
+	alpha           float64
+	fillColor       color.RGBA
+	strokeColor     color.RGBA
+	lineWidth       float64
+	lineCap         int
+	lineJoin        int
+	miterLimit      float64
+	dashes          []float64
+	font            *canvas.Font
+	fontSize        float64
+	inTextObject    bool
+	inMarkedContent bool
+	structElems     []pdfStructElem // structure element for each marked-content ID
+	structParents   int             // key in the parent tree
+	textPosition    canvas.Matrix
+	textCharSpace   float64
+	textRenderMode  int
+}
 
-	graphicsStates map[float64]pdfName
-	alpha          float64
-	fillColor      color.RGBA
-	strokeColor    color.RGBA
-	lineWidth      float64
-	lineCap        int
-	lineJoin       int
-	miterLimit     float64
-	dashes         []float64
-	font           *canvas.Font
-	fontSize       float64
-	inTextObject   bool
-	textPosition   canvas.Matrix
-	textCharSpace  float64
-	textRenderMode int
+// Write appends to the contents of the page. It panics when the page was flushed by FlushPage, since its contents have been written already.
+func (w *pdfPageWriter) Write(b []byte) (int, error) {
+	if w.Buffer == nil {
+		panic("page has been flushed, call NewPage before drawing")
+	}
+	return w.Buffer.Write(b)
 }
 
 func (w *pdfWriter) NewPage(width, height float64) *pdfPageWriter {
@@ -627,6 +1598,8 @@ func (w *pdfWriter) NewPage(width, height float64) *pdfPageWriter {
 		pdf:            w,
 		width:          width,
 		height:         height,
+		userUnit:       1.0,
+		baseTransform:  w.baseTransform,
 		resources:      pdfDict{},
 		graphicsStates: map[float64]pdfName{},
 		alpha:          1.0,
@@ -644,53 +1617,173 @@ func (w *pdfWriter) NewPage(width, height float64) *pdfPageWriter {
 		textCharSpace:  0.0,
 		textRenderMode: 0,
 	}
+	page.structParents = len(w.pages)
 	w.pages = append(w.pages, page)
-
-	m := canvas.Identity.Scale(ptPerMm, ptPerMm)
-	fmt.Fprintf(page, " %v %v %v %v %v %v cm", dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]))
+	page.writeInitialTransform()
+	page.newThumbnail()
 	return page
 }
 
+// newThumbnail creates the rasterizer for the thumbnail of the page if enabled.
+func (w *pdfPageWriter) newThumbnail() {
+	if w.pdf.thumbSize <= 0 || w.width <= 0.0 || w.height <= 0.0 {
+		w.thumbnail, w.thumbnailImg = nil, nil
+		return
+	}
+	resolution := float64(w.pdf.thumbSize) / math.Max(w.width, w.height)
+	width := int(math.Max(1.0, w.width*resolution+0.5))
+	height := int(math.Max(1.0, w.height*resolution+0.5))
+	w.thumbnailImg = image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(w.thumbnailImg, w.thumbnailImg.Bounds(), image.White, image.Point{}, draw.Src)
+	w.thumbnail = rasterizer.New(w.thumbnailImg, canvas.DPMM(resolution))
+}
+
+// writeInitialTransform writes the transformation from millimeters to points, which is translated to the lower-left corner of the media box.
+func (w *pdfPageWriter) writeInitialTransform() {
+	m := w.initialTransform()
+	fmt.Fprintf(w, " %v %v %v %v %v %v cm", pt(m[0][0]), pt(m[1][0]), pt(m[0][1]), pt(m[1][1]), pt(m[0][2]), pt(m[1][2]))
+	w.initialLen = w.Len()
+}
+
+// initialTransform returns the transformation from the page contents in millimeters to the default coordinate space in points, which includes the base transform.
+func (w *pdfPageWriter) initialTransform() canvas.Matrix {
+	unitsPerMm := w.unitsPerMm()
+	return canvas.Identity.Translate(w.x*unitsPerMm, w.y*unitsPerMm).Scale(unitsPerMm, unitsPerMm).Mul(w.baseTransform)
+}
+
+// unitsPerMm returns the number of default user space units per millimeter, which is ptPerMm unless the page sets a user unit.
+func (w *pdfPageWriter) unitsPerMm() float64 {
+	return ptPerMm / w.userUnit
+}
+
+// SetMediaBox sets the media box of the page in millimeters, allowing a non-zero lower-left corner. The coordinates of the page contents remain relative to the lower-left corner of the media box, i.e. the origin is translated by (box.X,box.Y) before scaling by ptPerMm. It must be called before drawing on the page.
+func (w *pdfPageWriter) SetMediaBox(box canvas.Rect) {
+	if w.Len() != w.initialLen {
+		panic("media box must be set before drawing")
+	}
+	w.x, w.y = box.X, box.Y
+	w.width, w.height = box.W, box.H
+	w.Reset()
+	w.writeInitialTransform()
+	w.newThumbnail()
+}
+
+// SetUserUnit sets the size of the default user space unit of the page in points, which is one by default. The media box, the initial transformation, and annotations are written in units of factor points, so that the page contents remain in millimeters. It must be called before drawing on the page.
+func (w *pdfPageWriter) SetUserUnit(factor float64) {
+	if w.Len() != w.initialLen {
+		panic("user unit must be set before drawing")
+	} else if !(0.0 < factor) || math.IsInf(factor, 0) {
+		panic("user unit must be positive")
+	}
+	w.userUnit = factor
+	w.Reset()
+	w.writeInitialTransform()
+}
+
+// SetBaseTransform sets the transformation that is applied to the page contents before the conversion from millimeters to points. It must be called before drawing on the page.
+func (w *pdfPageWriter) SetBaseTransform(m canvas.Matrix) {
+	if w.Len() != w.initialLen {
+		panic("base transform must be set before drawing")
+	}
+	w.baseTransform = m
+	w.Reset()
+	w.writeInitialTransform()
+}
+
+// writePage writes the page and its contents and frees the page's buffers. Writing a page a second time returns the page object written before.
 func (w *pdfPageWriter) writePage(parent pdfRef) pdfRef {
+	if w.ref != 0 {
+		return w.ref
+	}
+
 	b := w.Bytes()
 	if 0 < len(b) && b[0] == ' ' {
 		b = b[1:]
 	}
-	stream := pdfStream{
+	contents := w.pdf.writeObject(w.pdf.flate(ContentStreams, pdfStream{
 		dict:   pdfDict{},
 		stream: b,
-	}
-	if w.pdf.compress {
-		stream.dict["Filter"] = pdfFilterFlate
-	}
-	contents := w.pdf.writeObject(stream)
-	return w.pdf.writeObject(pdfDict{
+	}))
+	page := pdfDict{
 		"Type":      pdfName("Page"),
 		"Parent":    parent,
-		"MediaBox":  pdfArray{0.0, 0.0, w.width * ptPerMm, w.height * ptPerMm},
+		"MediaBox":  pdfArray{pt(w.x * w.unitsPerMm()), pt(w.y * w.unitsPerMm()), pt((w.x + w.width) * w.unitsPerMm()), pt((w.y + w.height) * w.unitsPerMm())},
 		"Resources": w.resources,
-		"Group": pdfDict{
+		"Contents":  contents,
+	}
+	if w.userUnit != 1.0 {
+		w.pdf.requireVersion(1, 6, "user units")
+		page["UserUnit"] = w.userUnit
+	}
+	if 14 <= w.pdf.version && !w.pdf.flatten {
+		page["Group"] = pdfDict{
 			"Type": pdfName("Group"),
 			"S":    pdfName("Transparency"),
 			"I":    true,
 			"CS":   pdfName("DeviceRGB"),
-		},
-		"Contents": contents,
-	})
+		}
+	}
+	if w.pdf.srgb {
+		if _, ok := w.resources["ColorSpace"]; !ok {
+			w.resources["ColorSpace"] = pdfDict{}
+		}
+		rgb, gray := w.pdf.getDefaultSRGB()
+		w.resources["ColorSpace"].(pdfDict)["DefaultRGB"] = rgb
+		w.resources["ColorSpace"].(pdfDict)["DefaultGray"] = gray
+		if group, ok := page["Group"].(pdfDict); ok {
+			group["CS"] = rgb
+		}
+	}
+	if w.pdf.tagged {
+		page["StructParents"] = w.structParents
+	}
+	if w.thumbnailImg != nil {
+		page["Thumb"] = w.pdf.writeObject(w.imageStream(w.thumbnailImg, canvas.Lossless))
+	}
+	if 0 < len(w.annots) {
+		annots := pdfArray{}
+		for _, annot := range w.annots {
+			ref := w.pdf.writeObject(annot)
+			if _, ok := annot["FT"]; ok {
+				w.pdf.fields = append(w.pdf.fields, ref)
+			}
+			annots = append(annots, ref)
+		}
+		page["Annots"] = annots
+	}
+	w.ref = w.pdf.writeObject(page)
+
+	// only the marked-content structure is needed afterwards for the structure tree
+	w.Buffer = nil
+	w.resources = nil
+	w.thumbnail, w.thumbnailImg = nil, nil
+	w.annots = nil
+	return w.ref
 }
 
 func (w *pdfPageWriter) SetAlpha(alpha float64) {
-	if alpha != w.alpha {
+	if w.pdf.flatten {
+		return
+	} else if alpha != w.alpha {
 		gs := w.getOpacityGS(alpha)
 		fmt.Fprintf(w, " /%v gs", gs)
 		w.alpha = alpha
 	}
 }
 
+// SetFillColor sets the fill color, where the color components are un-premultiplied by alpha. A fully transparent color only sets the alpha and keeps the current color, as its color components are undefined.
 func (w *pdfPageWriter) SetFillColor(fillColor color.RGBA) {
+	if w.pdf.flatten {
+		fillColor = flattenColor(fillColor)
+	}
 	a := float64(fillColor.A) / 255.0
-	if fillColor != w.fillColor {
-		if fillColor.R == fillColor.G && fillColor.R == fillColor.B {
+	if fillColor.A == 0 {
+		w.SetAlpha(0.0)
+		return
+	} else if fillColor != w.fillColor {
+		if ref, ok := w.pdf.getSeparation(fillColor); ok {
+			fmt.Fprintf(w, " /%v cs 1 scn", w.getColorSpace(ref))
+		} else if fillColor.R == fillColor.G && fillColor.R == fillColor.B {
 			fmt.Fprintf(w, " %v g", dec(float64(fillColor.R)/255.0/a))
 		} else {
 			fmt.Fprintf(w, " %v %v %v rg", dec(float64(fillColor.R)/255.0/a), dec(float64(fillColor.G)/255.0/a), dec(float64(fillColor.B)/255.0/a))
@@ -700,10 +1793,19 @@ func (w *pdfPageWriter) SetFillColor(fillColor color.RGBA) {
 	w.SetAlpha(a)
 }
 
+// SetStrokeColor sets the stroke color, see SetFillColor.
 func (w *pdfPageWriter) SetStrokeColor(strokeColor color.RGBA) {
+	if w.pdf.flatten {
+		strokeColor = flattenColor(strokeColor)
+	}
 	a := float64(strokeColor.A) / 255.0
-	if strokeColor != w.strokeColor {
-		if strokeColor.R == strokeColor.G && strokeColor.R == strokeColor.B {
+	if strokeColor.A == 0 {
+		w.SetAlpha(0.0)
+		return
+	} else if strokeColor != w.strokeColor {
+		if ref, ok := w.pdf.getSeparation(strokeColor); ok {
+			fmt.Fprintf(w, " /%v CS 1 SCN", w.getColorSpace(ref))
+		} else if strokeColor.R == strokeColor.G && strokeColor.R == strokeColor.B {
 			fmt.Fprintf(w, " %v G", dec(float64(strokeColor.R)/255.0/a))
 		} else {
 			fmt.Fprintf(w, " %v %v %v RG", dec(float64(strokeColor.R)/255.0/a), dec(float64(strokeColor.G)/255.0/a), dec(float64(strokeColor.B)/255.0/a))
@@ -758,13 +1860,20 @@ func (w *pdfPageWriter) SetLineJoin(joiner canvas.Joiner) {
 		fmt.Fprintf(w, " %d j", lineJoin)
 		w.lineJoin = lineJoin
 	}
-	if lineJoin == 0 && miterLimit != w.miterLimit {
+	if lineJoin == 0 {
+		w.SetMiterLimit(miterLimit)
+	}
+}
+
+func (w *pdfPageWriter) SetMiterLimit(miterLimit float64) {
+	if miterLimit != w.miterLimit {
 		fmt.Fprintf(w, " %v M", dec(miterLimit))
 		w.miterLimit = miterLimit
 	}
 }
 
 func (w *pdfPageWriter) SetDashes(dashPhase float64, dashArray []float64) {
+	dashArray = append([]float64(nil), dashArray...) // the dashes are kept as graphics state
 	if len(dashArray)%2 == 1 {
 		dashArray = append(dashArray, dashArray...)
 	}
@@ -849,6 +1958,7 @@ func (w *pdfPageWriter) SetTextRenderMode(mode int) {
 	}
 }
 
+// SetTextCharSpace sets the extra spacing between glyphs. Tc is in text space units, which are not scaled by the font size set by Tf, and since scaled fonts (e.g. subscripts) are set using the font size and not the text matrix, the spacing is independent of the font scale.
 func (w *pdfPageWriter) SetTextCharSpace(space float64) {
 	if !w.inTextObject {
 		panic("must be in text object")
@@ -876,6 +1986,20 @@ func (w *pdfPageWriter) EndTextObject() {
 	w.inTextObject = false
 }
 
+// beginSpanLanguage starts a marked-content sequence with the language of the text if it is set. These may be nested in the marked content of tagged PDF.
+func (w *pdfPageWriter) beginSpanLanguage(lang string) {
+	if lang != "" {
+		fmt.Fprintf(w, " /Span <</Lang (%s)>> BDC", escapeString([]byte(lang)))
+	}
+}
+
+func (w *pdfPageWriter) endSpanLanguage(lang string) {
+	if lang != "" {
+		fmt.Fprintf(w, " EMC")
+	}
+}
+
+// WriteText writes the TJ operator for strings, glyph IDs as []uint16, and spacing in millimeters as float64 or int. Strings are kerned.
 func (w *pdfPageWriter) WriteText(TJ ...interface{}) {
 	if !w.inTextObject {
 		panic("must be in text object")
@@ -885,7 +2009,7 @@ func (w *pdfPageWriter) WriteText(TJ ...interface{}) {
 	}
 
 	first := true
-	write := func(s string) {
+	writeGlyphs := func(glyphIDs []uint16) {
 		if first {
 			fmt.Fprintf(w, "(")
 			first = false
@@ -893,35 +2017,51 @@ func (w *pdfPageWriter) WriteText(TJ ...interface{}) {
 			fmt.Fprintf(w, " (")
 		}
 
-		buf := &bytes.Buffer{}
-		indices := w.font.IndicesOf(s)
-		binary.Write(buf, binary.BigEndian, indices)
-
-		s = buf.String()
-		s = strings.Replace(s, "\\", "\\\\", -1)
-		s = strings.Replace(s, "(", "\\(", -1)
-		s = strings.Replace(s, ")", "\\)", -1)
-		fmt.Fprintf(w, "%s)", s)
+		fmt.Fprintf(w, "%s)", pdfGlyphIDString(glyphIDs))
+	}
+	write := func(s string) {
+		cids := w.pdf.getCIDs(w.font, w.font.IndicesOf(s))
+		w.pdf.addToUnicode(w.font, cids, []rune(s))
+		writeGlyphs(cids)
 	}
 
 	units := w.font.UnitsPerEm()
+
 	fmt.Fprintf(w, "[")
 	for _, tj := range TJ {
 		switch val := tj.(type) {
 		case string:
+			if w.pdf.wordKerning {
+				kern := 0.0
+				var rPrev rune
+				for j, r := range val {
+					if 0 < j {
+						kern += w.pdf.kerning(w.font, rPrev, r)
+					}
+					rPrev = r
+				}
+				write(val)
+				if kern != 0.0 {
+					fmt.Fprintf(w, " %d", -glyphSpace(kern, units))
+				}
+				break
+			}
+
 			i := 0
 			var rPrev rune
 			for j, r := range val {
 				if i < j {
-					if kern, err := w.font.Kerning(rPrev, r, units); err == nil && kern != 0.0 {
+					if kern := w.pdf.kerning(w.font, rPrev, r); kern != 0.0 {
 						write(val[i:j])
-						fmt.Fprintf(w, " %d", -int(kern*1000/units+0.5))
+						fmt.Fprintf(w, " %d", -glyphSpace(kern, units))
 						i = j
 					}
 				}
 				rPrev = r
 			}
 			write(val[i:])
+		case []uint16:
+			writeGlyphs(w.pdf.getCIDs(w.font, val))
 		case float64:
 			fmt.Fprintf(w, " %d", -int(val*1000.0/w.fontSize+0.5))
 		case int:
@@ -931,33 +2071,387 @@ func (w *pdfPageWriter) WriteText(TJ ...interface{}) {
 	fmt.Fprintf(w, "]TJ")
 }
 
+// DrawColorSpan draws the glyphs of the text span outside of a text object, where glyphs with color layers in the COLR table are drawn as filled paths layer by layer in their palette colors and glyphs with embedded bitmaps in the sbix or CBDT tables are drawn as images. Runs of other glyphs are written as text in the text color. Faux bold emboldens text and color layers, but not bitmaps.
+func (w *pdfPageWriter) DrawColorSpan(sfnt *canvasFont.SFNT, span canvas.TextSpan, m canvas.Matrix) {
+	size := span.Face.Size * span.Face.Scale
+	f := size / float64(sfnt.Head.UnitsPerEm)
+
+	// plain glyphs are collected in TJ and written as text starting at x0 when interrupted by a color glyph
+	x0 := 0.0
+	TJ := []interface{}{}
+	run := []rune{}
+	flush := func() {
+		if len(run) != 0 {
+			TJ = append(TJ, string(run))
+			run = run[:0]
+		}
+		for 0 < len(TJ) {
+			if _, ok := TJ[len(TJ)-1].(float64); !ok {
+				break
+			}
+			TJ = TJ[:len(TJ)-1]
+		}
+		if len(TJ) == 0 {
+			return
+		}
+
+		w.StartTextObject()
+		w.SetFillColor(span.Face.Color)
+		w.SetFont(span.Face.Font, size)
+		w.SetTextPosition(m.Translate(x0, 0.0))
+		w.SetTextCharSpace(span.GlyphSpacing)
+		if 0.0 < span.Face.FauxBold {
+			w.SetTextRenderMode(w.textMode(span.Face.Color, 2))
+			fmt.Fprintf(w, " %v w", dec(span.Face.FauxBold*2.0))
+		} else {
+			w.SetTextRenderMode(w.textMode(span.Face.Color, 0))
+		}
+		w.WriteText(TJ...)
+		w.EndTextObject()
+		TJ = TJ[:0]
+	}
+
+	x := 0.0
+	words := span.Words()
+	for i, word := range words {
+		// kerning is applied within words as for text
+		first := true
+		var prevGlyphID uint16
+		for _, r := range word {
+			glyphID := sfnt.GlyphIndex(r)
+			if !first {
+				x += float64(sfnt.KerningMerged(prevGlyphID, glyphID)) * f
+			}
+
+			if layers, ok := sfnt.ColorLayers(glyphID, 0); ok {
+				flush()
+				for _, layer := range layers {
+					if sfnt.IsEmptyGlyph(layer.GlyphID) {
+						continue
+					}
+					p, err := canvas.GlyphPath(sfnt, layer.GlyphID, size, x, 0.0)
+					if err != nil || p == nil || p.Empty() {
+						continue
+					}
+					if 0.0 < span.Face.FauxBold {
+						p = p.Offset(span.Face.FauxBold, canvas.NonZero)
+					}
+					col := layer.Color
+					if layer.Foreground {
+						col = span.Face.Color
+					}
+					if w.pdf.flatten && col.A == 0 {
+						continue
+					}
+					w.SetFillColor(col)
+					fmt.Fprintf(w, " %v f", p.Transform(m).ToPDF())
+				}
+			} else if _, ok := sfnt.GlyphBitmap(glyphID, glyphBitmapPPEM(size)); ok {
+				flush()
+				w.drawGlyphBitmap(sfnt, glyphID, size, m.Translate(x, 0.0))
+			} else {
+				if len(run) == 0 && len(TJ) == 0 {
+					x0 = x
+				}
+				run = append(run, r)
+			}
+
+			x += float64(sfnt.GlyphAdvance(glyphID))*f + span.GlyphSpacing
+			prevGlyphID = glyphID
+			first = false
+		}
+		if i != len(words)-1 {
+			if len(run) != 0 {
+				TJ = append(TJ, string(run))
+				run = run[:0]
+			}
+			if len(TJ) != 0 {
+				TJ = append(TJ, span.WordSpacing)
+			}
+			x += span.WordSpacing
+		}
+	}
+	flush()
+}
+
+// thumbnailGlyph draws the outline of the glyph with its origin transformed by m on the thumbnail, if enabled.
+func (w *pdfPageWriter) thumbnailGlyph(font *canvas.Font, size float64, glyphID uint16, col color.RGBA, m canvas.Matrix) {
+	if w.thumbnail == nil {
+		return
+	}
+	sfnt := w.pdf.getSFNT(font)
+	if sfnt == nil || sfnt.IsEmptyGlyph(glyphID) {
+		return
+	}
+	p, err := canvas.GlyphPath(sfnt, glyphID, size, 0.0, 0.0)
+	if err != nil || p == nil || p.Empty() {
+		return
+	}
+	style := canvas.DefaultStyle
+	style.FillColor = col
+	w.thumbnail.RenderPath(p, style, w.baseTransform.Mul(m))
+}
+
+// drawGlyphBitmap draws the embedded bitmap of the glyph from the strike nearest to the font size, and returns false if the glyph has no bitmap or it could not be decoded.
+func (w *pdfPageWriter) drawGlyphBitmap(sfnt *canvasFont.SFNT, glyphID uint16, size float64, m canvas.Matrix) bool {
+	bitmap, ok := sfnt.GlyphBitmap(glyphID, glyphBitmapPPEM(size))
+	if !ok || bitmap.Format != "png" || bitmap.PPEM == 0 {
+		return false
+	}
+	img, err := png.Decode(bytes.NewReader(bitmap.Data))
+	if err != nil {
+		return false
+	}
+
+	scale := size / float64(bitmap.PPEM) // millimeters per pixel
+	w.DrawImage(img, canvas.Lossless, m.Translate(float64(bitmap.OriginX)*scale, float64(bitmap.OriginY)*scale).Scale(scale, scale))
+	return true
+}
+
+// glyphBitmapPPEM returns the pixels-per-em used to select the bitmap strike for a font size in millimeters, which is the font size in points.
+func glyphBitmapPPEM(size float64) uint16 {
+	return uint16(math.Min(size*ptPerMm+0.5, math.MaxUint16))
+}
+
+// hasColorGlyphs returns true if any of the runes maps to a glyph with color layers or an embedded bitmap.
+func hasColorGlyphs(sfnt *canvasFont.SFNT, s string, ppem uint16) bool {
+	for _, r := range s {
+		glyphID := sfnt.GlyphIndex(r)
+		if _, ok := sfnt.ColorLayers(glyphID, 0); ok {
+			return true
+		} else if _, ok := sfnt.GlyphBitmap(glyphID, ppem); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *pdfPageWriter) DrawImage(img image.Image, enc canvas.ImageEncoding, m canvas.Matrix) {
+	w.DrawImageClipped(img, enc, m, nil)
+}
+
+func (w *pdfPageWriter) DrawImageClipped(img image.Image, enc canvas.ImageEncoding, m canvas.Matrix, clip *canvas.Path) {
+	if w.pdf.imgResolution != 0.0 {
+		img, m = downsampleImage(img, m, float64(w.pdf.imgResolution))
+	}
+	w.drawImage(img, enc, m, clip, nil, nil)
+}
+
+// drawImage draws the image with the clipping path, decode array, and color key if not nil. The image must be downsampled already.
+func (w *pdfPageWriter) drawImage(img image.Image, enc canvas.ImageEncoding, m canvas.Matrix, clip *canvas.Path, decode []float64, colorKey []int) {
 	size := img.Bounds().Size()
 
-	// add clipping path around image for smooth edges when rotating
-	outerRect := canvas.Rect{0.0, 0.0, float64(size.X), float64(size.Y)}.Transform(m)
-	bl := m.Dot(canvas.Point{0, 0})
-	br := m.Dot(canvas.Point{float64(size.X), 0})
-	tl := m.Dot(canvas.Point{0, float64(size.Y)})
-	tr := m.Dot(canvas.Point{float64(size.X), float64(size.Y)})
-	fmt.Fprintf(w, " q %v %v %v %v re W n", dec(outerRect.X), dec(outerRect.Y), dec(outerRect.W), dec(outerRect.H))
-	fmt.Fprintf(w, " %v %v m %v %v l %v %v l %v %v l h W n", dec(bl.X), dec(bl.Y), dec(tl.X), dec(tl.Y), dec(tr.X), dec(tr.Y), dec(br.X), dec(br.Y))
+	fmt.Fprintf(w, " q")
+	if w.pdf.imgClip || !canvas.Equal(m[0][1], 0.0) || !canvas.Equal(m[1][0], 0.0) {
+		// add clipping path around image for smooth edges when rotating
+		outerRect := canvas.Rect{0.0, 0.0, float64(size.X), float64(size.Y)}.Transform(m)
+		bl := m.Dot(canvas.Point{0, 0})
+		br := m.Dot(canvas.Point{float64(size.X), 0})
+		tl := m.Dot(canvas.Point{0, float64(size.Y)})
+		tr := m.Dot(canvas.Point{float64(size.X), float64(size.Y)})
+		fmt.Fprintf(w, " %v %v %v %v re W n", dec(outerRect.X), dec(outerRect.Y), dec(outerRect.W), dec(outerRect.H))
+		fmt.Fprintf(w, " %v %v m %v %v l %v %v l %v %v l h W n", dec(bl.X), dec(bl.Y), dec(tl.X), dec(tl.Y), dec(tr.X), dec(tr.Y), dec(br.X), dec(br.Y))
+	}
+	if clip != nil && !clip.Empty() {
+		fmt.Fprintf(w, " %v W n", clip.ToPDF())
+	}
 
-	name := w.embedImage(img, enc)
+	name := w.embedImage(img, enc, decode, colorKey)
 	m = m.Scale(float64(size.X), float64(size.Y))
 	w.SetAlpha(1.0)
 	fmt.Fprintf(w, " %v %v %v %v %v %v cm /%v Do Q", dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]), name)
 }
 
-func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding) pdfName {
-	var stream pdfStream
-	if i, ok := img.(canvas.Image); ok && i.Mimetype == "image/jpeg" && 0 < len(i.Bytes) {
-		stream = w.jpegStream(i)
-	} else {
-		stream = w.imageStream(img)
+func (w *pdfPageWriter) DrawImageTiled(img image.Image, m canvas.Matrix, region *canvas.Path) {
+	if w.pdf.imgResolution != 0.0 {
+		img, m = downsampleImage(img, m, float64(w.pdf.imgResolution))
 	}
+	if region == nil || region.Empty() {
+		return
+	}
+	size := img.Bounds().Size()
 
-	ref := w.pdf.writeObject(stream)
+	// the pattern space is the default coordinate space of the page and not the current transformation
+	m = w.initialTransform().Mul(m)
+	w.pdf.requireVersion(1, 2, "tiling patterns")
+	ref := w.pdf.writeObject(w.pdf.flate(ContentStreams, pdfStream{
+		dict: pdfDict{
+			"Type":        pdfName("Pattern"),
+			"PatternType": 1,
+			"PaintType":   1,
+			"TilingType":  1,
+			"BBox":        pdfArray{0, 0, size.X, size.Y},
+			"XStep":       size.X,
+			"YStep":       size.Y,
+			"Matrix":      pdfArray{m[0][0], m[1][0], m[0][1], m[1][1], m[0][2], m[1][2]},
+			"Resources": pdfDict{
+				"XObject": pdfDict{"Im0": w.writeImage(img, canvas.Lossless, nil, nil)},
+			},
+		},
+		stream: []byte(fmt.Sprintf("%d 0 0 %d 0 0 cm /Im0 Do", size.X, size.Y)),
+	}))
+
+	if _, ok := w.resources["Pattern"]; !ok {
+		w.resources["Pattern"] = pdfDict{}
+	}
+	name := pdfName(fmt.Sprintf("P%d", len(w.resources["Pattern"].(pdfDict))))
+	w.resources["Pattern"].(pdfDict)[name] = ref
+
+	w.SetAlpha(1.0)
+	fmt.Fprintf(w, " q /Pattern cs /%v scn %v f Q", name, region.ToPDF())
+}
+
+// DrawAlphaMask paints the color through the luminance of the mask image. The mask image is drawn in a luminosity soft mask, which is set in the graphics state before filling the unit square of the image with the color.
+func (w *pdfPageWriter) DrawAlphaMask(mask image.Image, col color.RGBA, m canvas.Matrix) {
+	if w.pdf.imgResolution != 0.0 {
+		mask, m = downsampleImage(mask, m, float64(w.pdf.imgResolution))
+	}
+	if w.pdf.flatten {
+		if col.A != 0 {
+			w.drawImageMask(mask, col, m)
+		}
+		return
+	}
+	size := mask.Bounds().Size()
+	sp := mask.Bounds().Min // starting point
+	b := make([]byte, size.X*size.Y)
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			b[y*size.X+x] = color.GrayModel.Convert(mask.At(sp.X+x, sp.Y+y)).(color.Gray).Y
+		}
+	}
+	img := w.pdf.writeObject(w.pdf.flate(ImageStreams, pdfStream{
+		dict: pdfDict{
+			"Type":             pdfName("XObject"),
+			"Subtype":          pdfName("Image"),
+			"Width":            size.X,
+			"Height":           size.Y,
+			"ColorSpace":       pdfName("DeviceGray"),
+			"BitsPerComponent": 8,
+			"Interpolate":      true,
+		},
+		stream: b,
+	}))
+	w.pdf.images++
+
+	// the soft mask's group is drawn in the coordinate system at the time the graphics state is set
+	w.pdf.requireVersion(1, 4, "transparency")
+	group := w.pdf.writeObject(w.pdf.flate(ContentStreams, pdfStream{
+		dict: pdfDict{
+			"Type":    pdfName("XObject"),
+			"Subtype": pdfName("Form"),
+			"BBox":    pdfArray{0.0, 0.0, 1.0, 1.0},
+			"Group": pdfDict{
+				"Type": pdfName("Group"),
+				"S":    pdfName("Transparency"),
+				"CS":   pdfName("DeviceGray"),
+			},
+			"Resources": pdfDict{
+				"XObject": pdfDict{"Im0": img},
+			},
+		},
+		stream: []byte("/Im0 Do"),
+	}))
+	gs := w.pdf.writeObject(pdfDict{
+		"Type": pdfName("ExtGState"),
+		"SMask": pdfDict{
+			"Type": pdfName("Mask"),
+			"S":    pdfName("Luminosity"),
+			"G":    group,
+		},
+	})
+	if _, ok := w.resources["ExtGState"]; !ok {
+		w.resources["ExtGState"] = pdfDict{}
+	}
+	name := pdfName(fmt.Sprintf("M%d", len(w.resources["ExtGState"].(pdfDict))))
+	w.resources["ExtGState"].(pdfDict)[name] = gs
+
+	w.SetFillColor(col)
+	m = m.Scale(float64(size.X), float64(size.Y))
+	fmt.Fprintf(w, " q %v %v %v %v %v %v cm /%v gs 0 0 1 1 re f Q", dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]), name)
+}
+
+// drawImageMask paints the color through a 1-bit image mask, where coverage of at least one half is painted. It replaces the soft mask of DrawAlphaMask when flattening transparency.
+func (w *pdfPageWriter) drawImageMask(mask image.Image, col color.RGBA, m canvas.Matrix) {
+	size := mask.Bounds().Size()
+	sp := mask.Bounds().Min // starting point
+	stride := (size.X + 7) / 8
+	b := make([]byte, stride*size.Y)
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			if 128 <= color.GrayModel.Convert(mask.At(sp.X+x, sp.Y+y)).(color.Gray).Y {
+				b[y*stride+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	ref := w.pdf.writeObject(w.pdf.flate(ImageStreams, pdfStream{
+		dict: pdfDict{
+			"Type":      pdfName("XObject"),
+			"Subtype":   pdfName("Image"),
+			"Width":     size.X,
+			"Height":    size.Y,
+			"ImageMask": true,
+			"Decode":    pdfArray{1, 0}, // paint where bits are set
+		},
+		stream: b,
+	}))
+	w.pdf.images++
+	if _, ok := w.resources["XObject"]; !ok {
+		w.resources["XObject"] = pdfDict{}
+	}
+	name := pdfName(fmt.Sprintf("Im%d", len(w.resources["XObject"].(pdfDict))))
+	w.resources["XObject"].(pdfDict)[name] = ref
+
+	w.SetFillColor(col)
+	m = m.Scale(float64(size.X), float64(size.Y))
+	fmt.Fprintf(w, " q %v %v %v %v %v %v cm /%v Do Q", dec(m[0][0]), dec(m[1][0]), dec(m[0][1]), dec(m[1][1]), dec(m[0][2]), dec(m[1][2]), name)
+}
+
+// downsampleImage resizes the image when its resolution on the page exceeds the given resolution in dots-per-millimeter, and adjusts the transformation matrix accordingly. JPEG images that are embedded as is are encoded as JPEG again, so that they remain DCT compressed.
+func downsampleImage(img image.Image, m canvas.Matrix, resolution float64) (image.Image, canvas.Matrix) {
+	size := img.Bounds().Size()
+	width := float64(size.X) * math.Hypot(m[0][0], m[1][0])  // in mm
+	height := float64(size.Y) * math.Hypot(m[0][1], m[1][1]) // in mm
+	dstX := int(math.Ceil(width * resolution))
+	dstY := int(math.Ceil(height * resolution))
+	if size.X <= dstX && size.Y <= dstY || dstX == 0 || dstY == 0 {
+		return img, m
+	}
+	if size.X < dstX {
+		dstX = size.X
+	}
+	if size.Y < dstY {
+		dstY = size.Y
+	}
+
+	var dst draw.Image = image.NewRGBA(image.Rect(0, 0, dstX, dstY))
+	colorSpace, isJPEG := jpegColorSpace(img)
+	if colorSpace == "DeviceGray" {
+		dst = image.NewGray(dst.Bounds())
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	m = m.Scale(float64(size.X)/float64(dstX), float64(size.Y)/float64(dstY))
+
+	var imgDst image.Image = dst
+	if isJPEG && colorSpace != "DeviceCMYK" {
+		// the JPEG encoder does not support CMYK
+		buf := &bytes.Buffer{}
+		if err := jpeg.Encode(buf, dst, nil); err == nil {
+			if jpegDst, err := canvas.NewJPEGImage(buf); err == nil {
+				imgDst = jpegDst
+			}
+		}
+	}
+	if profile := imageICCProfile(img); iccComponents(profile) == imageColorComponents(imgDst) {
+		// keep the color profile of the original image
+		return ICCImage{imgDst, profile}, m
+	}
+	return imgDst, m
+}
+
+// embedImage writes the image and adds it to the page resources. The decode array, if not nil, overrides the default mapping of samples to color components, and the color key, if not nil, masks the samples within its ranges.
+func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding, decode []float64, colorKey []int) pdfName {
+	ref := w.writeImage(img, enc, decode, colorKey)
 	if _, ok := w.resources["XObject"]; !ok {
 		w.resources["XObject"] = pdfDict{}
 	}
@@ -966,17 +2460,105 @@ func (w *pdfPageWriter) embedImage(img image.Image, enc canvas.ImageEncoding) pd
 	return name
 }
 
-func (w *pdfPageWriter) jpegStream(img canvas.Image) pdfStream {
+// writeImage writes the image XObject without adding it to the page resources. Images with a color key are encoded losslessly, so that the masked samples are exact.
+func (w *pdfPageWriter) writeImage(img image.Image, enc canvas.ImageEncoding, decode []float64, colorKey []int) pdfRef {
+	var stream pdfStream
+	if colorSpace, ok := jpegColorSpace(img); ok {
+		stream = w.jpegStream(jpegImage(img), colorSpace)
+	} else if colorKey != nil {
+		stream = w.imageStream(img, canvas.Lossless)
+	} else {
+		stream = w.imageStream(img, enc)
+	}
+	if decode != nil {
+		if len(decode) != 2*colorComponents(stream.dict["ColorSpace"].(pdfName)) {
+			panic("decode array length must be twice the number of color components")
+		}
+		array := pdfArray{}
+		for _, v := range decode {
+			array = append(array, v)
+		}
+		stream.dict["Decode"] = array
+	}
+	if colorKey != nil {
+		if len(colorKey) != 2*colorComponents(stream.dict["ColorSpace"].(pdfName)) {
+			panic("color key length must be twice the number of color components")
+		}
+		array := pdfArray{}
+		for _, v := range colorKey {
+			array = append(array, v)
+		}
+		w.pdf.requireVersion(1, 3, "color key masking")
+		stream.dict["Mask"] = array
+	}
+	if profile := imageICCProfile(img); profile != nil && iccComponents(profile) == colorComponents(stream.dict["ColorSpace"].(pdfName)) {
+		stream.dict["ColorSpace"] = w.pdf.getICCProfile(profile)
+	}
+
+	ref := w.pdf.writeObject(stream)
+	w.pdf.images++
+	return ref
+}
+
+// jpegImage returns the image with its JPEG bytes, which may be wrapped by ICCImage.
+func jpegImage(img image.Image) canvas.Image {
+	switch i := img.(type) {
+	case ICCImage:
+		img = i.Image
+	case *ICCImage:
+		img = i.Image
+	}
+	i, _ := img.(canvas.Image)
+	return i
+}
+
+// jpegColorSpace returns the color space of a JPEG image that can be embedded as is, which excludes progressive JPEGs and unsupported color models.
+func jpegColorSpace(img image.Image) (pdfName, bool) {
+	i := jpegImage(img)
+	if i.Mimetype != "image/jpeg" || len(i.Bytes) == 0 {
+		return "", false
+	}
+
 	// ignore progressive jpeg (contains 0xff 0xc2 marker)
 	markerStarted := false
-	for _, b := range img.Bytes {
+	for _, b := range i.Bytes {
 		if markerStarted && b == 0xc2 {
-			// fallback to generic imageStream
-			return w.imageStream(img)
+			return "", false
 		}
 		markerStarted = (b == 0xff)
 	}
 
+	switch i.ColorModel() {
+	case color.GrayModel:
+		return pdfName("DeviceGray"), true
+	case color.YCbCrModel:
+		return pdfName("DeviceRGB"), true
+	case color.CMYKModel:
+		return pdfName("DeviceCMYK"), true
+	}
+	// unsupported JPEG color space, fallback to generic imageStream
+	return "", false
+}
+
+// imageColorComponents returns the number of color components of the image when embedded.
+func imageColorComponents(img image.Image) int {
+	if colorSpace, ok := jpegColorSpace(img); ok {
+		return colorComponents(colorSpace)
+	}
+	return 3
+}
+
+func colorComponents(colorSpace pdfName) int {
+	switch colorSpace {
+	case "DeviceGray":
+		return 1
+	case "DeviceCMYK":
+		return 4
+	}
+	return 3
+}
+
+func (w *pdfPageWriter) jpegStream(img canvas.Image, colorSpace pdfName) pdfStream {
 	size := img.Bounds().Size()
 	dict := pdfDict{
 		"Type":    pdfName("XObject"),
@@ -984,24 +2566,13 @@ func (w *pdfPageWriter) jpegStream(img canvas.Image) pdfStream {
 		"Width":   size.X,
 		"Height":  size.Y,
 
-		// "ColorSpace":       will be set below
+		"ColorSpace":       colorSpace,
 		"BitsPerComponent": 8, // bpc
 		// "Interpolate":      true,
 		"Filter": pdfFilterDCT, // f
 	}
-
-	switch img.ColorModel() {
-	case color.GrayModel:
-		dict["ColorSpace"] = pdfName("DeviceGray")
-	case color.YCbCrModel:
-		dict["ColorSpace"] = pdfName("DeviceRGB")
-	case color.CMYKModel:
-		dict["ColorSpace"] = pdfName("DeviceCMYK")
+	if colorSpace == "DeviceCMYK" {
 		dict["Decode"] = pdfArray([]interface{}{1, 0, 1, 0, 1, 0, 1, 0})
-	default:
-		// fallback to generic imageStream
-		// fmt.Errorf("unsupported JPEG-color space: %s", img.ColorModel())
-		return w.imageStream(img)
 	}
 
 	return pdfStream{
@@ -1010,7 +2581,8 @@ func (w *pdfPageWriter) jpegStream(img canvas.Image) pdfStream {
 	}
 }
 
-func (w *pdfPageWriter) imageStream(img image.Image) pdfStream {
+// imageStream returns the image as an RGB image stream with a soft mask for transparency, which is compressed with Flate or encoded as JPEG for lossy encoding.
+func (w *pdfPageWriter) imageStream(img image.Image, enc canvas.ImageEncoding) pdfStream {
 	size := img.Bounds().Size()
 	sp := img.Bounds().Min // starting point
 	b := make([]byte, size.X*size.Y*3)
@@ -1020,11 +2592,17 @@ func (w *pdfPageWriter) imageStream(img image.Image) pdfStream {
 		for x := 0; x < size.X; x++ {
 			i := (y*size.X + x) * 3
 			R, G, B, A := img.At(sp.X+x, sp.Y+y).RGBA()
-			if A != 0 {
-				b[i+0] = byte((R * 65535 / A) >> 8)
-				b[i+1] = byte((G * 65535 / A) >> 8)
-				b[i+2] = byte((B * 65535 / A) >> 8)
-				bMask[y*size.X+x] = byte(A >> 8)
+			if w.pdf.flatten {
+				// composite against white
+				b[i+0] = byte((R + 0xffff - A) >> 8)
+				b[i+1] = byte((G + 0xffff - A) >> 8)
+				b[i+2] = byte((B + 0xffff - A) >> 8)
+				continue
+			} else if A != 0 {
+				b[i+0] = unpremultiply(R, A)
+				b[i+1] = unpremultiply(G, A)
+				b[i+2] = unpremultiply(B, A)
+				bMask[y*size.X+x] = byte((A*255 + 32767) / 65535)
 			}
 			if A>>8 != 255 {
 				hasMask = true
@@ -1040,11 +2618,11 @@ func (w *pdfPageWriter) imageStream(img image.Image) pdfStream {
 		"ColorSpace":       pdfName("DeviceRGB"),
 		"BitsPerComponent": 8,
 		"Interpolate":      true,
-		"Filter":           pdfFilterFlate,
 	}
 
 	if hasMask {
-		dict["SMask"] = w.pdf.writeObject(pdfStream{
+		w.pdf.requireVersion(1, 4, "transparency")
+		dict["SMask"] = w.pdf.writeObject(w.pdf.flate(ImageStreams, pdfStream{
 			dict: pdfDict{
 				"Type":             pdfName("XObject"),
 				"Subtype":          pdfName("Image"),
@@ -1053,17 +2631,53 @@ func (w *pdfPageWriter) imageStream(img image.Image) pdfStream {
 				"ColorSpace":       pdfName("DeviceGray"),
 				"BitsPerComponent": 8,
 				"Interpolate":      true,
-				"Filter":           pdfFilterFlate,
 			},
 			stream: bMask,
-		})
+		}))
+	}
+
+	if enc == canvas.Lossy {
+		rgb := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		for i := 0; i < size.X*size.Y; i++ {
+			copy(rgb.Pix[4*i:], b[3*i:3*i+3])
+			rgb.Pix[4*i+3] = 255
+		}
+		buf := &bytes.Buffer{}
+		if err := jpeg.Encode(buf, rgb, nil); err == nil {
+			dict["Filter"] = pdfFilterDCT
+			return pdfStream{
+				dict:   dict,
+				stream: buf.Bytes(),
+			}
+		}
 	}
 
 	// TODO: (PDF) implement JPXFilter for lossy image compression
-	return pdfStream{
+	return w.pdf.flate(ImageStreams, pdfStream{
 		dict:   dict,
 		stream: b,
+	})
+}
+
+// textMode returns the text rendering mode for text filled with the given color, which is invisible for transparent colors when transparency is flattened since they would be flattened to white.
+func (w *pdfPageWriter) textMode(col color.RGBA, mode int) int {
+	if w.pdf.flatten && col.A == 0 {
+		return 3
 	}
+	return mode
+}
+
+// flattenColor returns the opaque color of the premultiplied color composited against white.
+func flattenColor(c color.RGBA) color.RGBA {
+	return color.RGBA{c.R + 255 - c.A, c.G + 255 - c.A, c.B + 255 - c.A, 255}
+}
+
+// unpremultiply returns the 8-bit color component from a 16-bit alpha-premultiplied color component and its non-zero alpha. It rounds instead of truncates to avoid banding for nearly transparent colors, and clamps colors that are brighter than their alpha.
+func unpremultiply(c, a uint32) byte {
+	if a <= c {
+		return 255
+	}
+	return byte((c*255 + a/2) / a)
 }
 
 func (w *pdfPageWriter) getOpacityGS(a float64) pdfName {
@@ -1076,9 +2690,6 @@ func (w *pdfPageWriter) getOpacityGS(a float64) pdfName {
 	if _, ok := w.resources["ExtGState"]; !ok {
 		w.resources["ExtGState"] = pdfDict{}
 	}
-	w.resources["ExtGState"].(pdfDict)[name] = pdfDict{
-		"CA": a,
-		"ca": a,
-	}
+	w.resources["ExtGState"].(pdfDict)[name] = w.pdf.getOpacityGS(a)
 	return name
 }
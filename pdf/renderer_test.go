@@ -2,11 +2,24 @@ package pdf
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
 	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/tdewolff/canvas"
+	canvasFont "github.com/tdewolff/canvas/font"
 	"github.com/tdewolff/test"
 )
 
@@ -84,6 +97,1216 @@ func TestPDFText(t *testing.T) {
 	//test.String(t, pdf.String(), " BT /F0 8 Tf 0 -7.421875 Td[(\x00G\x00H\x00M\x00D\x009) 63 (\x00X\x00\x1B)]TJ 1 0 0 rg 1 0 .3 1 0 -20.453125 Tm 1 Tc[(\x00J\x00O\x00\\\x00S\x00K\x00V\x00S\x00D\x00F\x00L\x00Q\x00J)]TJ 0 g 1 0 0 1 0 -29.765625 Tm 0 Tc 2 Tr .27984 w[(\x00G\x00H\x00M\x00D\x009) 63 (\x00X\x00\x14\x00\x15\x00V\x00X\x00E)]TJ /F1 10 Tf 0 -8.734375 Td .4 w[(\x00H\x00B\x00S\x00B\x00N\x00P\x00O\x00E\x00\x12\x00\x11)]TJ ET 1 0 0 rg 0 -22.703125 m 91.71875 -22.703125 l 91.71875 -21.803125 l 0 -21.803125 l f")
 }
 
+// extractText extracts the text of all TJ operators using the ToUnicode CMaps, where the strings within a TJ operator are separated by spaces as done by some text extractors.
+func extractText(out string) string {
+	toUnicode := map[uint16]rune{}
+	for _, m := range regexp.MustCompile(`<([0-9A-F]{4})> <([0-9A-F]{4})>\n`).FindAllStringSubmatch(out, -1) {
+		var cid, r uint16
+		fmt.Sscanf(m[1], "%X", &cid)
+		fmt.Sscanf(m[2], "%X", &r)
+		toUnicode[cid] = rune(r)
+	}
+
+	words := []string{}
+	for _, tj := range regexp.MustCompile(`(?s)\[(.*?)\]TJ`).FindAllStringSubmatch(out, -1) {
+		for _, str := range regexp.MustCompile(`\(((?:\\.|[^\\)])*)\)`).FindAllStringSubmatch(tj[1], -1) {
+			s := regexp.MustCompile(`(?s)\\(.)`).ReplaceAllString(str[1], "$1")
+			rs := []rune{}
+			for i := 0; i+1 < len(s); i += 2 {
+				rs = append(rs, toUnicode[binary.BigEndian.Uint16([]byte(s[i:]))])
+			}
+			words = append(words, string(rs))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func TestPDFFlattenTransparency(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{128, 0, 0, 128})
+	img.SetRGBA(1, 0, color.RGBA{0, 0, 255, 255})
+	mask := image.NewAlpha(image.Rect(0, 0, 9, 1))
+	mask.SetAlpha(0, 0, color.Alpha{255})
+	mask.SetAlpha(8, 0, color.Alpha{128})
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetCompression(false)
+	pdf.SetStreamCompression(ImageStreams, false)
+	pdf.SetFlattenTransparency(true)
+	style := canvas.DefaultStyle
+	style.FillColor = color.RGBA{0, 0, 128, 128}
+	style.StrokeColor = color.RGBA{64, 64, 64, 128}
+	style.StrokeWidth = 1.0
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), style, canvas.Identity)
+	pdf.RenderImage(img, canvas.Identity)
+	pdf.RenderAlphaMask(mask, color.RGBA{0, 128, 0, 128}, canvas.Identity)
+	test.Error(t, pdf.Close())
+	s := buf.String()
+
+	test.That(t, strings.Contains(s, " .49803922 .49803922 1 rg .74901961 G "), "flattened colors")
+	test.That(t, strings.Contains(s, "stream\n\xff\x7f\x7f\x00\x00\xff\nendstream"), "flattened image")
+	test.That(t, strings.Contains(s, "/Decode [1 0] /Height 1 /ImageMask true"), "image mask")
+	test.That(t, strings.Contains(s, "stream\n\x80\x80\nendstream"), "image mask data")
+	test.That(t, strings.Contains(s, " .49803922 1 .49803922 rg q 9 0 0 1 0 0 cm /Im1 Do Q"), "image mask content")
+	for _, key := range []string{"/SMask", "/ExtGState", "/Group", "/ca "} {
+		test.That(t, !strings.Contains(s, key), key)
+	}
+}
+
+func TestPDFFlattenTransparentText(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	test.Error(t, dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular))
+	transparent := dejaVuSerif.Face(12.0, canvas.Transparent, canvas.FontRegular, canvas.FontNormal)
+	black := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	// transparent text is invisible instead of white
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.SetFlattenTransparency(true)
+	pdf.RenderText(canvas.NewTextLine(transparent, "a", canvas.Left), canvas.Identity)
+	pdf.RenderText(canvas.NewTextLine(black, "a", canvas.Left), canvas.Identity)
+	pdf.RenderAlphaMask(image.NewAlpha(image.Rect(0, 0, 1, 1)), canvas.Transparent, canvas.Identity)
+	out := pdf.w.String()
+	test.That(t, strings.Contains(out, " 3 Tr["), out)
+	test.That(t, strings.Contains(out, " 0 g 0 Tr["), out)
+	test.That(t, !strings.Contains(out, " Do"), out)
+}
+
+func TestPDFWordKerning(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	test.Error(t, dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular))
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	render := func(wordKerning bool) string {
+		buf := &bytes.Buffer{}
+		pdf := New(buf, 210.0, 297.0)
+		pdf.SetCompression(false)
+		pdf.SetStreamCompression(FontStreams, false)
+		pdf.SetFontSubsetting(true)
+		pdf.SetWordKerning(wordKerning)
+		pdf.RenderText(canvas.NewTextLine(face, "Waterfall", canvas.Left), canvas.Identity)
+		test.Error(t, pdf.Close())
+		return buf.String()
+	}
+
+	out := render(false)
+	test.That(t, extractText(out) != "Waterfall", "word must be split for kerning")
+
+	out = render(true)
+	test.T(t, extractText(out), "Waterfall")
+	test.That(t, regexp.MustCompile(`\[\([^)]*\) -?\d+\]TJ`).MatchString(out), "kerning after the word")
+}
+
+func TestPDFMeasureText(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	width := pdf.MeasureText(face.Font, face.Size, "AVAV text")
+	test.That(t, math.Abs(width-face.TextWidth("AVAV text")) < 0.1, width) // TextWidth rounds to 26.6 fixed point
+	test.That(t, width < pdf.MeasureText(face.Font, face.Size, "AV")+pdf.MeasureText(face.Font, face.Size, "AV text"), "kerning must be applied")
+	test.Float(t, pdf.MeasureText(face.Font, face.Size, ""), 0.0)
+}
+
+func TestPDFMeasureTextGPOS(t *testing.T) {
+	b, err := ioutil.ReadFile("../font/DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := canvasFont.ParseSFNT(b)
+	test.Error(t, err)
+
+	// kern 'o' followed by 'l' by -100 font units in the GPOS table only
+	glyphO, glyphL := sfnt.GlyphIndex('o'), sfnt.GlyphIndex('l')
+	gpos := &bytes.Buffer{}
+	binary.Write(gpos, binary.BigEndian, []uint16{
+		1, 0, 0, 10, 24, // header
+		1, 'k'<<8 | 'e', 'r'<<8 | 'n', 8, // feature list
+		0, 1, 0, // kern feature
+		1, 4, // lookup list
+		2, 0, 1, 8, // pair adjustment lookup
+		1, 12, 0x0004, 0, 1, 18, // pair adjustment subtable with advance of the first glyph
+		1, 1, glyphO, // coverage
+		1, glyphL, 0xFF9C, // pair set
+	})
+	b = addSFNTTables(b, map[string][]byte{"GPOS": gpos.Bytes()})
+
+	family := canvas.NewFontFamily("gpos")
+	test.Error(t, family.LoadFont(b, canvas.FontRegular))
+	face := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	units := face.Font.UnitsPerEm()
+	kern := pdf.MeasureText(face.Font, face.Size, "ol") - pdf.MeasureText(face.Font, face.Size, "o") - pdf.MeasureText(face.Font, face.Size, "l")
+	test.Float(t, kern, -100.0*face.Size/units)
+
+	// the rendered text is kerned by the same amount
+	pdf.RenderText(canvas.NewTextLine(face, "ol", canvas.Left), canvas.Identity)
+	TJ := fmt.Sprintf("[(%s) %d (%s)]TJ", pdfGlyphIDString([]uint16{glyphO}), glyphSpace(100.0, units), pdfGlyphIDString([]uint16{glyphL}))
+	test.That(t, strings.Contains(pdf.w.String(), TJ), pdf.w.String())
+}
+
+func TestPDFTextFauxItalicRotated(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontItalic, canvas.FontNormal)
+	test.That(t, face.FauxItalic != 0.0)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.RenderText(canvas.NewTextLine(face, "a", canvas.Left), canvas.Identity.Rotate(45.0))
+
+	// the slant is applied in glyph space, so the glyph's vertical axis is sheared relative to the rotated baseline
+	m := pdf.w.textPosition
+	x := canvas.Point{X: m[0][0], Y: m[1][0]}
+	y := canvas.Point{X: m[0][1], Y: m[1][1]}
+	test.Float(t, x.Angle()*180.0/math.Pi, 45.0)
+	test.Float(t, x.Dot(y)/x.Length()/x.Length(), face.FauxItalic)
+	test.Float(t, x.PerpDot(y)/x.Length()/x.Length(), 1.0)
+}
+
+func TestPDFTextCharSpaceScaled(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	faceSub := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontSubscript)
+	test.That(t, faceSub.Scale != 1.0)
+
+	// the same tracking must result in the same Tc for scaled and unscaled spans, as Tc is not scaled by the font size
+	pdf := newPDFWriter(&bytes.Buffer{}).NewPage(210.0, 297.0)
+	pdf.StartTextObject()
+	pdf.SetFont(face.Font, face.Size*face.Scale)
+	pdf.SetTextCharSpace(1.0)
+	pdf.WriteText("a")
+	pdf.SetFont(faceSub.Font, faceSub.Size*faceSub.Scale)
+	pdf.SetTextCharSpace(1.0)
+	pdf.WriteText("a")
+	pdf.EndTextObject()
+	test.String(t, pdf.String(), " 2.8346457 0 0 2.8346457 0 0 cm BT /F0 4.2333333 Tf 1 Tc[(\x00D)]TJ /F0 2.4680333 Tf[(\x00D)]TJ ET")
+}
+
+func TestPDFGlyphs(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	ids := face.Font.IndicesOf("abc")
+	widths := glyphWidths(face.Font)
+	advance := func(id uint16) float64 {
+		return float64(widths[id]) * face.Size / 1000.0
+	}
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderGlyphs(face.Font, face.Size, []Glyph{
+		{ID: ids[0], XAdvance: advance(ids[0])},
+		{ID: ids[1], XAdvance: advance(ids[1]) + 1.0},
+		{ID: ids[2], XAdvance: advance(ids[2]), YOffset: 1.0},
+		{ID: ids[0], XAdvance: advance(ids[0])},
+	}, canvas.Black, canvas.Identity.Translate(10.0, 10.0))
+	test.String(t, pdf.w.String(), fmt.Sprintf(" 2.8346457 0 0 2.8346457 0 0 cm BT /F0 4.2333333 Tf 10 10 Td[(\x00D\x00E) -236]TJ %v 1 Td[(\x00F)]TJ %v -1 Td[(\x00D)]TJ ET", dec(advance(ids[0])+advance(ids[1])+1.0), dec(advance(ids[2]))))
+}
+
+func TestPDFGlyphsToUnicode(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	test.Error(t, dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular))
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	widths := glyphWidths(face.Font)
+	glyphs := []Glyph{}
+	for i, id := range face.Font.IndicesOf("ab") {
+		glyphs = append(glyphs, Glyph{ID: id, Rune: rune("ab"[i]), XAdvance: float64(widths[id]) * face.Size / 1000.0})
+	}
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 20.0, 10.0)
+	pdf.SetCompression(false)
+	pdf.SetStreamCompression(FontStreams, false)
+	pdf.SetFontSubsetting(true)
+	pdf.SetThumbnailSize(20)
+	pdf.RenderGlyphs(face.Font, face.Size, glyphs, canvas.Black, canvas.Identity.Translate(2.0, 2.0))
+
+	// glyphs are drawn on the thumbnail
+	drawn := false
+	img := pdf.w.thumbnailImg
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 255 {
+			drawn = true
+		}
+	}
+	test.That(t, drawn, "thumbnail")
+
+	test.Error(t, pdf.Close())
+	test.T(t, extractText(buf.String()), "ab")
+}
+
+func TestPDFGlyphsColored(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	ids := face.Font.IndicesOf("abc")
+	widths := glyphWidths(face.Font)
+	glyphs := []Glyph{}
+	for _, id := range ids {
+		glyphs = append(glyphs, Glyph{ID: id, XAdvance: float64(widths[id]) * face.Size / 1000.0})
+	}
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderGlyphsColored(face.Font, face.Size, glyphs, []color.RGBA{canvas.Red, canvas.Red, canvas.Blue}, canvas.Identity.Translate(10.0, 10.0))
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm BT 1 0 0 rg /F0 4.2333333 Tf 10 10 Td[(\x00D\x00E)]TJ 0 0 1 rg[(\x00F)]TJ ET")
+
+	defer func() {
+		test.That(t, recover() != nil, "must panic for a different number of colors")
+	}()
+	pdf.RenderGlyphsColored(face.Font, face.Size, glyphs, []color.RGBA{canvas.Red}, canvas.Identity)
+}
+
+func TestPDFGlyphsAt(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	ids := face.Font.IndicesOf("ab")
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderGlyphsAt(face.Font, face.Size, ids, []canvas.Matrix{
+		canvas.Identity.Translate(10.0, 10.0),
+		canvas.Identity.Translate(12.0, 11.0).Rotate(90.0),
+	}, canvas.Black)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm BT /F0 4.2333333 Tf 10 10 Td[(\x00D)]TJ 0 1 -1 0 12 11 Tm[(\x00E)]TJ ET")
+
+	defer func() {
+		test.That(t, recover() != nil, "must panic for a different number of matrices")
+	}()
+	pdf.RenderGlyphsAt(face.Font, face.Size, ids, []canvas.Matrix{canvas.Identity}, canvas.Black)
+}
+
+func TestPDFLanguage(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	faceFr := face
+	faceFr.Language = "fr-FR"
+
+	rt := canvas.NewRichText()
+	rt.Add(face, "a")
+	rt.Add(faceFr, "b")
+	text := rt.ToText(0.0, 0.0, canvas.Left, canvas.Top, 0.0, 0.0)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetLanguage("en-US")
+	pdf.SetTagged(true)
+	pdf.RenderText(text, canvas.Identity)
+	test.That(t, strings.Contains(pdf.w.String(), "TJ /Span <</Lang (fr-FR)>> BDC"), pdf.w.String())
+	test.That(t, strings.HasSuffix(pdf.w.String(), "TJ EMC ET EMC"), pdf.w.String())
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "/Lang (en-US)"), "document language")
+}
+
+func TestPDFMissingGlyph(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	var missing []rune
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.SetMissingGlyphFunc(func(font *canvas.Font, r rune) {
+		test.That(t, font == face.Font)
+		missing = append(missing, r)
+	})
+	pdf.RenderText(canvas.NewTextLine(face, "a中b文", canvas.Left), canvas.Identity)
+	test.T(t, missing, []rune{'中', '文'})
+
+	// control characters, whitespace, and formatting characters are not rendered
+	missing = missing[:0]
+	pdf.RenderText(canvas.NewTextLine(face, "a\x01b\u2066c\u2069\u3000d\t", canvas.Left), canvas.Identity)
+	test.T(t, len(missing), 0)
+	test.Error(t, pdf.Close())
+}
+
+func TestPDFSupplementaryPlane(t *testing.T) {
+	b, err := ioutil.ReadFile("../font/DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := canvasFont.ParseSFNT(b)
+	test.Error(t, err)
+
+	// map the supplementary-plane runes U+1F600 and U+2A700 to the glyphs of 'o' and 'l'
+	glyphO, glyphL := sfnt.GlyphIndex('o'), sfnt.GlyphIndex('l')
+	cmap, err := canvasFont.BuildCmap(map[rune]uint16{'a': sfnt.GlyphIndex('a'), 0x1F600: glyphO, 0x2A700: glyphL})
+	test.Error(t, err)
+	b = addSFNTTables(b, map[string][]byte{"cmap": cmap})
+
+	family := canvas.NewFontFamily("supplementary")
+	test.Error(t, family.LoadFont(b, canvas.FontRegular))
+	face := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetCompression(false)
+	pdf.SetStreamCompression(FontStreams, false)
+	pdf.RenderText(canvas.NewTextLine(face, "a\U0001F600\U0002A700", canvas.Left), canvas.Identity)
+	test.That(t, strings.Contains(pdf.w.String(), "[("+pdfGlyphIDString([]uint16{sfnt.GlyphIndex('a'), glyphO, glyphL})+")]TJ"), pdf.w.String())
+	test.Error(t, pdf.Close())
+
+	out := buf.String()
+	test.That(t, strings.Contains(out, fmt.Sprintf("3 beginbfchar\n<%04X> <0061>\n", sfnt.GlyphIndex('a'))), "ToUnicode of BMP rune")
+	test.That(t, strings.Contains(out, fmt.Sprintf("<%04X> <D83DDE00>\n", glyphO)), "ToUnicode of U+1F600")
+	test.That(t, strings.Contains(out, fmt.Sprintf("<%04X> <D869DF00>\n", glyphL)), "ToUnicode of U+2A700")
+}
+
+func TestPDFFontSubsetting(t *testing.T) {
+	b, err := ioutil.ReadFile("../font/DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := canvasFont.ParseSFNT(b)
+	test.Error(t, err)
+
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	test.Error(t, dejaVuSerif.LoadFont(b, canvas.FontRegular))
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	text := "Wörld-Ünïcødé!"
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetCompression(false)
+	pdf.SetStreamCompression(FontStreams, false)
+	pdf.SetFontSubsetting(true)
+	pdf.RenderText(canvas.NewTextLine(face, text, canvas.Left), canvas.Identity)
+	test.Error(t, pdf.Close())
+	out := buf.String()
+	test.That(t, strings.Contains(out, "/CIDToGIDMap /Identity"))
+	test.That(t, regexp.MustCompile(`/BaseFont /[A-Z]{6}\+`).MatchString(out), "subset tag")
+
+	// extract the CIDs from the content stream
+	cids := []uint16{}
+	for _, tj := range regexp.MustCompile(`(?s)\[(.*?)\]TJ`).FindAllStringSubmatch(out, -1) {
+		for _, str := range regexp.MustCompile(`\(((?:\\.|[^\\)])*)\)`).FindAllStringSubmatch(tj[1], -1) {
+			s := regexp.MustCompile(`(?s)\\(.)`).ReplaceAllString(str[1], "$1")
+			for i := 0; i+1 < len(s); i += 2 {
+				cids = append(cids, binary.BigEndian.Uint16([]byte(s[i:])))
+			}
+		}
+	}
+
+	// map CIDs back to text using the ToUnicode CMap
+	toUnicode := map[uint16]rune{}
+	for _, m := range regexp.MustCompile(`<([0-9A-F]{4})> <([0-9A-F]{4})>\n`).FindAllStringSubmatch(out, -1) {
+		var cid, r uint16
+		fmt.Sscanf(m[1], "%X", &cid)
+		fmt.Sscanf(m[2], "%X", &r)
+		toUnicode[cid] = rune(r)
+	}
+	rs := []rune{}
+	for _, cid := range cids {
+		rs = append(rs, toUnicode[cid])
+	}
+	test.T(t, string(rs), text)
+
+	// CIDs are glyph IDs of the embedded subset, which has the same outlines and widths
+	m := regexp.MustCompile(`/Length1 (\d+)[^\n]*?stream\n`).FindStringSubmatchIndex(out)
+	test.That(t, m != nil, "FontFile2")
+	var length int
+	fmt.Sscanf(out[m[2]:m[3]], "%d", &length)
+	subset, err := canvasFont.ParseSFNT([]byte(out[m[1] : m[1]+length]))
+	test.Error(t, err)
+	for i, r := range []rune(text) {
+		d, err := sfnt.GlyphSVGPath(sfnt.GlyphIndex(r))
+		test.Error(t, err)
+		cid := cids[i]
+		subsetD, err := subset.GlyphSVGPath(cid)
+		test.Error(t, err)
+		test.T(t, subsetD, d, string(r))
+		test.T(t, subset.GlyphAdvance(cid), sfnt.GlyphAdvance(sfnt.GlyphIndex(r)))
+	}
+	test.T(t, subset.Maxp.NumGlyphs, uint16(21)) // .notdef, 13 used glyphs, and 7 components of accented glyphs
+}
+
+func TestPDFStreamCompression(t *testing.T) {
+	render := func(setup func(pdf *PDF)) string {
+		buf := &bytes.Buffer{}
+		pdf := New(buf, 210.0, 297.0)
+		setup(pdf)
+		pdf.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.DefaultStyle, canvas.Identity)
+		pdf.RenderImage(image.NewGray(image.Rect(0, 0, 2, 2)), canvas.Identity)
+		test.Error(t, pdf.Close())
+		return buf.String()
+	}
+
+	// by default images are compressed but content streams are not
+	out := render(func(pdf *PDF) {})
+	test.That(t, strings.Contains(out, "/Im0 Do"), "uncompressed content")
+	test.That(t, strings.Contains(out, "/Subtype /Image /BitsPerComponent 8 /ColorSpace /DeviceRGB /Filter /FlateDecode"), "compressed image")
+
+	out = render(func(pdf *PDF) {
+		pdf.SetCompression(true)
+		pdf.SetStreamCompression(ImageStreams, false)
+	})
+	test.That(t, !strings.Contains(out, "/Im0 Do"), "compressed content")
+	test.That(t, strings.Contains(out, "/Subtype /Image /BitsPerComponent 8 /ColorSpace /DeviceRGB /Height 2"), "uncompressed image")
+
+	// SetCompression only applies to content streams, and unknown stream types are ignored
+	out = render(func(pdf *PDF) {
+		pdf.SetCompression(false)
+		pdf.SetStreamCompression(StreamType(-1), false)
+		pdf.SetStreamCompression(StreamType(3), false)
+	})
+	test.That(t, strings.Contains(out, "/Im0 Do"), "uncompressed content")
+	test.That(t, strings.Contains(out, "/Subtype /Image /BitsPerComponent 8 /ColorSpace /DeviceRGB /Filter /FlateDecode"), "compressed image")
+}
+
+func TestPDFTransparentColor(t *testing.T) {
+	pdf := newPDFWriter(&bytes.Buffer{}).NewPage(210.0, 297.0)
+	pdf.SetFillColor(canvas.Transparent)
+	pdf.SetStrokeColor(canvas.Transparent)
+	pdf.SetFillColor(canvas.Red)
+	test.String(t, pdf.String(), " 2.8346457 0 0 2.8346457 0 0 cm /A0 gs 1 0 0 rg /A1 gs")
+	test.That(t, !strings.Contains(pdf.String(), "NaN") && !strings.Contains(pdf.String(), "Inf"))
+}
+
+func TestPDFGraphicsState(t *testing.T) {
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.SetLineWidth(2.0)
+	pdf.SetLineWidth(2.0)
+	pdf.SetLineCap(canvas.RoundCapper{})
+	pdf.SetLineJoin(canvas.BevelJoiner{})
+	pdf.SetMiterLimit(4.0)
+	pdf.SetDashPattern(1.0, []float64{2.0, 3.0})
+	pdf.SetDashPattern(1.0, []float64{2.0, 3.0})
+	pdf.SetDashPattern(0.0, nil)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm 2 w 1 J 2 j 4 M [2 3] 1 d [] 0 d")
+
+	// the caller's slice is neither modified nor retained
+	pdf = New(&bytes.Buffer{}, 210.0, 297.0)
+	dashes := append(make([]float64, 0, 3), 2.0, 3.0)
+	pdf.SetDashPattern(1.0, dashes)
+	test.T(t, dashes[:3], []float64{2.0, 3.0, 0.0})
+	dashes[0] = 4.0
+	pdf.SetDashPattern(1.0, []float64{2.0, 3.0})
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm [2 3] 1 d")
+}
+
+func TestPDFDashReset(t *testing.T) {
+	path := &canvas.Path{}
+	path.MoveTo(0.0, 0.0)
+	path.LineTo(5.0, 0.0)
+	path.MoveTo(0.0, 2.0)
+	path.LineTo(5.0, 2.0)
+
+	style := canvas.DefaultStyle
+	style.FillColor = canvas.Transparent
+	style.StrokeColor = canvas.Black
+	style.StrokeWidth = 1.0
+	style.Dashes = []float64{2.0, 1.0}
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderPath(path, style, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm 2 M [2 1] 0 d 0 0 m 5 0 l 0 2 m 5 2 l S")
+
+	// each segment starts with a full dash
+	pdf = New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.SetDashReset(true)
+	pdf.RenderPath(path, style, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm 2 M [2 1] 0 d 0 0 m 5 0 l S 0 2 m 5 2 l S")
+
+	// fill and stroke are drawn separately
+	style.FillColor = canvas.Red
+	pdf = New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.SetDashReset(true)
+	pdf.RenderPath(path, style, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm 1 0 0 rg 0 0 m 5 0 l 0 2 m 5 2 l f 2 M [2 1] 0 d 0 0 m 5 0 l S 0 2 m 5 2 l S")
+}
+
+func TestPDFUserUnit(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetUserUnit(10.0)
+	pdf.AddSquareAnnotation(canvas.Rect{X: 10.0, Y: 10.0, W: 20.0, H: 20.0}, 0.0, canvas.Black, canvas.Transparent)
+	test.String(t, pdf.w.String(), " .28346457 0 0 .28346457 0 0 cm")
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "/MediaBox [0 0 59.527559 84.188976]"), s)
+	test.That(t, strings.Contains(s, "/UserUnit 10"), s)
+	test.That(t, strings.Contains(s, "/Rect [2.8346457 2.8346457 8.503937 8.503937]"), s)
+}
+
+func TestPDFBaseTransform(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetBaseTransform(canvas.Identity.ReflectYAbout(297.0 / 2.0))
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 -2.8346457 0 841.88976 cm")
+	pdf.AddSquareAnnotation(canvas.Rect{X: 10.0, Y: 10.0, W: 20.0, H: 20.0}, 0.0, canvas.Black, canvas.Transparent)
+	pdf.NewPage(210.0, 297.0)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 -2.8346457 0 841.88976 cm")
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "/Rect [28.346457 756.85039 85.03937 813.54331]"), s)
+}
+
+func TestPDFFontFile(t *testing.T) {
+	var tts = []struct {
+		filename string
+		fontfile string
+		stream   string
+	}{
+		{"../font/DejaVuSerif.ttf", "/FontFile2 4 0 R", "/Length1 "},
+		{"../font/EBGaramond12-Regular.otf", "/FontFile3 4 0 R", "/Subtype /OpenType"},
+	}
+	for _, tt := range tts {
+		t.Run(tt.filename, func(t *testing.T) {
+			family := canvas.NewFontFamily("font")
+			err := family.LoadFontFile(tt.filename, canvas.FontRegular)
+			test.Error(t, err)
+			face := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+			buf := &bytes.Buffer{}
+			pdf := New(buf, 210.0, 297.0)
+			pdf.RenderText(canvas.NewTextLine(face, "a", canvas.Left), canvas.Identity)
+			test.Error(t, pdf.Close())
+			s := buf.String()
+			test.That(t, strings.Contains(s, tt.fontfile), "font file entry in font descriptor")
+			fontfile := s[strings.Index(s, "4 0 obj"):]
+			fontfile = fontfile[:strings.Index(fontfile, "stream")]
+			test.That(t, strings.Contains(fontfile, tt.stream), fontfile)
+		})
+	}
+}
+
+func TestPDFGlyphSpace(t *testing.T) {
+	test.T(t, glyphSpace(1500.0, 2000.0), 750)
+	test.T(t, glyphSpace(1000.0, 1024.0), 977)
+	test.T(t, glyphSpace(-15.0, 2048.0), -7)
+	test.T(t, glyphSpace(-31.0, 2048.0), -15)
+
+	// advances of a 2048 units-per-em font must be exact to half a glyph space unit, also summed over a line
+	family := canvas.NewFontFamily("dejavu-serif")
+	err := family.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	font := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal).Font
+	units := font.UnitsPerEm()
+	test.T(t, units, 2048.0)
+
+	exactWidths := font.Widths(units)
+	widths := glyphWidths(font)
+	exact, total := 0.0, 0
+	for _, index := range font.IndicesOf("The quick brown fox jumps over the lazy dog") {
+		exact += exactWidths[index] * 1000.0 / units
+		total += widths[index]
+		test.That(t, math.Abs(float64(widths[index])-exactWidths[index]*1000.0/units) <= 0.5, "glyph", index)
+	}
+	test.That(t, math.Abs(float64(total)-exact) < 3.0, "line advance", total, exact)
+}
+
+func TestPDFWidthArray(t *testing.T) {
+	var tts = []struct {
+		widths []int
+		DW     int
+		W      string
+	}{
+		{[]int{}, 0, "[]"},
+		{[]int{5, 5, 5}, 5, "[]"},
+		{[]int{0, 5, 5, 5, 6, 5}, 5, "[0 [0] 4 [6]]"},
+		{[]int{0, 1, 2, 3, 3, 3, 3, 4, 4}, 3, "[0 [0 1 2] 7 [4 4]]"},
+		{[]int{0, 7, 7, 7, 7, 7, 1, 2, 0, 0}, 7, "[0 [0] 6 [1 2 0 0]]"},
+		{[]int{1, 2, 0, 3, 0, 0, 0}, 0, "[0 [1 2 0 3]]"},
+		{[]int{1, 2, 2, 2, 1, 0, 0}, 2, "[0 [1] 4 [1 0 0]]"},
+		{[]int{0, 0, 0, 0, 0, 7, 7, 7, 7, 1, 2}, 0, "[5 8 7 9 [1 2]]"},
+		{[]int{1, 3, 3, 3, 0, 0, 0, 0}, 0, "[0 [1 3 3 3]]"},
+		{[]int{0, 0, 0, 0, 3, 3, 3}, 0, "[4 6 3]"},
+	}
+	for _, tt := range tts {
+		t.Run(fmt.Sprint(tt.widths), func(t *testing.T) {
+			DW, W := widthArray(tt.widths)
+			buf := &bytes.Buffer{}
+			newPDFWriter(buf).writeVal(W)
+			test.T(t, DW, tt.DW)
+			test.String(t, strings.TrimPrefix(buf.String(), "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"), tt.W)
+		})
+	}
+
+	// reference: expand the W array and compare against the original widths of a real font
+	family := canvas.NewFontFamily("dejavu-serif")
+	err := family.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	widths := glyphWidths(family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal).Font)
+	DW, W := widthArray(widths)
+	expanded := make([]int, len(widths))
+	for i := range expanded {
+		expanded[i] = DW
+	}
+	numbers := 0
+	for i := 0; i < len(W); {
+		if list, ok := W[i+1].(pdfArray); ok {
+			for j, w := range list {
+				expanded[W[i].(int)+j] = w.(int)
+			}
+			numbers += 1 + len(list)
+			i += 2
+		} else {
+			for j := W[i].(int); j <= W[i+1].(int); j++ {
+				expanded[j] = W[i+2].(int)
+			}
+			numbers += 3
+			i += 3
+		}
+	}
+	test.T(t, expanded, widths)
+	test.That(t, numbers < len(widths), "W array must be shorter than a list of all widths:", numbers, len(widths))
+}
+
+func TestPDFSharedGraphicsStates(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := newPDFWriter(buf)
+	page1 := pdf.NewPage(210.0, 297.0)
+	page1.SetAlpha(0.5)
+	page2 := pdf.NewPage(210.0, 297.0)
+	page2.SetAlpha(0.25)
+	page2.SetAlpha(0.5)
+	test.String(t, page2.String(), " 2.8346457 0 0 2.8346457 0 0 cm /A0 gs /A1 gs")
+
+	ref := page1.resources["ExtGState"].(pdfDict)["A0"].(pdfRef)
+	test.T(t, page2.resources["ExtGState"].(pdfDict)["A1"], ref)
+	test.That(t, page2.resources["ExtGState"].(pdfDict)["A0"] != ref)
+	test.T(t, strings.Count(buf.String(), "/CA .5"), 1)
+}
+
+func TestPDFShapeAnnotations(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.AddSquareAnnotation(canvas.Rect{X: 0.0, Y: 0.0, W: 25.4, H: 25.4}, 0.0, canvas.Red, canvas.Transparent)
+	pdf.AddCircleAnnotation(canvas.Rect{X: 0.0, Y: 0.0, W: 25.4, H: 25.4}, 25.4, canvas.Black, canvas.Blue)
+	pdf.AddLineAnnotation(canvas.Point{X: 25.4, Y: 25.4}, canvas.Point{X: 0.0, Y: 0.0}, 0.0, canvas.Green)
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "<< /Type /Annot /Subtype /Square /BS << /W 0 >> /C [1 0 0] /Rect [0 0 72 72] >>"), "square annotation")
+	test.That(t, strings.Contains(s, "<< /Type /Annot /Subtype /Circle /BS << /W 72 >> /C [0 0 0] /IC [0 0 1] /Rect [0 0 72 72] >>"), "circle annotation")
+	test.That(t, strings.Contains(s, "<< /Type /Annot /Subtype /Line /BS << /W 0 >> /C [0 .50196078 0] /L [72 72 0 0] /Rect [0 0 72 72] >>"), "line annotation")
+	test.That(t, strings.Contains(s, "/Annots [5 0 R 6 0 R 7 0 R]"), "page annotations")
+}
+
+func TestPDFTextAnnotations(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.AddTextAnnotation(canvas.Point{X: 25.4, Y: 0.0}, "note", canvas.Yellow)
+	pdf.AddHighlightAnnotation("", canvas.Yellow, canvas.Rect{X: 0.0, Y: 25.4, W: 50.8, H: 25.4}, canvas.Rect{X: 0.0, Y: 0.0, W: 25.4, H: 25.4})
+	pdf.AddHighlightAnnotation("empty", canvas.Yellow)
+	pdf.AddTextAnnotation(canvas.Point{X: 50.8, Y: 0.0}, "caf\u00E9 \u20AC", canvas.Yellow)
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "<< /Type /Annot /Subtype /Text /C [1 1 0] /Contents (note) /Name /Note /Rect [72 0 96 24] >>"), "text annotation")
+	test.That(t, strings.Contains(s, "<< /Type /Annot /Subtype /Highlight /C [1 1 0] /QuadPoints [0 144 144 144 0 72 144 72 0 72 72 72 0 0 72 0] /Rect [0 0 144 144] >>"), "highlight annotation")
+	test.That(t, strings.Contains(s, "/Contents (\xFE\xFF\x00c\x00a\x00f\x00\xE9\x00 \x20\xAC)"), "UTF-16 text annotation")
+	test.That(t, strings.Contains(s, "/Annots [5 0 R 6 0 R 7 0 R]"), "page annotations")
+}
+
+func TestPDFTextField(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.AddTextField("name", canvas.Rect{X: 0.0, Y: 0.0, W: 25.4, H: 25.4}, "a", face.Font, 12.0, FieldRequired)
+	pdf.AddTextField("comments", canvas.Rect{X: 0.0, Y: 25.4, W: 25.4, H: 25.4}, "a\na", face.Font, 12.0, FieldMultiline|FieldReadOnly)
+	pdf.AddTextField("na\u00EFve", canvas.Rect{X: 0.0, Y: 50.8, W: 25.4, H: 25.4}, "\u00E9", face.Font, 12.0, 0)
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "/Tx BMC q BT /F0 12 Tf 0 g 2 31.84375 Td (\x00D) Tj ET Q EMC"), "single line appearance")
+	test.That(t, strings.Contains(s, "/Subtype /Widget /AP << /N 7 0 R >> /DA (/F0 12 Tf 0 g) /DV (a) /F 4 /FT /Tx /Ff 2 /Rect [0 0 72 72] /T (name) /V (a) >>"), "single line field")
+	test.That(t, strings.Contains(s, "/Ff 4097"), "multiline field")
+	test.That(t, strings.Contains(s, "/DV (\xFE\xFF\x00\xE9) /F 4 /FT /Tx /Ff 0 /Rect [0 144 72 216] /T (\xFE\xFF\x00n\x00a\x00\xEF\x00v\x00e) /V (\xFE\xFF\x00\xE9)"), "UTF-16 field")
+	test.That(t, strings.Contains(s, "/AcroForm << /DR << /Font << /F0 6 0 R >> >> /Fields [11 0 R 12 0 R 13 0 R] >>"), "interactive form")
+
+	// the appearance matches the widget rectangle in user units, with the text in points
+	buf.Reset()
+	pdf = New(buf, 210.0, 297.0)
+	pdf.SetCompression(false)
+	pdf.SetUserUnit(2.0)
+	pdf.AddTextField("name", canvas.Rect{X: 0.0, Y: 0.0, W: 25.4, H: 25.4}, "a", face.Font, 12.0, 0)
+	test.Error(t, pdf.Close())
+
+	s = buf.String()
+	test.That(t, strings.Contains(s, "/BBox [0 0 36 36]"), "appearance bounding box")
+	test.That(t, strings.Contains(s, "/Tx BMC q .5 0 0 .5 0 0 cm BT /F0 12 Tf 0 g 2 31.84375 Td"), "appearance in points")
+	test.That(t, strings.Contains(s, "/Rect [0 0 36 36]"), "widget rectangle")
+}
+
+func TestPDFSignatureField(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	test.That(t, pdf.AddSignatureField("signature", canvas.Rect{}, -1) != nil, "negative contents size")
+	test.Error(t, pdf.AddSignatureField("signature", canvas.Rect{}, 16))
+	test.That(t, pdf.AddSignatureField("signature2", canvas.Rect{}, 16) != nil, "second signature field")
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "/Subtype /Widget /F 132 /FT /Sig /Rect [0 0 0 0] /T (signature) /V 4 0 R >>"), "signature field")
+	test.That(t, strings.Contains(s, "/SigFlags 3"), "signature flags")
+
+	var a, b, c, d int
+	i := strings.Index(s, "/ByteRange [")
+	test.That(t, 0 <= i)
+	_, err := fmt.Sscanf(s[i:], "/ByteRange [%d %d %d %d]", &a, &b, &c, &d)
+	test.Error(t, err)
+	test.T(t, a, 0)
+	test.T(t, s[b:c], "<"+strings.Repeat("0", 32)+">")
+	test.T(t, c+d, len(s))
+	test.That(t, strings.HasSuffix(s, "%%EOF"))
+}
+
+func TestPDFNamedColor(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	test.Error(t, pdf.RegisterColor("Brand Red", canvas.Red, true))
+	test.Error(t, pdf.RegisterColor("grey", canvas.Gray, false))
+	test.Error(t, pdf.RegisterColor("Red", canvas.Red, false))
+	test.That(t, pdf.RegisterColor("Other Red", canvas.Red, true) != nil, "duplicate separation color")
+	test.That(t, pdf.RegisterColor("Clear", canvas.Transparent, true) != nil, "transparent separation color")
+
+	red, ok := pdf.NamedColor("Brand Red")
+	test.That(t, ok)
+	test.T(t, red, canvas.Red)
+	_, ok = pdf.NamedColor("blue")
+	test.That(t, !ok)
+
+	pdf.w.SetFillColor(red)
+	pdf.w.SetStrokeColor(red)
+	pdf.w.SetFillColor(canvas.Gray)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm /CS0 cs 1 scn /CS0 CS 1 SCN .50196078 g")
+	test.That(t, strings.Contains(buf.String(), "[/Separation /Brand#20Red /DeviceRGB << /C0 [1 1 1] /C1 [1 0 0] /Domain [0 1] /FunctionType 2 /N 1 >>]"))
+}
+
+func TestPDFTagged(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetTagged(true)
+	pdf.RenderImage(image.NewNRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity)
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	pdf.RenderImage(image.NewNRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity)
+	test.That(t, strings.HasPrefix(pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm /Figure <</MCID 0>> BDC q "), pdf.w.String())
+	test.That(t, strings.Contains(pdf.w.String(), "Q EMC /Artifact BMC 0 0 m 1 0 l 1 1 l 0 1 l f EMC /Figure <</MCID 1>> BDC q "), pdf.w.String())
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "/StructParents 0"), "page structure parents")
+	test.That(t, strings.Contains(s, "<< /Type /StructElem /K 0 /P 11 0 R /Pg 9 0 R /S /Figure >>"), "figure element")
+	test.That(t, strings.Contains(s, "<< /Type /StructElem /K [12 0 R 13 0 R] /P 10 0 R /S /Document >>"), "document element")
+	test.That(t, strings.Contains(s, "<< /Type /StructTreeRoot /K 11 0 R /ParentTree << /Nums [0 [12 0 R 13 0 R]] >> /ParentTreeNextKey 1 >>"), "structure tree root")
+	test.That(t, strings.Contains(s, "/MarkInfo << /Marked true >> /Pages 3 0 R /StructTreeRoot 10 0 R >>"), "catalog")
+}
+
+func TestPDFTaggedAlt(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetTagged(true)
+	pdf.RenderImageAlt(image.NewNRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity, "A red (square) logo")
+	test.That(t, strings.HasPrefix(pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm /Figure <</MCID 0>> BDC q "), pdf.w.String())
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "<< /Type /StructElem /Alt (A red \\(square\\) logo) /K 0 /P 9 0 R /Pg 7 0 R /S /Figure >>"), buf.String())
+
+	// untagged
+	buf.Reset()
+	pdf = New(buf, 210.0, 297.0)
+	pdf.RenderImageAlt(image.NewNRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity, "A red logo")
+	test.That(t, !strings.Contains(pdf.w.String(), "BDC"), pdf.w.String())
+	test.Error(t, pdf.Close())
+	test.That(t, !strings.Contains(buf.String(), "A red logo"))
+
+	// non-ASCII
+	buf.Reset()
+	pdf = New(buf, 210.0, 297.0)
+	pdf.SetTagged(true)
+	pdf.RenderImageAlt(image.NewNRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity, "Logo \u00E9")
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "/Alt (\xFE\xFF\x00L\x00o\x00g\x00o\x00 \x00\xE9)"), buf.String())
+}
+
+func TestPDFTaggedTiled(t *testing.T) {
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.SetTagged(true)
+	pdf.RenderImageTiled(image.NewNRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity, canvas.Rectangle(10.0, 10.0))
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm /Artifact BMC q /Pattern cs /P0 scn 0 0 m 10 0 l 10 10 l 0 10 l h f Q EMC")
+	test.T(t, len(pdf.w.structElems), 0)
+}
+
+func TestPDFTaggedAlphaMask(t *testing.T) {
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.SetTagged(true)
+	pdf.RenderAlphaMask(image.NewAlpha(image.Rect(0, 0, 1, 1)), canvas.Red, canvas.Identity)
+	test.That(t, strings.HasPrefix(pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm /Artifact BMC "), pdf.w.String())
+	test.T(t, len(pdf.w.structElems), 0)
+}
+
+func TestPDFTaggedClipped(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetTagged(true)
+	pdf.RenderImageClipped(image.NewNRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity, canvas.Rectangle(1.0, 1.0))
+	pdf.RenderImageClippedAlt(image.NewNRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity, canvas.Rectangle(1.0, 1.0), "A logo")
+	test.That(t, strings.HasPrefix(pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm /Artifact BMC q "), pdf.w.String())
+	test.That(t, strings.Contains(pdf.w.String(), "Q EMC /Figure <</MCID 0>> BDC q "), pdf.w.String())
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "/Alt (A logo)"), buf.String())
+}
+
+func TestPDFRawContent(t *testing.T) {
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	test.Error(t, pdf.RawContent([]byte("/Span <</ActualText (a\\)b)>> BDC 1 0 0 rg EMC")))
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm q\n/Span <</ActualText (a\\)b)>> BDC 1 0 0 rg EMC\nQ 0 0 m 1 0 l 1 1 l 0 1 l f")
+
+	var tts = []string{
+		"q",
+		"Q",
+		"q BT Q ET",
+		"BT BT ET ET",
+		"BT q Q ET",
+		"/P BMC",
+		"(abc",
+		"<abc",
+		"<< /A 1",
+		"[1 2",
+		"1 2]",
+	}
+	for _, tt := range tts {
+		t.Run(tt, func(t *testing.T) {
+			test.That(t, pdf.RawContent([]byte(tt)) != nil)
+		})
+	}
+
+	// names and strings are not operators
+	test.Error(t, pdf.RawContent([]byte("/q gs (BT) Tj % Q")))
+
+	// the data of inline images is skipped
+	test.Error(t, pdf.RawContent([]byte("BI /W 2 /H 1 /CS /G /BPC 8 ID Q(EI\nEI")))
+	test.That(t, pdf.RawContent([]byte("BI /W 2 /H 1 /CS /G /BPC 8 ID Q(")) != nil, "unterminated inline image")
+
+	pdf.w.StartTextObject()
+	test.That(t, pdf.RawContent([]byte("q Q")) != nil, "must fail in text object")
+}
+
+func TestPDFPathOperators(t *testing.T) {
+	data, closed := PathOperators(canvas.Rectangle(1.0, 2.0), canvas.Identity.Translate(3.0, 0.0))
+	test.String(t, data, "3 0 m 4 0 l 4 2 l 3 2 l")
+	test.That(t, closed, "closed path")
+
+	data, closed = PathOperators(canvas.MustParseSVG("M0 0L1 0zM2 0L3 0"), canvas.Identity)
+	test.String(t, data, "0 0 m 1 0 l h 2 0 m 3 0 l")
+	test.That(t, !closed, "open last subpath")
+
+	data, closed = PathOperators(&canvas.Path{}, canvas.Identity)
+	test.String(t, data, "")
+	test.That(t, !closed)
+
+	// clip raw content with the path
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	data, _ = PathOperators(canvas.Rectangle(1.0, 1.0), canvas.Identity)
+	test.Error(t, pdf.RawContent([]byte(data+" h W n")))
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm q\n0 0 m 1 0 l 1 1 l 0 1 l h W n\nQ")
+}
+
+func TestPDFPrecision(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 215.9, 279.4) // US Letter
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "/MediaBox [0 0 612 792]"), "integer media box")
+
+	defer func(precision int) {
+		canvas.Precision = precision
+	}(canvas.Precision)
+	canvas.Precision = 3
+	buf = &bytes.Buffer{}
+	pdf = New(buf, 210.0, 297.0)
+	pdf.RenderPath(canvas.Rectangle(1.0/3.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm 0 0 m .333 0 l .333 1 l 0 1 l f")
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "/MediaBox [0 0 595.27559 841.88976]"), "media box independent of precision")
+}
+
+func TestPDFDefaultSRGB(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetDefaultSRGB(true)
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	pdf.NewPage(210.0, 297.0)
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.T(t, strings.Count(s, "[/CalRGB << /Gamma [2.2 2.2 2.2] /Matrix [.4124 .2126 .0193 .3576 .7152 .1192 .1805 .0722 .9505] /WhitePoint [.9505 1 1.089] >>]"), 1)
+	test.T(t, strings.Count(s, "[/CalGray << /Gamma 2.2 /WhitePoint [.9505 1 1.089] >>]"), 1)
+	test.T(t, strings.Count(s, "/ColorSpace << /DefaultGray 6 0 R /DefaultRGB 5 0 R >>"), 2)
+	test.T(t, strings.Count(s, "/Group << /Type /Group /CS 5 0 R"), 2)
+}
+
+func TestPDFGradientStroke(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	style := canvas.DefaultStyle
+	style.FillColor = canvas.Transparent
+	style.StrokeWidth = 2.0
+	gradient := LinearGradient{
+		Start: canvas.Point{X: 0.0, Y: 0.0},
+		End:   canvas.Point{X: 10.0, Y: 0.0},
+		Stops: []GradientStop{{0.0, canvas.Red}, {0.5, canvas.Blue}, {1.0, canvas.Red}},
+	}
+	line := &canvas.Path{}
+	line.LineTo(10.0, 0.0)
+	pdf.RenderPathGradientStroke(line, style, gradient, canvas.Identity.Translate(5.0, 0.0))
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm q /Pattern cs /P0 scn 5 -1 m 15 -1 l 15 1 l 5 1 l h f Q")
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	test.That(t, strings.HasSuffix(pdf.w.String(), " Q 0 0 m 1 0 l 1 1 l 0 1 l f"), "fill color must be restored")
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "/Resources << /Pattern << /P0 4 0 R >> >>"), "page resources")
+	test.That(t, strings.Contains(s, "<< /Type /Pattern /Matrix [2.8346457 0 0 2.8346457 14.173228 0] /PatternType 2 /Shading << /ColorSpace /DeviceRGB /Coords [0 0 10 0] /Extend [true true] /Function << /Bounds [.5] /Domain [0 1] /Encode [0 1 0 1] /FunctionType 3 /Functions [<< /C0 [1 0 0] /C1 [0 0 1] /Domain [0 1] /FunctionType 2 /N 1 >> << /C0 [0 0 1] /C1 [1 0 0] /Domain [0 1] /FunctionType 2 /N 1 >>] >> /ShadingType 2 >> >>"), s)
+}
+
+func TestPDFGradientFill(t *testing.T) {
+	gradient := LinearGradient{
+		Start: canvas.Point{X: 0.0, Y: 0.0},
+		End:   canvas.Point{X: 1.0, Y: 0.0},
+		Stops: []GradientStop{{0.0, canvas.Red}, {1.0, canvas.Blue}},
+	}
+	style := canvas.DefaultStyle
+	style.StrokeColor = canvas.Black
+	style.StrokeWidth = 0.5
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderPathGradientFill(canvas.Rectangle(1.0, 1.0), style, gradient, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm .5 w 2 M q /Pattern cs /P0 scn 0 0 m 1 0 l 1 1 l 0 1 l b Q")
+
+	// stroke with a different opacity than the gradient fill
+	style.StrokeColor = color.RGBA{0, 0, 0, 128}
+	pdf = New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderPathGradientFill(canvas.Rectangle(1.0, 1.0), style, gradient, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm q /Pattern cs /P0 scn 0 0 m 1 0 l 1 1 l 0 1 l h f Q 0 G /A0 gs .5 w 2 M 0 0 m 1 0 l 1 1 l 0 1 l s")
+}
+
+func TestPDFMediaBox(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetMediaBox(canvas.Rect{X: 25.4, Y: 50.8, W: 254.0, H: 127.0})
+	width, height := pdf.Size()
+	test.T(t, width, 254.0)
+	test.T(t, height, 127.0)
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 72 144 cm 0 0 m 1 0 l 1 1 l 0 1 l f")
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "/MediaBox [72 144 792 504]"))
+
+	defer func() {
+		test.That(t, recover() != nil, "must panic after drawing")
+	}()
+	pdf.SetMediaBox(canvas.Rect{X: 0.0, Y: 0.0, W: 10.0, H: 10.0})
+}
+
+func TestPDFMediaBoxAnnotations(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	test.Error(t, dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular))
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetCompression(false)
+	pdf.SetMediaBox(canvas.Rect{X: 25.4, Y: 50.8, W: 254.0, H: 127.0})
+	pdf.AddSquareAnnotation(canvas.Rect{X: 0.0, Y: 0.0, W: 25.4, H: 25.4}, 0.0, canvas.Black, canvas.Transparent)
+	pdf.AddLineAnnotation(canvas.Point{X: 0.0, Y: 0.0}, canvas.Point{X: 25.4, Y: 0.0}, 0.0, canvas.Black)
+	pdf.AddHighlightAnnotation("", canvas.Yellow, canvas.Rect{X: 0.0, Y: 0.0, W: 25.4, H: 25.4})
+	pdf.AddTextField("name", canvas.Rect{X: 0.0, Y: 0.0, W: 25.4, H: 25.4}, "", dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal).Font, 12.0, 0)
+	test.Error(t, pdf.Close())
+	s := buf.String()
+
+	// annotations are placed relative to the lower-left corner of the media box as the page contents
+	test.T(t, strings.Count(s, "/Rect [72 144 144 216]"), 3)
+	test.That(t, strings.Contains(s, "/Rect [72 144 144 144]"), "line rectangle")
+	test.That(t, strings.Contains(s, "/L [72 144 144 144]"), "line")
+	test.That(t, strings.Contains(s, "/QuadPoints [72 216 144 216 72 144 144 144]"), "quad points")
+}
+
+func TestPDFThumbnail(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 20.0, 10.0)
+	pdf.SetThumbnailSize(4)
+	pdf.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.DefaultStyle, canvas.Identity)
+	test.T(t, pdf.w.thumbnailImg.Bounds(), image.Rect(0, 0, 4, 2))
+	test.T(t, pdf.w.thumbnailImg.RGBAAt(0, 0), color.RGBA{0, 0, 0, 255})
+	test.T(t, pdf.w.thumbnailImg.RGBAAt(3, 0), color.RGBA{255, 255, 255, 255})
+
+	pdf.NewPage(10.0, 10.0)
+	test.T(t, pdf.w.thumbnailImg.Bounds(), image.Rect(0, 0, 4, 4))
+	test.Error(t, pdf.Close())
+	test.T(t, strings.Count(buf.String(), "/Thumb "), 2)
+}
+
+func TestPDFType3Font(t *testing.T) {
+	font := NewType3Font(1000.0)
+	square := font.AddGlyph(600.0, Type3Layer{Path: canvas.Rectangle(500.0, 500.0)})
+	circle := font.AddGlyph(800.0, Type3Layer{Path: canvas.Rectangle(700.0, 700.0), Color: canvas.Red}, Type3Layer{Path: canvas.Circle(300.0).Translate(350.0, 350.0), Color: canvas.Blue})
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.RenderType3Text(font, 10.0, []byte{square, circle}, canvas.Green, canvas.Identity.Translate(10.0, 10.0))
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm BT 0 .50196078 0 rg /F0 10 Tf 10 10 Td (\x00\x01) Tj ET")
+	test.Error(t, pdf.Close())
+
+	s := buf.String()
+	test.That(t, strings.Contains(s, "stream\n600 0 0 0 500 500 d1 0 0 m 500 0 l 500 500 l 0 500 l h f\nendstream"), "uncolored glyph")
+	test.That(t, strings.Contains(s, "stream\n800 0 d0 1 0 0 rg 0 0 m 700 0 l 700 700 l 0 700 l h f 0 0 1 rg "), "colored glyph")
+	test.That(t, strings.Contains(s, "<< /Type /Font /Subtype /Type3 /CharProcs << /g0 7 0 R /g1 8 0 R >> /Encoding << /Type /Encoding /Differences [0 /g0 /g1] >> /FirstChar 0 /FontBBox [0 0 700 700] /FontMatrix [.001 0 0 .001 0 0] /LastChar 1 /Resources << >> /Widths [600 800] >>"), "Type3 font")
+}
+
+func TestPDFType3FontOrder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	for i := 0; i < 8; i++ {
+		font := NewType3Font(1000.0)
+		glyph := font.AddGlyph(600.0, Type3Layer{Path: canvas.Rectangle(500.0, 500.0)})
+		pdf.RenderType3Text(font, 10.0, []byte{glyph}, canvas.Black, canvas.Identity)
+	}
+	test.Error(t, pdf.Close())
+
+	// fonts are written in the order of their references
+	prev := 0
+	for _, m := range regexp.MustCompile(`\n(\d+) 0 obj\n<< /Type /Font /Subtype /Type3 `).FindAllStringSubmatch(buf.String(), -1) {
+		ref, _ := strconv.Atoi(m[1])
+		test.That(t, prev < ref, "font order")
+		prev = ref
+	}
+	test.That(t, prev != 0, "fonts")
+}
+
+// addSFNTTables returns the SFNT font with the given tables added or replaced.
+func addSFNTTables(b []byte, extra map[string][]byte) []byte {
+	tables := map[string][]byte{}
+	numTables := int(binary.BigEndian.Uint16(b[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := b[12+16*i:]
+		offset, length := binary.BigEndian.Uint32(rec[8:]), binary.BigEndian.Uint32(rec[12:])
+		tables[string(rec[:4])] = b[offset : offset+length]
+	}
+	for tag, table := range extra {
+		tables[tag] = table
+	}
+
+	tags := []string{}
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	header := &bytes.Buffer{}
+	data := &bytes.Buffer{}
+	header.Write(b[:4])
+	binary.Write(header, binary.BigEndian, []uint16{uint16(len(tags)), 0, 0, 0})
+	offset := 12 + 16*len(tags)
+	for _, tag := range tags {
+		table := append([]byte{}, tables[tag]...)
+		for len(table)%4 != 0 {
+			table = append(table, 0)
+		}
+		if tag == "head" {
+			binary.BigEndian.PutUint32(table[8:], 0)
+		}
+		checksum := uint32(0)
+		for i := 0; i < len(table); i += 4 {
+			checksum += binary.BigEndian.Uint32(table[i:])
+		}
+		header.WriteString(tag)
+		binary.Write(header, binary.BigEndian, []uint32{checksum, uint32(offset + data.Len()), uint32(len(tables[tag]))})
+		data.Write(table)
+	}
+	return append(header.Bytes(), data.Bytes()...)
+}
+
+func TestPDFColorGlyphs(t *testing.T) {
+	b, err := ioutil.ReadFile("../font/DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := canvasFont.ParseSFNT(b)
+	test.Error(t, err)
+
+	// glyph 'a' is drawn with layers 'o' in red and 'l' in the text color
+	glyphA, glyphO, glyphL := sfnt.GlyphIndex('a'), sfnt.GlyphIndex('o'), sfnt.GlyphIndex('l')
+	colr := &bytes.Buffer{}
+	binary.Write(colr, binary.BigEndian, []uint16{0, 1, 0, 14, 0, 20, 2, glyphA, 0, 2, glyphO, 0, glyphL, 0xFFFF})
+	cpal := &bytes.Buffer{}
+	binary.Write(cpal, binary.BigEndian, []uint16{0, 1, 1, 1, 0, 14, 0})
+	cpal.Write([]byte{0x00, 0x00, 0xFF, 0xFF})
+	b = addSFNTTables(b, map[string][]byte{"COLR": colr.Bytes(), "CPAL": cpal.Bytes()})
+
+	family := canvas.NewFontFamily("color")
+	test.Error(t, family.LoadFont(b, canvas.FontRegular))
+	face := family.Face(12.0, canvas.Blue, canvas.FontRegular, canvas.FontNormal)
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderText(canvas.NewTextLine(face, "ab", canvas.Left), canvas.Identity)
+	out := pdf.w.String()
+	test.That(t, strings.HasPrefix(out, " 2.8346457 0 0 2.8346457 0 0 cm 1 0 0 rg "), out)
+	test.That(t, strings.Contains(out, " 0 0 1 rg "), out)
+	test.That(t, strings.Contains(out, " h f BT /F0 4.2333333 Tf 2.523877 0 Td[(") && strings.HasSuffix(out, ")]TJ ET"), out)
+	test.That(t, !strings.Contains(out, " BT ET"), out)
+
+	// faux bold applies to text and color layers
+	bold := family.Face(12.0, canvas.Blue, canvas.FontBold, canvas.FontNormal)
+	pdf = New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderText(canvas.NewTextLine(bold, "ab", canvas.Left), canvas.Identity)
+	out = pdf.w.String()
+	test.That(t, strings.Contains(out, " 2 Tr "), out)
+	test.That(t, !strings.Contains(out, "1 0 0 rg 1.2733073 .14469401 m"), out)
+
+	// spans without color glyphs are written as text
+	pdf = New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderText(canvas.NewTextLine(face, "bc", canvas.Left), canvas.Identity)
+	test.That(t, strings.Contains(pdf.w.String(), "TJ"))
+}
+
+func TestPDFBitmapGlyphs(t *testing.T) {
+	b, err := ioutil.ReadFile("../font/DejaVuSerif.ttf")
+	test.Error(t, err)
+	sfnt, err := canvasFont.ParseSFNT(b)
+	test.Error(t, err)
+
+	pngBuf := &bytes.Buffer{}
+	test.Error(t, png.Encode(pngBuf, image.NewNRGBA(image.Rect(0, 0, 2, 2))))
+
+	// single strike with a PNG for glyph 'a'
+	numGlyphs := int(sfnt.Maxp.NumGlyphs)
+	glyphA := int(sfnt.GlyphIndex('a'))
+	sbix := &bytes.Buffer{}
+	binary.Write(sbix, binary.BigEndian, []uint16{1, 1})
+	binary.Write(sbix, binary.BigEndian, []uint32{1, 12})
+	binary.Write(sbix, binary.BigEndian, []uint16{12, 72})
+	start := uint32(4 + 4*(numGlyphs+1))
+	for i := 0; i <= numGlyphs; i++ {
+		offset := start
+		if glyphA < i {
+			offset += uint32(8 + pngBuf.Len())
+		}
+		binary.Write(sbix, binary.BigEndian, offset)
+	}
+	binary.Write(sbix, binary.BigEndian, []int16{0, -1})
+	sbix.WriteString("png ")
+	sbix.Write(pngBuf.Bytes())
+	b = addSFNTTables(b, map[string][]byte{"sbix": sbix.Bytes()})
+
+	family := canvas.NewFontFamily("bitmap")
+	test.Error(t, family.LoadFont(b, canvas.FontRegular))
+	face := family.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+	pdf.RenderText(canvas.NewTextLine(face, "ab", canvas.Left), canvas.Identity)
+	out := pdf.w.String()
+	test.That(t, strings.Contains(out, " /Im0 Do Q BT /F0 4.2333333 Tf 2.523877 0 Td[(") && strings.HasSuffix(out, ")]TJ ET"), out)
+	test.T(t, strings.Count(out, " BT "), 1)
+}
+
 func TestPDFImage(t *testing.T) {
 	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
 
@@ -93,6 +1316,119 @@ func TestPDFImage(t *testing.T) {
 	test.String(t, pdf.String(), " 2.8346457 0 0 2.8346457 0 0 cm q 0 0 2 2 re W n 0 0 m 0 2 l 2 2 l 2 0 l h W n 2 0 0 2 0 0 cm /Im0 Do Q")
 }
 
+func TestPDFImageClipped(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+
+	buf := &bytes.Buffer{}
+	pdf := newPDFWriter(buf).NewPage(210.0, 297.0)
+	pdf.DrawImageClipped(img, canvas.Lossless, canvas.Identity, canvas.Rectangle(1.0, 1.0))
+	test.String(t, pdf.String(), " 2.8346457 0 0 2.8346457 0 0 cm q 0 0 2 2 re W n 0 0 m 0 2 l 2 2 l 2 0 l h W n 0 0 m 1 0 l 1 1 l 0 1 l h W n 2 0 0 2 0 0 cm /Im0 Do Q")
+}
+
+func TestPDFImageTiled(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 3))
+
+	buf := &bytes.Buffer{}
+	w := newPDFWriter(buf)
+	w.SetCompression(false)
+	pdf := w.NewPage(210.0, 297.0)
+	pdf.DrawImageTiled(img, canvas.Identity.Translate(1.0, 0.0), canvas.Rectangle(10.0, 10.0))
+	test.String(t, pdf.String(), " 2.8346457 0 0 2.8346457 0 0 cm q /Pattern cs /P0 scn 0 0 m 10 0 l 10 10 l 0 10 l h f Q")
+	test.That(t, pdf.resources["XObject"] == nil, "image is only referenced by the pattern")
+	test.T(t, w.images, 1)
+
+	test.Error(t, w.Close())
+	test.That(t, strings.Contains(buf.String(), "/PatternType 1"), buf.String())
+	test.That(t, strings.Contains(buf.String(), "/XStep 2"), buf.String())
+	test.That(t, strings.Contains(buf.String(), "/YStep 3"), buf.String())
+	test.That(t, strings.Contains(buf.String(), "/Matrix [2.8346457 0 0 2.8346457 2.8346457 0]"), buf.String())
+	test.That(t, strings.Contains(buf.String(), "2 0 0 3 0 0 cm /Im0 Do"), buf.String())
+}
+
+func TestPDFImageNoClipping(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+
+	buf := &bytes.Buffer{}
+	pdf := newPDFWriter(buf)
+	pdf.SetImageClipping(false)
+	page := pdf.NewPage(210.0, 297.0)
+	page.DrawImage(img, canvas.Lossless, canvas.Identity.Translate(1.0, 0.0))
+	page.DrawImage(img, canvas.Lossless, canvas.Identity.Rotate(90.0))
+	test.String(t, page.String(), " 2.8346457 0 0 2.8346457 0 0 cm q 2 0 0 2 1 0 cm /Im0 Do Q q -2 0 2 2 re W n 0 0 m -2 0 l -2 2 l 0 2 l h W n 0 2 -2 0 0 0 cm /Im1 Do Q")
+}
+
+func TestPDFImageDecode(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	test.That(t, pdf.RenderImageDecode(img, canvas.Identity, []float64{1.0, 0.0}) != nil, "gray images are embedded as RGB")
+	test.That(t, !strings.Contains(pdf.w.String(), "Do"), "nothing drawn on error")
+	test.Error(t, pdf.RenderImageDecode(img, canvas.Identity, []float64{1.0, 0.0, 1.0, 0.0, 1.0, 0.0}))
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "/Decode [1 0 1 0 1 0]"), buf.String())
+}
+
+func TestPDFImageColorKey(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	test.That(t, pdf.RenderImageColorKey(img, canvas.Identity, []int{250, 255}) != nil, "gray images are embedded as RGB")
+	test.That(t, pdf.RenderImageColorKey(img, canvas.Identity, []int{250, 256, 250, 255, 250, 255}) != nil, "out of range")
+	test.That(t, pdf.RenderImageColorKey(img, canvas.Identity, []int{255, 250, 250, 255, 250, 255}) != nil, "inverted range")
+	test.That(t, !strings.Contains(pdf.w.String(), "Do"), "nothing drawn on error")
+	test.Error(t, pdf.RenderImageColorKey(img, canvas.Identity, []int{250, 255, 250, 255, 0, 255}))
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "/Mask [250 255 250 255 0 255]"), buf.String())
+}
+
+func TestPDFImageUnpremultiply(t *testing.T) {
+	// soft translucent edge of a single color
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{200, 100, 50, uint8(x)})
+	}
+
+	pdf := newPDFWriter(&bytes.Buffer{}).NewPage(210.0, 297.0)
+	stream := pdf.imageStream(img, canvas.Lossless)
+	test.That(t, stream.dict["SMask"] != nil, "must have soft mask")
+	for x := 1; x < 256; x++ {
+		R, G, B, A := img.At(x, 0).RGBA()
+		for i, c := range []uint32{R, G, B} {
+			// reference with rounding in floating point
+			expected := byte(math.Round(float64(c) / float64(A) * 255.0))
+			test.T(t, stream.stream[3*x+i], expected, "color component", i, "at alpha", x)
+		}
+	}
+
+	// invalid premultiplied colors must be clamped
+	stream = pdf.imageStream(&image.RGBA{Pix: []uint8{255, 128, 0, 128}, Stride: 4, Rect: image.Rect(0, 0, 1, 1)}, canvas.Lossless)
+	test.T(t, stream.stream, []byte{255, 255, 0})
+}
+
+func TestPDFImageResolution(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+
+	buf := &bytes.Buffer{}
+	pdf := newPDFWriter(buf)
+	pdf.SetImageResolution(2.0)
+	pdf.SetImageClipping(false)
+	page := pdf.NewPage(210.0, 297.0)
+	page.DrawImage(img, canvas.Lossless, canvas.Identity.Scale(0.1, 0.1)) // 10x5 mm
+	test.String(t, page.String(), " 2.8346457 0 0 2.8346457 0 0 cm q 10 0 0 5 0 0 cm /Im0 Do Q")
+
+	xobject := page.resources["XObject"].(pdfDict)["Im0"].(pdfRef)
+	test.That(t, strings.Contains(buf.String(), fmt.Sprintf("%d 0 obj\n<< /Type /XObject /Subtype /Image /BitsPerComponent 8 /ColorSpace /DeviceRGB /Filter /FlateDecode /Height 10 /Interpolate true /Length", xobject)))
+
+	// JPEG images remain DCT compressed
+	var jpegBuf bytes.Buffer
+	test.Error(t, jpeg.Encode(&jpegBuf, img, nil))
+	jpegImg, err := canvas.NewJPEGImage(&jpegBuf)
+	test.Error(t, err)
+	page.DrawImage(jpegImg, canvas.Lossless, canvas.Identity.Scale(0.1, 0.1))
+	xobject = page.resources["XObject"].(pdfDict)["Im1"].(pdfRef)
+	test.That(t, strings.Contains(buf.String(), fmt.Sprintf("%d 0 obj\n<< /Type /XObject /Subtype /Image /BitsPerComponent 8 /ColorSpace /DeviceRGB /Filter /DCTDecode /Height 10 /Length", xobject)))
+}
+
 func TestPDFMultipage(t *testing.T) {
 	buf := &bytes.Buffer{}
 	pdf := New(buf, 210, 297)
@@ -106,3 +1442,425 @@ func TestPDFMultipage(t *testing.T) {
 	nbPages := strings.Count(out, "/Type /Page ")
 	test.That(t, nbPages == 2, "expected 2 pages, got", nbPages)
 }
+
+func TestPDFBuffer(t *testing.T) {
+	pdf := NewBuffer(210, 297)
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	test.Error(t, pdf.Close())
+	b := pdf.Bytes()
+	test.That(t, bytes.HasPrefix(b, []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")), "header with binary comment")
+	test.That(t, bytes.HasSuffix(b, []byte("%%EOF")), "trailer")
+	test.That(t, 0 < pdf.Stats().StreamBytes)
+
+	defer func() {
+		test.That(t, recover() != nil, "must panic when not writing to memory")
+	}()
+	New(&bytes.Buffer{}, 210, 297).Bytes()
+}
+
+func TestPDFVersion(t *testing.T) {
+	pdf := NewBuffer(210, 297)
+	pdf.SetVersion(1, 5)
+	test.Error(t, pdf.Close())
+	test.That(t, bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-1.5\n")), "header")
+	test.That(t, bytes.Contains(pdf.Bytes(), []byte("<< /Type /Catalog /Pages 3 0 R /Version /1.5 >>")), "catalog")
+
+	pdf = NewBuffer(210, 297)
+	pdf.SetVersion(1, 3)
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	test.Error(t, pdf.Close())
+	test.That(t, bytes.HasPrefix(pdf.Bytes(), []byte("%PDF-1.3\n")), "header")
+	test.That(t, !bytes.Contains(pdf.Bytes(), []byte("/Version")), "no version in catalog")
+	test.That(t, !bytes.Contains(pdf.Bytes(), []byte("/Transparency")), "no transparency group")
+
+	pdf = NewBuffer(210, 297)
+	pdf.SetVersion(1, 3)
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.Style{FillColor: color.RGBA{0, 0, 0, 128}}, canvas.Identity)
+	test.That(t, pdf.Close() != nil, "transparency requires PDF 1.4")
+
+	defer func() {
+		test.That(t, recover() != nil, "must panic after writing")
+	}()
+	pdf.SetVersion(1, 4)
+}
+
+func TestPDFStats(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	err := dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular)
+	test.Error(t, err)
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	pdf := New(&bytes.Buffer{}, 210, 297)
+	pdf.RenderText(canvas.NewTextLine(face, "a", canvas.Left), canvas.Identity)
+	pdf.RenderImage(image.NewGray(image.Rect(0, 0, 2, 2)), canvas.Identity)
+	pdf.NewPage(210, 297)
+	pdf.RenderText(canvas.NewTextLine(face, "b", canvas.Left), canvas.Identity)
+	test.Error(t, pdf.Close())
+
+	stats := pdf.Stats()
+	test.T(t, stats.Objects, 11)
+	test.T(t, stats.Pages, 2)
+	test.T(t, stats.Fonts, 1)
+	test.T(t, stats.Images, 1)
+	test.That(t, 0 < stats.StreamBytes)
+}
+
+func TestPDFWriter(t *testing.T) {
+	c := canvas.New(50.0, 20.0)
+	c.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	c.RenderImage(image.NewGray(image.Rect(0, 0, 2, 2)), canvas.Identity)
+
+	buf := &bytes.Buffer{}
+	test.Error(t, Writer(buf, c))
+	s := buf.String()
+	test.That(t, strings.Contains(s, "/MediaBox [0 0 141.73228 56.692913]"), "page size")
+	test.That(t, strings.Contains(s, "/Filter /FlateDecode /Height 2"), "lossless image")
+	test.That(t, strings.HasSuffix(s, "%%EOF"), "closed")
+
+	buf.Reset()
+	test.Error(t, ImageEncodingWriter(canvas.Lossy)(buf, c))
+	s = buf.String()
+	test.That(t, strings.Contains(s, "/Filter /DCTDecode /Height 2"), "lossy image")
+	test.That(t, strings.HasSuffix(s, "%%EOF"), "closed")
+}
+
+func TestPDFImageICCProfile(t *testing.T) {
+	profile := make([]byte, 200)
+	copy(profile[12:], "mntrRGB XYZ ")
+	profile[199] = 0xAB
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(1, 1, color.RGBA{255, 0, 0, 255})
+
+	// PNG with an iCCP chunk after the IHDR chunk
+	var pngBuf bytes.Buffer
+	test.Error(t, png.Encode(&pngBuf, img))
+	var zBuf bytes.Buffer
+	zw := zlib.NewWriter(&zBuf)
+	zw.Write(profile)
+	zw.Close()
+	iccp := append([]byte("iCCP"), append([]byte("Display P3\x00\x00"), zBuf.Bytes()...)...)
+	chunk := make([]byte, 4, 12+len(iccp))
+	binary.BigEndian.PutUint32(chunk, uint32(len(iccp)-4))
+	chunk = append(chunk, iccp...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(iccp))
+	b := pngBuf.Bytes()
+	b = append(append(append([]byte{}, b[:33]...), chunk...), b[33:]...)
+	pngImg, err := canvas.NewPNGImage(bytes.NewReader(b))
+	test.Error(t, err)
+	test.T(t, imageICCProfile(pngImg), profile)
+
+	// JPEG with the profile split over two APP2 segments in reverse order
+	var jpegBuf bytes.Buffer
+	test.Error(t, jpeg.Encode(&jpegBuf, img, nil))
+	app2 := func(seq byte, data []byte) []byte {
+		segment := []byte{0xFF, 0xE2, 0, 0}
+		binary.BigEndian.PutUint16(segment[2:], uint16(2+14+len(data)))
+		segment = append(segment, "ICC_PROFILE\x00"...)
+		return append(append(segment, seq, 2), data...)
+	}
+	b = jpegBuf.Bytes()
+	b = append(append(append(append([]byte{}, b[:2]...), app2(2, profile[100:])...), app2(1, profile[:100])...), b[2:]...)
+	jpegImg, err := canvas.NewJPEGImage(bytes.NewReader(b))
+	test.Error(t, err)
+	test.T(t, imageICCProfile(jpegImg), profile)
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetCompression(false)
+	pdf.SetStreamCompression(ImageStreams, false)
+	pdf.RenderImage(pngImg, canvas.Identity)
+	pdf.RenderImage(jpegImg, canvas.Identity)
+	pdf.RenderImage(ICCImage{img, profile}, canvas.Identity)
+	pdf.RenderImage(img, canvas.Identity)
+	test.Error(t, pdf.Close())
+	s := buf.String()
+
+	m := regexp.MustCompile(`/ColorSpace \[/ICCBased (\d+) 0 R\]`).FindAllStringSubmatch(s, -1)
+	test.T(t, len(m), 3)
+	test.T(t, m[1][1], m[0][1])
+	test.T(t, m[2][1], m[0][1])
+	test.T(t, strings.Count(s, "/ColorSpace /DeviceRGB"), 1)
+	test.That(t, strings.Contains(s, "\n"+m[0][1]+" 0 obj\n<< /Alternate /DeviceRGB /Length 200 /N 3 >> stream\n"), "ICCBased stream")
+
+	// profiles whose color space does not match the image are ignored
+	gray := append([]byte{}, profile...)
+	copy(gray[16:], "GRAY")
+	test.T(t, iccComponents(gray), 1)
+	buf.Reset()
+	pdf = New(buf, 210.0, 297.0)
+	pdf.RenderImage(ICCImage{img, gray}, canvas.Identity)
+	test.Error(t, pdf.Close())
+	test.That(t, !strings.Contains(buf.String(), "/ICCBased"), "mismatched profile")
+}
+
+func TestPDFFlushPage(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210, 297)
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	pdf.FlushPage()
+	test.That(t, pdf.w.Buffer == nil, "page buffer must be freed")
+	test.That(t, strings.Contains(buf.String(), "/Type /Page "), "page must be written")
+	pdf.NewPage(210, 297)
+	pdf.RenderPath(canvas.Rectangle(2.0, 2.0), canvas.DefaultStyle, canvas.Identity)
+	test.Error(t, pdf.Close())
+	out := buf.String()
+
+	test.That(t, strings.Contains(out, "/Type /Pages /Count 2 /Kids [5 0 R 7 0 R]"), out)
+	test.That(t, strings.Index(out, "0 0 m 1 0 l") < strings.Index(out, "0 0 m 2 0 l"), "pages must be in order")
+	test.T(t, strings.Count(out, "/Type /Page "), 2)
+}
+
+func TestPDFFlushPageDrawing(t *testing.T) {
+	dejaVuSerif := canvas.NewFontFamily("dejavu-serif")
+	test.Error(t, dejaVuSerif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular))
+	face := dejaVuSerif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+
+	// drawing on a flushed page panics with a clear message
+	draws := []func(pdf *PDF){
+		func(pdf *PDF) { pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity) },
+		func(pdf *PDF) {
+			style := canvas.DefaultStyle
+			style.FillColor = color.RGBA{0, 0, 0, 128}
+			pdf.RenderPath(canvas.Rectangle(1.0, 1.0), style, canvas.Identity)
+		},
+		func(pdf *PDF) { pdf.RenderText(canvas.NewTextLine(face, "a", canvas.Left), canvas.Identity) },
+		func(pdf *PDF) { pdf.RenderImage(image.NewGray(image.Rect(0, 0, 2, 2)), canvas.Identity) },
+		func(pdf *PDF) { pdf.AddTextAnnotation(canvas.Point{}, "note", canvas.Yellow) },
+	}
+	for _, draw := range draws {
+		pdf := New(&bytes.Buffer{}, 210.0, 297.0)
+		pdf.FlushPage()
+		func() {
+			defer func() {
+				err := recover()
+				test.That(t, err != nil && strings.HasPrefix(fmt.Sprint(err), "page has been flushed"), err)
+			}()
+			draw(pdf)
+		}()
+	}
+}
+
+func TestPDFFlushPageResources(t *testing.T) {
+	serif := canvas.NewFontFamily("serif")
+	test.Error(t, serif.LoadFontFile("../font/DejaVuSerif.ttf", canvas.FontRegular))
+	garamond := canvas.NewFontFamily("garamond")
+	test.Error(t, garamond.LoadFontFile("../font/EBGaramond12-Regular.otf", canvas.FontRegular))
+
+	// each font is used on one page only
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	face := serif.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	pdf.RenderText(canvas.NewTextLine(face, "a", canvas.Left), canvas.Identity)
+	pdf.FlushPage()
+	pdf.NewPage(210.0, 297.0)
+	face = garamond.Face(12.0, canvas.Black, canvas.FontRegular, canvas.FontNormal)
+	pdf.RenderText(canvas.NewTextLine(face, "b", canvas.Left), canvas.Identity)
+	pdf.NewPage(210.0, 297.0)
+	pdf.RenderPath(canvas.Rectangle(1.0, 1.0), canvas.DefaultStyle, canvas.Identity)
+	test.Error(t, pdf.Close())
+	s := buf.String()
+
+	pages := regexp.MustCompile(`(\d+) 0 obj\n<< /Type /Page .*/Resources << (/Font << /F0 (\d+) 0 R >> )?>>`).FindAllStringSubmatch(s, -1)
+	test.T(t, len(pages), 3)
+	for _, page := range pages[:2] {
+		test.That(t, page[3] != "", "font resource")
+		test.That(t, strings.Index(s, "\n"+page[3]+" 0 obj\n") < strings.Index(s, "\n"+page[1]+" 0 obj\n"), "font written before page")
+	}
+	test.That(t, pages[0][3] != pages[1][3], "different fonts")
+	test.T(t, pages[2][2], "")
+}
+
+func TestPDFAlphaMask(t *testing.T) {
+	mask := image.NewAlpha(image.Rect(0, 0, 2, 2))
+	mask.SetAlpha(0, 0, color.Alpha{255})
+	mask.SetAlpha(1, 1, color.Alpha{128})
+
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	pdf.SetCompression(false)
+	pdf.SetStreamCompression(ImageStreams, false)
+	pdf.RenderAlphaMask(mask, canvas.Red, canvas.Identity.Translate(10.0, 20.0))
+	test.Error(t, pdf.Close())
+	s := buf.String()
+
+	test.That(t, strings.Contains(s, "/ColorSpace /DeviceGray"), "gray mask image")
+	test.That(t, strings.Contains(s, "stream\n\xff\x00\x00\x80\nendstream"), "coverage")
+	test.That(t, strings.Contains(s, "/Group << /Type /Group /CS /DeviceGray /S /Transparency >>"), "transparency group")
+	test.That(t, strings.Contains(s, "/SMask << /Type /Mask /G "), "soft mask")
+	test.That(t, strings.Contains(s, "/S /Luminosity"), "luminosity")
+	test.That(t, strings.Contains(s, "/ExtGState << /M0 "), "graphics state resource")
+	test.That(t, strings.Contains(s, " 1 0 0 rg q 2 0 0 2 10 20 cm /M0 gs 0 0 1 1 re f Q"), "content")
+}
+
+func TestPDFLinearized(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	pdf := NewBuffer(210.0, 297.0)
+	pdf.SetLinearized(true)
+	pdf.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.DefaultStyle, canvas.Identity)
+	pdf.NewPage(210.0, 297.0)
+	pdf.RenderImage(img, canvas.Identity)
+	pdf.NewPage(210.0, 297.0)
+	pdf.RenderImage(img, canvas.Identity)
+	test.Error(t, pdf.Close())
+	b := pdf.Bytes()
+
+	// the linearization parameter dictionary is the first object
+	m := regexp.MustCompile(`^%PDF-1\.7\n%[^\n]*\n(\d+) 0 obj\n<< /Linearized 1 /L +(\d+) /H \[ *(\d+) +(\d+)\] /O (\d+) /E +(\d+) /N 3 /T +(\d+) >>`).FindSubmatch(b)
+	test.That(t, m != nil, string(b))
+	test.String(t, string(m[2]), fmt.Sprint(len(b)))
+
+	var hintOffset, firstPage, mainXref int
+	fmt.Sscan(string(m[3]), &hintOffset)
+	fmt.Sscan(string(m[5]), &firstPage)
+	fmt.Sscan(string(m[7]), &mainXref)
+	test.That(t, bytes.HasPrefix(b[hintOffset:], []byte(fmt.Sprintf("%d 0 obj\n<< /Length ", firstPage-1))))
+	test.That(t, bytes.HasPrefix(b[mainXref:], []byte("\n0000000000 65535 f \n")))
+
+	// all objects are found at the offsets in both cross-reference tables
+	offsets := map[int]int{}
+	for _, m := range regexp.MustCompile(`xref\n(\d+) (\d+)\n((?:\d{10} \d{5} [fn] \n)+)`).FindAllSubmatch(b, -1) {
+		var start int
+		fmt.Sscan(string(m[1]), &start)
+		for i, entry := range strings.Split(string(m[3]), "\n") {
+			if strings.HasSuffix(entry, " n ") {
+				var offset int
+				fmt.Sscanf(entry, "%d", &offset)
+				offsets[start+i] = offset
+			}
+		}
+	}
+	test.T(t, len(offsets), len(regexp.MustCompile(`\d+ 0 obj\n`).FindAll(b, -1)))
+	for ref, offset := range offsets {
+		test.That(t, bytes.HasPrefix(b[offset:], []byte(fmt.Sprintf("%d 0 obj\n", ref))), ref)
+	}
+	test.That(t, bytes.HasSuffix(b, []byte(fmt.Sprintf("startxref\n%d\n%%%%EOF", bytes.Index(b, []byte("xref\n"))))))
+}
+
+func TestPDFIncremental(t *testing.T) {
+	pdf := NewBuffer(210.0, 297.0)
+	pdf.SetInfo("Title", "", "", "")
+	pdf.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.DefaultStyle, canvas.Identity)
+	test.Error(t, pdf.Close())
+	original := pdf.Bytes()
+
+	buf := &bytes.Buffer{}
+	pdf, err := NewIncremental(buf, original, 100.0, 100.0)
+	test.Error(t, err)
+	pdf.RenderPath(canvas.Rectangle(10.0, 10.0), canvas.DefaultStyle, canvas.Identity)
+	test.Error(t, pdf.AddSignatureField("signature", canvas.Rect{}, 16))
+	test.Error(t, pdf.Close())
+
+	b := buf.Bytes()
+	test.That(t, bytes.HasPrefix(b, original), "original document unchanged")
+	s := string(b[len(original):])
+	test.That(t, strings.HasPrefix(s, "\n7 0 obj\n"), s)
+	test.That(t, strings.Contains(s, "xref\n1 3\n"), s)
+	test.That(t, strings.Contains(s, fmt.Sprintf("/Prev %d", bytes.LastIndex(original, []byte("\nxref\n"))+1)), s)
+
+	r, trailer, err := newPDFReader(b)
+	test.Error(t, err)
+	test.T(t, trailer["Root"], pdfRef(1))
+	pages, err := r.getDict(pdfRef(3))
+	test.Error(t, err)
+	test.T(t, pages["Count"], 2)
+	test.T(t, len(pages["Kids"].(pdfArray)), 2)
+	info, err := r.getDict(pdfRef(2))
+	test.Error(t, err)
+	test.T(t, info["title"], "Title")
+	test.That(t, info["ModDate"] != nil, "modification date")
+	for ref, offset := range r.offsets {
+		if offset != -1 {
+			_, err := r.getObject(ref)
+			test.Error(t, err)
+		}
+	}
+
+	var a, c, d int
+	i := bytes.Index(b, []byte("/ByteRange ["))
+	_, err = fmt.Sscanf(string(b[i:]), "/ByteRange [%d %d %d %d]", &a, &a, &c, &d)
+	test.Error(t, err)
+	test.T(t, c+d, len(b))
+}
+
+func TestPDFIncrementalCarriageReturn(t *testing.T) {
+	title := "\xFE\xFF\x01\x0D" // č in UTF-16BE
+	id := pdfArray{"\r\n\x00\r", "\r"}
+
+	pdf := NewBuffer(210.0, 297.0)
+	pdf.SetInfo(title, "", "", "")
+	test.Error(t, pdf.Close())
+	original := pdf.Bytes()
+	test.That(t, !bytes.Contains(original, []byte("\r")), "no raw carriage returns")
+	i := bytes.LastIndex(original, []byte("trailer\n<< "))
+	original = append(original[:i+len("trailer\n<< ")], append([]byte("/ID [<0D0A000D> <0D>] "), original[i+len("trailer\n<< "):]...)...)
+
+	buf := &bytes.Buffer{}
+	pdf, err := NewIncremental(buf, original, 100.0, 100.0)
+	test.Error(t, err)
+	test.Error(t, pdf.Close())
+
+	r, trailer, err := newPDFReader(buf.Bytes())
+	test.Error(t, err)
+	test.T(t, trailer["ID"], id)
+	info, err := r.getDict(trailer["Info"].(pdfRef))
+	test.Error(t, err)
+	test.T(t, info["title"], title)
+}
+
+func TestBuiltinEncoding(t *testing.T) {
+	var tts = []struct {
+		enc *builtinEncoding
+		s   string
+		b   []byte
+		ok  bool
+	}{
+		{zapfDingbatsEncoding, "✓✔✂", []byte{0x33, 0x34, 0x22}, true},
+		{zapfDingbatsEncoding, "•●■★☎", []byte{0x6C, 0x6C, 0x6E, 0x48, 0x25}, true},
+		{zapfDingbatsEncoding, "①❶➔→♠", []byte{0xAC, 0xB6, 0xD4, 0xD5, 0xAB}, true},
+		{zapfDingbatsEncoding, "a", nil, false},
+		{symbolEncoding, "αβΩ\u2126≤", []byte{0x61, 0x62, 0x57, 0x57, 0xA3}, true},
+		{symbolEncoding, "1+1≠3 ∴", []byte{0x31, 0x2B, 0x31, 0xB9, 0x33, 0x20, 0x5C}, true},
+		{symbolEncoding, "a", nil, false},
+	}
+	for _, tt := range tts {
+		t.Run(tt.s, func(t *testing.T) {
+			b, err := tt.enc.Encode(tt.s)
+			test.T(t, err == nil, tt.ok)
+			test.T(t, b, tt.b)
+		})
+	}
+}
+
+func TestPDFStandardText(t *testing.T) {
+	buf := &bytes.Buffer{}
+	pdf := New(buf, 210.0, 297.0)
+	test.Error(t, pdf.RenderStandardText(ZapfDingbatsFont, 10.0, "✓ ✂", canvas.Black, canvas.Identity.Translate(10.0, 10.0)))
+	test.Error(t, pdf.RenderStandardText(SymbolFont, 10.0, "α(β)", canvas.Black, canvas.Identity))
+	test.Error(t, pdf.RenderStandardText(ZapfDingbatsFont, 10.0, "•", canvas.Black, canvas.Identity))
+	test.String(t, pdf.w.String(), " 2.8346457 0 0 2.8346457 0 0 cm BT /F0 10 Tf 10 10 Td (3 \x22) Tj ET BT /F1 10 Tf (a\\(b\\)) Tj ET BT /F0 10 Tf (l) Tj ET")
+	test.That(t, pdf.RenderStandardText(SymbolFont, 10.0, "a", canvas.Black, canvas.Identity) != nil, "missing glyph")
+	test.T(t, pdf.Stats().Fonts, 2)
+
+	test.Error(t, pdf.Close())
+	test.That(t, strings.Contains(buf.String(), "<< /Type /Font /Subtype /Type1 /BaseFont /ZapfDingbats >>"), "ZapfDingbats font")
+	test.That(t, strings.Contains(buf.String(), "<< /Type /Font /Subtype /Type1 /BaseFont /Symbol >>"), "Symbol font")
+}
+
+func TestPDFObjectTracer(t *testing.T) {
+	types := map[string]int{}
+	size := 0
+	pdf := NewBuffer(210.0, 297.0)
+	pdf.SetObjectTracer(func(ref int, typ string, n int) {
+		types[typ]++
+		size += n
+	})
+	pdf.RenderImage(image.NewRGBA(image.Rect(0, 0, 2, 2)), canvas.Identity)
+	test.Error(t, pdf.Close())
+
+	test.T(t, types, map[string]int{"": 2, "Catalog": 1, "Page": 1, "Pages": 1, "XObject/Image": 2})
+	b := pdf.Bytes()
+	start := bytes.LastIndexByte(b[:bytes.Index(b, []byte(" 0 obj\n"))], '\n') + 1
+	test.T(t, size, bytes.Index(b, []byte("\nxref\n"))+1-start) // all objects lie between the header and the cross-reference table
+}
@@ -0,0 +1,80 @@
+package pdf
+
+import (
+	"hash/crc32"
+	"sort"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+)
+
+// pdfFontSubset holds the glyphs of a TrueType font that are used in the document, which is embedded as a subset where the CID and the glyph ID of the subset are the index into glyphIDs. It is written when the document is closed.
+type pdfFontSubset struct {
+	ref      pdfRef
+	glyphIDs []uint16          // original glyph IDs by CID
+	cids     map[uint16]uint16 // CIDs by original glyph ID
+}
+
+// getCIDs returns the CIDs for the glyph IDs of the font, which are the glyph IDs themselves unless the font is subset. Glyphs of subset fonts are assigned CIDs in order of first use, so that the CIDs are stable while writing pages.
+func (w *pdfWriter) getCIDs(font *canvas.Font, glyphIDs []uint16) []uint16 {
+	subset, ok := w.fontSubsets[font]
+	if !ok {
+		return glyphIDs
+	}
+
+	cids := make([]uint16, len(glyphIDs))
+	for i, glyphID := range glyphIDs {
+		cid, ok := subset.cids[glyphID]
+		if !ok {
+			cid = uint16(len(subset.glyphIDs))
+			subset.glyphIDs = append(subset.glyphIDs, glyphID)
+			subset.cids[glyphID] = cid
+		}
+		cids[i] = cid
+	}
+	return cids
+}
+
+func (w *pdfWriter) writeFontSubsets() error {
+	fonts := make([]*canvas.Font, 0, len(w.fontSubsets))
+	for font := range w.fontSubsets {
+		fonts = append(fonts, font)
+	}
+	sort.Slice(fonts, func(i, j int) bool { return w.fontSubsets[fonts[i]].ref < w.fontSubsets[fonts[j]].ref })
+
+	for _, font := range fonts {
+		subset := w.fontSubsets[font]
+		b, _, err := w.getSFNT(font).Subset(subset.glyphIDs)
+		if err != nil {
+			return err
+		}
+
+		fontWidths := w.getGlyphWidths(font)
+		widths := make([]int, len(subset.glyphIDs))
+		for cid, glyphID := range subset.glyphIDs {
+			if int(glyphID) < len(fontWidths) {
+				widths[cid] = fontWidths[glyphID]
+			}
+		}
+
+		baseFont := subsetTag(subset.glyphIDs) + "+" + strings.ReplaceAll(font.Name(), " ", "_")
+		w.writeReservedObject(subset.ref, w.fontDict(font, baseFont, "font/truetype", b, widths))
+	}
+	return nil
+}
+
+// subsetTag returns the six uppercase letters that prefix the name of a subset font, which are derived from the glyphs in the subset so that different subsets of the same font have different names.
+func subsetTag(glyphIDs []uint16) string {
+	h := crc32.NewIEEE()
+	for _, glyphID := range glyphIDs {
+		h.Write([]byte{byte(glyphID >> 8), byte(glyphID)})
+	}
+	sum := h.Sum32()
+
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(sum%26)
+		sum /= 26
+	}
+	return string(tag)
+}
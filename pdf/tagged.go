@@ -0,0 +1,89 @@
+package pdf
+
+import (
+	"fmt"
+)
+
+// pdfStructElem is the structure element of a marked-content sequence, with its optional alternate text.
+type pdfStructElem struct {
+	tag pdfName
+	alt string
+}
+
+// BeginMarkedContent starts a marked-content sequence with the given structure type, such as P or Figure, and adds it to the structure tree.
+func (w *pdfPageWriter) BeginMarkedContent(tag pdfName) {
+	w.beginStructElem(pdfStructElem{tag: tag})
+}
+
+// BeginFigure starts a marked-content sequence for a Figure structure element with alternate text, which is announced by screen readers instead of the figure.
+func (w *pdfPageWriter) BeginFigure(alt string) {
+	w.beginStructElem(pdfStructElem{tag: "Figure", alt: alt})
+}
+
+func (w *pdfPageWriter) beginStructElem(elem pdfStructElem) {
+	if w.inMarkedContent {
+		panic("already in marked content")
+	}
+	fmt.Fprintf(w, " /%v <</MCID %d>> BDC", elem.tag, len(w.structElems))
+	w.structElems = append(w.structElems, elem)
+	w.inMarkedContent = true
+}
+
+// BeginArtifact starts a marked-content sequence for content that is not part of the logical structure, such as decorative paths.
+func (w *pdfPageWriter) BeginArtifact() {
+	if w.inMarkedContent {
+		panic("already in marked content")
+	}
+	fmt.Fprintf(w, " /Artifact BMC")
+	w.inMarkedContent = true
+}
+
+func (w *pdfPageWriter) EndMarkedContent() {
+	if !w.inMarkedContent {
+		panic("must be in marked content")
+	}
+	fmt.Fprintf(w, " EMC")
+	w.inMarkedContent = false
+}
+
+// writeStructTree writes the structure tree with a structure element for each marked-content sequence, which are children of a single document element. The parent tree maps the marked-content IDs of each page back to their structure elements.
+func (w *pdfWriter) writeStructTree(pages pdfArray) pdfRef {
+	root := w.reserveObject()
+	doc := w.reserveObject()
+
+	kids := pdfArray{}
+	nums := pdfArray{}
+	for i, page := range w.pages {
+		elems := pdfArray{}
+		for mcid, elem := range page.structElems {
+			dict := pdfDict{
+				"Type": pdfName("StructElem"),
+				"S":    elem.tag,
+				"P":    doc,
+				"Pg":   pages[i],
+				"K":    mcid,
+			}
+			if elem.alt != "" {
+				dict["Alt"] = pdfTextString(elem.alt)
+			}
+			ref := w.writeObject(dict)
+			elems = append(elems, ref)
+			kids = append(kids, ref)
+		}
+		nums = append(nums, page.structParents, elems)
+	}
+
+	w.writeReservedObject(doc, pdfDict{
+		"Type": pdfName("StructElem"),
+		"S":    pdfName("Document"),
+		"P":    root,
+		"K":    kids,
+	})
+	w.writeReservedObject(root, pdfDict{
+		"Type":              pdfName("StructTreeRoot"),
+		"K":                 doc,
+		"ParentTree":        pdfDict{"Nums": nums},
+		"ParentTreeNextKey": len(w.pages),
+	})
+	return root
+}
@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+
+	"github.com/tdewolff/canvas"
+)
+
+// pdfToUnicode is the ToUnicode CMap of a font, which maps glyph IDs back to text for text extraction and is written when the document is closed.
+type pdfToUnicode struct {
+	ref   pdfRef
+	runes map[uint16]rune
+}
+
+// getToUnicode returns the reserved reference of the ToUnicode CMap of the font.
+func (w *pdfWriter) getToUnicode(font *canvas.Font) pdfRef {
+	toUnicode, ok := w.toUnicode[font]
+	if !ok {
+		toUnicode = &pdfToUnicode{
+			ref:   w.reserveObject(),
+			runes: map[uint16]rune{},
+		}
+		w.toUnicode[font] = toUnicode
+	}
+	return toUnicode.ref
+}
+
+// addToUnicode records the runes that the glyphs represent, where the first rune is kept for glyphs that represent multiple runes.
+func (w *pdfWriter) addToUnicode(font *canvas.Font, glyphIDs []uint16, rs []rune) {
+	toUnicode, ok := w.toUnicode[font]
+	if !ok {
+		return
+	}
+	for i, glyphID := range glyphIDs {
+		if _, ok := toUnicode.runes[glyphID]; !ok && glyphID != 0 && i < len(rs) {
+			toUnicode.runes[glyphID] = rs[i]
+		}
+	}
+}
+
+func (w *pdfWriter) writeToUnicodes() {
+	toUnicodes := make([]*pdfToUnicode, 0, len(w.toUnicode))
+	for _, toUnicode := range w.toUnicode {
+		toUnicodes = append(toUnicodes, toUnicode)
+	}
+	sort.Slice(toUnicodes, func(i, j int) bool { return toUnicodes[i].ref < toUnicodes[j].ref })
+
+	for _, toUnicode := range toUnicodes {
+		w.writeReservedObject(toUnicode.ref, w.flate(FontStreams, pdfStream{
+			dict:   pdfDict{},
+			stream: toUnicodeCMap(toUnicode.runes),
+		}))
+	}
+}
+
+// toUnicodeCMap returns a CMap that maps two-byte glyph IDs to UTF-16BE, where runes outside the Basic Multilingual Plane are written as surrogate pairs.
+func toUnicodeCMap(runes map[uint16]rune) []byte {
+	glyphIDs := make([]uint16, 0, len(runes))
+	for glyphID := range runes {
+		glyphIDs = append(glyphIDs, glyphID)
+	}
+	sort.Slice(glyphIDs, func(i, j int) bool { return glyphIDs[i] < glyphIDs[j] })
+
+	b := &bytes.Buffer{}
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo <</Registry (Adobe) /Ordering (UCS) /Supplement 0>> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i := 0; i < len(glyphIDs); i += 100 {
+		// at most 100 entries per block
+		n := len(glyphIDs) - i
+		if 100 < n {
+			n = 100
+		}
+		fmt.Fprintf(b, "%d beginbfchar\n", n)
+		for _, glyphID := range glyphIDs[i : i+n] {
+			fmt.Fprintf(b, "<%04X> <", glyphID)
+			if r := runes[glyphID]; 0xFFFF < r {
+				r1, r2 := utf16.EncodeRune(r)
+				fmt.Fprintf(b, "%04X%04X", r1, r2)
+			} else {
+				fmt.Fprintf(b, "%04X", r)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.Bytes()
+}
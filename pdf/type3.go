@@ -0,0 +1,147 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/tdewolff/canvas"
+)
+
+// Type3Layer is a filled path of a Type3 glyph in glyph space units. If the color is transparent, the layer is filled with the current fill color.
+type Type3Layer struct {
+	Path  *canvas.Path
+	Color color.RGBA
+}
+
+type type3Glyph struct {
+	advance float64
+	layers  []Type3Layer
+}
+
+// Type3Font is a font where each glyph is defined by filled paths, such as symbol sets or color glyphs. Glyphs are identified by their character code, which are assigned in order of addition. A Type3 font holds at most 256 glyphs.
+type Type3Font struct {
+	unitsPerEm float64
+	glyphs     []type3Glyph
+}
+
+// NewType3Font returns a new Type3 font where glyph space units are scaled by the given units per em.
+func NewType3Font(unitsPerEm float64) *Type3Font {
+	return &Type3Font{
+		unitsPerEm: unitsPerEm,
+	}
+}
+
+// AddGlyph adds a glyph with the given advance and layers in glyph space units and returns its character code. Glyphs are colored if any layer has a non-transparent color, in which case all transparent layers are filled black, otherwise they are filled with the current fill color.
+func (f *Type3Font) AddGlyph(advance float64, layers ...Type3Layer) byte {
+	if 256 <= len(f.glyphs) {
+		panic("Type3 font can hold at most 256 glyphs")
+	}
+	f.glyphs = append(f.glyphs, type3Glyph{advance, layers})
+	return byte(len(f.glyphs) - 1)
+}
+
+// RenderType3Text renders a string of character codes of a Type3 font with the given font size in millimeters, with the text origin transformed by m. The text is filled with the given color for uncolored glyphs.
+func (r *PDF) RenderType3Text(font *Type3Font, size float64, codes []byte, col color.RGBA, m canvas.Matrix) {
+	r.w.StartTextObject()
+	r.w.SetFillColor(col)
+	r.w.SetType3Font(font, size)
+	r.w.SetTextPosition(m)
+	r.w.SetTextRenderMode(r.w.textMode(col, 0))
+	fmt.Fprintf(r.w, " (%s) Tj", escapeString(codes))
+	r.w.EndTextObject()
+}
+
+// SetType3Font sets the Type3 font for the text object, which is written when the document is closed so that glyphs may be added after its first use.
+func (w *pdfPageWriter) SetType3Font(font *Type3Font, size float64) {
+	if !w.inTextObject {
+		panic("must be in text object")
+	}
+
+	ref, ok := w.pdf.type3Fonts[font]
+	if !ok {
+		ref = w.pdf.reserveObject()
+		w.pdf.type3Fonts[font] = ref
+	}
+	if _, ok := w.resources["Font"]; !ok {
+		w.resources["Font"] = pdfDict{}
+	}
+	w.font = nil // Type0 font must be set again after this
+	for name, fontRef := range w.resources["Font"].(pdfDict) {
+		if ref == fontRef {
+			fmt.Fprintf(w, " /%v %v Tf", name, dec(size))
+			return
+		}
+	}
+	name := pdfName(fmt.Sprintf("F%d", len(w.resources["Font"].(pdfDict))))
+	w.resources["Font"].(pdfDict)[name] = ref
+	fmt.Fprintf(w, " /%v %v Tf", name, dec(size))
+}
+
+func (w *pdfWriter) writeType3Font(font *Type3Font, ref pdfRef) {
+	bounds := canvas.Rect{}
+	charProcs := pdfDict{}
+	differences := pdfArray{0}
+	widths := pdfArray{}
+	for i, glyph := range font.glyphs {
+		colored := false
+		glyphBounds := canvas.Rect{}
+		for _, layer := range glyph.layers {
+			colored = colored || layer.Color.A != 0
+			glyphBounds = glyphBounds.Add(layer.Path.Bounds())
+		}
+		bounds = bounds.Add(glyphBounds)
+
+		b := &bytes.Buffer{}
+		if colored {
+			fmt.Fprintf(b, "%v 0 d0", dec(glyph.advance))
+		} else {
+			fmt.Fprintf(b, "%v 0 %v %v %v %v d1", dec(glyph.advance), dec(glyphBounds.X), dec(glyphBounds.Y), dec(glyphBounds.X+glyphBounds.W), dec(glyphBounds.Y+glyphBounds.H))
+		}
+		for _, layer := range glyph.layers {
+			if colored {
+				c := opaqueColor(layer.Color)
+				fmt.Fprintf(b, " %v %v %v rg", dec(c[0].(float64)), dec(c[1].(float64)), dec(c[2].(float64)))
+			}
+			fmt.Fprintf(b, " %v f", layer.Path.ToPDF())
+		}
+
+		name := pdfName(fmt.Sprintf("g%d", i))
+		charProcs[name] = w.writeObject(w.flate(ContentStreams, pdfStream{
+			dict:   pdfDict{},
+			stream: b.Bytes(),
+		}))
+		differences = append(differences, name)
+		widths = append(widths, glyph.advance)
+	}
+
+	f := 1.0 / font.unitsPerEm
+	w.writeReservedObject(ref, pdfDict{
+		"Type":       pdfName("Font"),
+		"Subtype":    pdfName("Type3"),
+		"FontBBox":   pdfArray{math.Floor(bounds.X), math.Floor(bounds.Y), math.Ceil(bounds.X + bounds.W), math.Ceil(bounds.Y + bounds.H)},
+		"FontMatrix": pdfArray{f, 0, 0, f, 0, 0},
+		"CharProcs":  charProcs,
+		"Encoding": pdfDict{
+			"Type":        pdfName("Encoding"),
+			"Differences": differences,
+		},
+		"FirstChar": 0,
+		"LastChar":  len(font.glyphs) - 1,
+		"Widths":    widths,
+		"Resources": pdfDict{},
+	})
+}
+
+// escapeString escapes a byte string for use in a PDF literal string.
+func escapeString(b []byte) string {
+	s := &bytes.Buffer{}
+	for _, c := range b {
+		if c == '\\' || c == '(' || c == ')' {
+			s.WriteByte('\\')
+		}
+		s.WriteByte(c)
+	}
+	return s.String()
+}
@@ -25,6 +25,17 @@ func float64sEqual(a, b []float64) bool {
 	return true
 }
 
+// pt formats page geometry in points with ptPrecision decimals and significant digits.
+type pt float64
+
+const ptPrecision = 8
+
+func (f pt) String() string {
+	s := fmt.Sprintf("%.*f", ptPrecision, f)
+	return string(minify.Decimal([]byte(s), ptPrecision))
+}
+
+// dec formats a number with canvas.Precision decimals and significant digits.
 type dec float64
 
 func (f dec) String() string {
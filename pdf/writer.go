@@ -6,9 +6,17 @@ import (
 	"github.com/tdewolff/canvas"
 )
 
-// Writer writes the canvas as a PDF file.
+// Writer writes the canvas as a PDF file with a single page of the canvas size, and returns the error of closing the document. It can be passed to Canvas.WriteFile. Images are embedded losslessly, which is the default image encoding of the renderers, use ImageEncodingWriter for lossy images.
 func Writer(w io.Writer, c *canvas.Canvas) error {
-	pdf := New(w, c.W, c.H)
-	c.Render(pdf)
-	return pdf.Close()
+	return ImageEncodingWriter(canvas.Lossless)(w, c)
+}
+
+// ImageEncodingWriter returns a writer like Writer that embeds images with the given image encoding, see PDF.SetImageEncoding.
+func ImageEncodingWriter(enc canvas.ImageEncoding) canvas.Writer {
+	return func(w io.Writer, c *canvas.Canvas) error {
+		pdf := New(w, c.W, c.H)
+		pdf.SetImageEncoding(enc)
+		c.Render(pdf)
+		return pdf.Close()
+	}
 }
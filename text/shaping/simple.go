@@ -27,15 +27,26 @@ func (f Font) Destroy() {
 
 func (f Font) Shape(text string, size float64, direction Direction, script Script) []Glyph {
 	rs := []rune(text)
-	glyphs := make([]Glyph, len(rs))
-	var prevIndex uint16
+	indices := make([]uint16, len(rs))
 	for i, r := range rs {
-		index := f.sfnt.GlyphIndex(r)
-		fmt.Printf("%X %s => %d\n", r, string(r), index)
+		indices[i] = f.sfnt.GlyphIndex(r)
+		fmt.Printf("%X %s => %d\n", r, string(r), indices[i])
+	}
+	indices = f.sfnt.ApplyMorx(indices)
+
+	glyphs := make([]Glyph, len(indices))
+	var prevIndex uint16
+	for i, index := range indices {
 		glyphs[i].ID = index
 		glyphs[i].XAdvance = int32(f.sfnt.GlyphAdvance(index))
 		if 0 < i {
-			glyphs[i-1].XAdvance += int32(f.sfnt.Kerning(prevIndex, index))
+			if dx, dy, ok := f.sfnt.MarkToMark(prevIndex, index); ok {
+				// stack the mark on the previous mark, relative to the pen position after the previous mark
+				glyphs[i].XOffset = glyphs[i-1].XOffset - glyphs[i-1].XAdvance + int32(dx)
+				glyphs[i].YOffset = glyphs[i-1].YOffset + int32(dy)
+			} else {
+				glyphs[i-1].XAdvance += int32(f.sfnt.Kerning(prevIndex, index))
+			}
 		}
 		prevIndex = index
 	}
@@ -0,0 +1,23 @@
+// +build !harfbuzz
+
+package shaping
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/tdewolff/test"
+)
+
+func TestShapeMarkToMark(t *testing.T) {
+	b, err := ioutil.ReadFile("../../font/DejaVuSerif.ttf")
+	test.Error(t, err)
+	font, err := NewFont(b, 0)
+	test.Error(t, err)
+
+	// the acute is stacked on the circumflex, at the pen position after the base letter
+	glyphs := font.Shape("e\u0302\u0301", 12.0, LeftToRight, Latin)
+	test.T(t, len(glyphs), 3)
+	test.T(t, glyphs[2].XOffset, glyphs[1].XOffset-glyphs[1].XAdvance)
+	test.T(t, glyphs[2].YOffset, glyphs[1].YOffset+458)
+}
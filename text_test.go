@@ -173,7 +173,7 @@ func TestTextBounds(t *testing.T) {
 
 	bounds = text.OutlineBounds()
 	test.Float(t, bounds.X, 0.0)
-	test.Float(t, bounds.Y, -13.390625)
+	test.Float(t, bounds.Y, -12.4296875)
 	test.Float(t, bounds.W, face8.TextWidth("test")+face12.TextWidth("test"))
-	test.Float(t, bounds.H, 10.40625)
+	test.Float(t, bounds.H, 9.4453125)
 }